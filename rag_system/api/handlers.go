@@ -1,42 +1,116 @@
 package api
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"math"
+	"mime/multipart"
 	"net/http"
+	"path/filepath"
+	"rag_system/config"
 	"rag_system/core"
+	"rag_system/embedcache"
+	"rag_system/extract"
+	"rag_system/hnsw"
 	"rag_system/models"
+	"rag_system/provider"
+	"rag_system/tokenizer"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-var vectorDB *core.VectorDB
+var vectorDB core.VectorStore
 var ragService *core.RAGService
+var embeddingCache *embedcache.Cache // nil when disabled
+var maxUploadSize int64              // Largest file accepted by UploadDocumentsHandler, in bytes
 
-func InitializeServices(dbPath string) error {
+func InitializeServices(cfg config.Config) error {
 	var err error
 
 	// Initialize vector database
-	vectorDB, err = core.NewVectorDB(dbPath)
+	vectorDB, err = core.NewVectorStore(cfg.VectorStore, cfg.VectorDBPath, cfg.HNSW)
 	if err != nil {
 		return fmt.Errorf("failed to initialize vector database: %w", err)
 	}
 
+	// Initialize the embedding cache
+	if !cfg.EmbeddingCache.Disabled {
+		cachePath := cfg.EmbeddingCache.Path
+		if cachePath == "" {
+			cachePath = filepath.Join(cfg.VectorDBPath, embedcache.FileName)
+		}
+		embeddingCache, err = embedcache.Open(cachePath, cfg.EmbeddingCache)
+		if err != nil {
+			return fmt.Errorf("failed to open embedding cache: %w", err)
+		}
+		stats := embeddingCache.Stats()
+		log.Printf("Embedding cache: %d entries loaded from %s", stats.Entries, stats.Path)
+	}
+
+	tok, err := tokenizer.New(cfg.Tokenizer)
+	if err != nil {
+		return fmt.Errorf("failed to load tokenizer: %w", err)
+	}
+	log.Printf("Tokenizer: %s", tok.Name())
+
 	// Initialize services
-	embeddingService := core.NewEnbeddingService()
-	llmService := core.NewLLMService()
-	ragService = core.NewRAGService(vectorDB, embeddingService, llmService)
+	embeddingService, err := core.NewEnbeddingService(cfg.ProviderConfigs(), cfg.EmbeddingProvider, embeddingCache, tok)
+	if err != nil {
+		return fmt.Errorf("failed to initialize embedding providers: %w", err)
+	}
+	llmService, err := core.NewLLMService(cfg.ProviderConfigs(), cfg.LLMProvider)
+	if err != nil {
+		return fmt.Errorf("failed to initialize llm providers: %w", err)
+	}
+	profiles, err := core.OpenDocTypeProfiles(cfg.VectorDBPath, cfg.DocTypeProfiles)
+	if err != nil {
+		return fmt.Errorf("failed to load doc type profiles: %w", err)
+	}
+	ragService = core.NewRAGService(vectorDB, embeddingService, llmService, tok, cfg.MaxContextTokens, profiles)
+	maxUploadSize = int64(cfg.MaxUploadMB) << 20
 
 	log.Println("Services initialized successfully")
 	return nil
 }
 
+// providerError answers for a failed call to a model provider: 503 while it
+// is rate limiting, failing or cut off by its circuit breaker, passing on how
+// long to wait when known, and 502 when it rejects the configured
+// credentials. It reports whether err was such a failure.
+func providerError(c *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, provider.ErrRateLimited), errors.Is(err, provider.ErrServer), errors.Is(err, provider.ErrUnavailable):
+		if wait, ok := provider.RetryAfter(err); ok {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		}
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+	case errors.Is(err, provider.ErrAuth):
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+	default:
+		return false
+	}
+	log.Printf("Model provider error: %v", err)
+	return true
+}
+
+// resolveCollection maps an alias in a request to the collection it points to.
+func resolveCollection(name string) string {
+	return vectorDB.ResolveCollection(name)
+}
+
 func CreateCollectionHandler(c *gin.Context) {
 	var req struct {
 		Name        string `json:"name" binding:"required"`
 		Description string `json:"description"`
+		Dimension   int    `json:"dimension"`
+		models.EmbeddingSelection
+		models.LLMSelection
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -44,20 +118,122 @@ func CreateCollectionHandler(c *gin.Context) {
 		return
 	}
 
-	err := vectorDB.CreateCollection(req.Name, req.Description)
+	schema := models.CollectionSchema{EmbeddingSelection: req.EmbeddingSelection, Dimension: req.Dimension}
+	info, err := ragService.CreateCollection(req.Name, req.Description, schema, req.LLMSelection)
 	if err != nil {
+		if errors.Is(err, core.ErrSchemaMismatch) || errors.Is(err, core.ErrUnknownProvider) || errors.Is(err, core.ErrUnknownEmbeddingProvider) || errors.Is(err, core.ErrReservedName) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, core.ErrAliasConflict) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if providerError(c, err) {
+			return
+		}
 		log.Printf("Error creating collection: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create collection"})
 		return
 	}
 
 	c.JSON(http.StatusCreated, gin.H{
-		"message":     "Collection created successfully",
-		"name":        req.Name,
-		"description": req.Description,
+		"message":            "Collection created successfully",
+		"name":               info.Name,
+		"description":        info.Description,
+		"embedding_provider": info.EmbeddingProvider,
+		"embedding_model":    info.EmbeddingModel,
+		"dimension":          info.Dimension,
+		"distance":           info.Distance,
+		"llm_provider":       info.LLMProvider,
+		"chat_model":         info.ChatModel,
+	})
+}
+
+// SetCollectionLLMHandler sets the provider and chat model that answer
+// queries on a collection
+func SetCollectionLLMHandler(c *gin.Context) {
+	collectionName := resolveCollection(c.Param("name"))
+
+	var req models.LLMSelection
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	info, err := ragService.SetCollectionLLM(collectionName, req)
+	if err != nil {
+		if errors.Is(err, core.ErrUnknownProvider) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":         "Collection LLM updated successfully",
+		"collection_name": info.Name,
+		"llm_provider":    info.LLMProvider,
+		"chat_model":      info.ChatModel,
 	})
 }
 
+// ReembedCollectionHandler starts re-embedding every chunk of a collection
+// with a new embedding provider or model. The job runs in the background; its
+// progress is reported by GetReembedStatusHandler.
+func ReembedCollectionHandler(c *gin.Context) {
+	collectionName := resolveCollection(c.Param("name"))
+
+	var req models.EmbeddingSelection
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req == (models.EmbeddingSelection{}) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "embedding_provider or embedding_model is required"})
+		return
+	}
+
+	if c.Query("confirm") != "true" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "This operation will rebuild the collection with new embeddings",
+			"message": "To confirm, add '?confirm=true' to the request",
+		})
+		return
+	}
+
+	job, err := ragService.StartReembed(collectionName, req)
+	if err != nil {
+		if errors.Is(err, core.ErrReembedInProgress) || errors.Is(err, core.ErrWritesInProgress) || errors.Is(err, core.ErrReservedName) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, core.ErrUnknownEmbeddingProvider) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("Error starting re-embed of collection %s: %v", collectionName, err)
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, job)
+}
+
+// GetReembedStatusHandler reports the latest re-embed job of a collection.
+func GetReembedStatusHandler(c *gin.Context) {
+	collectionName := resolveCollection(c.Param("name"))
+
+	job, ok := ragService.ReembedJob(collectionName)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("no re-embed job for collection '%s'", collectionName)})
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
 func AddDocumentHandler(c *gin.Context) {
 	var req models.AddDocumentRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -65,33 +241,32 @@ func AddDocumentHandler(c *gin.Context) {
 		return
 	}
 
-	// Set default chunking strategy if none provided
 	if req.ChunkingConfig == nil {
-		req.ChunkingConfig = &models.ChunkingConfig{
-			Strategy:           models.StructuralStrategy,
-			FixedSize:          500,
-			Overlap:            50,
-			MinChunkSize:       100,
-			MaxChunkSize:       2000,
-			PreserveParagraphs: true,
-			ExtractKeywords:    true,
-		}
+		req.ChunkingConfig = defaultChunkingConfig(req.DocType)
 	}
+	req.CollectionName = resolveCollection(req.CollectionName)
 
-	// Document type is stored for metadata but doesn't affect chunking strategy
-	// All documents use the configured or default strategy
-
-	err := ragService.AddDocument(req.CollectionName, &req)
+	doc, err := ragService.AddDocument(req.CollectionName, &req)
 	if err != nil {
-		log.Printf("Error adding document to collection %s: %v", req.CollectionName, err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add document"})
+		if providerError(c, err) {
+			return
+		}
+		status := addDocumentErrorStatus(err)
+		if status == http.StatusInternalServerError {
+			log.Printf("Error adding document to collection %s: %v", req.CollectionName, err)
+			c.JSON(status, gin.H{"error": "Failed to add document"})
+			return
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
 		return
 	}
 
 	response := gin.H{
 		"message":           "Document added successfully",
+		"document_id":       doc.ID,
 		"collection_name":   req.CollectionName,
-		"chunking_strategy": string(req.ChunkingConfig.Strategy),
+		"chunking_strategy": doc.Metadata["chunking_strategy"],
+		"chunk_count":       len(doc.Chunks),
 	}
 
 	if req.Source != "" {
@@ -104,6 +279,181 @@ func AddDocumentHandler(c *gin.Context) {
 	c.JSON(http.StatusCreated, response)
 }
 
+// defaultChunkingConfig returns the chunk sizes of documents added without a
+// chunking config, or nil when the doc type has a profile to take them from.
+// The strategy is picked for the document.
+func defaultChunkingConfig(docType string) *models.ChunkingConfig {
+	if ragService.DocTypeProfiles().Get(docType) != nil {
+		return nil
+	}
+	return &models.ChunkingConfig{
+		FixedSize:          500,
+		Overlap:            50,
+		MinChunkSize:       100,
+		MaxChunkSize:       2000,
+		PreserveParagraphs: true,
+		ExtractKeywords:    true,
+	}
+}
+
+// addDocumentErrorStatus maps an error adding a document to an HTTP status,
+// with model provider failures mapped as providerError answers them.
+func addDocumentErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, provider.ErrRateLimited), errors.Is(err, provider.ErrServer), errors.Is(err, provider.ErrUnavailable):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, provider.ErrAuth):
+		return http.StatusBadGateway
+	case errors.Is(err, core.ErrSchemaMismatch), errors.Is(err, core.ErrReembedInProgress):
+		return http.StatusConflict
+	case errors.Is(err, core.ErrInvalidChunkingConfig), errors.Is(err, core.ErrReservedName):
+		return http.StatusBadRequest
+	case errors.Is(err, extract.ErrUnsupportedFormat):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, extract.ErrNoText), errors.Is(err, extract.ErrMalformed):
+		return http.StatusUnprocessableEntity
+	}
+	return http.StatusInternalServerError
+}
+
+// UploadDocumentsHandler adds the files of a multipart/form-data request,
+// sent in "files" (or "file"), to collection_name. Each file's format is
+// detected from its content and name and its text extracted accordingly.
+// Files are added one by one, and each gets its own result, so one that
+// fails does not stop the others. The doc_type, chunking_config (JSON) and
+// metadata (JSON) form fields apply to every file.
+func UploadDocumentsHandler(c *gin.Context) {
+	form, err := c.MultipartForm()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("expected a multipart/form-data request: %v", err)})
+		return
+	}
+	formValue := func(key string) string {
+		if values := form.Value[key]; len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+
+	if formValue("collection_name") == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "collection_name is required"})
+		return
+	}
+	files := append(form.File["files"], form.File["file"]...)
+	if len(files) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no files: send them in the 'files' field"})
+		return
+	}
+
+	base := models.AddDocumentRequest{
+		CollectionName: resolveCollection(formValue("collection_name")),
+		DocType:        formValue("doc_type"),
+	}
+	if value := formValue("chunking_config"); value != "" {
+		if err := json.Unmarshal([]byte(value), &base.ChunkingConfig); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid chunking_config: %v", err)})
+			return
+		}
+	}
+	if base.ChunkingConfig == nil {
+		base.ChunkingConfig = defaultChunkingConfig(base.DocType)
+	}
+	if value := formValue("metadata"); value != "" {
+		if err := json.Unmarshal([]byte(value), &base.Metadata); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid metadata: %v", err)})
+			return
+		}
+	}
+
+	results := make([]gin.H, 0, len(files))
+	added := 0
+	for _, file := range files {
+		result := uploadDocument(base, file)
+		if result["status"] == http.StatusCreated {
+			added++
+		}
+		results = append(results, result)
+	}
+
+	// 201 when every file was added, the file's own status for a single
+	// file, and 207 Multi-Status otherwise
+	status := http.StatusMultiStatus
+	switch {
+	case added == len(files):
+		status = http.StatusCreated
+	case len(files) == 1:
+		status = results[0]["status"].(int)
+	}
+	c.JSON(status, gin.H{
+		"collection_name": base.CollectionName,
+		"results":         results,
+		"added":           added,
+		"failed":          len(files) - added,
+	})
+}
+
+// uploadDocument extracts and adds one uploaded file, returning its result
+// with the HTTP status it would have on its own.
+func uploadDocument(base models.AddDocumentRequest, file *multipart.FileHeader) gin.H {
+	result := gin.H{"file": file.Filename, "size": file.Size}
+	fail := func(status int, message string) gin.H {
+		result["status"] = status
+		result["error"] = message
+		return result
+	}
+
+	if maxUploadSize > 0 && file.Size > maxUploadSize {
+		return fail(http.StatusRequestEntityTooLarge, fmt.Sprintf("file is larger than the limit of %d MB", maxUploadSize>>20))
+	}
+	f, err := file.Open()
+	if err != nil {
+		return fail(http.StatusBadRequest, fmt.Sprintf("failed to read upload: %v", err))
+	}
+	data, err := io.ReadAll(f)
+	f.Close()
+	if err != nil {
+		return fail(http.StatusBadRequest, fmt.Sprintf("failed to read upload: %v", err))
+	}
+
+	extracted, err := extract.Extract(file.Filename, data)
+	if err != nil {
+		return fail(addDocumentErrorStatus(err), err.Error())
+	}
+	result["mime_type"] = extracted.MIMEType
+
+	req := base
+	req.Content = extracted.Text
+	req.PageCount = extracted.PageCount()
+	req.Source = file.Filename
+	req.Metadata = map[string]interface{}{
+		"file_name": file.Filename,
+		"file_size": file.Size,
+		"mime_type": extracted.MIMEType,
+	}
+	for key, value := range extracted.Metadata {
+		req.Metadata[key] = value
+	}
+	for key, value := range base.Metadata {
+		req.Metadata[key] = value
+	}
+
+	doc, err := ragService.AddDocument(req.CollectionName, &req)
+	if err != nil {
+		status := addDocumentErrorStatus(err)
+		if status == http.StatusInternalServerError {
+			log.Printf("Error adding uploaded file %s to collection %s: %v", file.Filename, req.CollectionName, err)
+			return fail(status, "Failed to add document")
+		}
+		return fail(status, err.Error())
+	}
+
+	result["status"] = http.StatusCreated
+	result["document_id"] = doc.ID
+	result["chunking_strategy"] = doc.Metadata["chunking_strategy"]
+	result["chunk_count"] = len(doc.Chunks)
+	return result
+}
+
 func QueryHandler(c *gin.Context) {
 	var req models.QueryRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -112,12 +462,25 @@ func QueryHandler(c *gin.Context) {
 	}
 
 	// Set defaults for enhanced features
-	if req.TopK <= 0 {
-		req.TopK = 5
+	if err := core.ValidateQueryRequest(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
+	req.CollectionName = resolveCollection(req.CollectionName)
 
 	response, err := ragService.Query(&req)
 	if err != nil {
+		if errors.Is(err, core.ErrInvalidFilter) || errors.Is(err, core.ErrUnknownProvider) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, core.ErrSchemaMismatch) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if providerError(c, err) {
+			return
+		}
 		log.Printf("Error processing query for collection %s: %v", req.CollectionName, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process query"})
 		return
@@ -135,49 +498,42 @@ func SearchHandler(c *gin.Context) {
 		return
 	}
 
-	// Set defaults
-	if req.TopK <= 0 {
-		req.TopK = 5
+	if err := core.ValidateQueryRequest(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
+	req.CollectionName = resolveCollection(req.CollectionName)
 
 	startTime := time.Now()
 
 	// Use the original query (query expansion disabled for search-only mode)
 	query := req.Query
 
-	// Generate query embedding
-	embeddingClient := core.NewEnbeddingService()
-	queryEmbedding, err := embeddingClient.GetEmbedding(query)
-	if err != nil {
-		log.Printf("Error generating query embedding: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate query embedding"})
-		return
-	}
-
-	// Build metadata filters
-	filters := make(map[string]interface{})
-	for key, value := range req.MetadataFilters {
-		filters[key] = value
-	}
-
-	// Search for similar chunks
-	chunks, scores, err := vectorDB.QuerySimilarChunks(
-		req.CollectionName,
-		queryEmbedding,
-		req.TopK*2, // Get more for potential re-ranking
-		filters,
-	)
+	retrieval, err := ragService.Retrieve(&req, query)
 	if err != nil {
-		log.Printf("Error searching similar chunks: %v", err)
+		if errors.Is(err, core.ErrInvalidFilter) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, core.ErrSchemaMismatch) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if providerError(c, err) {
+			return
+		}
+		log.Printf("Error retrieving chunks: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search similar chunks"})
 		return
 	}
+	chunks, scores, ranks := retrieval.Chunks, retrieval.Scores, retrieval.Ranks
 
 	if len(chunks) == 0 {
-		c.JSON(http.StatusOK, gin.H{
+		response := gin.H{
 			"query":           req.Query,
 			"expanded_query":  query,
 			"collection_name": req.CollectionName,
+			"retrieval_mode":  retrieval.Mode,
 			"chunks_found":    0,
 			"chunks":          []interface{}{},
 			"context":         "",
@@ -185,49 +541,17 @@ func SearchHandler(c *gin.Context) {
 			"metadata": gin.H{
 				"semantic_threshold": req.SemanticThreshold,
 				"metadata_filters":   req.MetadataFilters,
+				"filter":             req.Filter,
 				"query_expansion":    req.QueryExpansion,
 				"include_parents":    req.IncludeParents,
 				"reranker_enabled":   req.RerankerEnabled,
 			},
-		})
-		return
-	}
-
-	// Apply semantic threshold filtering
-	if req.SemanticThreshold > 0 {
-		filteredChunks := make([]*models.EnhancedChunk, 0)
-		filteredScores := make([]float64, 0)
-
-		for i, score := range scores {
-			if score >= req.SemanticThreshold {
-				filteredChunks = append(filteredChunks, chunks[i])
-				filteredScores = append(filteredScores, score)
-			}
 		}
-
-		chunks = filteredChunks
-		scores = filteredScores
-
-		if len(chunks) == 0 {
-			c.JSON(http.StatusOK, gin.H{
-				"query":           req.Query,
-				"expanded_query":  query,
-				"collection_name": req.CollectionName,
-				"chunks_found":    0,
-				"chunks":          []interface{}{},
-				"context":         "",
-				"message":         "No chunks met the semantic similarity threshold",
-				"processing_time": time.Since(startTime).Seconds(),
-				"metadata": gin.H{
-					"semantic_threshold": req.SemanticThreshold,
-					"metadata_filters":   req.MetadataFilters,
-					"query_expansion":    req.QueryExpansion,
-					"include_parents":    req.IncludeParents,
-					"reranker_enabled":   req.RerankerEnabled,
-				},
-			})
-			return
+		if retrieval.Candidates > 0 {
+			response["message"] = "No chunks met the semantic similarity threshold"
 		}
+		c.JSON(http.StatusOK, response)
+		return
 	}
 
 	// Note: Advanced features like parent inclusion and re-ranking
@@ -238,6 +562,7 @@ func SearchHandler(c *gin.Context) {
 	if len(chunks) > req.TopK {
 		chunks = chunks[:req.TopK]
 		scores = scores[:req.TopK]
+		ranks = ranks[:req.TopK]
 	}
 
 	// Prepare response with detailed chunk information
@@ -258,6 +583,16 @@ func SearchHandler(c *gin.Context) {
 			"similarity_score": scores[i],
 		}
 
+		// Add per-list ranks (dense/lexical) behind the score
+		if ranks[i].DenseRank > 0 {
+			chunkInfo["dense_rank"] = ranks[i].DenseRank
+			chunkInfo["dense_score"] = ranks[i].DenseScore
+		}
+		if ranks[i].LexicalRank > 0 {
+			chunkInfo["lexical_rank"] = ranks[i].LexicalRank
+			chunkInfo["lexical_score"] = ranks[i].LexicalScore
+		}
+
 		// Add parent/child relationship info
 		if chunk.ParentChunkID != nil {
 			chunkInfo["parent_chunk_id"] = *chunk.ParentChunkID
@@ -286,6 +621,7 @@ func SearchHandler(c *gin.Context) {
 		"query":           req.Query,
 		"expanded_query":  query,
 		"collection_name": req.CollectionName,
+		"retrieval_mode":  retrieval.Mode,
 		"chunks_found":    len(chunks),
 		"chunks":          responseChunks,
 		"context":         context,
@@ -294,7 +630,9 @@ func SearchHandler(c *gin.Context) {
 		"metadata": gin.H{
 			"semantic_threshold": req.SemanticThreshold,
 			"metadata_filters":   req.MetadataFilters,
-			"filters_applied":    len(req.MetadataFilters) > 0,
+			"filter":             req.Filter,
+			"filters_applied":    len(req.MetadataFilters) > 0 || req.Filter != nil,
+			"fusion_method":      req.FusionMethod,
 			"note":               "Advanced features available in /api/v1/query endpoint",
 		},
 	}
@@ -340,7 +678,7 @@ func AnalyzeDocumentHandler(c *gin.Context) {
 
 	// Query with metadata and enhanced features enabled
 	queryReq := &models.QueryRequest{
-		CollectionName:    req.CollectionName,
+		CollectionName:    resolveCollection(req.CollectionName),
 		Query:             req.Query,
 		TopK:              10,
 		RerankerEnabled:   true,
@@ -409,6 +747,8 @@ func CompareChunkingHandler(c *gin.Context) {
 		Content    string                    `json:"content" binding:"required"`
 		DocType    string                    `json:"doc_type"`
 		Strategies []models.ChunkingStrategy `json:"strategies"`
+		// Options per strategy, e.g. {"semantic": {"breakpoint_percentile": 20}}
+		Options map[models.ChunkingStrategy]map[string]interface{} `json:"options"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -416,13 +756,10 @@ func CompareChunkingHandler(c *gin.Context) {
 		return
 	}
 
+	// Every registered strategy by default
 	if len(req.Strategies) == 0 {
-		req.Strategies = []models.ChunkingStrategy{
-			models.FixedSizeStrategy,
-			models.StructuralStrategy,
-			models.SemanticStrategy,
-			models.SentenceWindowStrategy,
-			models.ParentDocumentStrategy,
+		for _, spec := range core.ChunkingStrategies() {
+			req.Strategies = append(req.Strategies, spec.Name)
 		}
 	}
 
@@ -437,9 +774,10 @@ func CompareChunkingHandler(c *gin.Context) {
 			MaxChunkSize:       2000,
 			PreserveParagraphs: true,
 			ExtractKeywords:    true,
+			Options:            req.Options[strategy],
 		}
 
-		doc, err := core.ProcessDocumentContent(req.Content, "test_content", req.DocType, config)
+		doc, err := core.ProcessDocumentContent(req.Content, "test_content", req.DocType, 0, config, ragService.ChunkingEnv(models.EmbeddingSelection{}, req.DocType))
 		if err != nil {
 			results = append(results, gin.H{
 				"strategy": string(strategy),
@@ -458,6 +796,7 @@ func CompareChunkingHandler(c *gin.Context) {
 			chunkInfo := gin.H{
 				"id":          chunk.ID,
 				"text_length": len(chunk.Text),
+				"text_tokens": ragService.Tokenizer().Count(chunk.Text),
 				"chunk_type":  chunk.ChunkType,
 				"section":     chunk.Section,
 				"subsection":  chunk.Subsection,
@@ -485,6 +824,16 @@ func CompareChunkingHandler(c *gin.Context) {
 	})
 }
 
+// ListChunkingStrategiesHandler lists the registered chunking strategies
+// with the options each accepts.
+func ListChunkingStrategiesHandler(c *gin.Context) {
+	strategies := core.ChunkingStrategies()
+	c.JSON(http.StatusOK, gin.H{
+		"strategies": strategies,
+		"total":      len(strategies),
+	})
+}
+
 // Health check endpoint
 func HealthHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
@@ -518,8 +867,20 @@ func DeleteCollectionHandler(c *gin.Context) {
 		return
 	}
 
+	if resolveCollection(collectionName) != collectionName {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   fmt.Sprintf("'%s' is an alias", collectionName),
+			"message": "Delete the alias with DELETE /api/v1/aliases/" + collectionName,
+		})
+		return
+	}
+
 	err := vectorDB.DeleteCollection(collectionName)
 	if err != nil {
+		if errors.Is(err, core.ErrAliasConflict) || errors.Is(err, core.ErrReembedInProgress) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
 		log.Printf("Error deleting collection %s: %v", collectionName, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete collection"})
 		return
@@ -539,7 +900,7 @@ func GetCollectionStatsHandler(c *gin.Context) {
 		return
 	}
 
-	stats, err := vectorDB.GetCollectionStats(collectionName)
+	stats, err := vectorDB.GetCollectionStats(resolveCollection(collectionName))
 	if err != nil {
 		log.Printf("Error getting collection stats for %s: %v", collectionName, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get collection statistics"})
@@ -549,6 +910,256 @@ func GetCollectionStatsHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, stats)
 }
 
+// Alias handlers
+
+// ListAliasesHandler returns every alias and the collection it points to
+func ListAliasesHandler(c *gin.Context) {
+	aliases := vectorDB.ListAliases()
+	c.JSON(http.StatusOK, gin.H{
+		"aliases": aliases,
+		"total":   len(aliases),
+	})
+}
+
+// UpdateAliasesHandler applies a list of alias actions atomically, so a
+// rebuilt collection can be swapped in for its readers in one request
+func UpdateAliasesHandler(c *gin.Context) {
+	var req struct {
+		Actions []models.AliasAction `json:"actions" binding:"required,dive"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := vectorDB.UpdateAliases(req.Actions); err != nil {
+		aliasError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Aliases updated successfully",
+		"aliases": vectorDB.ListAliases(),
+	})
+}
+
+// SetAliasHandler creates an alias or points it at another collection
+func SetAliasHandler(c *gin.Context) {
+	alias := c.Param("alias")
+
+	var req struct {
+		Collection string `json:"collection" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	actions := []models.AliasAction{{Op: models.SetAlias, Alias: alias, Collection: req.Collection}}
+	if err := vectorDB.UpdateAliases(actions); err != nil {
+		aliasError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Alias set successfully",
+		"alias":      alias,
+		"collection": req.Collection,
+	})
+}
+
+// DeleteAliasHandler removes an alias; its collection is left untouched
+func DeleteAliasHandler(c *gin.Context) {
+	alias := c.Param("alias")
+
+	actions := []models.AliasAction{{Op: models.DeleteAlias, Alias: alias}}
+	if err := vectorDB.UpdateAliases(actions); err != nil {
+		aliasError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Alias deleted successfully",
+		"alias":   alias,
+	})
+}
+
+func aliasError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, core.ErrAliasConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case strings.Contains(err.Error(), "not found"):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	}
+}
+
+// Doc type profile handlers
+
+// ListDocTypeProfilesHandler lists the chunking profile in effect for every
+// doc type
+func ListDocTypeProfilesHandler(c *gin.Context) {
+	profiles := ragService.DocTypeProfiles().List()
+	c.JSON(http.StatusOK, gin.H{
+		"profiles": profiles,
+		"total":    len(profiles),
+	})
+}
+
+func GetDocTypeProfileHandler(c *gin.Context) {
+	docType := c.Param("doc_type")
+	profile := ragService.DocTypeProfiles().Get(docType)
+	if profile == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("No profile for doc type '%s'", docType)})
+		return
+	}
+	c.JSON(http.StatusOK, profile.DocTypeProfile)
+}
+
+// SetDocTypeProfileHandler creates or replaces the profile of a doc type,
+// taking precedence over one in the config file
+func SetDocTypeProfileHandler(c *gin.Context) {
+	var profile models.DocTypeProfile
+	if err := c.ShouldBindJSON(&profile); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	profile.DocType = c.Param("doc_type")
+
+	saved, err := ragService.DocTypeProfiles().Set(profile)
+	if err != nil {
+		if errors.Is(err, core.ErrInvalidProfile) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("Error saving profile of doc type %s: %v", profile.DocType, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save profile"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Profile saved successfully",
+		"profile": saved,
+	})
+}
+
+// DeleteDocTypeProfileHandler deletes a profile set through the API; a
+// profile of the same doc type in the config file applies again
+func DeleteDocTypeProfileHandler(c *gin.Context) {
+	docType := c.Param("doc_type")
+	deleted, err := ragService.DocTypeProfiles().Delete(docType)
+	if err != nil {
+		log.Printf("Error deleting profile of doc type %s: %v", docType, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete profile"})
+		return
+	}
+	if !deleted {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("No profile set through the API for doc type '%s'", docType)})
+		return
+	}
+
+	response := gin.H{
+		"message":  "Profile deleted successfully",
+		"doc_type": docType,
+	}
+	if profile := ragService.DocTypeProfiles().Get(docType); profile != nil {
+		response["profile"] = profile.DocTypeProfile // The config file's, now in effect
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// Index tuning handlers (local vector store only)
+
+// indexTuner returns the vector store as an IndexTuner, answering 501 when the
+// backend manages its own index.
+func indexTuner(c *gin.Context) (core.IndexTuner, bool) {
+	tuner, ok := vectorDB.(core.IndexTuner)
+	if !ok {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "Index tuning is only available with the local vector store"})
+	}
+	return tuner, ok
+}
+
+// GetIndexSettingsHandler returns the ANN index parameters of a collection
+func GetIndexSettingsHandler(c *gin.Context) {
+	tuner, ok := indexTuner(c)
+	if !ok {
+		return
+	}
+
+	collectionName := resolveCollection(c.Param("name"))
+	settings, err := tuner.IndexSettings(collectionName)
+	if err != nil {
+		log.Printf("Error getting index settings for %s: %v", collectionName, err)
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
+
+// UpdateIndexSettingsHandler changes the ANN index parameters of a collection
+func UpdateIndexSettingsHandler(c *gin.Context) {
+	tuner, ok := indexTuner(c)
+	if !ok {
+		return
+	}
+
+	var cfg hnsw.Config
+	if err := c.ShouldBindJSON(&cfg); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	collectionName := resolveCollection(c.Param("name"))
+	if err := tuner.SetIndexConfig(collectionName, cfg); err != nil {
+		log.Printf("Error updating index settings for %s: %v", collectionName, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	settings, _ := tuner.IndexSettings(collectionName)
+	c.JSON(http.StatusOK, settings)
+}
+
+// BenchmarkIndexHandler compares recall and latency of ANN parameters against exact search
+func BenchmarkIndexHandler(c *gin.Context) {
+	tuner, ok := indexTuner(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		K       int           `json:"k"`
+		Queries int           `json:"queries"`
+		Configs []hnsw.Config `json:"configs"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.K <= 0 {
+		req.K = 10
+	}
+	if req.Queries <= 0 {
+		req.Queries = 100
+	}
+
+	collectionName := resolveCollection(c.Param("name"))
+	results, err := tuner.BenchmarkIndex(collectionName, req.K, req.Queries, req.Configs)
+	if err != nil {
+		log.Printf("Error benchmarking index for %s: %v", collectionName, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"collection_name": collectionName,
+		"results":         results,
+	})
+}
+
 // Document management handlers
 
 // ListDocumentsHandler returns all documents in a collection
@@ -559,6 +1170,7 @@ func ListDocumentsHandler(c *gin.Context) {
 		return
 	}
 
+	collectionName = resolveCollection(collectionName)
 	documents, err := vectorDB.ListDocuments(collectionName)
 	if err != nil {
 		log.Printf("Error listing documents in collection %s: %v", collectionName, err)
@@ -581,10 +1193,12 @@ func DeleteDocumentHandler(c *gin.Context) {
 		return
 	}
 
-	err := vectorDB.DeleteDocument(documentID)
+	err := ragService.DeleteDocument(documentID)
 	if err != nil {
 		log.Printf("Error deleting document %s: %v", documentID, err)
-		if strings.Contains(err.Error(), "not found") {
+		if errors.Is(err, core.ErrReembedInProgress) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		} else if strings.Contains(err.Error(), "not found") {
 			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		} else {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete document"})
@@ -616,10 +1230,13 @@ func DeleteAllDocumentsHandler(c *gin.Context) {
 		return
 	}
 
-	err := vectorDB.DeleteAllDocumentsInCollection(collectionName)
+	collectionName = resolveCollection(collectionName)
+	err := ragService.DeleteAllDocuments(collectionName)
 	if err != nil {
 		log.Printf("Error deleting all documents in collection %s: %v", collectionName, err)
-		if strings.Contains(err.Error(), "no documents found") {
+		if errors.Is(err, core.ErrReembedInProgress) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		} else if strings.Contains(err.Error(), "no documents found") {
 			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		} else {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete documents"})
@@ -633,9 +1250,47 @@ func DeleteAllDocumentsHandler(c *gin.Context) {
 	})
 }
 
+// GetEmbeddingCacheHandler reports the size and hit rate of the embedding
+// cache, per model
+func GetEmbeddingCacheHandler(c *gin.Context) {
+	if embeddingCache == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "The embedding cache is disabled"})
+		return
+	}
+	c.JSON(http.StatusOK, embeddingCache.Stats())
+}
+
+// PurgeEmbeddingCacheHandler empties the embedding cache, or only the entries
+// of ?model=<provider>/<model>
+func PurgeEmbeddingCacheHandler(c *gin.Context) {
+	if embeddingCache == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "The embedding cache is disabled"})
+		return
+	}
+
+	model := c.Query("model")
+	removed, err := embeddingCache.Purge(model)
+	if err != nil {
+		log.Printf("Error purging embedding cache: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to purge embedding cache"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Embedding cache purged successfully",
+		"model":   model,
+		"removed": removed,
+	})
+}
+
 // Cleanup function
 func Cleanup() {
 	if vectorDB != nil {
 		vectorDB.Close()
 	}
+	if embeddingCache != nil {
+		if err := embeddingCache.Close(); err != nil {
+			log.Printf("Warning: could not close embedding cache: %v", err)
+		}
+	}
 }
@@ -28,9 +28,28 @@ func SetupRoutes() *gin.Engine {
 		v1.GET("/collections", ListCollectionsHandler)
 		v1.GET("/collections/:name", GetCollectionStatsHandler)
 		v1.DELETE("/collections/:name", DeleteCollectionHandler)
+		v1.PUT("/collections/:name/llm", SetCollectionLLMHandler)
+		v1.POST("/collections/:name/reembed", ReembedCollectionHandler)
+		v1.GET("/collections/:name/reembed", GetReembedStatusHandler)
+
+		// Collection aliases
+		v1.GET("/aliases", ListAliasesHandler)
+		v1.POST("/aliases", UpdateAliasesHandler) // Atomic batch of set/delete actions
+		v1.PUT("/aliases/:alias", SetAliasHandler)
+		v1.DELETE("/aliases/:alias", DeleteAliasHandler)
+
+		// ANN index tuning (local vector store)
+		v1.GET("/collections/:name/index", GetIndexSettingsHandler)
+		v1.PUT("/collections/:name/index", UpdateIndexSettingsHandler)
+		v1.POST("/collections/:name/index/benchmark", BenchmarkIndexHandler)
+
+		// Embedding cache
+		v1.GET("/embedding-cache", GetEmbeddingCacheHandler)
+		v1.DELETE("/embedding-cache", PurgeEmbeddingCacheHandler)
 
 		// Document management
 		v1.POST("/documents", AddDocumentHandler)
+		v1.POST("/documents/upload", UploadDocumentsHandler) // multipart/form-data, one or many files
 		v1.GET("/collections/:name/documents", ListDocumentsHandler)
 		v1.DELETE("/documents/:id", DeleteDocumentHandler)
 		v1.DELETE("/collections/:name/documents", DeleteAllDocumentsHandler)
@@ -40,8 +59,15 @@ func SetupRoutes() *gin.Engine {
 		v1.POST("/search", SearchHandler) // Search-only without LLM
 		v1.POST("/analyze", AnalyzeDocumentHandler)
 
-		// Chunking strategy comparison
+		// Chunking strategies
+		v1.GET("/chunking-strategies", ListChunkingStrategiesHandler)
 		v1.POST("/compare-chunking", CompareChunkingHandler)
+
+		// Chunking profiles by document type
+		v1.GET("/doc-type-profiles", ListDocTypeProfilesHandler)
+		v1.GET("/doc-type-profiles/:doc_type", GetDocTypeProfileHandler)
+		v1.PUT("/doc-type-profiles/:doc_type", SetDocTypeProfileHandler)
+		v1.DELETE("/doc-type-profiles/:doc_type", DeleteDocTypeProfileHandler)
 	}
 
 	return r
@@ -4,30 +4,113 @@ import (
 	"encoding/json"
 	"log"
 	"os"
+	"rag_system/embedcache"
+	"rag_system/hnsw"
+	"rag_system/models"
+	"rag_system/provider"
+	"rag_system/tokenizer"
 )
 
 type Config struct {
-	ServerPort      string `json:"server_port"`
-	LlamaCPPBaseURL string `json:"llamacpp_base_url"`
-	EmbeddingModel  string `json:"embedding_model"`
-	ChatModel       string `json:"chat_model"`
-	VectorDBPath    string `json:"vector_db_path"` // For SQLite
-	DefaultTopK     int    `json:"default_top_k"`
+	ServerPort      string      `json:"server_port"`
+	LlamaCPPBaseURL string      `json:"llamacpp_base_url"`
+	EmbeddingModel  string      `json:"embedding_model"`
+	ChatModel       string      `json:"chat_model"`
+	VectorStore     string      `json:"vector_store"`   // "qdrant", "local" or empty to auto-detect
+	VectorDBPath    string      `json:"vector_db_path"` // Directory of the local vector store
+	HNSW            hnsw.Config `json:"hnsw"`           // Default ANN index parameters of the local vector store
+	DefaultTopK     int         `json:"default_top_k"`
+
+	// LLMProvider answers queries unless a collection or request picks
+	// another, EmbeddingProvider embeds new collections unless they pick
+	// another. Providers adds named endpoints or overrides the built-in
+	// "llamacpp", "openai", "ollama", "anthropic" and "local".
+	LLMProvider       string                     `json:"llm_provider"`
+	EmbeddingProvider string                     `json:"embedding_provider"`
+	Providers         map[string]provider.Config `json:"providers"`
+
+	EmbeddingCache embedcache.Config `json:"embedding_cache"` // Persistent cache of computed embeddings
+
+	// Tokenizer counts tokens for embedding batches, rate limits, chunk sizes
+	// given in tokens and the context of answers, which holds at most
+	// MaxContextTokens unless a query asks for another budget.
+	Tokenizer        tokenizer.Config `json:"tokenizer"`
+	MaxContextTokens int              `json:"max_context_tokens"`
+
+	// DocTypeProfiles set the heading patterns, section levels, strategy and
+	// sizes of documents by doc_type. Profiles set through the API replace
+	// these until deleted.
+	DocTypeProfiles []models.DocTypeProfile `json:"doc_type_profiles"`
+
+	// MaxUploadMB is the largest file accepted by the upload endpoint.
+	MaxUploadMB int `json:"max_upload_mb"`
 }
 
 func DefaultConfig() Config {
 	return Config{
 		ServerPort:      "8080",                     // Gin server port
 		LlamaCPPBaseURL: "http://localhost:8091/v1", // Your OpenAI-compatible API
-		EmbeddingModel:  "nomic-embed-text-v1.5",    // Specify model if LlamaCPP needs it
+		EmbeddingModel:  "nomic-embed-text-v1.5",    // Embedding model of the local servers
 		ChatModel:       "qwen3:8b",                 // Specify model for LlamaCPP
-		VectorDBPath:    "./rag_database.db",
+		VectorDBPath:    "./rag_data",
+		HNSW:            hnsw.DefaultConfig(),
 		DefaultTopK:     3,
+
+		LLMProvider:       "llamacpp",
+		EmbeddingProvider: "llamacpp",
+
+		EmbeddingCache: embedcache.DefaultConfig(),
+
+		MaxContextTokens: 3000,
+
+		MaxUploadMB: 50,
 	}
 }
 
 var AppConfig Config
 
+// ProviderConfigs returns the built-in providers merged with the configured
+// ones. The local servers (llamacpp, ollama) default to ChatModel and
+// EmbeddingModel, llamacpp to LlamaCPPBaseURL.
+func (c Config) ProviderConfigs() map[string]provider.Config {
+	configs := map[string]provider.Config{
+		"llamacpp": {
+			Type:           provider.OpenAI,
+			BaseURL:        c.LlamaCPPBaseURL,
+			ChatModel:      c.ChatModel,
+			EmbeddingModel: c.EmbeddingModel,
+		},
+		"openai": {
+			Type:           provider.OpenAI,
+			BaseURL:        "https://api.openai.com/v1",
+			APIKeyEnv:      "OPENAI_API_KEY",
+			ChatModel:      "gpt-4.1-mini",
+			EmbeddingModel: "text-embedding-3-small",
+		},
+		"ollama": {
+			Type:           provider.Ollama,
+			BaseURL:        "http://localhost:11434",
+			ChatModel:      c.ChatModel,
+			EmbeddingModel: c.EmbeddingModel,
+		},
+		"anthropic": {
+			Type:      provider.Anthropic,
+			BaseURL:   "https://api.anthropic.com/v1",
+			APIKeyEnv: "ANTHROPIC_API_KEY",
+			ChatModel: "claude-3-5-haiku-latest",
+		},
+		"local": {
+			Type:           provider.Local,
+			EmbeddingModel: provider.LocalEmbeddingModel,
+			Dimensions:     provider.DefaultLocalDimensions,
+		},
+	}
+	for name, cfg := range c.Providers {
+		configs[name] = cfg
+	}
+	return configs
+}
+
 func LoadConfig(path string) error {
 	file, err := os.ReadFile(path)
 	if err != nil {
@@ -37,6 +120,8 @@ func LoadConfig(path string) error {
 		return nil // Or return err if config file is mandatory
 	}
 
+	// Start from the defaults so keys missing from the file keep their default value
+	AppConfig = DefaultConfig()
 	err = json.Unmarshal(file, &AppConfig)
 	if err != nil {
 		log.Println("Error unmarshalling config, using default config:", err)
@@ -0,0 +1,159 @@
+package core
+
+import (
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// BM25 parameters: k1 controls term-frequency saturation, b length normalisation.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// searchTokenPattern matches words and compound identifiers such as
+// "ERR-1042", "max_retries" or "v2.3.1" as single tokens.
+var searchTokenPattern = regexp.MustCompile(`[\p{L}\p{N}]+(?:[._\-/:][\p{L}\p{N}]+)*`)
+
+var compoundSeparators = regexp.MustCompile(`[._\-/:]`)
+
+// tokenizeForSearch lowercases text and splits it into lexical search terms.
+// Compound identifiers are emitted whole and as their parts, so "ERR-1042"
+// matches both "err-1042" and "1042".
+func tokenizeForSearch(text string) []string {
+	var tokens []string
+	for _, match := range searchTokenPattern.FindAllString(strings.ToLower(text), -1) {
+		tokens = append(tokens, match)
+		if parts := compoundSeparators.Split(match, -1); len(parts) > 1 {
+			tokens = append(tokens, parts...)
+		}
+	}
+	return tokens
+}
+
+// bm25TermScore is the BM25 contribution of one query term to one document.
+func bm25TermScore(tf, df, docCount int, docLen, avgDocLen float64) float64 {
+	if tf == 0 || df == 0 || docCount == 0 {
+		return 0
+	}
+	idf := math.Log(1 + (float64(docCount)-float64(df)+0.5)/(float64(df)+0.5))
+	norm := 1 - bm25B
+	if avgDocLen > 0 {
+		norm += bm25B * docLen / avgDocLen
+	}
+	return idf * (float64(tf) * (bm25K1 + 1)) / (float64(tf) + bm25K1*norm)
+}
+
+// BM25Index is an in-memory inverted index over chunk text. It is not safe
+// for concurrent use; the owning store guards it.
+type BM25Index struct {
+	postings map[string]map[string]int // term -> chunk ID -> term frequency
+	docTerms map[string]map[string]int // chunk ID -> term -> term frequency
+	docLen   map[string]int
+	totalLen int
+}
+
+// lexicalHit is one BM25 search result.
+type lexicalHit struct {
+	ID    string
+	Score float64
+}
+
+func NewBM25Index() *BM25Index {
+	return &BM25Index{
+		postings: make(map[string]map[string]int),
+		docTerms: make(map[string]map[string]int),
+		docLen:   make(map[string]int),
+	}
+}
+
+// Add indexes text under id, replacing any previous text for that id.
+func (b *BM25Index) Add(id, text string) {
+	b.Remove(id)
+
+	tokens := tokenizeForSearch(text)
+	terms := make(map[string]int)
+	for _, t := range tokens {
+		terms[t]++
+	}
+	for t, tf := range terms {
+		if b.postings[t] == nil {
+			b.postings[t] = make(map[string]int)
+		}
+		b.postings[t][id] = tf
+	}
+	b.docTerms[id] = terms
+	b.docLen[id] = len(tokens)
+	b.totalLen += len(tokens)
+}
+
+// Remove drops id from the index.
+func (b *BM25Index) Remove(id string) {
+	terms, ok := b.docTerms[id]
+	if !ok {
+		return
+	}
+	for t := range terms {
+		delete(b.postings[t], id)
+		if len(b.postings[t]) == 0 {
+			delete(b.postings, t)
+		}
+	}
+	b.totalLen -= b.docLen[id]
+	delete(b.docTerms, id)
+	delete(b.docLen, id)
+}
+
+// Len returns the number of indexed chunks.
+func (b *BM25Index) Len() int {
+	return len(b.docLen)
+}
+
+// Search returns up to topK chunk IDs ranked by BM25 score. accept, when not
+// nil, restricts results to the IDs it admits.
+func (b *BM25Index) Search(query string, topK int, accept func(id string) bool) []lexicalHit {
+	if len(b.docLen) == 0 {
+		return nil
+	}
+	avgDocLen := float64(b.totalLen) / float64(len(b.docLen))
+
+	scores := make(map[string]float64)
+	for _, term := range uniqueStrings(tokenizeForSearch(query)) {
+		postings := b.postings[term]
+		for id, tf := range postings {
+			if accept != nil && !accept(id) {
+				continue
+			}
+			scores[id] += bm25TermScore(tf, len(postings), len(b.docLen), float64(b.docLen[id]), avgDocLen)
+		}
+	}
+
+	hits := make([]lexicalHit, 0, len(scores))
+	for id, score := range scores {
+		hits = append(hits, lexicalHit{ID: id, Score: score})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].ID < hits[j].ID
+	})
+	if topK > 0 && len(hits) > topK {
+		hits = hits[:topK]
+	}
+	return hits
+}
+
+func uniqueStrings(items []string) []string {
+	seen := make(map[string]bool, len(items))
+	var out []string
+	for _, item := range items {
+		if !seen[item] {
+			seen[item] = true
+			out = append(out, item)
+		}
+	}
+	return out
+}
@@ -0,0 +1,77 @@
+package core
+
+import (
+	"fmt"
+	"rag_system/models"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// textSpan is a byte range of a document's content.
+type textSpan struct {
+	start, end int
+}
+
+// trimSpan narrows content[start:end] to exclude leading and trailing
+// whitespace. An all-whitespace span collapses to an empty one at start.
+func trimSpan(content string, start, end int) (int, int) {
+	text := content[start:end]
+	trimmed := strings.TrimLeftFunc(text, unicode.IsSpace)
+	if trimmed == "" {
+		return start, start
+	}
+	start += len(text) - len(trimmed)
+	end = start + len(strings.TrimRightFunc(trimmed, unicode.IsSpace))
+	return start, end
+}
+
+// splitParagraphSpans splits content[start:end] at every "\n\n", like
+// strings.Split, returning the spans between the separators.
+func splitParagraphSpans(content string, start, end int) []textSpan {
+	var spans []textSpan
+	for {
+		i := strings.Index(content[start:end], "\n\n")
+		if i < 0 {
+			return append(spans, textSpan{start, end})
+		}
+		spans = append(spans, textSpan{start, start + i})
+		start += i + 2
+	}
+}
+
+// newSpanChunk returns a chunk of content[start:end] without its surrounding
+// whitespace, positioned exactly where its text sits in content.
+func newSpanChunk(content string, docID string, start, end int) *models.EnhancedChunk {
+	start, end = trimSpan(content, start, end)
+	return &models.EnhancedChunk{
+		ID:         uuid.New().String(),
+		DocumentID: docID,
+		Text:       content[start:end],
+		StartPos:   start,
+		EndPos:     end,
+	}
+}
+
+// VerifyChunkOffsets checks that every chunk's text is exactly
+// content[StartPos:EndPos] and that neither offset falls inside a UTF-8
+// encoded character.
+func VerifyChunkOffsets(content string, chunks []*models.EnhancedChunk) error {
+	onBoundary := func(pos int) bool {
+		return pos == len(content) || utf8.RuneStart(content[pos])
+	}
+	for i, chunk := range chunks {
+		if chunk.StartPos < 0 || chunk.StartPos > chunk.EndPos || chunk.EndPos > len(content) {
+			return fmt.Errorf("chunk %d (%s): span [%d:%d] is outside the content of %d bytes", i, chunk.ChunkType, chunk.StartPos, chunk.EndPos, len(content))
+		}
+		if !onBoundary(chunk.StartPos) || !onBoundary(chunk.EndPos) {
+			return fmt.Errorf("chunk %d (%s): span [%d:%d] splits a character", i, chunk.ChunkType, chunk.StartPos, chunk.EndPos)
+		}
+		if content[chunk.StartPos:chunk.EndPos] != chunk.Text {
+			return fmt.Errorf("chunk %d (%s): text of %d bytes does not match span [%d:%d]", i, chunk.ChunkType, len(chunk.Text), chunk.StartPos, chunk.EndPos)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,325 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"rag_system/models"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrInvalidChunkingConfig is wrapped by errors about chunking configs that
+// name an unknown strategy, size unit or option, so handlers can answer 400.
+var ErrInvalidChunkingConfig = errors.New("invalid chunking config")
+
+// Chunker splits a document into chunks. Every chunk's Text must be exactly
+// Content[StartPos:EndPos]; ChunkRequest.NewChunk builds such chunks.
+type Chunker interface {
+	Chunk(req *ChunkRequest) ([]*models.EnhancedChunk, error)
+}
+
+// ChunkerFunc adapts a function to the Chunker interface.
+type ChunkerFunc func(req *ChunkRequest) ([]*models.EnhancedChunk, error)
+
+func (f ChunkerFunc) Chunk(req *ChunkRequest) ([]*models.EnhancedChunk, error) {
+	return f(req)
+}
+
+// ChunkRequest is a document to chunk, with the config adapted to it.
+type ChunkRequest struct {
+	Content         string
+	DocumentID      string
+	Source          string // e.g. the file name, whose extension tells the language of code
+	DocType         string
+	Config          *models.ChunkingConfig // Sizes are in Config.SizeUnit
+	Characteristics DocumentCharacteristics
+	Options         ChunkerOptions // The strategy's options, validated, with defaults applied
+	Env             ChunkingEnv
+
+	size chunkSizer
+}
+
+// Size measures text in the unit of the config's sizes.
+func (r *ChunkRequest) Size(text string) int {
+	return r.size.of(text)
+}
+
+// NewChunk returns a chunk of Content[start:end] without its surrounding
+// whitespace, positioned exactly where its text sits in Content.
+func (r *ChunkRequest) NewChunk(start, end int) *models.EnhancedChunk {
+	return newSpanChunk(r.Content, r.DocumentID, start, end)
+}
+
+// OptionType is the JSON type of a chunker option's value.
+type OptionType string
+
+const (
+	IntOption    OptionType = "int"
+	FloatOption  OptionType = "float"
+	BoolOption   OptionType = "bool"
+	StringOption OptionType = "string"
+)
+
+// ChunkerOption declares an option a strategy accepts in
+// chunking_config.options.
+type ChunkerOption struct {
+	Name        string      `json:"name"`
+	Type        OptionType  `json:"type"`
+	Description string      `json:"description"`
+	Default     interface{} `json:"default,omitempty"` // Applied when the option is not given; nil leaves it unset
+	Min         float64     `json:"min,omitempty"`     // Bounds of int and float options, checked when Max > Min
+	Max         float64     `json:"max,omitempty"`
+	Values      []string    `json:"values,omitempty"` // Allowed values of a string option; empty allows any
+}
+
+// ChunkerOptions holds validated option values: int, float64, bool or string
+// according to the option's type.
+type ChunkerOptions map[string]interface{}
+
+func (o ChunkerOptions) Int(name string) int {
+	v, _ := o[name].(int)
+	return v
+}
+
+func (o ChunkerOptions) Float(name string) float64 {
+	v, _ := o[name].(float64)
+	return v
+}
+
+func (o ChunkerOptions) Bool(name string) bool {
+	v, _ := o[name].(bool)
+	return v
+}
+
+func (o ChunkerOptions) String(name string) string {
+	v, _ := o[name].(string)
+	return v
+}
+
+// ChunkerSpec registers a chunking strategy under a name.
+type ChunkerSpec struct {
+	Name        models.ChunkingStrategy `json:"name"`
+	Description string                  `json:"description"`
+	Options     []ChunkerOption         `json:"options"`
+	Chunker     Chunker                 `json:"-"`
+}
+
+var (
+	chunkersMu sync.RWMutex
+	chunkers   = map[models.ChunkingStrategy]ChunkerSpec{}
+)
+
+// RegisterChunker makes a strategy available to chunking configs, the
+// strategy listing and chunking comparisons. Names must be unique.
+func RegisterChunker(spec ChunkerSpec) error {
+	if spec.Name == "" {
+		return fmt.Errorf("chunker name is empty")
+	}
+	if spec.Chunker == nil {
+		return fmt.Errorf("chunker %q has no implementation", spec.Name)
+	}
+	seen := map[string]bool{}
+	for _, option := range spec.Options {
+		if option.Name == "" || seen[option.Name] {
+			return fmt.Errorf("chunker %q: option names must be unique and non-empty", spec.Name)
+		}
+		seen[option.Name] = true
+		switch option.Type {
+		case IntOption, FloatOption, BoolOption, StringOption:
+		default:
+			return fmt.Errorf("chunker %q: option %q has unknown type %q", spec.Name, option.Name, option.Type)
+		}
+		if option.Default != nil {
+			if _, err := option.parse(option.Default); err != nil {
+				return fmt.Errorf("chunker %q: default of %w", spec.Name, err)
+			}
+		}
+	}
+	spec.Options = append([]ChunkerOption(nil), spec.Options...)
+
+	chunkersMu.Lock()
+	defer chunkersMu.Unlock()
+	if _, ok := chunkers[spec.Name]; ok {
+		return fmt.Errorf("chunker %q is already registered", spec.Name)
+	}
+	chunkers[spec.Name] = spec
+	return nil
+}
+
+// ChunkingStrategies returns the registered strategies sorted by name.
+func ChunkingStrategies() []ChunkerSpec {
+	chunkersMu.RLock()
+	defer chunkersMu.RUnlock()
+
+	specs := make([]ChunkerSpec, 0, len(chunkers))
+	for _, spec := range chunkers {
+		specs = append(specs, spec)
+	}
+	sort.Slice(specs, func(i, j int) bool { return specs[i].Name < specs[j].Name })
+	return specs
+}
+
+// chunkerFor returns the strategy registered as name with options validated
+// against its declared ones.
+func chunkerFor(name models.ChunkingStrategy, given map[string]interface{}) (ChunkerSpec, ChunkerOptions, error) {
+	chunkersMu.RLock()
+	spec, ok := chunkers[name]
+	chunkersMu.RUnlock()
+	if !ok {
+		var names []string
+		for _, s := range ChunkingStrategies() {
+			names = append(names, string(s.Name))
+		}
+		return spec, nil, fmt.Errorf("%w: unknown strategy %q (available: %s)", ErrInvalidChunkingConfig, name, strings.Join(names, ", "))
+	}
+
+	declared := make(map[string]ChunkerOption, len(spec.Options))
+	for _, option := range spec.Options {
+		declared[option.Name] = option
+	}
+	options := ChunkerOptions{}
+	for key, value := range given {
+		option, ok := declared[key]
+		if !ok {
+			return spec, nil, fmt.Errorf("%w: strategy %q has no option %q", ErrInvalidChunkingConfig, name, key)
+		}
+		parsed, err := option.parse(value)
+		if err != nil {
+			return spec, nil, fmt.Errorf("%w: strategy %q: %v", ErrInvalidChunkingConfig, name, err)
+		}
+		options[key] = parsed
+	}
+	for _, option := range spec.Options {
+		if _, ok := options[option.Name]; !ok && option.Default != nil {
+			options[option.Name], _ = option.parse(option.Default)
+		}
+	}
+	return spec, options, nil
+}
+
+// parse checks value against the option's type and bounds. Numbers decoded
+// from JSON arrive as float64; int options accept them when they are whole.
+func (o ChunkerOption) parse(value interface{}) (interface{}, error) {
+	var number float64
+	switch v := value.(type) {
+	case int:
+		number = float64(v)
+	case float64:
+		number = v
+	}
+
+	switch o.Type {
+	case IntOption:
+		if !isNumber(value) || number != math.Trunc(number) {
+			return nil, fmt.Errorf("option %q must be an integer", o.Name)
+		}
+	case FloatOption:
+		if !isNumber(value) {
+			return nil, fmt.Errorf("option %q must be a number", o.Name)
+		}
+	case BoolOption:
+		if _, ok := value.(bool); !ok {
+			return nil, fmt.Errorf("option %q must be true or false", o.Name)
+		}
+		return value, nil
+	case StringOption:
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("option %q must be a string", o.Name)
+		}
+		if len(o.Values) > 0 && !containsString(o.Values, s) {
+			return nil, fmt.Errorf("option %q must be one of %s", o.Name, strings.Join(o.Values, ", "))
+		}
+		return s, nil
+	}
+
+	if o.Max > o.Min && (number < o.Min || number > o.Max) {
+		return nil, fmt.Errorf("option %q must be between %g and %g", o.Name, o.Min, o.Max)
+	}
+	if o.Type == IntOption {
+		return int(number), nil
+	}
+	return number, nil
+}
+
+func isNumber(value interface{}) bool {
+	switch value.(type) {
+	case int, float64:
+		return true
+	}
+	return false
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// The built-in strategies.
+func init() {
+	builtins := []ChunkerSpec{
+		{
+			Name:        models.FixedSizeStrategy,
+			Description: "Windows of fixed_size with overlap, ending at whitespace where possible",
+			Chunker: ChunkerFunc(func(req *ChunkRequest) ([]*models.EnhancedChunk, error) {
+				return createFixedSizeChunks(req.Content, req.DocumentID, req.Config, req.size)
+			}),
+		},
+		{
+			Name:        models.StructuralStrategy,
+			Description: "Detected sections, split at paragraphs when larger than max_chunk_size",
+			Chunker: ChunkerFunc(func(req *ChunkRequest) ([]*models.EnhancedChunk, error) {
+				return createIntelligentStructuralChunks(req.Content, req.DocumentID, req.Config, req.Characteristics, req.size, req.Env.Profile)
+			}),
+		},
+		{
+			Name:        models.SemanticStrategy,
+			Description: "Sentences are embedded and chunks end where neighbouring sentences are least similar",
+			Options: []ChunkerOption{
+				{Name: "breakpoint_percentile", Type: FloatOption, Default: 10, Min: 1, Max: 99,
+					Description: "A chunk ends where neighbour similarity falls below this percentile of all of them"},
+				{Name: "sentence_buffer", Type: IntOption, Default: 1, Min: 0, Max: 5,
+					Description: "Neighbours on each side embedded with every sentence to smooth out short ones"},
+			},
+			Chunker: ChunkerFunc(func(req *ChunkRequest) ([]*models.EnhancedChunk, error) {
+				return createSemanticChunks(req.Content, req.DocumentID, req.Config, req.size, req.Env.Embed, req.Options)
+			}),
+		},
+		{
+			Name:        models.SentenceWindowStrategy,
+			Description: "Overlapping windows of sentence_window_size sentences",
+			Chunker: ChunkerFunc(func(req *ChunkRequest) ([]*models.EnhancedChunk, error) {
+				return createSentenceWindowChunks(req.Content, req.DocumentID, req.Config, req.size)
+			}),
+		},
+		{
+			Name:        models.ParentDocumentStrategy,
+			Description: "Large parent chunks, each split into child chunks linked to it",
+			Chunker: ChunkerFunc(func(req *ChunkRequest) ([]*models.EnhancedChunk, error) {
+				return createParentDocumentChunks(req.Content, req.DocumentID, req.Config, req.size)
+			}),
+		},
+		{
+			Name:        models.CodeStrategy,
+			Description: "Source code at declarations: Go functions, methods and types with their doc comments, other languages at top-level blocks",
+			Options: []ChunkerOption{
+				{Name: "syntax", Type: StringOption, Default: "auto", Values: []string{"auto", goSyntax, braceSyntax, indentSyntax},
+					Description: "How blocks are found; auto goes by the source's file extension"},
+			},
+			Chunker: ChunkerFunc(func(req *ChunkRequest) ([]*models.EnhancedChunk, error) {
+				return createCodeChunks(req.Content, req.DocumentID, req.Source, req.Config, req.size, req.Options.String("syntax"))
+			}),
+		},
+	}
+	for _, spec := range builtins {
+		if err := RegisterChunker(spec); err != nil {
+			panic(err)
+		}
+	}
+}
@@ -0,0 +1,441 @@
+package core
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"log"
+	"path/filepath"
+	"rag_system/models"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Code is split by one of these syntaxes.
+const (
+	goSyntax     = "go"     // go/parser declarations
+	braceSyntax  = "brace"  // Blocks delimited by braces: C, Java, JavaScript, Rust...
+	indentSyntax = "indent" // Blocks delimited by indentation: Python, YAML...
+)
+
+// codeLanguages maps source file extensions to their language and syntax.
+var codeLanguages = map[string]struct{ name, syntax string }{
+	".go":    {"go", goSyntax},
+	".py":    {"python", indentSyntax},
+	".rb":    {"ruby", indentSyntax},
+	".yaml":  {"yaml", indentSyntax},
+	".yml":   {"yaml", indentSyntax},
+	".js":    {"javascript", braceSyntax},
+	".jsx":   {"javascript", braceSyntax},
+	".mjs":   {"javascript", braceSyntax},
+	".ts":    {"typescript", braceSyntax},
+	".tsx":   {"typescript", braceSyntax},
+	".java":  {"java", braceSyntax},
+	".kt":    {"kotlin", braceSyntax},
+	".scala": {"scala", braceSyntax},
+	".c":     {"c", braceSyntax},
+	".h":     {"c", braceSyntax},
+	".cc":    {"cpp", braceSyntax},
+	".cpp":   {"cpp", braceSyntax},
+	".hpp":   {"cpp", braceSyntax},
+	".cs":    {"csharp", braceSyntax},
+	".rs":    {"rust", braceSyntax},
+	".swift": {"swift", braceSyntax},
+	".php":   {"php", braceSyntax},
+	".proto": {"protobuf", braceSyntax},
+}
+
+// isCodeSource reports whether source names a file of a known language.
+func isCodeSource(source string) bool {
+	_, ok := codeLanguages[strings.ToLower(filepath.Ext(source))]
+	return ok
+}
+
+// codeSymbolPattern finds the name a block of code declares.
+var codeSymbolPattern = regexp.MustCompile(`(?m)^\s*(?:(?:export|public|private|protected|internal|static|async|abstract|final|pub|default)\s+)*(?:func|function|def|class|struct|interface|enum|trait|impl|fn|type|module|message|service|const|let|var)\s+(?:\([^)]*\)\s*)?([A-Za-z_$][\w$]*)`)
+
+// codeUnit is a span of source code that is kept together when possible.
+type codeUnit struct {
+	start, end int
+	meta       map[string]interface{} // kind, symbol and receiver of Go declarations
+}
+
+// createCodeChunks splits source code at declarations. Go is parsed with
+// go/parser, and each chunk holds whole functions, methods or type
+// declarations with their doc comments; other languages are split at
+// top-level blocks found by brace depth or indentation. Small neighbouring
+// declarations share a chunk up to the minimum chunk size; a declaration
+// larger than the maximum is split at the blocks nested in it.
+func createCodeChunks(content string, docID string, source string, config *models.ChunkingConfig, size chunkSizer, syntax string) ([]*models.EnhancedChunk, error) {
+	language := codeLanguages[strings.ToLower(filepath.Ext(source))]
+	if syntax == "" || syntax == "auto" {
+		syntax = language.syntax
+	}
+	if syntax == "" {
+		syntax = guessCodeSyntax(content)
+	}
+	metadata := map[string]interface{}{"syntax": syntax}
+	if language.name != "" {
+		metadata["language"] = language.name
+	}
+
+	lines := newCodeLines(content, syntax)
+	var units []codeUnit
+	if syntax == goSyntax {
+		pkg, goUnits, err := goCodeUnits(content, source)
+		if err != nil {
+			log.Printf("Go source %s does not parse, splitting by braces: %v", source, err)
+			metadata["syntax"] = braceSyntax
+		} else {
+			units = goUnits
+			metadata["package"] = pkg
+		}
+	}
+	if units == nil {
+		units = lines.units(0, len(lines.lines), false)
+	}
+
+	var chunks []*models.EnhancedChunk
+	addChunk := func(group []codeUnit, part int) {
+		chunk := newSpanChunk(content, docID, group[0].start, group[len(group)-1].end)
+		if chunk.Text == "" {
+			return
+		}
+		chunk.ChunkType = "code"
+		chunk.ChunkIndex = len(chunks)
+		chunk.Metadata = make(map[string]interface{})
+		for key, value := range metadata {
+			chunk.Metadata[key] = value
+		}
+		for key, value := range mergeCodeMeta(content, group) {
+			chunk.Metadata[key] = value
+		}
+		if part > 0 {
+			chunk.Metadata["part"] = part
+		}
+		chunk.Section, _ = chunk.Metadata["receiver"].(string)
+		chunk.Section = strings.TrimPrefix(chunk.Section, "*")
+		chunk.Subsection, _ = chunk.Metadata["symbol"].(string)
+		if chunk.Section == "" {
+			chunk.Section = chunk.Subsection
+		}
+		if chunk.Section == "" {
+			chunk.Section = "code"
+		}
+		if config.ExtractKeywords {
+			chunk.Keywords = extractKeywords(chunk.Text)
+		}
+		chunks = append(chunks, chunk)
+	}
+
+	var group []codeUnit
+	flush := func() {
+		if len(group) > 0 {
+			addChunk(group, 0)
+			group = nil
+		}
+	}
+	for _, unit := range units {
+		if config.MaxChunkSize > 0 && size.of(content[unit.start:unit.end]) > config.MaxChunkSize {
+			flush()
+			// Too large on its own: split at the blocks nested in it
+			start, end := trimSpan(content, unit.start, unit.end)
+			first, last := lines.lineOf(start), lines.lineOf(end-1)+1
+			parts := lines.pack(content, lines.units(first, last, true), config, size)
+			if len(parts) < 2 {
+				addChunk([]codeUnit{unit}, 0)
+				continue
+			}
+			parts[0].start = unit.start
+			parts[len(parts)-1].end = unit.end
+			for i, part := range parts {
+				part.meta = unit.meta
+				addChunk([]codeUnit{part}, i+1)
+			}
+			continue
+		}
+		if len(group) > 0 {
+			current := size.of(content[group[0].start:group[len(group)-1].end])
+			next := size.of(content[group[0].start:unit.end])
+			if current >= config.MinChunkSize || (config.MaxChunkSize > 0 && next > config.MaxChunkSize) {
+				flush()
+			}
+		}
+		group = append(group, unit)
+	}
+	flush()
+
+	return chunks, nil
+}
+
+// mergeCodeMeta describes the units of a chunk together: their symbols
+// joined, and the receiver and kind they share. Units that were not parsed
+// get the symbol their text declares first.
+func mergeCodeMeta(content string, group []codeUnit) map[string]interface{} {
+	var symbols []string
+	shared := map[string]interface{}{}
+	for i, unit := range group {
+		meta := unit.meta
+		if meta == nil {
+			meta = map[string]interface{}{}
+			if m := codeSymbolPattern.FindStringSubmatch(content[unit.start:unit.end]); m != nil {
+				meta["symbol"] = m[1]
+			}
+		}
+		if symbol, ok := meta["symbol"].(string); ok && symbol != "" && !containsString(symbols, symbol) {
+			symbols = append(symbols, symbol)
+		}
+		for _, key := range []string{"kind", "receiver"} {
+			if i == 0 {
+				if value, ok := meta[key]; ok {
+					shared[key] = value
+				}
+			} else if shared[key] != meta[key] {
+				delete(shared, key)
+			}
+		}
+	}
+	if len(symbols) > 0 {
+		shared["symbol"] = strings.Join(symbols, ", ")
+	}
+	return shared
+}
+
+// goCodeUnits returns the package name of Go source and its declarations as
+// units that cover it in order: the package clause and imports, then every
+// declaration with the comments before it.
+func goCodeUnits(content string, source string) (string, []codeUnit, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, source, content, parser.ParseComments)
+	if err != nil {
+		return "", nil, err
+	}
+	offset := func(pos token.Pos) int {
+		return fset.Position(pos).Offset
+	}
+
+	headerEnd := offset(file.Name.End())
+	decls := file.Decls
+	for len(decls) > 0 {
+		gen, ok := decls[0].(*ast.GenDecl)
+		if !ok || gen.Tok != token.IMPORT {
+			break
+		}
+		headerEnd = offset(gen.End())
+		decls = decls[1:]
+	}
+	units := []codeUnit{{start: 0, end: headerEnd, meta: map[string]interface{}{"kind": "package"}}}
+
+	for _, decl := range decls {
+		meta := map[string]interface{}{}
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			meta["symbol"] = d.Name.Name
+			meta["kind"] = "func"
+			if d.Recv != nil && len(d.Recv.List) > 0 {
+				meta["kind"] = "method"
+				meta["receiver"] = receiverName(d.Recv.List[0].Type)
+			}
+		case *ast.GenDecl:
+			meta["kind"] = d.Tok.String()
+			var names []string
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					names = append(names, s.Name.Name)
+				case *ast.ValueSpec:
+					for _, name := range s.Names {
+						names = append(names, name.Name)
+					}
+				}
+			}
+			meta["symbol"] = strings.Join(names, ", ")
+		}
+		units = append(units, codeUnit{start: units[len(units)-1].end, end: offset(decl.End()), meta: meta})
+	}
+	units[len(units)-1].end = len(content)
+	return file.Name.Name, units, nil
+}
+
+// receiverName returns the type of a method receiver as written, without
+// type parameters: "T" or "*T".
+func receiverName(expr ast.Expr) string {
+	switch e := expr.(type) {
+	case *ast.StarExpr:
+		return "*" + receiverName(e.X)
+	case *ast.IndexExpr:
+		return receiverName(e.X)
+	case *ast.IndexListExpr:
+		return receiverName(e.X)
+	case *ast.ParenExpr:
+		return receiverName(e.X)
+	case *ast.Ident:
+		return e.Name
+	}
+	return ""
+}
+
+// guessCodeSyntax picks brace or indent syntax for source of an unknown
+// language by how its blocks open.
+func guessCodeSyntax(content string) string {
+	braces, colons := 0, 0
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasSuffix(line, "{"):
+			braces++
+		case strings.HasSuffix(line, ":"):
+			colons++
+		}
+	}
+	if colons > braces {
+		return indentSyntax
+	}
+	return braceSyntax
+}
+
+// codeLine is a line of source code with the block level it starts at:
+// brace depth, or indentation width.
+type codeLine struct {
+	start, end int // Byte span without the newline
+	level      int
+	blank      bool
+	closer     bool // Starts with a closing bracket, so it ends the block before it
+}
+
+type codeLines struct {
+	lines []codeLine
+}
+
+// newCodeLines splits content into lines and measures their block level.
+// Brace depth skips braces in strings and comments.
+func newCodeLines(content string, syntax string) *codeLines {
+	var lines []codeLine
+	depth := 0
+	var quote byte // Open string delimiter, 0 outside strings
+	inComment := false
+	for start := 0; start <= len(content); {
+		end := strings.IndexByte(content[start:], '\n')
+		if end < 0 {
+			end = len(content)
+		} else {
+			end += start
+		}
+		text := content[start:end]
+		trimmed := strings.TrimSpace(text)
+		line := codeLine{start: start, end: end, blank: trimmed == ""}
+		if trimmed != "" && strings.ContainsRune(")]}", rune(trimmed[0])) && quote == 0 && !inComment {
+			line.closer = true
+		}
+
+		if syntax == indentSyntax {
+			line.level = len(text) - len(strings.TrimLeft(text, " \t"))
+		} else {
+			line.level = depth
+			for i := 0; i < len(text); i++ {
+				c := text[i]
+				switch {
+				case inComment:
+					if c == '*' && i+1 < len(text) && text[i+1] == '/' {
+						inComment = false
+						i++
+					}
+				case quote != 0:
+					if c == '\\' {
+						i++
+					} else if c == quote {
+						quote = 0
+					}
+				case c == '/' && i+1 < len(text) && text[i+1] == '/':
+					i = len(text)
+				case c == '/' && i+1 < len(text) && text[i+1] == '*':
+					inComment = true
+					i++
+				case c == '"' || c == '\'' || c == '`':
+					quote = c
+				case c == '{':
+					depth++
+				case c == '}':
+					depth = max(depth-1, 0)
+				}
+			}
+			// Only raw strings span lines
+			if quote != '`' {
+				quote = 0
+			}
+		}
+		lines = append(lines, line)
+		start = end + 1
+	}
+	return &codeLines{lines: lines}
+}
+
+// lineOf returns the index of the line holding the byte at pos.
+func (c *codeLines) lineOf(pos int) int {
+	return sort.Search(len(c.lines), func(i int) bool { return c.lines[i].end >= pos })
+}
+
+// units splits lines [first, last) into blocks at their outermost level. A
+// block starts at a line of that level after a blank line or after a deeper
+// line, so comments and decorators directly above a block stay with it. In
+// a nested split the first line, a declaration's header, is not counted when
+// finding the level, so the declaration is split at the blocks in its body.
+func (c *codeLines) units(first, last int, nested bool) []codeUnit {
+	if first >= last {
+		return nil
+	}
+	level := -1
+	from := first
+	if nested {
+		from++
+	}
+	for i := from; i < last; i++ {
+		if line := c.lines[i]; !line.blank && !line.closer && (level < 0 || line.level < level) {
+			level = line.level
+		}
+	}
+
+	var units []codeUnit
+	start := c.lines[first].start
+	previousLevel := -1 // Level of the last non-blank line
+	for i := first; i < last; i++ {
+		line := c.lines[i]
+		if line.blank {
+			continue
+		}
+		boundary := i > first && !line.closer && line.level == level &&
+			(c.lines[i-1].blank || previousLevel > level)
+		if boundary && line.start > start {
+			units = append(units, codeUnit{start: start, end: line.start})
+			start = line.start
+		}
+		previousLevel = line.level
+	}
+	return append(units, codeUnit{start: start, end: c.lines[last-1].end})
+}
+
+// pack groups units into parts up to the minimum chunk size, never beyond
+// the maximum unless a unit alone exceeds it. A short last part joins the
+// one before it when both fit.
+func (c *codeLines) pack(content string, units []codeUnit, config *models.ChunkingConfig, size chunkSizer) []codeUnit {
+	var parts []codeUnit
+	fits := func(start, end int) bool {
+		return config.MaxChunkSize <= 0 || size.of(content[start:end]) <= config.MaxChunkSize
+	}
+	for _, unit := range units {
+		if n := len(parts); n > 0 {
+			last := parts[n-1]
+			if size.of(content[last.start:last.end]) < config.MinChunkSize && fits(last.start, unit.end) {
+				parts[n-1].end = unit.end
+				continue
+			}
+		}
+		parts = append(parts, unit)
+	}
+	if n := len(parts); n > 1 && size.of(content[parts[n-1].start:parts[n-1].end]) < config.MinChunkSize && fits(parts[n-2].start, parts[n-1].end) {
+		parts[n-2].end = parts[n-1].end
+		parts = parts[:n-1]
+	}
+	return parts
+}
@@ -0,0 +1,324 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"rag_system/models"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrInvalidProfile is wrapped by errors about doc type profiles that cannot
+// be applied, so handlers can answer 400.
+var ErrInvalidProfile = errors.New("invalid doc type profile")
+
+// profilesFileName holds the profiles set through the API, inside the vector
+// store directory.
+const profilesFileName = "doc_type_profiles.json"
+
+// maxHeadingLevel is the deepest section level a heading rule may start.
+const maxHeadingLevel = 6
+
+// DocTypeProfile is a validated profile with its heading patterns compiled.
+type DocTypeProfile struct {
+	models.DocTypeProfile
+	headings []headingRule
+}
+
+type headingRule struct {
+	pattern *regexp.Regexp
+	level   int
+}
+
+// heading returns the title and level of line when it is a heading of the
+// profile, with ok false otherwise. Rules are tried in order.
+func (p *DocTypeProfile) heading(line string) (title string, level int, ok bool) {
+	for _, rule := range p.headings {
+		matches := rule.pattern.FindStringSubmatch(line)
+		if matches == nil {
+			continue
+		}
+		title = matches[0]
+		if len(matches) > 1 && matches[1] != "" {
+			title = matches[1]
+		}
+		return strings.TrimSpace(title), rule.level, true
+	}
+	return "", 0, false
+}
+
+// chunkingConfig returns config with what it leaves unset taken from the
+// profile: the strategy, with the profile's options for it, and the sizes,
+// when the request gives them in the same unit or gives none at all.
+func (p *DocTypeProfile) chunkingConfig(config *models.ChunkingConfig) *models.ChunkingConfig {
+	if p == nil || p.Chunking == nil {
+		return config
+	}
+	preferred := p.Chunking
+	if config == nil {
+		merged := *preferred
+		return &merged
+	}
+
+	merged := *config
+	if merged.Strategy == "" {
+		merged.Strategy = preferred.Strategy
+	}
+	if merged.Strategy == preferred.Strategy && len(preferred.Options) > 0 {
+		merged.Options = make(map[string]interface{}, len(preferred.Options)+len(config.Options))
+		for key, value := range preferred.Options {
+			merged.Options[key] = value
+		}
+		for key, value := range config.Options {
+			merged.Options[key] = value
+		}
+	}
+
+	unit := func(u models.SizeUnit) models.SizeUnit {
+		if u == "" {
+			return models.CharUnits
+		}
+		return u
+	}
+	noSizes := true
+	for _, field := range chunkSizeFields(config) {
+		noSizes = noSizes && *field == 0
+	}
+	if config.SizeUnit == "" && noSizes {
+		merged.SizeUnit = preferred.SizeUnit
+	}
+	if unit(merged.SizeUnit) == unit(preferred.SizeUnit) {
+		requested, fallback := chunkSizeFields(&merged), chunkSizeFields(preferred)
+		for i, field := range requested {
+			if *field == 0 {
+				*field = *fallback[i]
+			}
+		}
+	}
+	if merged.SentenceWindowSize == 0 {
+		merged.SentenceWindowSize = preferred.SentenceWindowSize
+	}
+	merged.PreserveParagraphs = merged.PreserveParagraphs || preferred.PreserveParagraphs
+	merged.ExtractKeywords = merged.ExtractKeywords || preferred.ExtractKeywords
+	return &merged
+}
+
+// compileProfile validates a profile and compiles its heading patterns.
+func compileProfile(profile models.DocTypeProfile) (*DocTypeProfile, error) {
+	profile.DocType = normalizeDocType(profile.DocType)
+	if profile.DocType == "" {
+		return nil, fmt.Errorf("%w: doc_type is required", ErrInvalidProfile)
+	}
+
+	// The profile keeps copies, so callers' values cannot change it
+	profile.Headings = append([]models.HeadingRule(nil), profile.Headings...)
+	if profile.Chunking != nil {
+		chunking := *profile.Chunking
+		profile.Chunking = &chunking
+	}
+
+	compiled := &DocTypeProfile{DocTypeProfile: profile}
+	for i, rule := range profile.Headings {
+		if rule.Pattern == "" {
+			return nil, fmt.Errorf("%w: %s: heading %d has no pattern", ErrInvalidProfile, profile.DocType, i)
+		}
+		pattern, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: heading %d: %v", ErrInvalidProfile, profile.DocType, i, err)
+		}
+		level := rule.Level
+		if level == 0 {
+			level = 1
+		}
+		if level < 1 || level > maxHeadingLevel {
+			return nil, fmt.Errorf("%w: %s: heading %d: level must be between 1 and %d", ErrInvalidProfile, profile.DocType, i, maxHeadingLevel)
+		}
+		compiled.Headings[i].Level = level
+		compiled.headings = append(compiled.headings, headingRule{pattern: pattern, level: level})
+	}
+
+	if chunking := profile.Chunking; chunking != nil {
+		switch chunking.SizeUnit {
+		case "", models.CharUnits, models.TokenUnits:
+		default:
+			return nil, fmt.Errorf("%w: %s: unknown size_unit %q", ErrInvalidProfile, profile.DocType, chunking.SizeUnit)
+		}
+		if chunking.Strategy != "" {
+			if _, _, err := chunkerFor(chunking.Strategy, chunking.Options); err != nil {
+				return nil, fmt.Errorf("%w: %s: %v", ErrInvalidProfile, profile.DocType, err)
+			}
+		} else if len(chunking.Options) > 0 {
+			return nil, fmt.Errorf("%w: %s: options need a strategy", ErrInvalidProfile, profile.DocType)
+		}
+	}
+	return compiled, nil
+}
+
+// normalizeDocType makes doc types match regardless of case and padding.
+func normalizeDocType(docType string) string {
+	return strings.ToLower(strings.TrimSpace(docType))
+}
+
+// DocTypeProfiles holds the chunking profiles of document types: those of
+// the config file, and those set through the API, which are persisted and
+// replace a config profile of the same doc type.
+type DocTypeProfiles struct {
+	mu         sync.RWMutex
+	path       string
+	configured map[string]*DocTypeProfile
+	custom     map[string]*DocTypeProfile
+}
+
+// OpenDocTypeProfiles validates the configured profiles and loads those set
+// through the API from dir.
+func OpenDocTypeProfiles(dir string, configured []models.DocTypeProfile) (*DocTypeProfiles, error) {
+	p := &DocTypeProfiles{
+		path:       filepath.Join(dir, profilesFileName),
+		configured: make(map[string]*DocTypeProfile),
+		custom:     make(map[string]*DocTypeProfile),
+	}
+	for _, profile := range configured {
+		profile.Source = "config"
+		compiled, err := compileProfile(profile)
+		if err != nil {
+			return nil, err
+		}
+		p.configured[compiled.DocType] = compiled
+	}
+
+	data, err := os.ReadFile(p.path)
+	if os.IsNotExist(err) {
+		return p, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read doc type profiles: %w", err)
+	}
+	var saved []models.DocTypeProfile
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("failed to decode doc type profiles %s: %w", p.path, err)
+	}
+	for _, profile := range saved {
+		compiled, err := compileProfile(profile)
+		if err != nil {
+			return nil, fmt.Errorf("profile saved in %s: %w", p.path, err)
+		}
+		p.custom[compiled.DocType] = compiled
+	}
+	return p, nil
+}
+
+// Get returns the profile of a doc type, or nil when it has none.
+func (p *DocTypeProfiles) Get(docType string) *DocTypeProfile {
+	if p == nil {
+		return nil
+	}
+	docType = normalizeDocType(docType)
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if profile, ok := p.custom[docType]; ok {
+		return profile
+	}
+	return p.configured[docType]
+}
+
+// List returns the profile in effect for every doc type, sorted by doc type.
+func (p *DocTypeProfiles) List() []models.DocTypeProfile {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	profiles := make([]models.DocTypeProfile, 0, len(p.configured)+len(p.custom))
+	for docType, profile := range p.configured {
+		if _, ok := p.custom[docType]; !ok {
+			profiles = append(profiles, profile.DocTypeProfile)
+		}
+	}
+	for _, profile := range p.custom {
+		profiles = append(profiles, profile.DocTypeProfile)
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].DocType < profiles[j].DocType })
+	return profiles
+}
+
+// Set validates a profile and stores it, replacing any profile of its doc
+// type until deleted.
+func (p *DocTypeProfiles) Set(profile models.DocTypeProfile) (models.DocTypeProfile, error) {
+	profile.Source = "api"
+	compiled, err := compileProfile(profile)
+	if err != nil {
+		return models.DocTypeProfile{}, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	previous, existed := p.custom[compiled.DocType]
+	p.custom[compiled.DocType] = compiled
+	if err := p.saveLocked(); err != nil {
+		if existed {
+			p.custom[compiled.DocType] = previous
+		} else {
+			delete(p.custom, compiled.DocType)
+		}
+		return models.DocTypeProfile{}, err
+	}
+	return compiled.DocTypeProfile, nil
+}
+
+// Delete removes the profile set through the API for a doc type, so a
+// config profile of the same doc type applies again. It reports whether
+// there was one.
+func (p *DocTypeProfiles) Delete(docType string) (bool, error) {
+	docType = normalizeDocType(docType)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	previous, ok := p.custom[docType]
+	if !ok {
+		return false, nil
+	}
+	delete(p.custom, docType)
+	if err := p.saveLocked(); err != nil {
+		p.custom[docType] = previous
+		return false, err
+	}
+	return true, nil
+}
+
+// saveLocked writes the API profiles atomically: temp file, then rename.
+func (p *DocTypeProfiles) saveLocked() error {
+	profiles := make([]models.DocTypeProfile, 0, len(p.custom))
+	for _, profile := range p.custom {
+		profiles = append(profiles, profile.DocTypeProfile)
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].DocType < profiles[j].DocType })
+
+	data, err := json.MarshalIndent(profiles, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode doc type profiles: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(p.path), 0o755); err != nil {
+		return fmt.Errorf("failed to save doc type profiles: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(p.path), profilesFileName+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to save doc type profiles: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to save doc type profiles: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to save doc type profiles: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), p.path); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to save doc type profiles: %w", err)
+	}
+	return nil
+}
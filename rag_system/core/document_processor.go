@@ -5,10 +5,13 @@ import (
 	"log"
 	"math"
 	"rag_system/models"
+	"rag_system/tokenizer"
 	"regexp"
 	"sort"
 	"strings"
+	"time"
 	"unicode"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
 )
@@ -21,10 +24,10 @@ const (
 	overlapRatio           = 0.15 // 15% overlap
 
 	// Document size categories
-	verySmallDoc = 1000000  // < 1KB - keep as single chunk or minimal splits
-	smallDoc     = 3000000  // < 3KB - conservative chunking
-	mediumDoc    = 10000000 // < 10KB - normal chunking
-	largeDoc     = 50000000 // < 50KB - aggressive chunking
+	verySmallDoc = 1000  // < 1KB - keep as single chunk or minimal splits
+	smallDoc     = 3000  // < 3KB - conservative chunking
+	mediumDoc    = 10000 // < 10KB - normal chunking
+	largeDoc     = 50000 // < 50KB - aggressive chunking
 
 	// Minimum chunks before splitting
 	minChunksThreshold = 3
@@ -65,6 +68,9 @@ type DocumentSection struct {
 	Content   string
 	StartLine int
 	EndLine   int
+	StartPos  int // Byte offset of Content in the document
+
+	Subsection string // Titles of the nested headings the section is under, from a doc type profile
 }
 
 // NewDocumentProcessor creates a new document processor
@@ -73,7 +79,14 @@ func NewDocumentProcessor() *DocumentProcessor {
 	return &DocumentProcessor{}
 }
 
-func analyzeStructure(content string) (DocumentStructureType, bool) {
+func analyzeStructure(content string, profile *DocTypeProfile) (DocumentStructureType, bool) {
+	if profile != nil && len(profile.headings) > 0 {
+		return analyzeProfileStructure(content, profile)
+	}
+	if headings := parseMarkdownHeadings(content); len(headings) >= minMarkdownHeadings {
+		return analyzeMarkdownStructure(content, headings)
+	}
+
 	// Check for hierarchical patterns (multiple heading levels)
 	hierarchicalPatterns := []string{
 		`(?m)^#+\s+`,            // Markdown headers
@@ -115,6 +128,45 @@ func analyzeStructure(content string) (DocumentStructureType, bool) {
 	return NoStructure, false
 }
 
+// analyzeProfileStructure classifies the structure of a document by the
+// headings of its doc type profile.
+func analyzeProfileStructure(content string, profile *DocTypeProfile) (DocumentStructureType, bool) {
+	headings := 0
+	levels := map[int]bool{}
+	for _, line := range strings.Split(content, "\n") {
+		if _, level, ok := profile.heading(strings.TrimSpace(line)); ok {
+			headings++
+			levels[level] = true
+		}
+	}
+
+	return headingStructure(content, headings, len(levels))
+}
+
+// analyzeMarkdownStructure classifies the structure of a Markdown document
+// by its heading tree.
+func analyzeMarkdownStructure(content string, headings map[int]markdownHeading) (DocumentStructureType, bool) {
+	levels := map[int]bool{}
+	for _, heading := range headings {
+		levels[heading.level] = true
+	}
+	return headingStructure(content, len(headings), len(levels))
+}
+
+// headingStructure classifies a document with headings: hierarchical when
+// they nest, sectioned when there are several.
+func headingStructure(content string, headings, levels int) (DocumentStructureType, bool) {
+	switch {
+	case levels >= 2 && headings >= 3:
+		return HierarchicalStructure, true
+	case headings >= 2:
+		return SectionedStructure, true
+	case strings.Count(content, "\n\n") >= 3:
+		return SimpleStructure, true
+	}
+	return NoStructure, false
+}
+
 func calculateComplexity(content string) float64 {
 	words := strings.Fields(content)
 
@@ -148,7 +200,7 @@ func calculateOptimalChunkCount(length int) int {
 	}
 }
 
-func analyzeDocument(content string) DocumentCharacteristics {
+func analyzeDocument(content string, profile *DocTypeProfile) DocumentCharacteristics {
 	length := len(content)
 	var category DocumentCategory
 
@@ -165,7 +217,7 @@ func analyzeDocument(content string) DocumentCharacteristics {
 		category = VeryLargeDocument
 	}
 
-	structureType, hasStructure := analyzeStructure(content)
+	structureType, hasStructure := analyzeStructure(content, profile)
 
 	complexity := calculateComplexity(content)
 
@@ -289,27 +341,70 @@ func adaptiveChunkingStrategy(characteristics DocumentCharacteristics, config *m
 	adaptiveConfig.PreserveParagraphs = true
 	adaptiveConfig.ExtractKeywords = true
 
+	// A strategy the config names is kept; only the sizes are adapted
+	if config.Strategy != "" {
+		adaptiveConfig.Strategy = config.Strategy
+	}
+
 	return &adaptiveConfig
 }
 
-func ProcessDocumentContent(content string, source string, docType string, config *models.ChunkingConfig) (*models.Document, error) {
+// ChunkingEnv provides chunkers with what they need beyond the text and its
+// config.
+type ChunkingEnv struct {
+	Tokenizer tokenizer.Tokenizer                       // Counts chunk sizes given in tokens
+	Embed     func(texts []string) ([][]float32, error) // Embeds sentences for the semantic strategy; nil groups paragraphs instead
+	Profile   *DocTypeProfile                           // Profile of the document's doc_type, nil when it has none
+}
+
+// ProcessDocumentContent chunks a document with the registered chunker of
+// the config's strategy, or of the one picked for the document when the
+// config names none. Chunk sizes are in bytes, or in tokens counted by
+// env.Tokenizer when config asks for them. What config leaves unset comes
+// from env.Profile, whose headings also replace the built-in ones. pages is
+// the page count of a paged document, such as an extracted PDF, and 0 for
+// one without pages; chunks of paged documents record their pages.
+func ProcessDocumentContent(content string, source string, docType string, pages int, config *models.ChunkingConfig, env ChunkingEnv) (*models.Document, error) {
 	if content == "" {
 		return nil, fmt.Errorf("Content cannot be empty")
 	}
+	config = env.Profile.chunkingConfig(config)
+
 	// Analyze document characteristics
-	characteristics := analyzeDocument(content)
+	characteristics := analyzeDocument(content, env.Profile)
 
 	// Override config with adaptive strategy if needed
-	adaptiveConfig := adaptiveChunkingStrategy(characteristics, config)
+	var adaptiveConfig *models.ChunkingConfig
+	var size chunkSizer
+	switch {
+	case config == nil || config.SizeUnit == "" || config.SizeUnit == models.CharUnits:
+		adaptiveConfig = adaptiveChunkingStrategy(characteristics, config)
+	case config.SizeUnit == models.TokenUnits:
+		adaptiveConfig = adaptiveTokenChunkingStrategy(characteristics, config, env.Tokenizer.Count(content))
+		size.tok = env.Tokenizer
+	default:
+		return nil, fmt.Errorf("%w: unknown size_unit %q (expected %q or %q)", ErrInvalidChunkingConfig, config.SizeUnit, models.CharUnits, models.TokenUnits)
+	}
+	if config != nil && config.Strategy == "" && len(config.Options) > 0 {
+		return nil, fmt.Errorf("%w: options need a strategy", ErrInvalidChunkingConfig)
+	}
+	if (config == nil || config.Strategy == "") && isCodeSource(source) {
+		adaptiveConfig.Strategy = models.CodeStrategy
+	}
+	chunker, options, err := chunkerFor(adaptiveConfig.Strategy, adaptiveConfig.Options)
+	if err != nil {
+		return nil, err
+	}
 
 	log.Printf("Document analysis: %d chars, category: %s, structure: %s, strategy: %s",
 		characteristics.Length, characteristics.Category, characteristics.StructureType, adaptiveConfig.Strategy)
 
 	doc := &models.Document{
-		ID:      uuid.New().String(),
-		Content: content,
-		Source:  source,
-		DocType: docType,
+		ID:        uuid.New().String(),
+		Content:   content,
+		Source:    source,
+		DocType:   docType,
+		CreatedAt: time.Now().UTC(),
 		Metadata: map[string]interface{}{
 			"chunking_strategy": string(adaptiveConfig.Strategy),
 			"document_length":   characteristics.Length,
@@ -318,32 +413,47 @@ func ProcessDocumentContent(content string, source string, docType string, confi
 			"chunk_count":       0, // Will be updated after chunking
 		},
 	}
-
-	var chunks []*models.EnhancedChunk
-	var err error
-
-	// Apply the determined strategy
-	switch adaptiveConfig.Strategy {
-	case models.FixedSizeStrategy:
-		chunks, err = createFixedSizeChunks(content, doc.ID, adaptiveConfig)
-	case models.StructuralStrategy:
-		chunks, err = createIntelligentStructuralChunks(content, doc.ID, adaptiveConfig, characteristics)
-	case models.SemanticStrategy:
-		chunks, err = createSemanticChunks(content, doc.ID, adaptiveConfig)
-	case models.SentenceWindowStrategy:
-		chunks, err = createSentenceWindowChunks(content, doc.ID, adaptiveConfig)
-	case models.ParentDocumentStrategy:
-		chunks, err = createParentDocumentChunks(content, doc.ID, adaptiveConfig)
-	default:
-		chunks, err = createIntelligentStructuralChunks(content, doc.ID, adaptiveConfig, characteristics)
+	if size.tok != nil {
+		doc.Metadata["size_unit"] = string(models.TokenUnits)
+		doc.Metadata["tokenizer"] = env.Tokenizer.Name()
+	}
+	if env.Profile != nil {
+		doc.Metadata["doc_type_profile"] = env.Profile.DocType
 	}
 
+	// Apply the determined strategy
+	chunks, err := chunker.Chunker.Chunk(&ChunkRequest{
+		Content:         content,
+		DocumentID:      doc.ID,
+		Source:          source,
+		DocType:         docType,
+		Config:          adaptiveConfig,
+		Characteristics: characteristics,
+		Options:         options,
+		Env:             env,
+		size:            size,
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create chunks: %w", err)
 	}
 
+	// Tables are chunked by rows under their header, whatever the strategy
+	if adaptiveConfig.Strategy != models.CodeStrategy && len(chunks) > 0 {
+		if tables := detectTables(content); len(tables) > 0 {
+			chunks = spliceTableChunks(content, chunks, tables, adaptiveConfig, size, detectSections(content, env.Profile))
+			doc.Metadata["table_count"] = len(tables)
+		}
+	}
+
 	// Post-process chunks for quality
-	chunks = postProcessChunks(chunks, characteristics)
+	chunks = postProcessChunks(content, chunks, characteristics)
+	if err := VerifyChunkOffsets(content, chunks); err != nil {
+		return nil, fmt.Errorf("chunk offsets do not match the content: %w", err)
+	}
+
+	if pages > 0 {
+		doc.Metadata["page_count"] = annotatePages(content, chunks)
+	}
 
 	doc.Chunks = chunks
 	doc.Metadata["chunk_count"] = len(chunks)
@@ -352,47 +462,120 @@ func ProcessDocumentContent(content string, source string, docType string, confi
 	return doc, nil
 }
 
+// adaptiveTokenChunkingStrategy is adaptiveChunkingStrategy for sizes given
+// in tokens. The adaptive thresholds are in bytes, so requested sizes are
+// converted at the document's own bytes per token, adapted, and converted
+// back; sizes the adaptation keeps are returned exactly as requested.
+func adaptiveTokenChunkingStrategy(characteristics DocumentCharacteristics, config *models.ChunkingConfig, tokens int) *models.ChunkingConfig {
+	bytesPerToken := float64(characteristics.Length) / math.Max(float64(tokens), 1)
+
+	byteConfig := *config
+	for _, field := range chunkSizeFields(&byteConfig) {
+		*field = int(math.Round(float64(*field) * bytesPerToken))
+	}
+
+	adaptiveConfig := adaptiveChunkingStrategy(characteristics, &byteConfig)
+
+	requested, converted := chunkSizeFields(config), chunkSizeFields(&byteConfig)
+	for i, field := range chunkSizeFields(adaptiveConfig) {
+		switch {
+		case *field == *converted[i]:
+			*field = *requested[i]
+		case *field > 0:
+			*field = int(math.Max(math.Round(float64(*field)/bytesPerToken), 1))
+		}
+	}
+
+	log.Printf("Chunk sizes in tokens (%.1f bytes per token): fixed=%d, overlap=%d, min=%d, max=%d",
+		bytesPerToken, adaptiveConfig.FixedSize, adaptiveConfig.Overlap, adaptiveConfig.MinChunkSize, adaptiveConfig.MaxChunkSize)
+	return adaptiveConfig
+}
+
+// chunkSizeFields returns the sizes of config that are given in its unit.
+func chunkSizeFields(config *models.ChunkingConfig) []*int {
+	return []*int{&config.FixedSize, &config.Overlap, &config.MinChunkSize, &config.MaxChunkSize}
+}
+
+// chunkSizer measures text in the unit of the chunk sizes: bytes, or tokens
+// when tok is set.
+type chunkSizer struct {
+	tok tokenizer.Tokenizer
+}
+
+func (s chunkSizer) of(text string) int {
+	if s.tok == nil {
+		return len(text)
+	}
+	return s.tok.Count(text)
+}
+
+// prefix returns the length in bytes of the longest prefix of text that is
+// at most n long and ends on a character, but at least one character so that
+// callers make progress.
+func (s chunkSizer) prefix(text string, n int) int {
+	var end int
+	if s.tok == nil {
+		end = max(min(n, len(text)), 0)
+		for end > 0 && end < len(text) && !utf8.RuneStart(text[end]) {
+			end--
+		}
+	} else {
+		end = tokenizer.Prefix(s.tok, text, n)
+	}
+	if end == 0 && text != "" {
+		_, end = utf8.DecodeRuneInString(text)
+	}
+	return end
+}
+
+// suffix returns the length in bytes of the longest suffix of text that is
+// at most n long and starts on a character.
+func (s chunkSizer) suffix(text string, n int) int {
+	if s.tok == nil {
+		start := len(text) - max(min(n, len(text)), 0)
+		for start < len(text) && !utf8.RuneStart(text[start]) {
+			start++
+		}
+		return len(text) - start
+	}
+	return tokenizer.Suffix(s.tok, text, n)
+}
+
 // createIntelligentStructuralChunks creates context-aware structural chunks
-func createIntelligentStructuralChunks(content string, docID string, config *models.ChunkingConfig, characteristics DocumentCharacteristics) ([]*models.EnhancedChunk, error) {
+func createIntelligentStructuralChunks(content string, docID string, config *models.ChunkingConfig, characteristics DocumentCharacteristics, size chunkSizer, profile *DocTypeProfile) ([]*models.EnhancedChunk, error) {
 	var chunks []*models.EnhancedChunk
 
 	// For very small documents, prefer minimal chunking
 	if characteristics.Category == VerySmallDocument {
-		return createMinimalChunks(content, docID, config)
+		return createMinimalChunks(content, docID, config, size)
 	}
 
 	// Detect sections and create meaningful chunks
-	sections := detectSections(content)
+	sections := detectSections(content, profile)
 
 	chunkIndex := 0
 	for _, section := range sections {
-		sectionChunks := createSectionChunks(section, docID, config, &chunkIndex)
+		sectionChunks := createSectionChunks(section, docID, config, &chunkIndex, size)
 		chunks = append(chunks, sectionChunks...)
 	}
 
 	// If no meaningful sections found, fall back to sentence-based chunking
 	if len(chunks) == 0 {
-		return createSentenceWindowChunks(content, docID, config)
+		return createSentenceWindowChunks(content, docID, config, size)
 	}
 
 	return chunks, nil
 }
 
 // createMinimalChunks for very small documents
-func createMinimalChunks(content string, docID string, config *models.ChunkingConfig) ([]*models.EnhancedChunk, error) {
+func createMinimalChunks(content string, docID string, config *models.ChunkingConfig, size chunkSizer) ([]*models.EnhancedChunk, error) {
 	// For very small content, create just 1-2 meaningful chunks
-	if len(content) <= config.MinChunkSize {
+	if size.of(content) <= config.MinChunkSize {
 		// Single chunk
-		chunk := &models.EnhancedChunk{
-			ID:         uuid.New().String(),
-			DocumentID: docID,
-			Text:       strings.TrimSpace(content),
-			ChunkType:  "document",
-			Section:    "complete",
-			StartPos:   0,
-			EndPos:     len(content),
-			ChunkIndex: 0,
-		}
+		chunk := newSpanChunk(content, docID, 0, len(content))
+		chunk.ChunkType = "document"
+		chunk.Section = "complete"
+		chunk.ChunkIndex = 0
 
 		if config.ExtractKeywords {
 			chunk.Keywords = extractKeywords(chunk.Text)
@@ -402,36 +585,23 @@ func createMinimalChunks(content string, docID string, config *models.ChunkingCo
 	}
 
 	// Split into 2-3 meaningful parts based on paragraphs or sentences
-	paragraphs := strings.Split(content, "\n\n")
+	paragraphs := splitParagraphSpans(content, 0, len(content))
 	if len(paragraphs) < 2 {
 		// Fall back to sentence splitting
-		return createSentenceWindowChunks(content, docID, config)
+		return createSentenceWindowChunks(content, docID, config, size)
 	}
 
 	// Group paragraphs into meaningful chunks
 	var chunks []*models.EnhancedChunk
-	currentChunk := ""
 	chunkIndex := 0
-	startPos := 0
+	groupStart := paragraphs[0].start
 
 	for i, para := range paragraphs {
-		testChunk := currentChunk
-		if testChunk != "" {
-			testChunk += "\n\n"
-		}
-		testChunk += para
-
-		if len(testChunk) >= config.MinChunkSize || i == len(paragraphs)-1 {
-			chunk := &models.EnhancedChunk{
-				ID:         uuid.New().String(),
-				DocumentID: docID,
-				Text:       strings.TrimSpace(testChunk),
-				ChunkType:  "paragraph_group",
-				Section:    fmt.Sprintf("section_%d", chunkIndex+1),
-				StartPos:   startPos,
-				EndPos:     startPos + len(testChunk),
-				ChunkIndex: chunkIndex,
-			}
+		if size.of(content[groupStart:para.end]) >= config.MinChunkSize || i == len(paragraphs)-1 {
+			chunk := newSpanChunk(content, docID, groupStart, para.end)
+			chunk.ChunkType = "paragraph_group"
+			chunk.Section = fmt.Sprintf("section_%d", chunkIndex+1)
+			chunk.ChunkIndex = chunkIndex
 
 			if config.ExtractKeywords {
 				chunk.Keywords = extractKeywords(chunk.Text)
@@ -439,10 +609,9 @@ func createMinimalChunks(content string, docID string, config *models.ChunkingCo
 
 			chunks = append(chunks, chunk)
 			chunkIndex++
-			startPos += len(testChunk) + 2 // +2 for \n\n
-			currentChunk = ""
-		} else {
-			currentChunk = testChunk
+			if i+1 < len(paragraphs) {
+				groupStart = paragraphs[i+1].start
+			}
 		}
 	}
 
@@ -450,48 +619,68 @@ func createMinimalChunks(content string, docID string, config *models.ChunkingCo
 }
 
 // postProcessChunks ensures chunk quality and adds relationships
-func postProcessChunks(chunks []*models.EnhancedChunk, characteristics DocumentCharacteristics) []*models.EnhancedChunk {
+func postProcessChunks(content string, chunks []*models.EnhancedChunk, characteristics DocumentCharacteristics) []*models.EnhancedChunk {
 	// Remove too-small chunks by merging with neighbors
 	filteredChunks := []*models.EnhancedChunk{}
 
 	for i, chunk := range chunks {
 		if len(chunk.Text) < minMeaningfulChunkSize/2 && i < len(chunks)-1 {
-			// Merge with next chunk
 			nextChunk := chunks[i+1]
-			nextChunk.Text = chunk.Text + "\n\n" + nextChunk.Text
-			nextChunk.StartPos = chunk.StartPos
-			if len(chunk.Keywords) > 0 {
-				nextChunk.Keywords = append(nextChunk.Keywords, chunk.Keywords...)
+			// Merge with next chunk if it continues the text; table rows stay on their own
+			if chunk.ChunkType != "table" && nextChunk.ChunkType != "table" &&
+				nextChunk.StartPos >= chunk.StartPos &&
+				(nextChunk.StartPos <= chunk.EndPos || strings.TrimSpace(content[chunk.EndPos:nextChunk.StartPos]) == "") {
+				nextChunk.StartPos = chunk.StartPos
+				nextChunk.EndPos = max(nextChunk.EndPos, chunk.EndPos)
+				nextChunk.Text = content[nextChunk.StartPos:nextChunk.EndPos]
+				if len(chunk.Keywords) > 0 {
+					nextChunk.Keywords = append(nextChunk.Keywords, chunk.Keywords...)
+				}
+				// Skip current chunk
+				continue
 			}
-			// Skip current chunk
-			continue
 		}
 		filteredChunks = append(filteredChunks, chunk)
 	}
 
 	// Add parent-child relationships for larger documents
 	if characteristics.Category == LargeDocument || characteristics.Category == VeryLargeDocument {
-		filteredChunks = addParentChildRelationships(filteredChunks)
+		filteredChunks = addParentChildRelationships(content, filteredChunks)
 	}
 
 	return filteredChunks
 }
 
-// Enhanced detectSections function
-func detectSections(content string) []DocumentSection {
+// detectSections splits content at heading lines: those of the doc type
+// profile when it has any, then those of Markdown, otherwise the built-in
+// patterns. Headings below level 1 start subsections of the section they
+// are in.
+func detectSections(content string, profile *DocTypeProfile) []DocumentSection {
 	var sections []DocumentSection
 
+	var markdown map[int]markdownHeading
+	if profile == nil || len(profile.headings) == 0 {
+		if headings := parseMarkdownHeadings(content); len(headings) >= minMarkdownHeadings {
+			markdown = headings
+		}
+	}
+
 	// Enhanced section detection patterns
 	sectionPatterns := []*regexp.Regexp{
 		regexp.MustCompile(`(?i)^([A-Z][A-Z\s]{2,}):?\s*$`), // ALL CAPS sections
 		regexp.MustCompile(`(?i)^(EXPERIENCE|EDUCATION|SKILLS|SUMMARY|OBJECTIVE|PROJECTS|ACHIEVEMENTS|AWARDS|CERTIFICATIONS|LANGUAGES|REFERENCES|CONTACT|ABOUT).*$`), // Common resume sections
-		regexp.MustCompile(`(?m)^#+\s+(.+)$`),       // Markdown headers
+		regexp.MustCompile(`(?m)^#+\s+(.+)$`),       // A Markdown header of a document with too few to read its tree
 		regexp.MustCompile(`(?m)^(\d+\.\s+.+)$`),    // Numbered sections
 		regexp.MustCompile(`(?m)^([IVX]+\.\s+.+)$`), // Roman numeral sections
 	}
 
 	lines := strings.Split(content, "\n")
+	lineStarts := make([]int, len(lines))
+	for i := 1; i < len(lines); i++ {
+		lineStarts[i] = lineStarts[i-1] + len(lines[i-1]) + 1
+	}
 	currentSection := DocumentSection{Title: "document", StartLine: 0}
+	var titles []string // Open heading titles by level
 
 	for i, line := range lines {
 		line = strings.TrimSpace(line)
@@ -499,15 +688,45 @@ func detectSections(content string) []DocumentSection {
 			continue
 		}
 
-		isSection := false
-		var sectionTitle string
+		var title string
+		level := 0
+		switch {
+		case profile != nil && len(profile.headings) > 0:
+			if t, l, ok := profile.heading(line); ok {
+				title, level = t, l
+			}
+		case markdown != nil:
+			if heading, ok := markdown[i]; ok {
+				title, level = heading.title, heading.level
+			}
+		default:
+			for _, pattern := range sectionPatterns {
+				if matches := pattern.FindStringSubmatch(line); len(matches) > 1 {
+					title, level = matches[1], 1
+					break
+				}
+			}
+		}
+
+		isSection := level > 0
+		var sectionTitle, subsection string
+		if isSection {
+			for len(titles) < level {
+				titles = append(titles, "")
+			}
+			titles = append(titles[:level-1], title)
 
-		for _, pattern := range sectionPatterns {
-			if matches := pattern.FindStringSubmatch(line); len(matches) > 1 {
-				isSection = true
-				sectionTitle = matches[1]
-				break
+			sectionTitle = titles[0]
+			if sectionTitle == "" {
+				sectionTitle = "document"
+			}
+			var nested []string
+			for _, t := range titles[1:] {
+				if t != "" {
+					nested = append(nested, t)
+				}
 			}
+			subsection = strings.Join(nested, " > ")
 		}
 
 		if isSection {
@@ -522,8 +741,10 @@ func detectSections(content string) []DocumentSection {
 
 			// Start new section
 			currentSection = DocumentSection{
-				Title:     sectionTitle,
-				StartLine: i,
+				Title:      sectionTitle,
+				StartLine:  i,
+				StartPos:   lineStarts[i],
+				Subsection: subsection,
 			}
 		}
 	}
@@ -551,73 +772,53 @@ func detectSections(content string) []DocumentSection {
 }
 
 // createSectionChunks creates chunks from a document section
-func createSectionChunks(section DocumentSection, docID string, config *models.ChunkingConfig, chunkIndex *int) []*models.EnhancedChunk {
+func createSectionChunks(section DocumentSection, docID string, config *models.ChunkingConfig, chunkIndex *int, size chunkSizer) []*models.EnhancedChunk {
 	var chunks []*models.EnhancedChunk
 
-	content := strings.TrimSpace(section.Content)
-	if content == "" {
+	content := section.Content
+	start, end := trimSpan(content, 0, len(content))
+	if start == end {
 		return chunks
 	}
 
-	// If section is small enough, keep as single chunk
-	if len(content) <= config.MaxChunkSize {
-		chunk := &models.EnhancedChunk{
-			ID:         uuid.New().String(),
-			DocumentID: docID,
-			Text:       content,
-			Section:    section.Title,
-			ChunkType:  "section",
-			StartPos:   0,
-			EndPos:     len(content),
-			ChunkIndex: *chunkIndex,
-		}
+	// Chunks are cut from the section, positioned in the document
+	newChunk := func(start, end int, chunkType string) *models.EnhancedChunk {
+		chunk := newSpanChunk(content, docID, start, end)
+		chunk.StartPos += section.StartPos
+		chunk.EndPos += section.StartPos
+		chunk.Section = section.Title
+		chunk.Subsection = section.Subsection
+		chunk.ChunkType = chunkType
+		chunk.ChunkIndex = *chunkIndex
 
 		if config.ExtractKeywords {
-			chunk.Keywords = extractKeywords(content)
+			chunk.Keywords = extractKeywords(chunk.Text)
 		}
+		return chunk
+	}
 
-		chunks = append(chunks, chunk)
+	// If section is small enough, keep as single chunk
+	if size.of(content[start:end]) <= config.MaxChunkSize {
+		chunks = append(chunks, newChunk(start, end, "section"))
 		*chunkIndex++
 		return chunks
 	}
 
 	// Split large sections into meaningful chunks
-	paragraphs := strings.Split(content, "\n\n")
-	currentChunk := ""
-	startPos := 0
+	paragraphs := splitParagraphSpans(content, start, end)
+	groupStart := paragraphs[0].start
 
 	for i, para := range paragraphs {
-		testChunk := currentChunk
-		if testChunk != "" {
-			testChunk += "\n\n"
-		}
-		testChunk += para
-
-		shouldChunk := len(testChunk) >= config.MinChunkSize &&
-			(len(testChunk) >= config.MaxChunkSize || i == len(paragraphs)-1)
+		testSize := size.of(content[groupStart:para.end])
+		shouldChunk := testSize >= config.MinChunkSize &&
+			(testSize >= config.MaxChunkSize || i == len(paragraphs)-1)
 
 		if shouldChunk {
-			chunk := &models.EnhancedChunk{
-				ID:         uuid.New().String(),
-				DocumentID: docID,
-				Text:       strings.TrimSpace(testChunk),
-				Section:    section.Title,
-				ChunkType:  "section_part",
-				StartPos:   startPos,
-				EndPos:     startPos + len(testChunk),
-				ChunkIndex: *chunkIndex,
-			}
-
-			if config.ExtractKeywords {
-				chunk.Keywords = extractKeywords(testChunk)
-			}
-
-			chunks = append(chunks, chunk)
+			chunks = append(chunks, newChunk(groupStart, para.end, "section_part"))
 			*chunkIndex++
-			startPos += len(testChunk) + 2
-			currentChunk = ""
-		} else {
-			currentChunk = testChunk
+			if i+1 < len(paragraphs) {
+				groupStart = paragraphs[i+1].start
+			}
 		}
 	}
 
@@ -625,10 +826,10 @@ func createSectionChunks(section DocumentSection, docID string, config *models.C
 }
 
 // Keep all existing helper functions but enhance them...
-// (createFixedSizeChunks, createSemanticChunks, etc. - existing implementations)
+// (createFixedSizeChunks, createSentenceWindowChunks, etc. - existing implementations)
 
 // addParentChildRelationships creates hierarchical chunk relationships
-func addParentChildRelationships(chunks []*models.EnhancedChunk) []*models.EnhancedChunk {
+func addParentChildRelationships(content string, chunks []*models.EnhancedChunk) []*models.EnhancedChunk {
 	// Group chunks by section
 	sectionGroups := make(map[string][]*models.EnhancedChunk)
 
@@ -644,27 +845,21 @@ func addParentChildRelationships(chunks []*models.EnhancedChunk) []*models.Enhan
 
 	for section, sectionChunks := range sectionGroups {
 		if len(sectionChunks) > 2 {
-			// Create parent chunk for section
-			combinedText := ""
+			// Create parent chunk spanning the section's chunks
+			start, end := sectionChunks[0].StartPos, sectionChunks[0].EndPos
 			var childIDs []string
 
-			for i, chunk := range sectionChunks {
-				if i > 0 {
-					combinedText += "\n\n"
-				}
-				combinedText += chunk.Text
+			for _, chunk := range sectionChunks {
+				start = min(start, chunk.StartPos)
+				end = max(end, chunk.EndPos)
 				childIDs = append(childIDs, chunk.ID)
 			}
 
-			parentChunk := &models.EnhancedChunk{
-				ID:            uuid.New().String(),
-				DocumentID:    sectionChunks[0].DocumentID,
-				Text:          combinedText,
-				Section:       section,
-				ChunkType:     "parent",
-				ChildChunkIDs: childIDs,
-				ChunkIndex:    sectionChunks[0].ChunkIndex,
-			}
+			parentChunk := newSpanChunk(content, sectionChunks[0].DocumentID, start, end)
+			parentChunk.Section = section
+			parentChunk.ChunkType = "parent"
+			parentChunk.ChildChunkIDs = childIDs
+			parentChunk.ChunkIndex = sectionChunks[0].ChunkIndex
 
 			enhancedChunks = append(enhancedChunks, parentChunk)
 
@@ -746,21 +941,15 @@ func extractKeywords(text string) []string {
 // These would be implemented with similar intelligence and quality controls
 
 // createFixedSizeChunks creates chunks of fixed size with intelligent overlaps
-func createFixedSizeChunks(content string, docID string, config *models.ChunkingConfig) ([]*models.EnhancedChunk, error) {
+func createFixedSizeChunks(content string, docID string, config *models.ChunkingConfig, size chunkSizer) ([]*models.EnhancedChunk, error) {
 	var chunks []*models.EnhancedChunk
 
-	if len(content) <= config.FixedSize {
+	if size.of(content) <= config.FixedSize {
 		// Single chunk
-		chunk := &models.EnhancedChunk{
-			ID:         uuid.New().String(),
-			DocumentID: docID,
-			Text:       strings.TrimSpace(content),
-			ChunkType:  "fixed_size",
-			Section:    "document",
-			StartPos:   0,
-			EndPos:     len(content),
-			ChunkIndex: 0,
-		}
+		chunk := newSpanChunk(content, docID, 0, len(content))
+		chunk.ChunkType = "fixed_size"
+		chunk.Section = "document"
+		chunk.ChunkIndex = 0
 
 		if config.ExtractKeywords {
 			chunk.Keywords = extractKeywords(chunk.Text)
@@ -774,100 +963,83 @@ func createFixedSizeChunks(content string, docID string, config *models.Chunking
 	chunkIndex := 0
 
 	for start < len(content) {
-		end := start + config.FixedSize
-		if end > len(content) {
-			end = len(content)
-		}
+		end := start + size.prefix(content[start:], config.FixedSize)
 
 		// Try to end at word boundary
-		if end < len(content) && !unicode.IsSpace(rune(content[end])) {
+		if r, _ := utf8.DecodeRuneInString(content[end:]); end < len(content) && !unicode.IsSpace(r) {
 			// Find last space within reasonable distance
-			for i := end; i > start+config.FixedSize-50 && i > start; i-- {
-				if unicode.IsSpace(rune(content[i])) {
+			for i := end - 1; i > end-50 && i > start; i-- {
+				if r, _ := utf8.DecodeRuneInString(content[i:]); unicode.IsSpace(r) {
 					end = i
 					break
 				}
 			}
 		}
 
-		chunkText := strings.TrimSpace(content[start:end])
-		if len(chunkText) > 0 {
-			chunk := &models.EnhancedChunk{
-				ID:         uuid.New().String(),
-				DocumentID: docID,
-				Text:       chunkText,
-				ChunkType:  "fixed_size",
-				Section:    "document",
-				StartPos:   start,
-				EndPos:     end,
-				ChunkIndex: chunkIndex,
-			}
+		chunk := newSpanChunk(content, docID, start, end)
+		if chunk.Text != "" {
+			chunk.ChunkType = "fixed_size"
+			chunk.Section = "document"
+			chunk.ChunkIndex = chunkIndex
 
 			if config.ExtractKeywords {
-				chunk.Keywords = extractKeywords(chunkText)
+				chunk.Keywords = extractKeywords(chunk.Text)
 			}
 
 			chunks = append(chunks, chunk)
 			chunkIndex++
 		}
 
-		// Move start position with overlap
-		start = end - config.Overlap
-		if start >= end {
+		if end >= len(content) {
 			break
 		}
+
+		// Move start position with overlap, always making progress
+		next := end - size.suffix(content[start:end], config.Overlap)
+		if next <= start {
+			next = end
+		}
+		start = next
 	}
 
 	return chunks, nil
 }
 
-// createSemanticChunks creates chunks based on semantic boundaries
-func createSemanticChunks(content string, docID string, config *models.ChunkingConfig) ([]*models.EnhancedChunk, error) {
-	// For now, fall back to paragraph-based chunking with semantic awareness
-	paragraphs := strings.Split(content, "\n\n")
+// groupParagraphChunks groups paragraphs up to the maximum chunk size. It
+// stands in for semantic chunking when sentences cannot be embedded.
+func groupParagraphChunks(content string, docID string, config *models.ChunkingConfig, size chunkSizer) ([]*models.EnhancedChunk, error) {
+	paragraphs := splitParagraphSpans(content, 0, len(content))
 	var chunks []*models.EnhancedChunk
 
-	currentChunk := ""
 	chunkIndex := 0
-	startPos := 0
+	groupStart := -1
 
 	for i, para := range paragraphs {
-		para = strings.TrimSpace(para)
-		if para == "" {
+		start, end := trimSpan(content, para.start, para.end)
+		if start == end {
 			continue
 		}
-
-		testChunk := currentChunk
-		if testChunk != "" {
-			testChunk += "\n\n"
+		if groupStart < 0 {
+			groupStart = start
 		}
-		testChunk += para
 
-		shouldChunk := len(testChunk) >= config.MinChunkSize &&
-			(len(testChunk) >= config.MaxChunkSize || i == len(paragraphs)-1)
+		testSize := size.of(content[groupStart:end])
+		shouldChunk := testSize >= config.MinChunkSize &&
+			(testSize >= config.MaxChunkSize || i == len(paragraphs)-1)
 
 		if shouldChunk {
-			chunk := &models.EnhancedChunk{
-				ID:         uuid.New().String(),
-				DocumentID: docID,
-				Text:       strings.TrimSpace(testChunk),
-				ChunkType:  "semantic",
-				Section:    "content",
-				StartPos:   startPos,
-				EndPos:     startPos + len(testChunk),
-				ChunkIndex: chunkIndex,
-			}
+			chunk := newSpanChunk(content, docID, groupStart, end)
+			chunk.ChunkType = "semantic"
+			chunk.Section = "content"
+			chunk.ChunkIndex = chunkIndex
 
 			if config.ExtractKeywords {
-				chunk.Keywords = extractKeywords(testChunk)
+				chunk.Keywords = extractKeywords(chunk.Text)
 			}
 
 			chunks = append(chunks, chunk)
 			chunkIndex++
-			startPos += len(testChunk) + 2
-			currentChunk = ""
-		} else {
-			currentChunk = testChunk
+			groupStart = -1
 		}
 	}
 
@@ -875,45 +1047,38 @@ func createSemanticChunks(content string, docID string, config *models.ChunkingC
 }
 
 // createSentenceWindowChunks creates overlapping sentence windows
-func createSentenceWindowChunks(content string, docID string, config *models.ChunkingConfig) ([]*models.EnhancedChunk, error) {
+func createSentenceWindowChunks(content string, docID string, config *models.ChunkingConfig, size chunkSizer) ([]*models.EnhancedChunk, error) {
 	// Split into sentences
-	sentences := regexp.MustCompile(`[.!?]+\s+`).Split(content, -1)
+	sentences := splitSentenceSpans(content)
 	var chunks []*models.EnhancedChunk
 
 	windowSize := config.SentenceWindowSize
 	if windowSize == 0 {
 		windowSize = 3 // Default
 	}
+	step := max(windowSize/2, 1) // 50% overlap
 
 	chunkIndex := 0
 
-	for i := 0; i < len(sentences); i += windowSize / 2 { // 50% overlap
+	for i := 0; i < len(sentences); i += step {
 		end := i + windowSize
 		if end > len(sentences) {
 			end = len(sentences)
 		}
 
-		windowText := strings.Join(sentences[i:end], ". ")
-		windowText = strings.TrimSpace(windowText)
+		chunk := newSpanChunk(content, docID, sentences[i].start, sentences[end-1].end)
 
-		if len(windowText) < config.MinChunkSize && i+windowSize < len(sentences) {
+		if size.of(chunk.Text) < config.MinChunkSize && i+windowSize < len(sentences) {
 			continue // Skip if too small and not last
 		}
 
-		if len(windowText) > 0 {
-			chunk := &models.EnhancedChunk{
-				ID:         uuid.New().String(),
-				DocumentID: docID,
-				Text:       windowText,
-				ChunkType:  "sentence_window",
-				Section:    "content",
-				StartPos:   0, // Could calculate actual positions
-				EndPos:     len(windowText),
-				ChunkIndex: chunkIndex,
-			}
+		if chunk.Text != "" {
+			chunk.ChunkType = "sentence_window"
+			chunk.Section = "content"
+			chunk.ChunkIndex = chunkIndex
 
 			if config.ExtractKeywords {
-				chunk.Keywords = extractKeywords(windowText)
+				chunk.Keywords = extractKeywords(chunk.Text)
 			}
 
 			chunks = append(chunks, chunk)
@@ -930,7 +1095,7 @@ func createSentenceWindowChunks(content string, docID string, config *models.Chu
 }
 
 // createParentDocumentChunks creates hierarchical parent-child chunks
-func createParentDocumentChunks(content string, docID string, config *models.ChunkingConfig) ([]*models.EnhancedChunk, error) {
+func createParentDocumentChunks(content string, docID string, config *models.ChunkingConfig, size chunkSizer) ([]*models.EnhancedChunk, error) {
 	// First create large parent chunks
 	parentSize := config.MaxChunkSize * 2 // Parents are larger
 	var parentChunks []*models.EnhancedChunk
@@ -941,33 +1106,23 @@ func createParentDocumentChunks(content string, docID string, config *models.Chu
 	parentIndex := 0
 
 	for start < len(content) {
-		end := start + parentSize
-		if end > len(content) {
-			end = len(content)
-		}
+		end := start + size.prefix(content[start:], parentSize)
 
 		// Try to end at paragraph boundary
 		if end < len(content) {
-			for i := end; i > start+parentSize-200 && i > start; i-- {
-				if content[i:i+2] == "\n\n" {
+			for i := end; i > end-200 && i > start; i-- {
+				if strings.HasPrefix(content[i:], "\n\n") {
 					end = i
 					break
 				}
 			}
 		}
 
-		parentText := strings.TrimSpace(content[start:end])
-		if len(parentText) > 0 {
-			parentChunk := &models.EnhancedChunk{
-				ID:         uuid.New().String(),
-				DocumentID: docID,
-				Text:       parentText,
-				ChunkType:  "parent",
-				Section:    fmt.Sprintf("section_%d", parentIndex+1),
-				StartPos:   start,
-				EndPos:     end,
-				ChunkIndex: parentIndex,
-			}
+		parentChunk := newSpanChunk(content, docID, start, end)
+		if parentText := parentChunk.Text; len(parentText) > 0 {
+			parentChunk.ChunkType = "parent"
+			parentChunk.Section = fmt.Sprintf("section_%d", parentIndex+1)
+			parentChunk.ChunkIndex = parentIndex
 
 			if config.ExtractKeywords {
 				parentChunk.Keywords = extractKeywords(parentText)
@@ -978,18 +1133,21 @@ func createParentDocumentChunks(content string, docID string, config *models.Chu
 			// Create child chunks from this parent
 			childChunks, err := createFixedSizeChunks(parentText, docID, &models.ChunkingConfig{
 				Strategy:        models.FixedSizeStrategy,
+				SizeUnit:        config.SizeUnit,
 				FixedSize:       config.MinChunkSize,
 				Overlap:         config.Overlap / 2,
 				ExtractKeywords: config.ExtractKeywords,
-			})
+			}, size)
 
 			if err != nil {
 				return nil, err
 			}
 
-			// Link children to parent
+			// Link children to parent, positioned in the document
 			var childIDs []string
 			for _, child := range childChunks {
+				child.StartPos += parentChunk.StartPos
+				child.EndPos += parentChunk.StartPos
 				child.ParentChunkID = &parentChunk.ID
 				child.Section = parentChunk.Section
 				child.ChunkType = "child"
@@ -1,84 +1,385 @@
 package core
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
-	"os"
+	"math"
+	"rag_system/embedcache"
 	"rag_system/models"
+	"rag_system/provider"
+	"rag_system/tokenizer"
+	"sort"
 	"strings"
-	"time"
+	"sync"
+	"unicode"
+	"unicode/utf8"
 )
 
-var NewhttpClient = &http.Client{Timeout: 180 * time.Second}
-
 const (
 	defaultEmbeddingBatchSize = 32
 	maxTokensPerBatch         = 8000
-	maxCharsPerToken          = 4
 	maxBatchSizeLimit         = 64
 	minBatchSize              = 1
 )
 
-const openAIEmbeddingURL = "https://api.openai.com/v1/embeddings"
+// ErrUnknownEmbeddingProvider is wrapped by errors about embedding provider
+// names that are not configured.
+var ErrUnknownEmbeddingProvider = errors.New("unknown embedding provider")
+
+// legacyEmbeddingProvider embedded every collection recorded before the
+// embedding provider was configurable.
+const legacyEmbeddingProvider = "openai"
+
+// EmbeddingService embeds text through the configured embedding providers.
+type EmbeddingService struct {
+	providers       map[string]provider.EmbeddingProvider
+	configs         map[string]provider.Config
+	defaultProvider string
+	cache           *embedcache.Cache // nil when disabled
+	tokenizer       tokenizer.Tokenizer
+
+	mu         sync.Mutex
+	dimensions map[models.EmbeddingSelection]int // Probed vector sizes
+}
+
+// NewEnbeddingService builds a client for every configured provider that
+// serves embeddings. defaultProvider embeds for collections that do not
+// record one. Texts found in cache are not sent to the provider; cache may be
+// nil. Batches and rate limits are budgeted in tokens counted by tok.
+func NewEnbeddingService(configs map[string]provider.Config, defaultProvider string, cache *embedcache.Cache, tok tokenizer.Tokenizer) (*EmbeddingService, error) {
+	e := &EmbeddingService{
+		providers:       make(map[string]provider.EmbeddingProvider, len(configs)),
+		configs:         configs,
+		defaultProvider: defaultProvider,
+		cache:           cache,
+		tokenizer:       tok,
+		dimensions:      make(map[models.EmbeddingSelection]int),
+	}
+	for name, cfg := range configs {
+		if !cfg.Type.ServesEmbeddings() {
+			continue
+		}
+		embedder, err := provider.NewEmbedding(name, cfg, tok)
+		if err != nil {
+			return nil, err
+		}
+		e.providers[name] = embedder
+	}
+	if _, ok := e.providers[defaultProvider]; !ok {
+		return nil, fmt.Errorf("%w: embedding_provider %q (configured: %v)", ErrUnknownEmbeddingProvider, defaultProvider, e.ProviderNames())
+	}
+	return e, nil
+}
 
-func GetEmbeddings(texts []string, modelName string) ([][]float32, error) {
+// ProviderNames lists the configured embedding providers, sorted.
+func (e *EmbeddingService) ProviderNames() []string {
+	names := make([]string, 0, len(e.providers))
+	for name := range e.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
 
-	if modelName == "" {
-		modelName = "text-embedding-3-small"
+// Resolve fills in the deployment's provider and the provider's embedding
+// model where sel leaves them empty.
+func (e *EmbeddingService) Resolve(sel models.EmbeddingSelection) (models.EmbeddingSelection, error) {
+	if sel.EmbeddingProvider == "" {
+		sel.EmbeddingProvider = e.defaultProvider
+	}
+	if _, ok := e.providers[sel.EmbeddingProvider]; !ok {
+		return sel, fmt.Errorf("%w: %q (configured: %v)", ErrUnknownEmbeddingProvider, sel.EmbeddingProvider, e.ProviderNames())
+	}
+	if sel.EmbeddingModel == "" {
+		sel.EmbeddingModel = e.configs[sel.EmbeddingProvider].EmbeddingModel
+	}
+	if sel.EmbeddingModel == "" {
+		return sel, fmt.Errorf("provider %q has no embedding_model configured", sel.EmbeddingProvider)
 	}
+	return sel, nil
+}
+
+// GetEmbedding embeds text with the deployment's provider and model.
+func (e *EmbeddingService) GetEmbedding(text string) ([]float32, error) {
+	return e.GetEmbeddingWith(text, models.EmbeddingSelection{})
+}
+
+// GetEmbeddings embeds texts with the deployment's provider and model.
+func (e *EmbeddingService) GetEmbeddings(texts []string) ([][]float32, error) {
+	return e.GetEmbeddingsWith(texts, models.EmbeddingSelection{})
+}
+
+// GetEmbeddingWith embeds text with the selected provider and model.
+func (e *EmbeddingService) GetEmbeddingWith(text string, sel models.EmbeddingSelection) ([]float32, error) {
+	embeddings, err := e.GetEmbeddingsWith([]string{text}, sel)
+	if err != nil {
+		return nil, err
+	}
+	if len(embeddings) == 0 {
+		return nil, fmt.Errorf("no embedding returned")
+	}
+	return embeddings[0], nil
+}
+
+// GetEmbeddingsWith embeds texts with the selected provider and model. Only
+// texts missing from the cache are sent to the provider, each once.
+func (e *EmbeddingService) GetEmbeddingsWith(texts []string, sel models.EmbeddingSelection) ([][]float32, error) {
+	embeddings, _, err := e.embedTexts(texts, sel)
+	return embeddings, err
+}
+
+// embedTexts is GetEmbeddingsWith, also reporting how many windows each text
+// was split into because it was too large for the model (1 when embedded
+// whole). Pooled vectors are not cached, so the count is never lost.
+func (e *EmbeddingService) embedTexts(texts []string, sel models.EmbeddingSelection) ([][]float32, []int, error) {
+	sel, err := e.Resolve(sel)
+	if err != nil {
+		return nil, nil, err
+	}
+	if e.cache == nil {
+		return e.embed(texts, sel)
+	}
+
+	cacheModel := cacheModelName(sel)
+	embeddings := make([][]float32, len(texts))
+	windows := make([]int, len(texts))
+	missing := make(map[string][]int) // Normalized text -> indexes in texts
+	var missTexts []string
+	for i, text := range texts {
+		if vector, ok := e.cache.Get(cacheModel, text); ok {
+			embeddings[i] = vector
+			windows[i] = 1
+			continue
+		}
+		normalized := embedcache.Normalize(text)
+		if _, seen := missing[normalized]; !seen {
+			missTexts = append(missTexts, text)
+		}
+		missing[normalized] = append(missing[normalized], i)
+	}
+	if len(texts) > 1 {
+		log.Printf("Embedding cache: %d of %d texts cached, embedding %d", len(texts)-len(missTexts), len(texts), len(missTexts))
+	}
+	if len(missTexts) == 0 {
+		return embeddings, windows, nil
+	}
+
+	fresh, freshWindows, err := e.embed(missTexts, sel)
+	if err != nil {
+		return nil, nil, err
+	}
+	var cacheTexts []string
+	var cacheVectors [][]float32
+	for j, text := range missTexts {
+		for _, i := range missing[embedcache.Normalize(text)] {
+			embeddings[i] = fresh[j]
+			windows[i] = freshWindows[j]
+		}
+		if freshWindows[j] == 1 {
+			cacheTexts = append(cacheTexts, text)
+			cacheVectors = append(cacheVectors, fresh[j])
+		}
+	}
+	if err := e.cache.Put(cacheModel, cacheTexts, cacheVectors); err != nil {
+		log.Printf("Warning: could not update embedding cache: %v", err)
+	}
+	return embeddings, windows, nil
+}
+
+func (e *EmbeddingService) embed(texts []string, sel models.EmbeddingSelection) ([][]float32, []int, error) {
+	cfg := e.configs[sel.EmbeddingProvider]
+	embeddings, windows, err := GetEmbeddings(context.Background(), e.providers[sel.EmbeddingProvider], e.tokenizer, texts, sel.EmbeddingModel, cfg.Workers(), cfg.InputTokenLimit())
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", sel.EmbeddingProvider, err)
+	}
+	return embeddings, windows, nil
+}
+
+// cacheModelName is the model name embeddings of sel are cached under,
+// "<provider>/<model>", so that servers sharing a model name do not share
+// vectors.
+func cacheModelName(sel models.EmbeddingSelection) string {
+	return sel.EmbeddingProvider + "/" + sel.EmbeddingModel
+}
+
+// Dimension returns the vector size of the selected model, discovered by
+// embedding a probe text the first time it is asked for.
+func (e *EmbeddingService) Dimension(sel models.EmbeddingSelection) (int, error) {
+	sel, err := e.Resolve(sel)
+	if err != nil {
+		return 0, err
+	}
+
+	e.mu.Lock()
+	dim, ok := e.dimensions[sel]
+	e.mu.Unlock()
+	if ok {
+		return dim, nil
+	}
+
+	probe, err := e.GetEmbeddingWith("dimension probe", sel)
+	if err != nil {
+		return 0, fmt.Errorf("failed to probe dimension of embedding model %s: %w", sel.EmbeddingModel, err)
+	}
+	if len(probe) == 0 {
+		return 0, fmt.Errorf("embedding model %s returned an empty vector", sel.EmbeddingModel)
+	}
+
+	e.mu.Lock()
+	e.dimensions[sel] = len(probe)
+	e.mu.Unlock()
+	return len(probe), nil
+}
+
+// GetEmbeddings embeds texts through p in batches of at most
+// maxTokensPerBatch tokens as counted by tok, up to workers of them in flight
+// at once. Results are placed by each batch's StartIndex, so
+// they keep the order of texts whatever order the batches finish in. The
+// first batch that fails cancels the ones still queued or in flight. A text
+// of more than maxInputTokens tokens (0: no limit), or one the model rejects
+// as too large even on its own, is split into windows that fit, whose
+// vectors are mean-pooled; windows reports how many each text took (1 when
+// embedded whole).
+func GetEmbeddings(ctx context.Context, p provider.EmbeddingProvider, tok tokenizer.Tokenizer, texts []string, modelName string, workers, maxInputTokens int) ([][]float32, []int, error) {
 
 	if len(texts) == 0 {
-		return [][]float32{}, nil
+		return [][]float32{}, []int{}, nil
 	}
 
 	allEmbeddings := make([][]float32, len(texts))
+	windows := make([]int, len(texts))
 
-	batches := createAdaptiveBatches(texts)
+	batches := createAdaptiveBatches(texts, tok, maxInputTokens)
 
-	log.Printf("Processing %d texts in %d adaptive batches", len(texts), len(batches))
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(batches) {
+		workers = len(batches)
+	}
 
-	for batchIndex, batch := range batches {
+	log.Printf("Processing %d texts in %d adaptive batches with %d workers", len(texts), len(batches), workers)
 
-		embeddings, err := processBatchWithRetry(batch, modelName, batchIndex)
-		if err != nil {
-			return nil, fmt.Errorf("failed to process batch %d: %w", batchIndex, err)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		failOnce sync.Once
+		firstErr error
+	)
+	queue := make(chan int)
+
+	go func() {
+		defer close(queue)
+		for batchIndex := range batches {
+			select {
+			case queue <- batchIndex:
+			case <-ctx.Done():
+				return
+			}
 		}
+	}()
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batchIndex := range queue {
+				if ctx.Err() != nil {
+					return
+				}
+				batch := batches[batchIndex]
+
+				fail := func(err error) {
+					failOnce.Do(func() {
+						firstErr = fmt.Errorf("failed to process batch %d: %w", batchIndex, err)
+						cancel()
+					})
+				}
 
-		for i, embedding := range embeddings {
+				var embeddings [][]float32
+				var err error
+				if batch.Pooled {
+					embeddings = [][]float32{nil} // Over the model's limit: embedded in windows below
+				} else if embeddings, err = processBatchWithRetry(ctx, p, tok, batch, modelName, batchIndex); err != nil {
+					fail(err)
+					return
+				}
+
+				// Batches cover disjoint index ranges, so no locking is needed
+				for i, embedding := range embeddings {
+
+					globalIndex := batch.StartIndex + i
 
-			globalIndex := batch.StartIndex + i
+					if globalIndex >= len(allEmbeddings) {
+						continue
+					}
+
+					windows[globalIndex] = 1
+					if embedding == nil {
+						// Too large on its own
+						embedding, windows[globalIndex], err = embedPooled(ctx, p, tok, texts[globalIndex], modelName, maxInputTokens)
+						if err != nil {
+							fail(fmt.Errorf("text at index %d: %w", globalIndex, err))
+							return
+						}
+					}
+					allEmbeddings[globalIndex] = embedding
+
+				}
 
-			if globalIndex < len(allEmbeddings) {
-				allEmbeddings[globalIndex] = embedding
+				log.Printf("Successfully processed batch %d (%d texts)", batchIndex, len(batch.Texts))
 			}
+		}()
+	}
 
-		}
+	wg.Wait()
 
-		log.Printf("Successfully processed batch %d (%d texts)", batchIndex, len(batch.Texts))
+	if firstErr != nil {
+		return nil, nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
 	}
 
+	dimension := len(allEmbeddings[0])
+
 	for idx, emb := range allEmbeddings {
 
 		if len(emb) == 0 {
-			return nil, fmt.Errorf("embedding for text at index %d was not populated", idx)
+			return nil, nil, fmt.Errorf("embedding for text at index %d was not populated", idx)
+		}
+
+		if len(emb) != dimension {
+			return nil, nil, fmt.Errorf("embedding for text at index %d has %d dimensions, expected %d", idx, len(emb), dimension)
 		}
 
 	}
 
-	return allEmbeddings, nil
+	return allEmbeddings, windows, nil
 }
 
 type EmbeddingBatch struct {
-	Texts      []string
-	StartIndex int
-	TotalChars int
+	Texts       []string
+	StartIndex  int
+	TotalChars  int
+	TotalTokens int
+	Pooled      bool // A single text over the model's input limit, embedded in windows
 }
 
-func createAdaptiveBatches(texts []string) []EmbeddingBatch {
+func newEmbeddingBatch(texts []string, startIndex int, tok tokenizer.Tokenizer) EmbeddingBatch {
+	batch := EmbeddingBatch{Texts: texts, StartIndex: startIndex}
+	for _, text := range texts {
+		batch.TotalChars += len(text)
+		batch.TotalTokens += tok.Count(text)
+	}
+	return batch
+}
+
+func createAdaptiveBatches(texts []string, tok tokenizer.Tokenizer, maxInputTokens int) []EmbeddingBatch {
 
 	var batches []EmbeddingBatch
 
@@ -90,44 +391,49 @@ func createAdaptiveBatches(texts []string) []EmbeddingBatch {
 			StartIndex: i,
 		}
 
-		currentChars := 0
 		batchSize := 0
 
 		for i+batchSize < len(texts) && batchSize < maxBatchSizeLimit {
 
-			textChars := len(texts[i+batchSize])
+			text := texts[i+batchSize]
+			textTokens := tok.Count(text)
 
-			estimatedTokens := (currentChars + textChars) / maxCharsPerToken
+			// A text over the model's limit gets a batch of its own
+			if maxInputTokens > 0 && textTokens > maxInputTokens {
+				if batchSize > 0 {
+					break
+				}
+				log.Printf("Text at index %d has %d tokens, over the model's %d: embedding it in windows", i, textTokens, maxInputTokens)
+				batch.Texts = []string{text}
+				batch.TotalChars, batch.TotalTokens = len(text), textTokens
+				batch.Pooled = true
+				batchSize = 1
+				break
+			}
 
-			if estimatedTokens > maxTokensPerBatch && batchSize > 0 {
+			if batch.TotalTokens+textTokens > maxTokensPerBatch && batchSize > 0 {
 				break
 			}
 
-			if textChars/maxCharsPerToken > maxTokensPerBatch {
+			batch.Texts = append(batch.Texts, text)
+			batch.TotalChars += len(text)
+			batch.TotalTokens += textTokens
+			batchSize++
+
+			if textTokens > maxTokensPerBatch {
 
 				log.Printf(
-					"Warning: Text at index %d is very large (%d chars, ~%d tokens), processing individually",
-					i+batchSize,
-					textChars,
-					textChars/maxCharsPerToken,
+					"Warning: Text at index %d is very large (%d chars, %d tokens), processing individually",
+					i+batchSize-1,
+					len(text),
+					textTokens,
 				)
 
-				if batchSize == 0 {
-					batch.Texts = append(batch.Texts, texts[i+batchSize])
-					batch.TotalChars = textChars
-					batchSize = 1
-				}
-
 				break
 			}
 
-			batch.Texts = append(batch.Texts, texts[i+batchSize])
-			currentChars += textChars
-			batchSize++
-
 		}
 
-		batch.TotalChars = currentChars
 		batches = append(batches, batch)
 
 		i += batchSize
@@ -136,227 +442,199 @@ func createAdaptiveBatches(texts []string) []EmbeddingBatch {
 	return batches
 }
 
-func getEmbeddingDimension(modelName string) int {
+// processBatchWithRetry embeds a batch, halving it while the model reports it
+// as too large. Texts too large on their own come back as nil. Rate limits and
+// server errors are retried by the provider client, so any other failure is
+// final.
+func processBatchWithRetry(ctx context.Context, p provider.EmbeddingProvider, tok tokenizer.Tokenizer, batch EmbeddingBatch, modelName string, batchIndex int) ([][]float32, error) {
+
+	log.Printf(
+		"Batch %d: %d texts, %d chars, %d tokens",
+		batchIndex,
+		len(batch.Texts),
+		batch.TotalChars,
+		batch.TotalTokens,
+	)
 
-	modelDimensions := map[string]int{
-		"text-embedding-3-small": 1536,
-		"text-embedding-3-large": 3072,
-		"text-embedding-ada-002": 1536,
-	}
+	embeddings, err := p.Embed(ctx, batch.Texts, modelName)
 
-	if dim, exists := modelDimensions[modelName]; exists {
-		return dim
+	if err == nil {
+		return embeddings, nil
 	}
 
-	log.Printf("Unknown model %s, defaulting to 1536", modelName)
-
-	return 1536
-}
-
-func processBatchWithRetry(batch EmbeddingBatch, modelName string, batchIndex int) ([][]float32, error) {
-
-	currentBatch := batch
-
-	maxRetries := 3
+	if !errors.Is(err, provider.ErrOversized) {
+		return nil, err
+	}
 
-	for attempt := 0; attempt < maxRetries; attempt++ {
+	if len(batch.Texts) == 1 {
 
 		log.Printf(
-			"Batch %d attempt %d: %d texts, %d chars (~%d tokens)",
+			"Single text at batch %d is too large (%d chars), embedding it in windows",
 			batchIndex,
-			attempt+1,
-			len(currentBatch.Texts),
-			currentBatch.TotalChars,
-			currentBatch.TotalChars/maxCharsPerToken,
+			batch.TotalChars,
 		)
 
-		embeddings, err := sendEmbeddingRequest(currentBatch.Texts, modelName)
-
-		if err == nil {
-			return embeddings, nil
-		}
-
-		if isOversizedBatchError(err) {
-
-			if len(currentBatch.Texts) == 1 {
-
-				log.Printf(
-					"Single text at batch %d is too large (%d chars), skipping",
-					batchIndex,
-					currentBatch.TotalChars,
-				)
-
-				dimension := getEmbeddingDimension(modelName)
-
-				placeholder := make([]float32, dimension)
-
-				return [][]float32{placeholder}, nil
-			}
-
-			if len(currentBatch.Texts) > minBatchSize {
-
-				log.Printf(
-					"Batch %d is too large, splitting in half (attempt %d)",
-					batchIndex,
-					attempt+1,
-				)
-
-				midpoint := len(currentBatch.Texts) / 2
+		return [][]float32{nil}, nil
+	}
 
-				firstHalfChars := 0
+	log.Printf("Batch %d is too large, splitting in half", batchIndex)
 
-				for _, text := range currentBatch.Texts[:midpoint] {
-					firstHalfChars += len(text)
-				}
+	midpoint := len(batch.Texts) / 2
 
-				secondHalfChars := 0
+	firstHalf := newEmbeddingBatch(batch.Texts[:midpoint], batch.StartIndex, tok)
 
-				for _, text := range currentBatch.Texts[midpoint:] {
-					secondHalfChars += len(text)
-				}
+	secondHalf := newEmbeddingBatch(batch.Texts[midpoint:], batch.StartIndex+midpoint, tok)
 
-				firstHalf := EmbeddingBatch{
-					Texts:      currentBatch.Texts[:midpoint],
-					StartIndex: currentBatch.StartIndex,
-					TotalChars: firstHalfChars,
-				}
+	firstEmbeddings, err := processBatchWithRetry(ctx, p, tok, firstHalf, modelName, batchIndex)
 
-				secondHalf := EmbeddingBatch{
-					Texts:      currentBatch.Texts[midpoint:],
-					StartIndex: currentBatch.StartIndex + midpoint,
-					TotalChars: secondHalfChars,
-				}
-
-				firstEmbeddings, err1 := processBatchWithRetry(firstHalf, modelName, batchIndex)
-
-				if err1 != nil {
-					return nil, fmt.Errorf("failed to process first half of split batch: %w", err1)
-				}
+	if err != nil {
+		return nil, fmt.Errorf("failed to process first half of split batch: %w", err)
+	}
 
-				secondEmbeddings, err2 := processBatchWithRetry(secondHalf, modelName, batchIndex)
+	secondEmbeddings, err := processBatchWithRetry(ctx, p, tok, secondHalf, modelName, batchIndex)
 
-				if err2 != nil {
-					return nil, fmt.Errorf("failed to process second half of split batch: %w", err2)
-				}
+	if err != nil {
+		return nil, fmt.Errorf("failed to process second half of split batch: %w", err)
+	}
 
-				combined := append(firstEmbeddings, secondEmbeddings...)
+	return append(firstEmbeddings, secondEmbeddings...), nil
+}
 
-				return combined, nil
-			}
+// minWindowChars is the smallest window an oversized text is split into.
+// A model that rejects even that much text is misconfigured.
+const minWindowChars = 256
+
+// embedPooled embeds a text too large for the model by splitting it into
+// windows that fit and averaging their vectors, weighted by window length, so
+// every part of the text counts towards the result. Windows hold at most
+// maxInputTokens tokens as counted by tok; without a limit, or when the model
+// rejects a text within it, the text is halved until the windows are
+// accepted. It returns the pooled, unit-length vector and the number of
+// windows.
+func embedPooled(ctx context.Context, p provider.EmbeddingProvider, tok tokenizer.Tokenizer, text, modelName string, maxInputTokens int) ([]float32, int, error) {
+	parts := tokenWindows(tok, text, maxInputTokens)
+	if len(parts) < 2 {
+		first, second := splitHalf(text)
+		if first == "" || second == "" {
+			return nil, 0, fmt.Errorf("text of %d chars is too large for model %s and cannot be split", len(text), modelName)
 		}
+		parts = []string{first, second}
+	}
 
-		if attempt == maxRetries-1 || len(currentBatch.Texts) <= minBatchSize {
-
-			return nil, fmt.Errorf("failed after %d attempts: %w", attempt+1, err)
+	var windows []string
+	var vectors [][]float32
+	for _, part := range parts {
+		if err := embedWindows(ctx, p, part, modelName, &windows, &vectors); err != nil {
+			return nil, 0, err
 		}
-
-		time.Sleep(time.Second * time.Duration(attempt+1))
 	}
 
-	return nil, fmt.Errorf("exceeded maximum retry attempts")
-}
-
-func sendEmbeddingRequest(texts []string, modelName string) ([][]float32, error) {
-
-	reqPayload := models.EmbeddingRequest{
-		Input: texts,
-		Model: modelName,
+	dimension := len(vectors[0])
+	pooled := make([]float64, dimension)
+	for i, vector := range vectors {
+		if len(vector) != dimension {
+			return nil, 0, fmt.Errorf("window %d has %d dimensions, expected %d", i, len(vector), dimension)
+		}
+		weight := float64(len(windows[i]))
+		for j, v := range vector {
+			pooled[j] += weight * float64(v)
+		}
 	}
 
-	payloadBytes, err := json.Marshal(reqPayload)
-
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal embedding request: %w", err)
+	var norm float64
+	for _, v := range pooled {
+		norm += v * v
 	}
+	norm = math.Sqrt(norm)
 
-	req, err := http.NewRequest("POST", openAIEmbeddingURL, bytes.NewBuffer(payloadBytes))
-
-	if err != nil {
-		return nil, fmt.Errorf("failed to create embedding request: %w", err)
+	embedding := make([]float32, dimension)
+	for i, v := range pooled {
+		if norm > 0 {
+			embedding[i] = float32(v / norm)
+		}
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-
-	req.Header.Set(
-		"Authorization",
-		"Bearer "+os.Getenv("OPENAI_API_KEY"),
-	)
-
-	resp, err := NewhttpClient.Do(req)
+	log.Printf("Embedded text of %d chars as %d pooled windows", len(text), len(windows))
+	return embedding, len(windows), nil
+}
 
-	if err != nil {
-		return nil, fmt.Errorf("failed to call OpenAI embedding API: %w", err)
+// embedWindows embeds text as one window, halving it for as long as the
+// model rejects it as too large, which only happens when the tokenizer
+// undercounts the model's tokens. Windows and their vectors are appended
+// in text order.
+func embedWindows(ctx context.Context, p provider.EmbeddingProvider, text, modelName string, windows *[]string, vectors *[][]float32) error {
+	embeddings, err := p.Embed(ctx, []string{text}, modelName)
+	if err == nil {
+		if len(embeddings) != 1 || len(embeddings[0]) == 0 {
+			return fmt.Errorf("provider returned no embedding for a window of %d chars", len(text))
+		}
+		*windows = append(*windows, text)
+		*vectors = append(*vectors, embeddings[0])
+		return nil
 	}
-
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-
-		errBodyBytes, _ := io.ReadAll(resp.Body)
-
-		return nil, fmt.Errorf(
-			"embedding API request failed with status %s: %s",
-			resp.Status,
-			string(errBodyBytes),
-		)
+	if !errors.Is(err, provider.ErrOversized) {
+		return err
 	}
 
-	var embeddingResp models.EmbeddingAPIResponse
-
-	if err := json.NewDecoder(resp.Body).Decode(&embeddingResp); err != nil {
-		return nil, fmt.Errorf("failed to decode embedding API response: %w", err)
+	first, second := splitHalf(text)
+	if len(text) < 2*minWindowChars || first == "" || second == "" {
+		return fmt.Errorf("window of %d chars is still too large for model %s: %w", len(text), modelName, err)
 	}
-
-	if len(embeddingResp.Data) != len(texts) {
-
-		return nil, fmt.Errorf(
-			"mismatch in number of embeddings returned (%d) vs texts sent (%d)",
-			len(embeddingResp.Data),
-			len(texts),
-		)
+	if err := embedWindows(ctx, p, first, modelName, windows, vectors); err != nil {
+		return err
 	}
+	return embedWindows(ctx, p, second, modelName, windows, vectors)
+}
 
-	embeddings := make([][]float32, len(texts))
-
-	for _, data := range embeddingResp.Data {
-
-		if data.Index >= 0 && data.Index < len(embeddings) {
-
-			embeddings[data.Index] = data.Embedding
-
-		} else {
-
-			return nil, fmt.Errorf(
-				"embedding data index out of bounds: %d",
-				data.Index,
-			)
+// tokenWindows cuts text into consecutive windows of at most maxTokens
+// tokens, each ending at whitespace when there is some in its second half.
+// It returns nil when maxTokens is 0.
+func tokenWindows(tok tokenizer.Tokenizer, text string, maxTokens int) []string {
+	if maxTokens <= 0 {
+		return nil
+	}
+	var windows []string
+	for rest := strings.TrimSpace(text); rest != ""; {
+		end := tokenizer.Prefix(tok, rest, maxTokens)
+		if end < len(rest) {
+			if space := strings.LastIndexFunc(rest[:end], unicode.IsSpace); space > end/2 {
+				end = space
+			}
 		}
-
+		if end == 0 {
+			// A single character holding more tokens than the limit
+			_, end = utf8.DecodeRuneInString(rest)
+		}
+		windows = append(windows, strings.TrimSpace(rest[:end]))
+		rest = strings.TrimSpace(rest[end:])
 	}
-
-	return embeddings, nil
+	return windows
 }
 
-func isOversizedBatchError(err error) bool {
-
-	errorStr := strings.ToLower(err.Error())
-
-	oversizedIndicators := []string{
-		"too large",
-		"input is too large",
-		"context length exceeded",
-		"maximum context length",
-		"token limit",
-		"input size",
+// splitHalf cuts text in two near its middle, at the closest whitespace when
+// there is some and never inside a UTF-8 sequence.
+func splitHalf(text string) (string, string) {
+	mid := len(text) / 2
+	for mid > 0 && !utf8.RuneStart(text[mid]) {
+		mid--
 	}
 
-	for _, indicator := range oversizedIndicators {
-
-		if strings.Contains(errorStr, indicator) {
-			return true
+	// Look for whitespace within a quarter of the text either side
+	reach := len(text) / 4
+	for offset := 0; offset <= reach; offset++ {
+		if i := mid - offset; i > 0 && isASCIISpace(text[i]) {
+			mid = i
+			break
+		}
+		if i := mid + offset; i < len(text) && isASCIISpace(text[i]) {
+			mid = i
+			break
 		}
-
 	}
 
-	return false
+	return strings.TrimSpace(text[:mid]), strings.TrimSpace(text[mid:])
+}
+
+func isASCIISpace(b byte) bool {
+	return b < utf8.RuneSelf && unicode.IsSpace(rune(b))
 }
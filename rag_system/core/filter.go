@@ -0,0 +1,478 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"rag_system/models"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrInvalidFilter is wrapped by every filter validation error so handlers
+// can answer 400 instead of 500.
+var ErrInvalidFilter = errors.New("invalid filter")
+
+type filterFieldKind int
+
+const (
+	stringField filterFieldKind = iota
+	numberField
+	listField
+	anyField // metadata paths: type decided by the stored value
+)
+
+// chunkFilterFields are the chunk attributes a filter may name directly.
+var chunkFilterFields = map[string]filterFieldKind{
+	"chunk_type":      stringField,
+	"section":         stringField,
+	"subsection":      stringField,
+	"doc_type":        stringField,
+	"source":          stringField,
+	"document_id":     stringField,
+	"parent_chunk_id": stringField,
+	"chunk_index":     numberField,
+	"start_pos":       numberField,
+	"end_pos":         numberField,
+	"confidence":      numberField,
+	"keywords":        listField,
+}
+
+const (
+	chunkMetadataPrefix    = "metadata."
+	documentMetadataPrefix = "document."
+)
+
+// maxFilterDepth bounds nesting so a hostile request cannot recurse forever.
+const maxFilterDepth = 16
+
+// QueryFilter combines the legacy equality filters and the filter expression
+// of a request into one validated expression. It returns nil when the request
+// has no filters.
+func QueryFilter(req *models.QueryRequest) (*models.FilterExpr, error) {
+	var clauses []*models.FilterExpr
+
+	keys := make([]string, 0, len(req.MetadataFilters))
+	for key := range req.MetadataFilters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		clause, err := legacyFilterClause(key, req.MetadataFilters[key])
+		if err != nil {
+			return nil, err
+		}
+		clauses = append(clauses, clause)
+	}
+
+	if req.Filter != nil {
+		if err := ValidateFilter(req.Filter); err != nil {
+			return nil, err
+		}
+		clauses = append(clauses, req.Filter)
+	}
+
+	switch len(clauses) {
+	case 0:
+		return nil, nil
+	case 1:
+		return clauses[0], nil
+	default:
+		return &models.FilterExpr{And: clauses}, nil
+	}
+}
+
+// legacyFilterClause turns one metadata_filters entry into an eq (or, for a
+// list value, in) clause. Keys that are not chunk attributes address the
+// chunk's metadata.
+func legacyFilterClause(key string, value interface{}) (*models.FilterExpr, error) {
+	field := key
+	if _, ok := chunkFilterFields[key]; !ok && !strings.HasPrefix(key, chunkMetadataPrefix) && !strings.HasPrefix(key, documentMetadataPrefix) {
+		field = chunkMetadataPrefix + key
+	}
+
+	clause := &models.FilterExpr{Field: field, Op: models.FilterEq, Value: value}
+	if _, ok := value.([]interface{}); ok {
+		clause.Op = models.FilterIn
+	}
+	if err := validateFilterNode(clause, "metadata_filters."+key, 0); err != nil {
+		return nil, err
+	}
+	return clause, nil
+}
+
+// ValidateFilter checks a filter expression's structure, field names,
+// operators and value types.
+func ValidateFilter(expr *models.FilterExpr) error {
+	return validateFilterNode(expr, "filter", 0)
+}
+
+func validateFilterNode(expr *models.FilterExpr, path string, depth int) error {
+	if expr == nil {
+		return fmt.Errorf("%w: %s is empty", ErrInvalidFilter, path)
+	}
+	if depth > maxFilterDepth {
+		return fmt.Errorf("%w: %s is nested deeper than %d levels", ErrInvalidFilter, path, maxFilterDepth)
+	}
+
+	kinds := 0
+	if expr.And != nil {
+		kinds++
+	}
+	if expr.Or != nil {
+		kinds++
+	}
+	if expr.Not != nil {
+		kinds++
+	}
+	if expr.Field != "" || expr.Op != "" {
+		kinds++
+	}
+	if kinds != 1 {
+		return fmt.Errorf("%w: %s must have exactly one of and, or, not or field/op", ErrInvalidFilter, path)
+	}
+
+	switch {
+	case expr.And != nil:
+		return validateFilterList(expr.And, path+".and", depth)
+	case expr.Or != nil:
+		return validateFilterList(expr.Or, path+".or", depth)
+	case expr.Not != nil:
+		return validateFilterNode(expr.Not, path+".not", depth+1)
+	}
+
+	kind, err := filterFieldKindOf(expr.Field)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrInvalidFilter, path, err)
+	}
+
+	switch expr.Op {
+	case models.FilterEq, models.FilterNe:
+		if !isFilterScalar(expr.Value) {
+			return fmt.Errorf("%w: %s: %s needs a string, number or boolean value", ErrInvalidFilter, path, expr.Op)
+		}
+	case models.FilterIn:
+		values, ok := expr.Value.([]interface{})
+		if !ok || len(values) == 0 {
+			return fmt.Errorf("%w: %s: in needs a non-empty list of values", ErrInvalidFilter, path)
+		}
+		for i, v := range values {
+			if !isFilterScalar(v) {
+				return fmt.Errorf("%w: %s: in value %d must be a string, number or boolean", ErrInvalidFilter, path, i)
+			}
+		}
+	case models.FilterGt, models.FilterGte, models.FilterLt, models.FilterLte:
+		if kind == stringField || kind == listField {
+			return fmt.Errorf("%w: %s: %s is not supported on field %q", ErrInvalidFilter, path, expr.Op, expr.Field)
+		}
+		_, isNumber := filterNumber(expr.Value)
+		if _, isDate := filterTime(expr.Value); !isNumber && !isDate {
+			return fmt.Errorf("%w: %s: %s needs a number or an RFC 3339 date", ErrInvalidFilter, path, expr.Op)
+		}
+		if kind == numberField && !isNumber {
+			return fmt.Errorf("%w: %s: field %q is numeric", ErrInvalidFilter, path, expr.Field)
+		}
+	case models.FilterExists:
+		if _, ok := expr.Value.(bool); expr.Value != nil && !ok {
+			return fmt.Errorf("%w: %s: exists takes true, false or no value", ErrInvalidFilter, path)
+		}
+	case "":
+		return fmt.Errorf("%w: %s: op is required", ErrInvalidFilter, path)
+	default:
+		return fmt.Errorf("%w: %s: unknown op %q (expected eq, ne, in, gt, gte, lt, lte or exists)", ErrInvalidFilter, path, expr.Op)
+	}
+	return nil
+}
+
+func validateFilterList(list []*models.FilterExpr, path string, depth int) error {
+	if len(list) == 0 {
+		return fmt.Errorf("%w: %s must not be empty", ErrInvalidFilter, path)
+	}
+	for i, child := range list {
+		if err := validateFilterNode(child, fmt.Sprintf("%s[%d]", path, i), depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func filterFieldKindOf(field string) (filterFieldKind, error) {
+	if field == "" {
+		return 0, fmt.Errorf("field is required")
+	}
+	if kind, ok := chunkFilterFields[field]; ok {
+		return kind, nil
+	}
+	for _, prefix := range []string{chunkMetadataPrefix, documentMetadataPrefix} {
+		if strings.HasPrefix(field, prefix) {
+			path := strings.TrimPrefix(field, prefix)
+			if path == "" || strings.HasPrefix(path, ".") || strings.HasSuffix(path, ".") || strings.Contains(path, "..") {
+				return 0, fmt.Errorf("invalid field path %q", field)
+			}
+			return anyField, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown field %q (use a chunk field, metadata.<key> or document.<key>)", field)
+}
+
+func isFilterScalar(v interface{}) bool {
+	switch v.(type) {
+	case string, bool:
+		return true
+	}
+	_, ok := filterNumber(v)
+	return ok
+}
+
+// filterNumber converts the numeric types found in requests and stored
+// metadata to float64.
+func filterNumber(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+var filterTimeLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02"}
+
+// filterTime parses date strings in the layouts filters accept.
+func filterTime(v interface{}) (time.Time, bool) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, true
+	case string:
+		for _, layout := range filterTimeLayouts {
+			if parsed, err := time.Parse(layout, t); err == nil {
+				return parsed, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// filterSubject gives a filter access to a stored chunk's field values.
+type filterSubject interface {
+	filterValue(field string) (interface{}, bool)
+}
+
+// matchFilter evaluates a validated filter expression against one chunk.
+// A nil expression matches everything.
+func matchFilter(expr *models.FilterExpr, subject filterSubject) bool {
+	if expr == nil {
+		return true
+	}
+	switch {
+	case expr.And != nil:
+		for _, child := range expr.And {
+			if !matchFilter(child, subject) {
+				return false
+			}
+		}
+		return true
+	case expr.Or != nil:
+		for _, child := range expr.Or {
+			if matchFilter(child, subject) {
+				return true
+			}
+		}
+		return false
+	case expr.Not != nil:
+		return !matchFilter(expr.Not, subject)
+	}
+
+	value, present := subject.filterValue(expr.Field)
+	if present && isEmptyFilterValue(value) {
+		present = false
+	}
+
+	switch expr.Op {
+	case models.FilterExists:
+		want, ok := expr.Value.(bool)
+		if !ok {
+			want = true
+		}
+		return present == want
+	case models.FilterNe:
+		return !present || !anyElement(value, func(v interface{}) bool { return filterEqual(v, expr.Value) })
+	}
+
+	if !present {
+		return false
+	}
+
+	switch expr.Op {
+	case models.FilterEq:
+		return anyElement(value, func(v interface{}) bool { return filterEqual(v, expr.Value) })
+	case models.FilterIn:
+		candidates, _ := expr.Value.([]interface{})
+		return anyElement(value, func(v interface{}) bool {
+			for _, c := range candidates {
+				if filterEqual(v, c) {
+					return true
+				}
+			}
+			return false
+		})
+	case models.FilterGt, models.FilterGte, models.FilterLt, models.FilterLte:
+		return anyElement(value, func(v interface{}) bool {
+			cmp, ok := filterCompare(v, expr.Value)
+			if !ok {
+				return false
+			}
+			switch expr.Op {
+			case models.FilterGt:
+				return cmp > 0
+			case models.FilterGte:
+				return cmp >= 0
+			case models.FilterLt:
+				return cmp < 0
+			default:
+				return cmp <= 0
+			}
+		})
+	}
+	return false
+}
+
+// anyElement applies pred to a scalar, or to each element of a list value,
+// mirroring how Qdrant matches conditions against array payloads.
+func anyElement(value interface{}, pred func(interface{}) bool) bool {
+	rv := reflect.ValueOf(value)
+	if rv.Kind() == reflect.Slice {
+		for i := 0; i < rv.Len(); i++ {
+			if pred(rv.Index(i).Interface()) {
+				return true
+			}
+		}
+		return false
+	}
+	return pred(value)
+}
+
+func isEmptyFilterValue(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Map:
+		return rv.Len() == 0
+	}
+	return false
+}
+
+func filterEqual(stored, want interface{}) bool {
+	if a, ok := filterNumber(stored); ok {
+		b, ok := filterNumber(want)
+		return ok && a == b
+	}
+	switch s := stored.(type) {
+	case string:
+		w, ok := want.(string)
+		return ok && s == w
+	case bool:
+		w, ok := want.(bool)
+		return ok && s == w
+	}
+	return false
+}
+
+// filterCompare orders a stored value against a filter bound, numerically
+// when both are numbers and chronologically when both are dates.
+func filterCompare(stored, bound interface{}) (int, bool) {
+	if a, ok := filterNumber(stored); ok {
+		b, ok := filterNumber(bound)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case a < b:
+			return -1, true
+		case a > b:
+			return 1, true
+		}
+		return 0, true
+	}
+	a, ok := filterTime(stored)
+	if !ok {
+		return 0, false
+	}
+	b, ok := filterTime(bound)
+	if !ok {
+		return 0, false
+	}
+	return a.Compare(b), true
+}
+
+// lookupPath walks a dotted path through nested metadata maps.
+func lookupPath(m map[string]interface{}, path string) (interface{}, bool) {
+	var current interface{} = m
+	for _, key := range strings.Split(path, ".") {
+		node, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		current, ok = node[key]
+		if !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// chunkFilterValue resolves a filter field on a chunk together with the
+// source, doc_type and metadata of its document.
+func chunkFilterValue(chunk *models.EnhancedChunk, source, docType string, docMetadata map[string]interface{}, field string) (interface{}, bool) {
+	switch field {
+	case "chunk_type":
+		return chunk.ChunkType, true
+	case "section":
+		return chunk.Section, chunk.Section != ""
+	case "subsection":
+		return chunk.Subsection, chunk.Subsection != ""
+	case "doc_type":
+		return docType, docType != ""
+	case "source":
+		return source, source != ""
+	case "document_id":
+		return chunk.DocumentID, chunk.DocumentID != ""
+	case "parent_chunk_id":
+		if chunk.ParentChunkID == nil || *chunk.ParentChunkID == "" {
+			return nil, false
+		}
+		return *chunk.ParentChunkID, true
+	case "chunk_index":
+		return chunk.ChunkIndex, true
+	case "start_pos":
+		return chunk.StartPos, true
+	case "end_pos":
+		return chunk.EndPos, true
+	case "confidence":
+		return chunk.Confidence, true
+	case "keywords":
+		return chunk.Keywords, len(chunk.Keywords) > 0
+	}
+	if path, ok := strings.CutPrefix(field, chunkMetadataPrefix); ok {
+		return lookupPath(chunk.Metadata, path)
+	}
+	if path, ok := strings.CutPrefix(field, documentMetadataPrefix); ok {
+		return lookupPath(docMetadata, path)
+	}
+	return nil, false
+}
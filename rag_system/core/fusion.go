@@ -0,0 +1,141 @@
+package core
+
+import (
+	"rag_system/models"
+	"sort"
+)
+
+// rrfK dampens the influence of top ranks in reciprocal rank fusion; 60 is
+// the value from the original RRF paper and works well without tuning.
+const rrfK = 60
+
+const defaultDenseWeight = 0.5
+
+// rankedList is one retrieval result list, best first.
+type rankedList struct {
+	chunks []*models.EnhancedChunk
+	scores []float64
+}
+
+// fuseRankedLists merges the dense and lexical result lists of a hybrid query
+// into one list ordered by fused score, and reports each chunk's rank in
+// both inputs.
+func fuseRankedLists(dense, lexical rankedList, method models.FusionMethod, denseWeight float64) ([]*models.EnhancedChunk, []float64, []models.RetrievalRank) {
+	if denseWeight <= 0 || denseWeight > 1 {
+		denseWeight = defaultDenseWeight
+	}
+
+	type entry struct {
+		chunk *models.EnhancedChunk
+		rank  models.RetrievalRank
+	}
+	entries := map[string]*entry{}
+	var order []string
+
+	get := func(chunk *models.EnhancedChunk) *entry {
+		e, ok := entries[chunk.ID]
+		if !ok {
+			e = &entry{chunk: chunk, rank: models.RetrievalRank{ChunkID: chunk.ID}}
+			entries[chunk.ID] = e
+			order = append(order, chunk.ID)
+		}
+		return e
+	}
+
+	denseNorm := minMaxNormalize(dense.scores)
+	lexicalNorm := minMaxNormalize(lexical.scores)
+
+	for i, chunk := range dense.chunks {
+		e := get(chunk)
+		e.rank.DenseRank = i + 1
+		e.rank.DenseScore = dense.scores[i]
+		if method == models.WeightedScoreFusion {
+			e.rank.FusedScore += denseWeight * denseNorm[i]
+		} else {
+			e.rank.FusedScore += 1.0 / float64(rrfK+i+1)
+		}
+	}
+	for i, chunk := range lexical.chunks {
+		e := get(chunk)
+		e.rank.LexicalRank = i + 1
+		e.rank.LexicalScore = lexical.scores[i]
+		if method == models.WeightedScoreFusion {
+			e.rank.FusedScore += (1 - denseWeight) * lexicalNorm[i]
+		} else {
+			e.rank.FusedScore += 1.0 / float64(rrfK+i+1)
+		}
+	}
+
+	sort.SliceStable(order, func(i, j int) bool {
+		return entries[order[i]].rank.FusedScore > entries[order[j]].rank.FusedScore
+	})
+
+	chunks := make([]*models.EnhancedChunk, len(order))
+	scores := make([]float64, len(order))
+	ranks := make([]models.RetrievalRank, len(order))
+	for i, id := range order {
+		e := entries[id]
+		chunks[i] = e.chunk
+		scores[i] = e.rank.FusedScore
+		ranks[i] = e.rank
+	}
+	return chunks, scores, ranks
+}
+
+// singleListRanks describes a dense-only or lexical-only result list in the
+// same shape as a fused one.
+func singleListRanks(chunks []*models.EnhancedChunk, scores []float64, mode models.RetrievalMode) []models.RetrievalRank {
+	ranks := make([]models.RetrievalRank, len(chunks))
+	for i, chunk := range chunks {
+		rank := models.RetrievalRank{ChunkID: chunk.ID, FusedScore: scores[i]}
+		if mode == models.LexicalRetrieval {
+			rank.LexicalRank, rank.LexicalScore = i+1, scores[i]
+		} else {
+			rank.DenseRank, rank.DenseScore = i+1, scores[i]
+		}
+		ranks[i] = rank
+	}
+	return ranks
+}
+
+// alignRanks reorders ranks to follow chunks after re-ranking, parent
+// inclusion or truncation changed the result list.
+func alignRanks(chunks []*models.EnhancedChunk, ranks []models.RetrievalRank) []models.RetrievalRank {
+	byID := make(map[string]models.RetrievalRank, len(ranks))
+	for _, r := range ranks {
+		byID[r.ChunkID] = r
+	}
+	aligned := make([]models.RetrievalRank, len(chunks))
+	for i, chunk := range chunks {
+		if r, ok := byID[chunk.ID]; ok {
+			aligned[i] = r
+		} else {
+			aligned[i] = models.RetrievalRank{ChunkID: chunk.ID}
+		}
+	}
+	return aligned
+}
+
+func minMaxNormalize(scores []float64) []float64 {
+	out := make([]float64, len(scores))
+	if len(scores) == 0 {
+		return out
+	}
+	lo, hi := scores[0], scores[0]
+	for _, s := range scores {
+		if s < lo {
+			lo = s
+		}
+		if s > hi {
+			hi = s
+		}
+	}
+	for i, s := range scores {
+		if hi == lo {
+			out[i] = 1
+		} else {
+			out[i] = (s - lo) / (hi - lo)
+		}
+	}
+	return out
+}
@@ -1,74 +1,116 @@
 package core
 
 import (
-	"bytes"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
-	"os"
 	"rag_system/models"
+	"rag_system/provider"
+	"sort"
 )
 
-var httpClient = &http.Client{}
+// ErrUnknownProvider is wrapped by errors about provider names that are not
+// configured.
+var ErrUnknownProvider = errors.New("unknown llm provider")
 
-func GenerateChatCompletion(messages []models.ChatCompletionMessage, modelName string) (string, error) {
-	if modelName == "" {
-		modelName = "gpt-4.1-mini"
-	}
-
-	log.Println("Request recieved to call Openai")
+// LLMService answers prompts through the configured chat providers.
+type LLMService struct {
+	providers       map[string]provider.ChatProvider
+	configs         map[string]provider.Config
+	defaultProvider string
+}
 
-	reqPayload := models.ChatCompletionRequest{
-		Model:    modelName,
-		Messages: messages,
+// NewLLMService builds a client for every configured provider that serves
+// chat. defaultProvider answers queries for which neither the request nor the
+// collection picks one.
+func NewLLMService(configs map[string]provider.Config, defaultProvider string) (*LLMService, error) {
+	l := &LLMService{
+		providers:       make(map[string]provider.ChatProvider, len(configs)),
+		configs:         configs,
+		defaultProvider: defaultProvider,
 	}
-
-	payloadBytes, err := json.Marshal(reqPayload)
-
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %w", err)
+	for name, cfg := range configs {
+		if !cfg.Type.ServesChat() {
+			continue
+		}
+		chat, err := provider.NewChat(name, cfg)
+		if err != nil {
+			return nil, err
+		}
+		l.providers[name] = chat
 	}
-
-	apiURL := "https://api.openai.com/v1/chat/completions"
-
-	req, err := http.NewRequest(
-		"POST",
-		apiURL,
-		bytes.NewBuffer(payloadBytes),
-	)
-	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+	if _, ok := l.providers[defaultProvider]; !ok {
+		return nil, fmt.Errorf("%w: llm_provider %q (configured: %v)", ErrUnknownProvider, defaultProvider, l.ProviderNames())
 	}
+	return l, nil
+}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+os.Getenv("OPENAI_API_KEY"))
-
-	resp, err := httpClient.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("failed to call OpenAI API: %w", err)
+// ProviderNames lists the configured providers, sorted.
+func (l *LLMService) ProviderNames() []string {
+	names := make([]string, 0, len(l.providers))
+	for name := range l.providers {
+		names = append(names, name)
 	}
-	defer resp.Body.Close()
-
-	bodyBytes, _ := io.ReadAll(resp.Body)
+	sort.Strings(names)
+	return names
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("OpenAI API error: %s", string(bodyBytes))
+// CheckSelection rejects a selection naming a provider that is not configured.
+func (l *LLMService) CheckSelection(sel models.LLMSelection) error {
+	if sel.LLMProvider == "" {
+		return nil
 	}
+	if _, ok := l.providers[sel.LLMProvider]; !ok {
+		return fmt.Errorf("%w: %q (configured: %v)", ErrUnknownProvider, sel.LLMProvider, l.ProviderNames())
+	}
+	return nil
+}
 
-	var completionResponse models.ChatCompletionResponse
-
-	err = json.Unmarshal(bodyBytes, &completionResponse)
-	if err != nil {
-		return "", fmt.Errorf("failed to decode response: %w", err)
+// Resolve picks the provider and model from selections ordered from highest
+// to lowest precedence, ending with the deployment default. The first level
+// naming a provider decides it; a model set at that level or above wins over
+// the provider's configured chat model.
+func (l *LLMService) Resolve(levels ...models.LLMSelection) (models.LLMSelection, error) {
+	levels = append(levels, models.LLMSelection{LLMProvider: l.defaultProvider})
+
+	var sel models.LLMSelection
+	for _, level := range levels {
+		if sel.ChatModel == "" {
+			sel.ChatModel = level.ChatModel
+		}
+		if level.LLMProvider != "" {
+			sel.LLMProvider = level.LLMProvider
+			break
+		}
 	}
 
-	if len(completionResponse.Choices) == 0 {
-		return "", fmt.Errorf("no response choices returned")
+	if err := l.CheckSelection(sel); err != nil {
+		return sel, err
+	}
+	if sel.ChatModel == "" {
+		sel.ChatModel = l.configs[sel.LLMProvider].ChatModel
 	}
+	if sel.ChatModel == "" {
+		return sel, fmt.Errorf("provider %q has no chat_model configured", sel.LLMProvider)
+	}
+	return sel, nil
+}
 
-	log.Println("Response from OpenAI:", completionResponse.Choices[0].Message.Content)
+// GenerateResponse sends prompt as a single user message to the selected
+// provider and model.
+func (l *LLMService) GenerateResponse(prompt string, sel models.LLMSelection) (string, error) {
+	chat, ok := l.providers[sel.LLMProvider]
+	if !ok {
+		return "", fmt.Errorf("%w: %q", ErrUnknownProvider, sel.LLMProvider)
+	}
 
-	return completionResponse.Choices[0].Message.Content, nil
+	log.Printf("Generating answer with %s (%s)", sel.LLMProvider, sel.ChatModel)
+	messages := []models.ChatCompletionMessage{
+		{Role: "user", Content: prompt},
+	}
+	answer, err := chat.ChatCompletion(messages, sel.ChatModel)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", sel.LLMProvider, err)
+	}
+	return answer, nil
 }
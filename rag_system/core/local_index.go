@@ -0,0 +1,108 @@
+package core
+
+import (
+	"fmt"
+	"log"
+	"rag_system/hnsw"
+)
+
+var _ IndexTuner = (*LocalVectorStore)(nil)
+
+// IndexSettings returns the HNSW parameters and size of a collection's index.
+func (s *LocalVectorStore) IndexSettings(collectionName string) (map[string]interface{}, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	col, ok := s.collections[collectionName]
+	if !ok {
+		return nil, fmt.Errorf("collection '%s' not found", collectionName)
+	}
+
+	searchMode := "hnsw"
+	if col.index.Len() < exactSearchMaxPoints {
+		searchMode = "exact"
+	}
+
+	return map[string]interface{}{
+		"collection_name":  collectionName,
+		"config":           col.IndexConfig,
+		"indexed_vectors":  col.index.Len(),
+		"dimension":        col.index.Dimension(),
+		"search_mode":      searchMode,
+		"exact_search_max": exactSearchMaxPoints,
+	}, nil
+}
+
+// SetIndexConfig changes a collection's HNSW parameters. Changing M or
+// ef_construction rebuilds the graph; ef_search alone takes effect immediately.
+func (s *LocalVectorStore) SetIndexConfig(collectionName string, cfg hnsw.Config) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	col, ok := s.collections[collectionName]
+	if !ok {
+		return fmt.Errorf("collection '%s' not found", collectionName)
+	}
+
+	current := col.IndexConfig
+	if cfg.M == 0 {
+		cfg.M = current.M
+	}
+	if cfg.EfConstruction == 0 {
+		cfg.EfConstruction = current.EfConstruction
+	}
+	if cfg.EfSearch == 0 {
+		cfg.EfSearch = current.EfSearch
+	}
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	col.IndexConfig = cfg
+	if cfg.M == current.M && cfg.EfConstruction == current.EfConstruction {
+		col.index.SetEfSearch(cfg.EfSearch)
+	} else {
+		log.Printf("Rebuilding index of collection %s with m=%d ef_construction=%d", collectionName, cfg.M, cfg.EfConstruction)
+		if err := s.rebuildIndex(col); err != nil {
+			return err
+		}
+	}
+
+	return s.saveLocked(col)
+}
+
+// BenchmarkIndex measures recall@k and latency of candidate HNSW parameters on
+// the collection's own vectors. A held-out sample of stored vectors is used as
+// queries. With no configs, the current M/ef_construction is tried with a
+// range of ef_search values.
+func (s *LocalVectorStore) BenchmarkIndex(collectionName string, k, queries int, configs []hnsw.Config) ([]hnsw.BenchmarkResult, error) {
+	s.mu.RLock()
+	col, ok := s.collections[collectionName]
+	if !ok {
+		s.mu.RUnlock()
+		return nil, fmt.Errorf("collection '%s' not found", collectionName)
+	}
+	current := col.IndexConfig
+	var ids []string
+	var vectors [][]float32
+	for id, point := range col.Points {
+		if hasSignal(point.Vector) {
+			ids = append(ids, id)
+			vectors = append(vectors, point.Vector)
+		}
+	}
+	s.mu.RUnlock()
+
+	if len(vectors) < 2 {
+		return nil, fmt.Errorf("collection '%s' needs at least 2 embedded chunks to benchmark", collectionName)
+	}
+
+	if len(configs) == 0 {
+		for _, ef := range []int{16, 32, 64, 128, 256} {
+			configs = append(configs, hnsw.Config{M: current.M, EfConstruction: current.EfConstruction, EfSearch: ef})
+		}
+	}
+
+	dataIDs, data, sample := hnsw.SampleQueries(ids, vectors, queries, 1)
+	return hnsw.Benchmark(dataIDs, data, sample, k, configs)
+}
@@ -0,0 +1,206 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"rag_system/models"
+)
+
+// Writes to a local collection are appended to its log rather than
+// rewriting the collection file and index, which would make every write
+// cost as much as the whole collection. The log is folded into a new
+// snapshot once it outgrows the snapshot, at least localLogMinCompact
+// bytes, and on Close; on open it is replayed on top of the snapshot.
+
+const (
+	localLogExt        = ".log"
+	localLogMinCompact = 4 << 20
+)
+
+// localLogRecord is one write: points stored or replaced, then points
+// deleted. Each record is framed by its length, so a record torn by a crash
+// is detected and dropped.
+type localLogRecord struct {
+	Put    []localPointRecord
+	Delete []string
+}
+
+func (s *LocalVectorStore) logPath(name string) string {
+	return filepath.Join(s.dir, name+localLogExt)
+}
+
+// appendLocked logs stored and deleted points of a collection, whose
+// in-memory state already reflects them, and snapshots the collection once
+// the log has outgrown it.
+func (s *LocalVectorStore) appendLocked(col *localCollection, put []*localPoint, deleted []string) error {
+	if len(put) == 0 && len(deleted) == 0 {
+		return nil
+	}
+	record := localLogRecord{Delete: deleted}
+	for _, point := range put {
+		encoded, err := encodePoint(point)
+		if err != nil {
+			return err
+		}
+		record.Put = append(record.Put, encoded)
+	}
+
+	var frame bytes.Buffer
+	frame.Write(make([]byte, 4))
+	if err := gob.NewEncoder(&frame).Encode(&record); err != nil {
+		return fmt.Errorf("failed to encode log record of collection %s: %w", col.Name, err)
+	}
+	binary.BigEndian.PutUint32(frame.Bytes(), uint32(frame.Len()-4))
+
+	f, err := os.OpenFile(s.logPath(col.Name), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open log of collection %s: %w", col.Name, err)
+	}
+	if _, err := f.Write(frame.Bytes()); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to append to log of collection %s: %w", col.Name, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to append to log of collection %s: %w", col.Name, err)
+	}
+
+	col.logSize += int64(frame.Len())
+	if col.logSize > max(localLogMinCompact, col.snapshotSize) {
+		return s.saveLocked(col)
+	}
+	return nil
+}
+
+// replayLog applies a collection's log to its points and index. A torn
+// record at the end of the log, left by a crash mid-write, is cut off.
+func (s *LocalVectorStore) replayLog(col *localCollection) error {
+	path := s.logPath(col.Name)
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open log of collection %s: %w", col.Name, err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to open log of collection %s: %w", col.Name, err)
+	}
+
+	r := bufio.NewReader(f)
+	var offset int64
+	records := 0
+	for {
+		record, size, err := readLogRecord(r, info.Size()-offset)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Printf("Warning: dropping the end of the log of collection %s after %d records: %v", col.Name, records, err)
+			if err := os.Truncate(path, offset); err != nil {
+				return fmt.Errorf("failed to truncate log of collection %s: %w", col.Name, err)
+			}
+			break
+		}
+		if err := col.applyLogRecord(record); err != nil {
+			return fmt.Errorf("failed to replay log of collection %s: %w", col.Name, err)
+		}
+		offset += size
+		records++
+	}
+	col.logSize = offset
+	return nil
+}
+
+// readLogRecord reads one framed record, with at most remaining bytes left
+// in the log, and returns its size on disk.
+func readLogRecord(r *bufio.Reader, remaining int64) (*localLogRecord, int64, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if err == io.EOF {
+			return nil, 0, io.EOF
+		}
+		return nil, 0, fmt.Errorf("torn record header: %w", err)
+	}
+	length := int64(binary.BigEndian.Uint32(header[:]))
+	if length > remaining-int64(len(header)) {
+		return nil, 0, fmt.Errorf("torn record: %d bytes announced, %d left", length, remaining-int64(len(header)))
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, 0, fmt.Errorf("torn record: %w", err)
+	}
+	var record localLogRecord
+	if err := gob.NewDecoder(bytes.NewReader(body)).Decode(&record); err != nil {
+		return nil, 0, fmt.Errorf("corrupt record: %w", err)
+	}
+	return &record, int64(len(header) + len(body)), nil
+}
+
+func (c *localCollection) applyLogRecord(record *localLogRecord) error {
+	for _, encoded := range record.Put {
+		point, err := decodePoint(encoded)
+		if err != nil {
+			return err
+		}
+		if err := c.indexPoint(point); err != nil {
+			return err
+		}
+		c.Points[point.Chunk.ID] = point
+	}
+	for _, id := range record.Delete {
+		delete(c.Points, id)
+		c.index.Delete(id)
+	}
+	return nil
+}
+
+// encodePoint returns the on-disk form of a point.
+func encodePoint(point *localPoint) (localPointRecord, error) {
+	chunkJSON, err := json.Marshal(point.Chunk)
+	if err != nil {
+		return localPointRecord{}, fmt.Errorf("failed to encode chunk %s: %w", point.Chunk.ID, err)
+	}
+	record := localPointRecord{
+		Chunk:   chunkJSON,
+		Source:  point.Source,
+		DocType: point.DocType,
+		Vector:  point.Vector,
+	}
+	if len(point.DocMetadata) > 0 {
+		if record.DocMetadata, err = json.Marshal(point.DocMetadata); err != nil {
+			return localPointRecord{}, fmt.Errorf("failed to encode document metadata of chunk %s: %w", point.Chunk.ID, err)
+		}
+	}
+	return record, nil
+}
+
+// decodePoint rebuilds a point from its on-disk form.
+func decodePoint(record localPointRecord) (*localPoint, error) {
+	chunk := &models.EnhancedChunk{}
+	if err := json.Unmarshal(record.Chunk, chunk); err != nil {
+		return nil, fmt.Errorf("failed to decode chunk: %w", err)
+	}
+	chunk.Embedding = record.Vector
+	point := &localPoint{
+		Chunk:   chunk,
+		Source:  record.Source,
+		DocType: record.DocType,
+		Vector:  record.Vector,
+	}
+	if len(record.DocMetadata) > 0 {
+		if err := json.Unmarshal(record.DocMetadata, &point.DocMetadata); err != nil {
+			return nil, fmt.Errorf("failed to decode document metadata: %w", err)
+		}
+	}
+	return point, nil
+}
@@ -0,0 +1,940 @@
+package core
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"rag_system/hnsw"
+	"rag_system/models"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// LocalVectorStore is an embedded VectorStore that needs no external services.
+// Every collection is held in memory and persisted as a gob snapshot under
+// the store directory (config.VectorDBPath), one file per collection, with
+// its HNSW index saved next to it and a log of the writes made since.
+// Collection and document records live in the Registry in the same directory.
+type LocalVectorStore struct {
+	mu            sync.RWMutex
+	dir           string
+	indexDefaults hnsw.Config
+	collections   map[string]*localCollection
+	registry      *Registry
+}
+
+type localCollection struct {
+	Name        string
+	Description string
+	CreatedAt   time.Time
+	IndexConfig hnsw.Config
+	Points      map[string]*localPoint // keyed by chunk ID
+	index       *hnsw.Index
+	lexical     *BM25Index // Rebuilt from chunk text on load
+
+	logSize      int64 // Bytes of writes logged since the snapshot
+	snapshotSize int64
+}
+
+type localPoint struct {
+	Chunk       *models.EnhancedChunk
+	Source      string
+	DocType     string
+	DocMetadata map[string]interface{} // Document-level metadata, for filters
+	Vector      []float32
+}
+
+// localCollectionFile is the on-disk form of a collection. Chunks are kept as
+// JSON because their metadata maps hold arbitrary values gob cannot encode.
+type localCollectionFile struct {
+	Name        string
+	Description string
+	CreatedAt   time.Time
+	IndexConfig hnsw.Config
+	Points      []localPointRecord
+}
+
+type localPointRecord struct {
+	Chunk       []byte
+	Source      string
+	DocType     string
+	DocMetadata []byte // JSON, like Chunk
+	Vector      []float32
+}
+
+var collectionNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+const (
+	localCollectionExt = ".gob"
+	localIndexExt      = ".hnsw"
+
+	// Collections smaller than this are searched exactly; the HNSW graph only
+	// pays off once brute force gets expensive.
+	exactSearchMaxPoints = 1000
+)
+
+// NewLocalVectorStore opens (or creates) an embedded store rooted at dir and
+// loads every collection found there. indexDefaults are the HNSW parameters
+// given to new collections.
+func NewLocalVectorStore(dir string, indexDefaults hnsw.Config) (*LocalVectorStore, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("vector_db_path must be set for the local vector store")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create vector store directory %s: %w", dir, err)
+	}
+
+	registry, err := OpenRegistry(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	store := &LocalVectorStore{
+		dir:           dir,
+		indexDefaults: indexDefaults,
+		collections:   make(map[string]*localCollection),
+		registry:      registry,
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*"+localCollectionExt))
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan vector store directory: %w", err)
+	}
+	for _, file := range files {
+		col, err := loadLocalCollection(file)
+		if err != nil {
+			return nil, err
+		}
+		if err := store.openIndex(col); err != nil {
+			return nil, err
+		}
+		if err := store.replayLog(col); err != nil {
+			return nil, err
+		}
+		col.rebuildLexical()
+		store.collections[col.Name] = col
+	}
+	if err := store.importIntoRegistry(); err != nil {
+		return nil, err
+	}
+
+	log.Printf("Opened local vector store at %s (%d collections)", dir, len(store.collections))
+	return store, nil
+}
+
+// CreateCollection creates an empty collection. Creating an existing collection is a no-op.
+func (s *LocalVectorStore) CreateCollection(name, description string, schema models.CollectionSchema) error {
+	if err := validateSchema(&schema); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.createCollectionLocked(name, description, schema)
+	return err
+}
+
+// GetCollectionInfo returns a collection's registry record.
+func (s *LocalVectorStore) GetCollectionInfo(name string) (*models.CollectionInfo, error) {
+	info, ok := s.registry.Collection(name)
+	if !ok {
+		return nil, fmt.Errorf("collection '%s' not found", name)
+	}
+	return info, nil
+}
+
+// AddDocument stores all chunks of a document, together with any embeddings
+// already attached to them.
+func (s *LocalVectorStore) AddDocument(collectionName string, doc *models.Document) error {
+	dim, err := embeddingDimension(doc.Chunks)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	col, err := s.createCollectionLocked(collectionName, "", models.CollectionSchema{Dimension: dim})
+	if err != nil {
+		return err
+	}
+	if dim > 0 {
+		if err := s.registry.CheckDimension(collectionName, dim); err != nil {
+			return err
+		}
+	}
+
+	points := make([]*localPoint, 0, len(doc.Chunks))
+	for _, chunk := range doc.Chunks {
+		// Keep the same contract as the Qdrant backend: AddEmbeddings finds the
+		// target collection through this metadata key.
+		if chunk.Metadata == nil {
+			chunk.Metadata = make(map[string]interface{})
+		}
+		chunk.Metadata["collection_name"] = collectionName
+
+		point := &localPoint{
+			Chunk:       chunk,
+			Source:      doc.Source,
+			DocType:     doc.DocType,
+			DocMetadata: doc.Metadata,
+			Vector:      chunk.Embedding,
+		}
+		if err := col.indexPoint(point); err != nil {
+			return err
+		}
+		col.lexical.Add(chunk.ID, chunk.Text)
+		col.Points[chunk.ID] = point
+		points = append(points, point)
+	}
+
+	if err := s.appendLocked(col, points, nil); err != nil {
+		return err
+	}
+	if err := s.registry.PutDocument(newDocumentInfo(collectionName, doc)); err != nil {
+		return err
+	}
+
+	log.Printf("Stored document %s with %d chunks into collection %s", doc.ID, len(doc.Chunks), collectionName)
+	return nil
+}
+
+// AddEmbeddings sets the vectors of the given chunks, inserting chunks that
+// were not stored through AddDocument.
+func (s *LocalVectorStore) AddEmbeddings(chunks []*models.EnhancedChunk) error {
+	if len(chunks) == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	byCollection := map[string][]*models.EnhancedChunk{}
+	for _, chunk := range chunks {
+		if len(chunk.Embedding) == 0 {
+			continue
+		}
+		col := "default"
+		if chunk.Metadata != nil {
+			if c, ok := chunk.Metadata["collection_name"].(string); ok && c != "" {
+				col = c
+			}
+		}
+		byCollection[col] = append(byCollection[col], chunk)
+	}
+	if len(byCollection) == 0 {
+		return fmt.Errorf("no valid embeddings found in chunks")
+	}
+
+	for collectionName, colChunks := range byCollection {
+		dim, err := embeddingDimension(colChunks)
+		if err != nil {
+			return err
+		}
+		col, err := s.createCollectionLocked(collectionName, "", models.CollectionSchema{Dimension: dim})
+		if err != nil {
+			return err
+		}
+		if err := s.registry.CheckDimension(collectionName, dim); err != nil {
+			return err
+		}
+
+		var changed []*localPoint
+		for _, chunk := range colChunks {
+			point, ok := col.Points[chunk.ID]
+			if !ok {
+				point = &localPoint{}
+			}
+			// AddDocument usually indexed and logged this exact chunk already
+			unchanged := ok && equalVectors(point.Vector, chunk.Embedding) && col.index.Contains(chunk.ID)
+			if unchanged && point.Chunk == chunk {
+				continue
+			}
+			changed = append(changed, point)
+			if !ok || point.Chunk.Text != chunk.Text {
+				col.lexical.Add(chunk.ID, chunk.Text)
+			}
+			point.Chunk = chunk
+			point.Vector = chunk.Embedding
+			if unchanged {
+				continue
+			}
+			if err := col.indexPoint(point); err != nil {
+				return err
+			}
+			col.Points[chunk.ID] = point
+		}
+
+		if err := s.appendLocked(col, changed, nil); err != nil {
+			return err
+		}
+		log.Printf("Upserted %d embeddings into collection %s", len(colChunks), collectionName)
+	}
+
+	return nil
+}
+
+// QuerySimilarChunks returns the topK chunks most similar to the query by
+// cosine similarity. Large collections are searched through the HNSW index;
+// small ones, and filtered searches the index cannot satisfy, exactly.
+func (s *LocalVectorStore) QuerySimilarChunks(collectionName string, queryEmbedding []float32, topK int, filter *models.FilterExpr) ([]*models.EnhancedChunk, []float64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	col, ok := s.collections[collectionName]
+	if !ok {
+		return nil, nil, fmt.Errorf("collection '%s' not found", collectionName)
+	}
+	if err := s.registry.CheckDimension(collectionName, len(queryEmbedding)); err != nil {
+		return nil, nil, err
+	}
+
+	if col.index.Len() >= exactSearchMaxPoints {
+		accept := func(id string) bool { return matchFilter(filter, col.Points[id]) }
+		hits := col.index.SearchFiltered(queryEmbedding, topK, accept)
+		if len(hits) >= topK || filter == nil {
+			chunks := make([]*models.EnhancedChunk, len(hits))
+			scores := make([]float64, len(hits))
+			for i, hit := range hits {
+				chunks[i] = col.Points[hit.ID].result()
+				scores[i] = hit.Score
+			}
+			return chunks, scores, nil
+		}
+	}
+
+	return col.exactSearch(queryEmbedding, topK, filter)
+}
+
+// QueryLexical ranks the collection's chunks against the query text with BM25.
+func (s *LocalVectorStore) QueryLexical(collectionName string, query string, topK int, filter *models.FilterExpr) ([]*models.EnhancedChunk, []float64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	col, ok := s.collections[collectionName]
+	if !ok {
+		return nil, nil, fmt.Errorf("collection '%s' not found", collectionName)
+	}
+
+	accept := func(id string) bool { return matchFilter(filter, col.Points[id]) }
+	hits := col.lexical.Search(query, topK, accept)
+
+	chunks := make([]*models.EnhancedChunk, len(hits))
+	scores := make([]float64, len(hits))
+	for i, hit := range hits {
+		chunks[i] = col.Points[hit.ID].result()
+		scores[i] = hit.Score
+	}
+	return chunks, scores, nil
+}
+
+// exactSearch scores every stored vector against the query.
+func (c *localCollection) exactSearch(queryEmbedding []float32, topK int, filter *models.FilterExpr) ([]*models.EnhancedChunk, []float64, error) {
+	type scored struct {
+		point *localPoint
+		score float64
+	}
+
+	var candidates []scored
+	for _, point := range c.Points {
+		if len(point.Vector) == 0 || !matchFilter(filter, point) {
+			continue
+		}
+		if len(point.Vector) != len(queryEmbedding) {
+			continue
+		}
+		candidates = append(candidates, scored{point: point, score: cosineSimilarity(queryEmbedding, point.Vector)})
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].score > candidates[j].score
+	})
+	if topK > 0 && len(candidates) > topK {
+		candidates = candidates[:topK]
+	}
+
+	chunks := make([]*models.EnhancedChunk, len(candidates))
+	scores := make([]float64, len(candidates))
+	for i, c := range candidates {
+		chunks[i] = c.point.result()
+		scores[i] = c.score
+	}
+	return chunks, scores, nil
+}
+
+// GetChunkWithParents retrieves a chunk and walks up its parent hierarchy.
+func (s *LocalVectorStore) GetChunkWithParents(chunkID string) ([]*models.EnhancedChunk, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, col := range s.collections {
+		point, ok := col.Points[chunkID]
+		if !ok {
+			continue
+		}
+
+		// Walk up the parent hierarchy, prepending so order is root → leaf
+		var hierarchy []*models.EnhancedChunk
+		for point != nil {
+			hierarchy = append([]*models.EnhancedChunk{point.result()}, hierarchy...)
+			parentID := point.Chunk.ParentChunkID
+			if parentID == nil || *parentID == "" {
+				break
+			}
+			point = col.Points[*parentID]
+		}
+		return hierarchy, nil
+	}
+
+	return nil, fmt.Errorf("chunk %s not found", chunkID)
+}
+
+// ListCollections returns all collections with their registry records.
+func (s *LocalVectorStore) ListCollections() ([]map[string]interface{}, error) {
+	return s.registry.CollectionSummaries(), nil
+}
+
+// DeleteCollection removes a collection and its file.
+func (s *LocalVectorStore) DeleteCollection(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.collections[name]; !ok {
+		return fmt.Errorf("collection '%s' not found", name)
+	}
+	if err := s.registry.CheckDeletable(name); err != nil {
+		return err
+	}
+	if err := os.Remove(s.collectionPath(name)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete collection: %w", err)
+	}
+	if err := os.Remove(s.indexPath(name)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete collection index: %w", err)
+	}
+	if err := os.Remove(s.logPath(name)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete collection log: %w", err)
+	}
+	delete(s.collections, name)
+	return s.registry.DeleteCollection(name)
+}
+
+// ReplaceCollection saves replacement's chunks under name's files and
+// removes replacement. name keeps its description and creation time.
+func (s *LocalVectorStore) ReplaceCollection(name, replacement string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	col, ok := s.collections[name]
+	if !ok {
+		return fmt.Errorf("collection '%s' not found", name)
+	}
+	repl, ok := s.collections[replacement]
+	if !ok {
+		return fmt.Errorf("collection '%s' not found", replacement)
+	}
+
+	repl.Name = name
+	repl.Description = col.Description
+	repl.CreatedAt = col.CreatedAt
+	for _, point := range repl.Points {
+		if point.Chunk.Metadata != nil {
+			point.Chunk.Metadata["collection_name"] = name
+		}
+	}
+	if err := s.saveLocked(repl); err != nil {
+		return err
+	}
+	s.collections[name] = repl
+	delete(s.collections, replacement)
+
+	if err := os.Remove(s.collectionPath(replacement)); err != nil && !os.IsNotExist(err) {
+		log.Printf("Warning: could not remove replaced collection file %s: %v", replacement, err)
+	}
+	if err := os.Remove(s.indexPath(replacement)); err != nil && !os.IsNotExist(err) {
+		log.Printf("Warning: could not remove replaced collection index %s: %v", replacement, err)
+	}
+	if err := os.Remove(s.logPath(replacement)); err != nil && !os.IsNotExist(err) {
+		log.Printf("Warning: could not remove replaced collection log %s: %v", replacement, err)
+	}
+	return s.registry.ReplaceCollection(name, replacement)
+}
+
+// MarkShadow records that name is the shadow a re-embed job builds to
+// replace collection.
+func (s *LocalVectorStore) MarkShadow(name, collection string) error {
+	return s.registry.SetShadow(name, collection, false)
+}
+
+// SetCollectionLLM records the provider and chat model of a collection.
+func (s *LocalVectorStore) SetCollectionLLM(name string, llm models.LLMSelection) error {
+	return s.registry.SetCollectionLLM(name, llm)
+}
+
+// ResolveCollection returns the collection an alias points to, or name.
+func (s *LocalVectorStore) ResolveCollection(name string) string {
+	return s.registry.Resolve(name)
+}
+
+// ListAliases returns every alias and its collection.
+func (s *LocalVectorStore) ListAliases() map[string]string {
+	return s.registry.Aliases()
+}
+
+// UpdateAliases applies alias actions atomically.
+func (s *LocalVectorStore) UpdateAliases(actions []models.AliasAction) error {
+	return s.registry.UpdateAliases(actions)
+}
+
+// ListDocuments returns the registered documents of a collection.
+func (s *LocalVectorStore) ListDocuments(collectionName string) ([]map[string]interface{}, error) {
+	s.mu.RLock()
+	_, ok := s.collections[collectionName]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("failed to list documents: collection '%s' not found", collectionName)
+	}
+	return s.registry.DocumentSummaries(collectionName), nil
+}
+
+// DeleteDocument deletes all chunks belonging to a document ID across all collections.
+func (s *LocalVectorStore) DeleteDocument(documentID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deleted := false
+	for _, col := range s.collections {
+		var removed []string
+		for id, point := range col.Points {
+			if point.Chunk.DocumentID == documentID {
+				delete(col.Points, id)
+				col.index.Delete(id)
+				col.lexical.Remove(id)
+				removed = append(removed, id)
+			}
+		}
+		if len(removed) == 0 {
+			continue
+		}
+		if err := s.appendLocked(col, nil, removed); err != nil {
+			return err
+		}
+		deleted = true
+		log.Printf("Deleted chunks for document '%s' from collection '%s'", documentID, col.Name)
+	}
+
+	if !deleted {
+		return fmt.Errorf("document with ID '%s' not found", documentID)
+	}
+	_, err := s.registry.DeleteDocument(documentID)
+	return err
+}
+
+// DeleteAllDocumentsInCollection deletes every chunk but keeps the collection.
+func (s *LocalVectorStore) DeleteAllDocumentsInCollection(collectionName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	col, ok := s.collections[collectionName]
+	if !ok || len(col.Points) == 0 {
+		return fmt.Errorf("no documents found in collection '%s'", collectionName)
+	}
+
+	col.Points = make(map[string]*localPoint)
+	col.lexical = NewBM25Index()
+	if err := s.rebuildIndex(col); err != nil {
+		return err
+	}
+	if err := s.saveLocked(col); err != nil {
+		return err
+	}
+	if err := s.registry.DeleteDocuments(collectionName); err != nil {
+		return err
+	}
+
+	log.Printf("Deleted all documents from collection '%s'", collectionName)
+	return nil
+}
+
+// ExportDocuments returns every document of a collection with its chunks.
+func (s *LocalVectorStore) ExportDocuments(collectionName string) ([]*models.Document, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	col, ok := s.collections[collectionName]
+	if !ok {
+		return nil, fmt.Errorf("collection '%s' not found", collectionName)
+	}
+	chunks := make([]*models.EnhancedChunk, 0, len(col.Points))
+	for _, point := range col.Points {
+		// Exported chunks are written elsewhere, so they get their own metadata
+		chunk := point.result()
+		chunk.Metadata = make(map[string]interface{}, len(point.Chunk.Metadata))
+		for key, value := range point.Chunk.Metadata {
+			chunk.Metadata[key] = value
+		}
+		chunks = append(chunks, chunk)
+	}
+	return assembleDocuments(s.registry.Documents(collectionName), chunks), nil
+}
+
+// GetCollectionStats returns stats for a named collection.
+func (s *LocalVectorStore) GetCollectionStats(collectionName string) (map[string]interface{}, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	col, ok := s.collections[collectionName]
+	if !ok {
+		return nil, fmt.Errorf("collection '%s' not found", collectionName)
+	}
+
+	chunkTypes := map[string]int{}
+	for _, point := range col.Points {
+		if ct := point.Chunk.ChunkType; ct != "" {
+			chunkTypes[ct]++
+		}
+	}
+
+	summary, _ := s.registry.CollectionSummary(collectionName)
+	return map[string]interface{}{
+		"name":               col.Name,
+		"description":        summary["description"],
+		"embedding_provider": summary["embedding_provider"],
+		"embedding_model":    summary["embedding_model"],
+		"created_at":         summary["created_at"],
+		"updated_at":         summary["updated_at"],
+		"document_count":     summary["doc_count"],
+		"chunk_count":        len(col.Points),
+		"chunk_types":        chunkTypes,
+		"document_types":     summary["document_types"],
+	}, nil
+}
+
+// Close folds the log of every collection into its snapshot.
+func (s *LocalVectorStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, col := range s.collections {
+		if col.logSize == 0 {
+			continue
+		}
+		if err := s.saveLocked(col); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ── internal helpers ──────────────────────────────────────────────────────────
+
+func (s *LocalVectorStore) createCollectionLocked(name, description string, schema models.CollectionSchema) (*localCollection, error) {
+	if col, ok := s.collections[name]; ok {
+		return col, nil
+	}
+	if !collectionNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("invalid collection name %q: use letters, digits, '_', '-' or '.'", name)
+	}
+	if s.registry.IsAlias(name) {
+		return nil, fmt.Errorf("%w: '%s' is an alias", ErrAliasConflict, name)
+	}
+
+	col := &localCollection{
+		Name:        name,
+		Description: description,
+		CreatedAt:   time.Now().UTC(),
+		IndexConfig: s.indexDefaults,
+		Points:      make(map[string]*localPoint),
+		lexical:     NewBM25Index(),
+	}
+	if err := s.rebuildIndex(col); err != nil {
+		return nil, err
+	}
+	if err := s.saveLocked(col); err != nil {
+		return nil, err
+	}
+	if err := s.registry.EnsureCollection(name, description, schema); err != nil {
+		return nil, err
+	}
+	s.collections[name] = col
+	return col, nil
+}
+
+// importIntoRegistry registers collections and documents stored before the
+// registry existed. Their documents get the collection's creation time.
+func (s *LocalVectorStore) importIntoRegistry() error {
+	var collections []*models.CollectionInfo
+	var documents []*models.DocumentInfo
+	for _, col := range s.sortedCollections() {
+		if !s.registry.HasCollection(col.Name) {
+			collections = append(collections, &models.CollectionInfo{
+				Name:        col.Name,
+				Description: col.Description,
+				CollectionSchema: models.CollectionSchema{
+					Dimension: col.index.Dimension(),
+					Distance:  models.CosineDistance,
+				},
+				CreatedAt: col.CreatedAt,
+				UpdatedAt: col.CreatedAt,
+			})
+		}
+
+		docs := map[string]*models.DocumentInfo{}
+		for _, point := range col.Points {
+			docID := point.Chunk.DocumentID
+			if docID == "" || s.registry.HasDocument(col.Name, docID) {
+				continue
+			}
+			doc, ok := docs[docID]
+			if !ok {
+				doc = &models.DocumentInfo{
+					ID:             docID,
+					CollectionName: col.Name,
+					Source:         point.Source,
+					DocType:        point.DocType,
+					Metadata:       point.DocMetadata,
+					CreatedAt:      col.CreatedAt,
+					UpdatedAt:      col.CreatedAt,
+				}
+				docs[docID] = doc
+				documents = append(documents, doc)
+			}
+			doc.ChunkCount++
+		}
+	}
+	return s.registry.Import(collections, documents)
+}
+
+func (s *LocalVectorStore) sortedCollections() []*localCollection {
+	cols := make([]*localCollection, 0, len(s.collections))
+	for _, col := range s.collections {
+		cols = append(cols, col)
+	}
+	sort.Slice(cols, func(i, j int) bool { return cols[i].Name < cols[j].Name })
+	return cols
+}
+
+func (s *LocalVectorStore) collectionPath(name string) string {
+	return filepath.Join(s.dir, name+localCollectionExt)
+}
+
+func (s *LocalVectorStore) indexPath(name string) string {
+	return filepath.Join(s.dir, name+localIndexExt)
+}
+
+// openIndex loads the saved HNSW index of a collection, rebuilding it when it
+// is missing or out of sync with the stored vectors.
+func (s *LocalVectorStore) openIndex(col *localCollection) error {
+	idx, err := hnsw.LoadFile(s.indexPath(col.Name))
+	if err == nil && col.indexMatches(idx) {
+		col.index = idx
+		return nil
+	}
+	if err != nil && !os.IsNotExist(err) {
+		log.Printf("Warning: could not load index for collection %s, rebuilding: %v", col.Name, err)
+	}
+	if err := s.rebuildIndex(col); err != nil {
+		return err
+	}
+	return col.index.SaveFile(s.indexPath(col.Name))
+}
+
+// rebuildIndex builds a fresh HNSW index from the collection's vectors.
+func (s *LocalVectorStore) rebuildIndex(col *localCollection) error {
+	idx, err := hnsw.New(col.IndexConfig)
+	if err != nil {
+		return fmt.Errorf("invalid index parameters for collection %s: %w", col.Name, err)
+	}
+	col.IndexConfig = idx.Config()
+	col.index = idx
+	for _, point := range col.Points {
+		if err := col.indexPoint(point); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// saveLocked snapshots a collection atomically: encode to a temp file, then
+// rename. The HNSW index is written alongside it, and the log the snapshot
+// now covers is removed.
+func (s *LocalVectorStore) saveLocked(col *localCollection) error {
+	if err := col.index.SaveFile(s.indexPath(col.Name)); err != nil {
+		return fmt.Errorf("failed to save index of collection %s: %w", col.Name, err)
+	}
+
+	file := localCollectionFile{
+		Name:        col.Name,
+		Description: col.Description,
+		CreatedAt:   col.CreatedAt,
+		IndexConfig: col.IndexConfig,
+		Points:      make([]localPointRecord, 0, len(col.Points)),
+	}
+	for _, point := range col.Points {
+		record, err := encodePoint(point)
+		if err != nil {
+			return err
+		}
+		file.Points = append(file.Points, record)
+	}
+
+	path := s.collectionPath(col.Name)
+	tmp, err := os.CreateTemp(s.dir, col.Name+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to save collection %s: %w", col.Name, err)
+	}
+	if err := gob.NewEncoder(tmp).Encode(&file); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to encode collection %s: %w", col.Name, err)
+	}
+	size, err := tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to save collection %s: %w", col.Name, err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to save collection %s: %w", col.Name, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to save collection %s: %w", col.Name, err)
+	}
+	if err := os.Remove(s.logPath(col.Name)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove log of collection %s: %w", col.Name, err)
+	}
+	col.logSize, col.snapshotSize = 0, size
+	return nil
+}
+
+func loadLocalCollection(path string) (*localCollection, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open collection file %s: %w", path, err)
+	}
+	defer f.Close()
+
+	var file localCollectionFile
+	if err := gob.NewDecoder(f).Decode(&file); err != nil {
+		return nil, fmt.Errorf("failed to decode collection file %s: %w", path, err)
+	}
+
+	col := &localCollection{
+		Name:        file.Name,
+		Description: file.Description,
+		CreatedAt:   file.CreatedAt,
+		IndexConfig: file.IndexConfig,
+		Points:      make(map[string]*localPoint, len(file.Points)),
+	}
+	for _, record := range file.Points {
+		point, err := decodePoint(record)
+		if err != nil {
+			return nil, fmt.Errorf("%w in %s", err, path)
+		}
+		col.Points[point.Chunk.ID] = point
+	}
+	if info, err := f.Stat(); err == nil {
+		col.snapshotSize = info.Size()
+	}
+	return col, nil
+}
+
+// indexPoint adds a point's vector to the index, or removes the point from
+// the index when it has no usable vector yet.
+func (c *localCollection) indexPoint(point *localPoint) error {
+	if !hasSignal(point.Vector) {
+		c.index.Delete(point.Chunk.ID)
+		return nil
+	}
+	if err := c.index.Add(point.Chunk.ID, point.Vector); err != nil {
+		return fmt.Errorf("failed to index chunk in collection %s: %w", c.Name, err)
+	}
+	return nil
+}
+
+// indexMatches reports whether a loaded index was built with the collection's
+// parameters and holds exactly its indexed vectors.
+func (c *localCollection) indexMatches(idx *hnsw.Index) bool {
+	cfg := idx.Config()
+	if cfg.M != c.IndexConfig.M || cfg.EfConstruction != c.IndexConfig.EfConstruction {
+		return false
+	}
+	indexed := 0
+	for id, point := range c.Points {
+		if !hasSignal(point.Vector) {
+			continue
+		}
+		if !idx.Contains(id) {
+			return false
+		}
+		indexed++
+	}
+	if indexed != idx.Len() {
+		return false
+	}
+	idx.SetEfSearch(c.IndexConfig.EfSearch)
+	return true
+}
+
+func (c *localCollection) rebuildLexical() {
+	c.lexical = NewBM25Index()
+	for id, point := range c.Points {
+		c.lexical.Add(id, point.Chunk.Text)
+	}
+}
+
+// filterValue implements filterSubject.
+func (p *localPoint) filterValue(field string) (interface{}, bool) {
+	return chunkFilterValue(p.Chunk, p.Source, p.DocType, p.DocMetadata, field)
+}
+
+// result returns a copy of the stored chunk without its vector, matching what
+// the Qdrant backend returns from a query.
+func (p *localPoint) result() *models.EnhancedChunk {
+	chunk := *p.Chunk
+	chunk.Embedding = nil
+	return &chunk
+}
+
+func equalVectors(a, b []float32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// hasSignal reports whether a vector is non-empty and not all zeros.
+func hasSignal(vec []float32) bool {
+	for _, v := range vec {
+		if v != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func cosineSimilarity(a, b []float32) float64 {
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
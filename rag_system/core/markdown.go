@@ -0,0 +1,126 @@
+package core
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// minMarkdownHeadings is how many Markdown headings a document needs for
+// its sections to be read from the Markdown heading tree rather than the
+// built-in patterns.
+const minMarkdownHeadings = 2
+
+var (
+	atxHeadingPattern      = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]+(.*?))?(?:[ \t]+#+)?[ \t]*$`)
+	setextUnderlinePattern = regexp.MustCompile(`^ {0,3}(={3,}|-{3,})[ \t]*$`)
+	codeFencePattern       = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})")
+	notParagraphPattern    = regexp.MustCompile(`^\s*([-*+>|]|\d+[.)]\s|#)|^ {4,}`)
+)
+
+// markdownHeading is a heading of a Markdown document.
+type markdownHeading struct {
+	title string
+	level int
+}
+
+// parseMarkdownHeadings returns the headings of Markdown content by line
+// index: ATX headings ("## Title") and setext headings (a one-line
+// paragraph underlined with === or ---). Lines of fenced code blocks are not
+// headings, unlike "# comments" in a shell example.
+//
+// Levels are ranked among those the document uses, so a document of ## and
+// #### headings has levels 1 and 2. A single heading above all others that
+// comes first titles the document: it starts a section of its own at level
+// 1, and the levels below it are ranked from 1.
+func parseMarkdownHeadings(content string) map[int]markdownHeading {
+	lines := strings.Split(content, "\n")
+	headings := map[int]markdownHeading{}
+	blank := func(i int) bool {
+		return i < 0 || strings.TrimSpace(lines[i]) == ""
+	}
+
+	var fence string // Opening fence of the code block the line is in
+	for i, line := range lines {
+		line = strings.TrimRight(line, "\r")
+		if fence != "" {
+			trimmed := strings.TrimSpace(line)
+			if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" {
+				fence = ""
+			}
+			continue
+		}
+		if m := codeFencePattern.FindStringSubmatch(line); m != nil {
+			fence = m[1]
+			continue
+		}
+
+		if m := atxHeadingPattern.FindStringSubmatch(line); m != nil {
+			if title := strings.TrimSpace(m[2]); title != "" {
+				headings[i] = markdownHeading{title: title, level: len(m[1])}
+			}
+			continue
+		}
+		if m := setextUnderlinePattern.FindStringSubmatch(line); m != nil && !blank(i-1) && blank(i-2) {
+			if _, ok := headings[i-1]; ok || notParagraphPattern.MatchString(lines[i-1]) {
+				continue
+			}
+			level := 1
+			if m[1][0] == '-' {
+				level = 2
+			}
+			headings[i-1] = markdownHeading{title: strings.TrimSpace(lines[i-1]), level: level}
+		}
+	}
+
+	rankMarkdownLevels(headings)
+	return headings
+}
+
+// rankMarkdownLevels renumbers heading levels from 1 without gaps, taking a
+// lone first heading above the others for the document's title.
+func rankMarkdownLevels(headings map[int]markdownHeading) {
+	lines := make([]int, 0, len(headings))
+	for line := range headings {
+		lines = append(lines, line)
+	}
+	sort.Ints(lines)
+
+	title := -1
+	if len(lines) > 1 {
+		first := headings[lines[0]].level
+		lone := true
+		for _, line := range lines[1:] {
+			lone = lone && headings[line].level > first
+		}
+		if lone {
+			title = lines[0]
+		}
+	}
+
+	used := map[int]bool{}
+	for _, line := range lines {
+		if line != title {
+			used[headings[line].level] = true
+		}
+	}
+	var levels []int
+	for level := range used {
+		levels = append(levels, level)
+	}
+	sort.Ints(levels)
+	rank := make(map[int]int, len(levels))
+	for i, level := range levels {
+		rank[level] = i + 1
+	}
+
+	for _, line := range lines {
+		heading := headings[line]
+		if line == title {
+			heading.level = 1
+		} else {
+			heading.level = rank[heading.level]
+		}
+		headings[line] = heading
+	}
+}
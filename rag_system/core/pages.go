@@ -0,0 +1,55 @@
+package core
+
+import (
+	"fmt"
+	"rag_system/extract"
+	"rag_system/models"
+	"sort"
+	"strings"
+)
+
+// pageBreaks returns the offsets of the page breaks in the text of a paged
+// document, such as an extracted PDF; nil when it has one page.
+func pageBreaks(content string) []int {
+	var breaks []int
+	for offset := 0; ; {
+		i := strings.Index(content[offset:], extract.PageBreak)
+		if i < 0 {
+			return breaks
+		}
+		breaks = append(breaks, offset+i)
+		offset += i + len(extract.PageBreak)
+	}
+}
+
+// annotatePages records the pages, numbered from 1, each chunk of a paged
+// document spans in its page and page_end metadata, so answers can cite
+// them. A document of one page has no page break and all its chunks are on
+// page 1. It returns the document's page count.
+func annotatePages(content string, chunks []*models.EnhancedChunk) int {
+	breaks := pageBreaks(content)
+	pageAt := func(pos int) int {
+		return sort.SearchInts(breaks, pos) + 1
+	}
+	for _, chunk := range chunks {
+		if chunk.Metadata == nil {
+			chunk.Metadata = map[string]interface{}{}
+		}
+		chunk.Metadata["page"] = pageAt(chunk.StartPos)
+		chunk.Metadata["page_end"] = pageAt(max(chunk.EndPos-1, chunk.StartPos))
+	}
+	return len(breaks) + 1
+}
+
+// pageLabel cites the pages of a chunk, as "p. 3" or "pp. 3-4"; empty for
+// chunks of documents without pages.
+func pageLabel(chunk *models.EnhancedChunk) string {
+	page, ok := filterNumber(chunk.Metadata["page"])
+	if !ok {
+		return ""
+	}
+	if end, ok := filterNumber(chunk.Metadata["page_end"]); ok && end > page {
+		return fmt.Sprintf("pp. %d-%d", int(page), int(end))
+	}
+	return fmt.Sprintf("p. %d", int(page))
+}
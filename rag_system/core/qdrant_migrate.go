@@ -0,0 +1,139 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/qdrant/go-client/qdrant"
+)
+
+// PayloadMigrator is implemented by stores whose stored format can be
+// upgraded in place.
+type PayloadMigrator interface {
+	MigratePayloads() (MigrationResult, error)
+}
+
+// MigrationResult counts the points a payload migration rewrote, and those
+// it skipped because their legacy fields do not parse. Skipped points keep
+// their JSON strings, so they can be repaired and migrated by a later run.
+type MigrationResult struct {
+	Migrated int
+	Failed   int
+}
+
+var _ PayloadMigrator = (*VectorDB)(nil)
+
+// legacyPayloadFields were stored as JSON strings before payloads were typed.
+var legacyPayloadFields = []string{"child_chunk_ids", "keywords", "metadata"}
+
+const migrateBatchSize = 256
+
+// MigratePayloads rewrites points stored with JSON-string keywords,
+// child_chunk_ids and metadata into native payload values in every
+// collection, and ensures the payload indexes exist. It is idempotent.
+// Points whose strings are not valid JSON are logged and skipped.
+func (db *VectorDB) MigratePayloads() (MigrationResult, error) {
+	var total MigrationResult
+	collections, err := db.client.ListCollections(db.ctx)
+	if err != nil {
+		return total, fmt.Errorf("failed to list collections: %w", err)
+	}
+
+	for _, collectionName := range collections {
+		db.createPayloadIndexes(collectionName)
+
+		result, err := db.migrateCollectionPayloads(collectionName)
+		total.Migrated += result.Migrated
+		total.Failed += result.Failed
+		if err != nil {
+			return total, err
+		}
+		log.Printf("Migrated %d points in collection %s, skipped %d", result.Migrated, collectionName, result.Failed)
+	}
+	return total, nil
+}
+
+func (db *VectorDB) migrateCollectionPayloads(collectionName string) (MigrationResult, error) {
+	var result MigrationResult
+	limit := uint32(migrateBatchSize)
+	var offset *qdrant.PointId
+
+	for {
+		points, next, err := db.client.ScrollAndOffset(db.ctx, &qdrant.ScrollPoints{
+			CollectionName: collectionName,
+			Offset:         offset,
+			Limit:          &limit,
+			WithPayload:    qdrant.NewWithPayloadInclude(legacyPayloadFields...),
+		})
+		if err != nil {
+			return result, fmt.Errorf("failed to scroll collection %s: %w", collectionName, err)
+		}
+
+		for _, point := range points {
+			update, err := typedPayloadUpdate(point.GetPayload())
+			if err != nil {
+				log.Printf("Warning: skipping point %s in %s: %v", point.GetId().String(), collectionName, err)
+				result.Failed++
+				continue
+			}
+			if len(update) == 0 {
+				continue
+			}
+			wait := true
+			_, err = db.client.SetPayload(db.ctx, &qdrant.SetPayloadPoints{
+				CollectionName: collectionName,
+				Wait:           &wait,
+				Payload:        qdrant.NewValueMap(update),
+				PointsSelector: qdrant.NewPointsSelector(point.GetId()),
+			})
+			if err != nil {
+				return result, fmt.Errorf("failed to rewrite payload of point %s in %s: %w", point.GetId().String(), collectionName, err)
+			}
+			result.Migrated++
+		}
+
+		if next == nil {
+			return result, nil
+		}
+		offset = next
+	}
+}
+
+// typedPayloadUpdate decodes the legacy JSON-string fields of a payload into
+// native values. It returns nil when the payload is already typed, and an
+// error when a field is not valid JSON, rather than dropping its contents.
+func typedPayloadUpdate(payload map[string]*qdrant.Value) (map[string]interface{}, error) {
+	update := map[string]interface{}{}
+	for _, key := range legacyPayloadFields {
+		v, ok := payload[key]
+		if !ok {
+			continue
+		}
+		if _, isString := v.GetKind().(*qdrant.Value_StringValue); !isString {
+			continue
+		}
+		raw := v.GetStringValue()
+		if key == "metadata" {
+			var m map[string]interface{}
+			if raw != "" {
+				if err := json.Unmarshal([]byte(raw), &m); err != nil {
+					return nil, fmt.Errorf("%s is not a JSON object: %w", key, err)
+				}
+			}
+			update[key] = payloadObject(m)
+		} else {
+			var items []string
+			if raw != "" {
+				if err := json.Unmarshal([]byte(raw), &items); err != nil {
+					return nil, fmt.Errorf("%s is not a JSON list of strings: %w", key, err)
+				}
+			}
+			update[key] = payloadList(items)
+		}
+	}
+	if len(update) == 0 {
+		return nil, nil
+	}
+	return update, nil
+}
@@ -5,128 +5,306 @@ import (
 	"log"
 	"math"
 	"os"
+	"rag_system/extract"
 	"rag_system/models"
+	"rag_system/tokenizer"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
-type EmbeddingService struct{}
+type RAGService struct {
+	vectorDB         VectorStore
+	embeddingClient  *EmbeddingService
+	llmClient        *LLMService
+	tokenizer        tokenizer.Tokenizer
+	maxContextTokens int // Default context budget of answers; 0 means unlimited
+	profiles         *DocTypeProfiles
+
+	reembedMu   sync.Mutex
+	reembedJobs map[string]*models.ReembedJob // latest job per collection
+	writes      map[string]int                // Store writes in flight per collection; "" for any collection
+}
 
-func NewEnbeddingService() *EmbeddingService {
-	return &EmbeddingService{}
+func NewRAGService(vectorDB VectorStore, embeddingClient *EmbeddingService, llmClient *LLMService, tok tokenizer.Tokenizer, maxContextTokens int, profiles *DocTypeProfiles) *RAGService {
+	return &RAGService{
+		vectorDB:         vectorDB,
+		embeddingClient:  embeddingClient,
+		llmClient:        llmClient,
+		tokenizer:        tok,
+		maxContextTokens: maxContextTokens,
+		profiles:         profiles,
+		reembedJobs:      make(map[string]*models.ReembedJob),
+		writes:           make(map[string]int),
+	}
 }
 
-func (e *EmbeddingService) GetEmbedding(text string) ([]float32, error) {
-	embeddings, err := GetEmbeddings([]string{text}, "")
-	if err != nil {
-		return nil, err
+// Tokenizer returns the tokenizer chunk sizes and context budgets are
+// counted with.
+func (r *RAGService) Tokenizer() tokenizer.Tokenizer {
+	return r.tokenizer
+}
+
+// DocTypeProfiles returns the chunking profiles of document types.
+func (r *RAGService) DocTypeProfiles() *DocTypeProfiles {
+	return r.profiles
+}
+
+// ChunkingEnv returns the environment documents of docType are chunked in,
+// embedding sentences with the given provider and model.
+func (r *RAGService) ChunkingEnv(sel models.EmbeddingSelection, docType string) ChunkingEnv {
+	return ChunkingEnv{
+		Tokenizer: r.tokenizer,
+		Profile:   r.profiles.Get(docType),
+		Embed: func(texts []string) ([][]float32, error) {
+			return r.embeddingClient.GetEmbeddingsWith(texts, sel)
+		},
 	}
-	if len(embeddings) == 0 {
-		return nil, fmt.Errorf("no embedding returned")
+}
+
+// ReadFileContent reads a file and returns its text, extracted according to
+// its format.
+func ReadFileContent(filePath string) (*extract.Result, error) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file %s: %w", filePath, err)
 	}
-	return embeddings[0], nil
+	return extract.Extract(filePath, content)
 }
 
-func (e *EmbeddingService) GetEmbeddings(texts []string) ([][]float32, error) {
-	return GetEmbeddings(texts, "")
+// CreateCollection creates a collection whose vectors come from the schema's
+// embedding provider and model, the deployment's when unset. When the
+// dimension is 0 it is discovered by embedding a probe text. llm is the
+// collection's default provider and chat model, if any. Names ending in
+// shadowSuffix, which re-embed jobs keep for themselves, are refused.
+func (r *RAGService) CreateCollection(name, description string, schema models.CollectionSchema, llm models.LLMSelection) (*models.CollectionInfo, error) {
+	if err := checkCollectionName(name); err != nil {
+		return nil, err
+	}
+	return r.createCollection(name, description, schema, llm)
 }
 
-// LLMService wraps the LLM functionality
-type LLMService struct{}
+func (r *RAGService) createCollection(name, description string, schema models.CollectionSchema, llm models.LLMSelection) (*models.CollectionInfo, error) {
+	if err := r.llmClient.CheckSelection(llm); err != nil {
+		return nil, err
+	}
+	sel, err := r.embeddingClient.Resolve(schema.EmbeddingSelection)
+	if err != nil {
+		return nil, err
+	}
+	schema.EmbeddingSelection = sel
+	if schema.Dimension == 0 {
+		if schema.Dimension, err = r.embeddingClient.Dimension(sel); err != nil {
+			return nil, err
+		}
+	}
 
-func NewLLMService() *LLMService {
-	return &LLMService{}
+	if err := r.vectorDB.CreateCollection(name, description, schema); err != nil {
+		return nil, err
+	}
+	if llm != (models.LLMSelection{}) {
+		if err := r.vectorDB.SetCollectionLLM(name, llm); err != nil {
+			return nil, err
+		}
+	}
+	return r.vectorDB.GetCollectionInfo(name)
 }
 
-func (l *LLMService) GenerateResponse(prompt string) (string, error) {
-	messages := []models.ChatCompletionMessage{
-		{Role: "user", Content: prompt},
+// SetCollectionLLM changes the provider and chat model that answer queries
+// on a collection. An empty selection falls back to the deployment default.
+func (r *RAGService) SetCollectionLLM(name string, llm models.LLMSelection) (*models.CollectionInfo, error) {
+	if err := r.llmClient.CheckSelection(llm); err != nil {
+		return nil, err
 	}
-	return GenerateChatCompletion(messages, "")
+	if err := r.vectorDB.SetCollectionLLM(name, llm); err != nil {
+		return nil, err
+	}
+	return r.vectorDB.GetCollectionInfo(name)
 }
 
-type RAGService struct {
-	vectorDB        *VectorDB
-	embeddingClient *EmbeddingService
-	llmClient       *LLMService
+// resolveLLM picks the provider and model of a query: the request's, then
+// the collection's, then the deployment's.
+func (r *RAGService) resolveLLM(req *models.QueryRequest) (models.LLMSelection, error) {
+	var collection models.LLMSelection
+	if info, err := r.vectorDB.GetCollectionInfo(req.CollectionName); err == nil {
+		collection = info.LLMSelection
+	}
+	return r.llmClient.Resolve(req.LLMSelection, collection)
 }
 
-func NewRAGService(vectorDB *VectorDB, embeddingClient *EmbeddingService, llmClient *LLMService) *RAGService {
-	return &RAGService{
-		vectorDB:        vectorDB,
-		embeddingClient: embeddingClient,
-		llmClient:       llmClient,
+// collectionEmbedding returns the embedding provider and model of a
+// collection: the recorded ones, or the deployment's for collections that do
+// not exist yet. Collections recorded without a provider predate configurable
+// providers and were embedded through OpenAI.
+func (r *RAGService) collectionEmbedding(collectionName string) (models.EmbeddingSelection, error) {
+	var sel models.EmbeddingSelection
+	if info, err := r.vectorDB.GetCollectionInfo(collectionName); err == nil {
+		sel = info.EmbeddingSelection
+		if sel.EmbeddingProvider == "" {
+			sel.EmbeddingProvider = legacyEmbeddingProvider
+		}
 	}
+	return r.embeddingClient.Resolve(sel)
 }
 
-// ReadFileContent reads a file and returns its content as string
-func ReadFileContent(filePath string) (string, error) {
-	content, err := os.ReadFile(filePath)
+// DeleteDocument deletes a document from every collection holding it. It is
+// refused while one of them is being re-embedded, whose swap would bring the
+// document back.
+func (r *RAGService) DeleteDocument(documentID string) error {
+	err := r.beginWrite("", func() error {
+		for name, job := range r.reembedJobs {
+			if job.Status != models.ReembedRunning {
+				continue
+			}
+			docs, err := r.vectorDB.ListDocuments(name)
+			if err != nil {
+				return err
+			}
+			for _, doc := range docs {
+				if doc["id"] == documentID {
+					return fmt.Errorf("%w: '%s' holds document %s", ErrReembedInProgress, name, documentID)
+				}
+			}
+		}
+		return nil
+	})
 	if err != nil {
-		return "", fmt.Errorf("failed to read file %s: %w", filePath, err)
+		return err
 	}
-	return string(content), nil
+	defer r.endWrite("")
+	return r.vectorDB.DeleteDocument(documentID)
 }
 
-func (r *RAGService) AddDocument(collectionName string, req *models.AddDocumentRequest) error {
+// DeleteAllDocuments deletes every document of a collection, refused while
+// it is being re-embedded.
+func (r *RAGService) DeleteAllDocuments(collectionName string) error {
+	if err := r.beginWrite(collectionName, nil); err != nil {
+		return err
+	}
+	defer r.endWrite(collectionName)
+	return r.vectorDB.DeleteAllDocumentsInCollection(collectionName)
+}
+
+// AddDocument chunks, embeds and stores a document, returning the stored document.
+func (r *RAGService) AddDocument(collectionName string, req *models.AddDocumentRequest) (*models.Document, error) {
 	startTime := time.Now()
 
+	if r.reembedRunning(collectionName) {
+		return nil, fmt.Errorf("%w: '%s'", ErrReembedInProgress, collectionName)
+	}
+
 	// Read content
 	var content string
 	var err error
+	pages := req.PageCount
 
 	if req.FilePath != "" {
-		content, err = ReadFileContent(req.FilePath)
+		result, err := ReadFileContent(req.FilePath)
 		if err != nil {
-			return fmt.Errorf("failed to read file: %w", err)
+			return nil, fmt.Errorf("failed to read file: %w", err)
 		}
+		content, pages = result.Text, result.PageCount()
 	} else if req.Content != "" {
 		content = req.Content
 	} else {
-		return fmt.Errorf("either file_path or content must be provided")
+		return nil, fmt.Errorf("either file_path or content must be provided")
 	}
 
 	if len(content) == 0 {
-		return fmt.Errorf("document content is empty")
+		return nil, fmt.Errorf("document content is empty")
 	}
 
-	doc, err := ProcessDocumentContent(content, req.Source, req.DocType, req.ChunkingConfig)
+	// Chunks, and sentences for semantic chunking, use the collection's model
+	_, err = r.vectorDB.GetCollectionInfo(collectionName)
+	exists := err == nil
+	if !exists {
+		if err := checkCollectionName(collectionName); err != nil {
+			return nil, err
+		}
+	}
+	sel, err := r.collectionEmbedding(collectionName)
+	if err != nil {
+		return nil, err
+	}
+
+	// A file's extension tells the language of source code
+	source := req.Source
+	if source == "" {
+		source = req.FilePath
+	}
+	doc, err := ProcessDocumentContent(content, source, req.DocType, pages, req.ChunkingConfig, r.ChunkingEnv(sel, req.DocType))
 	if err != nil {
-		return fmt.Errorf("failed to process document: %w", err)
+		return nil, fmt.Errorf("failed to process document: %w", err)
+	}
+
+	// Custom metadata sits next to what the processor derived; processor keys win
+	for key, value := range req.Metadata {
+		if _, exists := doc.Metadata[key]; !exists {
+			doc.Metadata[key] = value
+		}
 	}
 
 	log.Printf("Document processed: %d chunks created using %s strategy",
 		len(doc.Chunks), doc.Metadata["chunking_strategy"])
 
-	// Generate embeddings for all chunks
-	log.Printf("Generating embeddings for %d chunks...", len(doc.Chunks))
-	if err := r.generateEmbeddings(doc.Chunks); err != nil {
-		return fmt.Errorf("failed to generate embeddings: %w", err)
+	// Generate embeddings for all chunks with the collection's model
+	log.Printf("Generating embeddings for %d chunks with %s (%s)...", len(doc.Chunks), sel.EmbeddingProvider, sel.EmbeddingModel)
+	if err := r.generateEmbeddings(doc.Chunks, sel); err != nil {
+		return nil, fmt.Errorf("failed to generate embeddings: %w", err)
+	}
+
+	// A re-embed may have started, or finished, while the document was
+	// processed: its chunks must neither miss the job's export nor carry
+	// vectors of the model the collection no longer uses
+	err = r.beginWrite(collectionName, func() error {
+		current, err := r.collectionEmbedding(collectionName)
+		if err != nil {
+			return err
+		}
+		if current != sel {
+			return fmt.Errorf("%w: collection '%s' switched to %s (%s) while the document was embedded with %s (%s); add it again", ErrSchemaMismatch, collectionName, current.EmbeddingProvider, current.EmbeddingModel, sel.EmbeddingProvider, sel.EmbeddingModel)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer r.endWrite(collectionName)
+
+	// A document added to a new collection records the deployment's model
+	if !exists && len(doc.Chunks) > 0 {
+		schema := models.CollectionSchema{EmbeddingSelection: sel, Dimension: len(doc.Chunks[0].Embedding)}
+		if err := r.vectorDB.CreateCollection(collectionName, "", schema); err != nil {
+			return nil, fmt.Errorf("failed to create collection: %w", err)
+		}
 	}
 
 	// Store document and chunks in vector database
 	if err := r.vectorDB.AddDocument(collectionName, doc); err != nil {
-		return fmt.Errorf("failed to add document to database: %w", err)
+		return nil, fmt.Errorf("failed to add document to database: %w", err)
 	}
 
 	// Store embeddings
 	if err := r.vectorDB.AddEmbeddings(doc.Chunks); err != nil {
-		return fmt.Errorf("failed to add embeddings: %w", err)
+		return nil, fmt.Errorf("failed to add embeddings: %w", err)
 	}
 
 	log.Printf("Document '%s' added successfully in %v with %d chunks",
 		doc.Source, time.Since(startTime), len(doc.Chunks))
 
-	return nil
+	return doc, nil
 }
 
 func (r *RAGService) Query(req *models.QueryRequest) (*models.QueryResponse, error) {
 	startTime := time.Now()
 
-	// Set defaults
-	if req.TopK <= 0 {
-		req.TopK = 5
+	if err := ValidateQueryRequest(req); err != nil {
+		return nil, err
+	}
+	llm, err := r.resolveLLM(req)
+	if err != nil {
+		return nil, err
 	}
 
 	// Query expansion
@@ -139,62 +317,29 @@ func (r *RAGService) Query(req *models.QueryRequest) (*models.QueryResponse, err
 		}
 	}
 
-	// Generate query embedding
-	queryEmbedding, err := r.embeddingClient.GetEmbedding(query)
+	// Retrieve candidate chunks
+	retrieval, err := r.Retrieve(req, query)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate query embedding: %w", err)
-	}
-
-	// Build metadata filters
-	var filters map[string]interface{}
-	if len(req.MetadataFilters) > 0 {
-		filters = make(map[string]interface{})
-		for key, value := range req.MetadataFilters {
-			filters[key] = value
-		}
-	}
-
-	// Search for similar chunks
-	chunks, scores, err := r.vectorDB.QuerySimilarChunks(
-		req.CollectionName,
-		queryEmbedding,
-		req.TopK*2, // Get more for re-ranking
-		filters,
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to search similar chunks: %w", err)
+		return nil, err
 	}
+	chunks, scores := retrieval.Chunks, retrieval.Scores
 
-	if len(chunks) == 0 {
+	if retrieval.Candidates == 0 {
 		return &models.QueryResponse{
 			Answer:         "I couldn't find any relevant information for your query.",
 			ProcessingTime: time.Since(startTime).Seconds(),
-			MetadataUsed:   len(req.MetadataFilters) > 0,
+			MetadataUsed:   len(req.MetadataFilters) > 0 || req.Filter != nil,
+			RetrievalMode:  retrieval.Mode,
 		}, nil
 	}
 
-	// Apply semantic threshold filtering
-	if req.SemanticThreshold > 0 {
-		filteredChunks := make([]*models.EnhancedChunk, 0)
-		filteredScores := make([]float64, 0)
-
-		for i, score := range scores {
-			if score >= req.SemanticThreshold {
-				filteredChunks = append(filteredChunks, chunks[i])
-				filteredScores = append(filteredScores, score)
-			}
-		}
-
-		chunks = filteredChunks
-		scores = filteredScores
-
-		if len(chunks) == 0 {
-			return &models.QueryResponse{
-				Answer:         "No chunks met the semantic similarity threshold.",
-				ProcessingTime: time.Since(startTime).Seconds(),
-				MetadataUsed:   len(req.MetadataFilters) > 0,
-			}, nil
-		}
+	if len(chunks) == 0 {
+		return &models.QueryResponse{
+			Answer:         "No chunks met the semantic similarity threshold.",
+			ProcessingTime: time.Since(startTime).Seconds(),
+			MetadataUsed:   len(req.MetadataFilters) > 0 || req.Filter != nil,
+			RetrievalMode:  retrieval.Mode,
+		}, nil
 	}
 
 	// Include parent chunks if requested
@@ -205,7 +350,13 @@ func (r *RAGService) Query(req *models.QueryRequest) (*models.QueryResponse, err
 	// Re-ranking
 	var rerankedScores []float64
 	if req.RerankerEnabled && len(chunks) > 1 {
-		chunks, rerankedScores = r.rerankChunks(query, chunks, scores)
+		rerankInput := scores
+		if retrieval.Mode != models.DenseRetrieval {
+			// BM25 and fused scores are not on the 0-1 similarity scale the
+			// re-ranker boosts and caps, so rescale them relative to the best hit
+			rerankInput = scaleToBest(scores)
+		}
+		chunks, rerankedScores = r.rerankChunks(query, chunks, rerankInput)
 	}
 
 	// Limit to requested TopK after re-ranking
@@ -218,10 +369,14 @@ func (r *RAGService) Query(req *models.QueryRequest) (*models.QueryResponse, err
 	}
 
 	// Prepare context for LLM
-	context := r.prepareContext(chunks)
+	budget := req.MaxContextTokens
+	if budget <= 0 {
+		budget = r.maxContextTokens
+	}
+	context, contextTokens := r.prepareContext(chunks, budget)
 
 	// Generate answer using LLM
-	answer, err := r.generateAnswer(req.Query, context)
+	answer, err := r.generateAnswer(req.Query, context, llm)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate answer: %w", err)
 	}
@@ -233,7 +388,11 @@ func (r *RAGService) Query(req *models.QueryRequest) (*models.QueryResponse, err
 		EnhancedChunks:   chunks,
 		SimilarityScores: scores,
 		ProcessingTime:   time.Since(startTime).Seconds(),
-		MetadataUsed:     len(req.MetadataFilters) > 0,
+		MetadataUsed:     len(req.MetadataFilters) > 0 || req.Filter != nil,
+		RetrievalMode:    retrieval.Mode,
+		ContextTokens:    contextTokens,
+		RetrievalRanks:   alignRanks(chunks, retrieval.Ranks),
+		LLMSelection:     llm,
 	}
 
 	if len(rerankedScores) > 0 {
@@ -243,18 +402,28 @@ func (r *RAGService) Query(req *models.QueryRequest) (*models.QueryResponse, err
 	return response, nil
 }
 
-func (r *RAGService) generateEmbeddings(chunks []*models.EnhancedChunk) error {
+func (r *RAGService) generateEmbeddings(chunks []*models.EnhancedChunk, sel models.EmbeddingSelection) error {
 	texts := make([]string, len(chunks))
 	for i, chunk := range chunks {
-		texts[i] = chunk.Text
+		texts[i] = tableChunkText(chunk)
 	}
-	embeddings, err := r.embeddingClient.GetEmbeddings(texts)
+	embeddings, windows, err := r.embeddingClient.embedTexts(texts, sel)
 	if err != nil {
 		return err
 	}
 
 	for i, embedding := range embeddings {
 		chunks[i].Embedding = embedding
+		// Re-embedding with a larger model may fit a chunk flagged before
+		delete(chunks[i].Metadata, "embedding_windows")
+		if windows[i] > 1 {
+			// Too large for the model, embedded as a pooled set of windows
+			if chunks[i].Metadata == nil {
+				chunks[i].Metadata = make(map[string]interface{})
+			}
+			chunks[i].Metadata["embedding_windows"] = windows[i]
+			log.Printf("Warning: chunk %s (%d chars) exceeded the model input and was embedded as %d pooled windows", chunks[i].ID, len(chunks[i].Text), windows[i])
+		}
 	}
 
 	return nil
@@ -496,35 +665,66 @@ func (r *RAGService) isExperienceRelated(chunk *models.EnhancedChunk) bool {
 	return false
 }
 
-func (r *RAGService) prepareContext(chunks []*models.EnhancedChunk) string {
+// minContextPartTokens is the smallest part of a chunk worth cutting it to
+// when it does not fit the context budget whole.
+const minContextPartTokens = 50
+
+// prepareContext joins chunks, best first, into the context of the prompt
+// and returns it with its size in tokens. Once budget tokens are used (0
+// means no limit), the chunk that does not fit is cut at a token boundary if
+// a useful part of it fits, and the rest are left out.
+func (r *RAGService) prepareContext(chunks []*models.EnhancedChunk, budget int) (string, int) {
 	var contextParts []string
+	used := 0
+	separatorTokens := r.tokenizer.Count("\n\n")
 
 	for i, chunk := range chunks {
 		var contextPart strings.Builder
 
 		// Add metadata information if available
-		if chunk.Section != "" || chunk.Subsection != "" {
-			contextPart.WriteString(fmt.Sprintf("[Context %d", i+1))
-			if chunk.Section != "" {
-				contextPart.WriteString(fmt.Sprintf(" - %s", chunk.Section))
+		contextPart.WriteString(fmt.Sprintf("[Context %d", i+1))
+		if chunk.Section != "" {
+			contextPart.WriteString(fmt.Sprintf(" - %s", chunk.Section))
+		}
+		if chunk.Subsection != "" {
+			contextPart.WriteString(fmt.Sprintf(" - %s", chunk.Subsection))
+		}
+		// The page lets answers cite where in a PDF they come from
+		if page := pageLabel(chunk); page != "" {
+			contextPart.WriteString(fmt.Sprintf(" (%s)", page))
+		}
+		contextPart.WriteString("]\n")
+
+		contextPart.WriteString(tableChunkText(chunk))
+		part := contextPart.String()
+
+		partTokens := r.tokenizer.Count(part)
+		if len(contextParts) > 0 {
+			partTokens += separatorTokens
+		}
+		if budget > 0 && used+partTokens > budget {
+			remaining := budget - used
+			if len(contextParts) > 0 {
+				remaining -= separatorTokens
 			}
-			if chunk.Subsection != "" {
-				contextPart.WriteString(fmt.Sprintf(" - %s", chunk.Subsection))
+			if remaining >= minContextPartTokens {
+				part = part[:tokenizer.Prefix(r.tokenizer, part, remaining)]
+				used = budget - remaining + r.tokenizer.Count(part)
+				contextParts = append(contextParts, part)
 			}
-			contextPart.WriteString("]\n")
-		} else {
-			contextPart.WriteString(fmt.Sprintf("[Context %d]\n", i+1))
+			log.Printf("Context budget of %d tokens reached: using %d of %d chunks", budget, len(contextParts), len(chunks))
+			break
 		}
 
-		contextPart.WriteString(chunk.Text)
-		contextParts = append(contextParts, contextPart.String())
+		contextParts = append(contextParts, part)
+		used += partTokens
 	}
 
-	return strings.Join(contextParts, "\n\n")
+	return strings.Join(contextParts, "\n\n"), used
 }
 
-func (r *RAGService) generateAnswer(query, context string) (string, error) {
-	prompt := fmt.Sprintf(`You are a helpful AI assistant. Based on the provided context, answer the user's question accurately and comprehensively. If the context doesn't contain enough information to answer the question, say so clearly.
+func (r *RAGService) generateAnswer(query, context string, llm models.LLMSelection) (string, error) {
+	prompt := fmt.Sprintf(`You are a helpful AI assistant. Based on the provided context, answer the user's question accurately and comprehensively. If the context doesn't contain enough information to answer the question, say so clearly. Where a context is marked with its pages, such as (p. 3), cite the pages your answer relies on.
 
 Context:
 %s
@@ -533,7 +733,7 @@ Question: %s
 
 Answer:`, context, query)
 
-	return r.llmClient.GenerateResponse(prompt)
+	return r.llmClient.GenerateResponse(prompt, llm)
 }
 
 func (r *RAGService) extractChunkTexts(chunks []*models.EnhancedChunk) []string {
@@ -544,6 +744,21 @@ func (r *RAGService) extractChunkTexts(chunks []*models.EnhancedChunk) []string
 	return texts
 }
 
+// scaleToBest divides scores by the highest one.
+func scaleToBest(scores []float64) []float64 {
+	best := 0.0
+	for _, s := range scores {
+		best = math.Max(best, s)
+	}
+	scaled := make([]float64, len(scores))
+	for i, s := range scores {
+		if best > 0 {
+			scaled[i] = s / best
+		}
+	}
+	return scaled
+}
+
 // Helper function to check if slice contains string
 func contains(slice []string, item string) bool {
 	for _, s := range slice {
@@ -0,0 +1,271 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"rag_system/models"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrReembedInProgress is returned for writes to a collection that is being
+// re-embedded, and for a second re-embed of the same collection.
+var ErrReembedInProgress = errors.New("collection is being re-embedded")
+
+// ErrWritesInProgress is returned for a re-embed of a collection that
+// documents are being stored into or deleted from.
+var ErrWritesInProgress = errors.New("collection has writes in progress")
+
+// ErrReservedName is returned for collection names ending in shadowSuffix,
+// which re-embed jobs keep for their shadow collections.
+var ErrReservedName = errors.New("reserved collection name")
+
+// shadowSuffix names the collection a re-embed job builds next to the live one.
+const shadowSuffix = "__reembed"
+
+// reembedBatchChunks is how many chunks are sent to GetEmbeddings at once;
+// GetEmbeddings splits them further into adaptive API batches.
+const reembedBatchChunks = 256
+
+// checkCollectionName refuses names of re-embed shadow collections.
+func checkCollectionName(name string) error {
+	if strings.HasSuffix(name, shadowSuffix) {
+		return fmt.Errorf("%w: names ending in '%s' are kept for re-embed jobs", ErrReservedName, shadowSuffix)
+	}
+	return nil
+}
+
+// StartReembed re-embeds every chunk of a collection with the selected
+// provider and model in the background. An empty provider keeps the
+// collection's, an empty model means the provider's embedding model.
+// Chunks are written to a shadow collection, and only once all of them are
+// embedded does the shadow replace the collection, so queries keep using the
+// old vectors until the swap. A job that fails before the swap removes the
+// shadow and leaves the collection untouched. On Qdrant, which copies the
+// shadow's points into the collection, a failure during the swap leaves the
+// collection incomplete and keeps the shadow: re-embedding the collection
+// again finishes the swap. Adding and deleting documents is refused while a
+// job runs.
+func (r *RAGService) StartReembed(name string, sel models.EmbeddingSelection) (*models.ReembedJob, error) {
+	info, err := r.vectorDB.GetCollectionInfo(name)
+	if err != nil {
+		return nil, err
+	}
+	previous, err := r.collectionEmbedding(name)
+	if err != nil {
+		return nil, err
+	}
+	if sel.EmbeddingProvider == "" {
+		sel.EmbeddingProvider = previous.EmbeddingProvider
+	}
+	if sel, err = r.embeddingClient.Resolve(sel); err != nil {
+		return nil, err
+	}
+
+	shadowName := name + shadowSuffix
+	if shadow, err := r.vectorDB.GetCollectionInfo(shadowName); err == nil {
+		if shadow.ShadowOf != name {
+			return nil, fmt.Errorf("%w: collection '%s' exists and is not a re-embed shadow of '%s'", ErrReservedName, shadowName, name)
+		}
+		if shadow.Swapping {
+			// An interrupted swap is finished with the vectors already embedded
+			sel = shadow.EmbeddingSelection
+		}
+	}
+
+	r.reembedMu.Lock()
+	defer r.reembedMu.Unlock()
+
+	if job, ok := r.reembedJobs[name]; ok && job.Status == models.ReembedRunning {
+		return nil, fmt.Errorf("%w: '%s' (job %s)", ErrReembedInProgress, name, job.ID)
+	}
+	if writes := r.writes[name] + r.writes[""]; writes > 0 {
+		return nil, fmt.Errorf("%w: %d to '%s'; retry once they are done", ErrWritesInProgress, writes, name)
+	}
+
+	job := &models.ReembedJob{
+		ID:                uuid.New().String(),
+		CollectionName:    name,
+		ShadowCollection:  shadowName,
+		PreviousProvider:  previous.EmbeddingProvider,
+		PreviousModel:     previous.EmbeddingModel,
+		EmbeddingProvider: sel.EmbeddingProvider,
+		EmbeddingModel:    sel.EmbeddingModel,
+		Status:            models.ReembedRunning,
+		StartedAt:         time.Now().UTC(),
+	}
+	r.reembedJobs[name] = job
+	snapshot := *job
+
+	go r.runReembed(job, info.Description)
+	return &snapshot, nil
+}
+
+// ReembedJob returns the state of the latest re-embed job of a collection.
+func (r *RAGService) ReembedJob(name string) (*models.ReembedJob, bool) {
+	r.reembedMu.Lock()
+	defer r.reembedMu.Unlock()
+
+	job, ok := r.reembedJobs[name]
+	if !ok {
+		return nil, false
+	}
+	snapshot := *job
+	return &snapshot, true
+}
+
+func (r *RAGService) reembedRunning(name string) bool {
+	r.reembedMu.Lock()
+	defer r.reembedMu.Unlock()
+
+	job, ok := r.reembedJobs[name]
+	return ok && job.Status == models.ReembedRunning
+}
+
+// beginWrite reserves a store write to a collection, or to any collection
+// when name is "", which StartReembed waits out by refusing to start. It
+// refuses writes to a collection being re-embedded, and calls check, if
+// any, with the job state held so that no job starts before the write ends.
+// Every successful beginWrite is paired with an endWrite.
+func (r *RAGService) beginWrite(name string, check func() error) error {
+	r.reembedMu.Lock()
+	defer r.reembedMu.Unlock()
+
+	if job, ok := r.reembedJobs[name]; ok && job.Status == models.ReembedRunning {
+		return fmt.Errorf("%w: '%s'", ErrReembedInProgress, name)
+	}
+	if check != nil {
+		if err := check(); err != nil {
+			return err
+		}
+	}
+	r.writes[name]++
+	return nil
+}
+
+func (r *RAGService) endWrite(name string) {
+	r.reembedMu.Lock()
+	defer r.reembedMu.Unlock()
+
+	if r.writes[name]--; r.writes[name] <= 0 {
+		delete(r.writes, name)
+	}
+}
+
+func (r *RAGService) updateReembed(job *models.ReembedJob, update func(*models.ReembedJob)) {
+	r.reembedMu.Lock()
+	defer r.reembedMu.Unlock()
+	update(job)
+}
+
+func (r *RAGService) runReembed(job *models.ReembedJob, description string) {
+	err := r.reembed(job, description)
+	if err != nil {
+		log.Printf("Re-embedding collection %s failed: %v", job.CollectionName, err)
+		shadow, infoErr := r.vectorDB.GetCollectionInfo(job.ShadowCollection)
+		switch {
+		case infoErr != nil, shadow.ShadowOf != job.CollectionName:
+			// No shadow of ours to remove
+		case shadow.Swapping:
+			// The collection lost its chunks; the shadow holds the only complete copy
+			err = fmt.Errorf("%w; collection '%s' is incomplete and its re-embedded chunks are kept in '%s': re-embed the collection again to finish the swap", err, job.CollectionName, job.ShadowCollection)
+		default:
+			if err := r.vectorDB.DeleteCollection(job.ShadowCollection); err != nil {
+				log.Printf("Warning: could not remove shadow collection %s: %v", job.ShadowCollection, err)
+			}
+		}
+	}
+
+	now := time.Now().UTC()
+	r.updateReembed(job, func(j *models.ReembedJob) {
+		j.FinishedAt = &now
+		if err != nil {
+			j.Status = models.ReembedFailed
+			j.Error = err.Error()
+		} else {
+			j.Status = models.ReembedCompleted
+		}
+	})
+	if err == nil {
+		log.Printf("Re-embedded collection %s with %s (%s) in %v", job.CollectionName, job.EmbeddingProvider, job.EmbeddingModel, now.Sub(job.StartedAt))
+	}
+}
+
+func (r *RAGService) reembed(job *models.ReembedJob, description string) error {
+	sel := models.EmbeddingSelection{EmbeddingProvider: job.EmbeddingProvider, EmbeddingModel: job.EmbeddingModel}
+
+	// A shadow left behind by an interrupted job is stale, unless it was
+	// being swapped in: then it holds the collection's only complete copy
+	if shadow, err := r.vectorDB.GetCollectionInfo(job.ShadowCollection); err == nil {
+		switch {
+		case shadow.ShadowOf != job.CollectionName:
+			return fmt.Errorf("%w: collection '%s' exists and is not a re-embed shadow of '%s'", ErrReservedName, job.ShadowCollection, job.CollectionName)
+		case shadow.Swapping:
+			log.Printf("Resuming the interrupted swap of %s into %s", job.ShadowCollection, job.CollectionName)
+			return r.swapShadow(job)
+		}
+		if err := r.vectorDB.DeleteCollection(job.ShadowCollection); err != nil {
+			return fmt.Errorf("failed to remove stale shadow collection: %w", err)
+		}
+	}
+
+	docs, err := r.vectorDB.ExportDocuments(job.CollectionName)
+	if err != nil {
+		return fmt.Errorf("failed to export collection %s: %w", job.CollectionName, err)
+	}
+	totalChunks := 0
+	for _, doc := range docs {
+		totalChunks += len(doc.Chunks)
+	}
+	r.updateReembed(job, func(j *models.ReembedJob) {
+		j.TotalDocuments = len(docs)
+		j.TotalChunks = totalChunks
+	})
+
+	if _, err := r.createCollection(job.ShadowCollection, description, models.CollectionSchema{EmbeddingSelection: sel}, models.LLMSelection{}); err != nil {
+		return fmt.Errorf("failed to create shadow collection: %w", err)
+	}
+	if err := r.vectorDB.MarkShadow(job.ShadowCollection, job.CollectionName); err != nil {
+		return fmt.Errorf("failed to mark shadow collection: %w", err)
+	}
+
+	for start := 0; start < len(docs); {
+		// Group whole documents into one embedding call
+		end, chunks := start, []*models.EnhancedChunk(nil)
+		for end < len(docs) && (len(chunks) == 0 || len(chunks)+len(docs[end].Chunks) <= reembedBatchChunks) {
+			chunks = append(chunks, docs[end].Chunks...)
+			end++
+		}
+
+		if err := r.generateEmbeddings(chunks, sel); err != nil {
+			return fmt.Errorf("failed to embed chunks: %w", err)
+		}
+		for _, doc := range docs[start:end] {
+			if err := r.vectorDB.AddDocument(job.ShadowCollection, doc); err != nil {
+				return fmt.Errorf("failed to store document %s: %w", doc.ID, err)
+			}
+			if err := r.vectorDB.AddEmbeddings(doc.Chunks); err != nil {
+				return fmt.Errorf("failed to store embeddings of document %s: %w", doc.ID, err)
+			}
+		}
+
+		done := end - start
+		r.updateReembed(job, func(j *models.ReembedJob) {
+			j.CompletedDocuments += done
+			j.EmbeddedChunks += len(chunks)
+		})
+		start = end
+	}
+
+	return r.swapShadow(job)
+}
+
+func (r *RAGService) swapShadow(job *models.ReembedJob) error {
+	if err := r.vectorDB.ReplaceCollection(job.CollectionName, job.ShadowCollection); err != nil {
+		return fmt.Errorf("failed to swap in shadow collection: %w", err)
+	}
+	return nil
+}
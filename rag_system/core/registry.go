@@ -0,0 +1,616 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"rag_system/models"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrSchemaMismatch is wrapped by errors about vectors that do not fit a
+// collection's recorded schema.
+var ErrSchemaMismatch = errors.New("embedding schema mismatch")
+
+// ErrAliasConflict is wrapped by errors about alias and collection names that
+// clash, and about deleting a collection that aliases still point to.
+var ErrAliasConflict = errors.New("alias conflict")
+
+// registryFileName is the registry's file inside the vector store directory.
+const registryFileName = "registry.json"
+
+// Registry records collections and the documents stored in them, so listing
+// endpoints do not have to reconstruct them from chunk payloads. Both vector
+// store backends keep it up to date; it is persisted as JSON next to the
+// store's data (config.VectorDBPath).
+type Registry struct {
+	mu          sync.RWMutex
+	path        string
+	collections map[string]*models.CollectionInfo
+	documents   map[string]*models.DocumentInfo // keyed by documentKey
+	aliases     map[string]string               // alias → collection
+}
+
+// documentKey scopes document IDs to their collection, so a document can be
+// held by a collection and its re-embedding shadow at the same time.
+func documentKey(collectionName, id string) string {
+	return collectionName + "/" + id
+}
+
+type registryFile struct {
+	Collections []*models.CollectionInfo `json:"collections"`
+	Documents   []*models.DocumentInfo   `json:"documents"`
+	Aliases     map[string]string        `json:"aliases,omitempty"`
+}
+
+// OpenRegistry loads the registry in dir, starting empty if it does not exist yet.
+func OpenRegistry(dir string) (*Registry, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create registry directory %s: %w", dir, err)
+	}
+
+	r := &Registry{
+		path:        filepath.Join(dir, registryFileName),
+		collections: make(map[string]*models.CollectionInfo),
+		documents:   make(map[string]*models.DocumentInfo),
+		aliases:     make(map[string]string),
+	}
+
+	data, err := os.ReadFile(r.path)
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read registry: %w", err)
+	}
+
+	var file registryFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to decode registry %s: %w", r.path, err)
+	}
+	for _, col := range file.Collections {
+		r.collections[col.Name] = col
+	}
+	for _, doc := range file.Documents {
+		r.documents[documentKey(doc.CollectionName, doc.ID)] = doc
+	}
+	for alias, collection := range file.Aliases {
+		r.aliases[alias] = collection
+	}
+	return r, nil
+}
+
+// HasCollection reports whether a collection is registered.
+func (r *Registry) HasCollection(name string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.collections[name]
+	return ok
+}
+
+// HasDocument reports whether a document is registered in a collection.
+func (r *Registry) HasDocument(collectionName, id string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.documents[documentKey(collectionName, id)]
+	return ok
+}
+
+// Collection returns a copy of a collection's record.
+func (r *Registry) Collection(name string) (*models.CollectionInfo, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	col, ok := r.collections[name]
+	if !ok {
+		return nil, false
+	}
+	info := *col
+	return &info, true
+}
+
+// EnsureCollection registers a collection with its schema unless it already is.
+func (r *Registry) EnsureCollection(name, description string, schema models.CollectionSchema) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.collections[name]; ok {
+		return nil
+	}
+	if _, ok := r.aliases[name]; ok {
+		return fmt.Errorf("%w: '%s' is an alias", ErrAliasConflict, name)
+	}
+	if schema.Distance == "" {
+		schema.Distance = models.CosineDistance
+	}
+	now := time.Now().UTC()
+	r.collections[name] = &models.CollectionInfo{
+		Name:             name,
+		Description:      description,
+		CollectionSchema: schema,
+		CreatedAt:        now,
+		UpdatedAt:        now,
+	}
+	return r.saveLocked()
+}
+
+// SetCollectionLLM records the provider and chat model of a collection.
+func (r *Registry) SetCollectionLLM(name string, llm models.LLMSelection) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	col, ok := r.collections[name]
+	if !ok {
+		return fmt.Errorf("collection '%s' not found", name)
+	}
+	col.LLMSelection = llm
+	return r.saveLocked()
+}
+
+// SetShadow marks a collection as the shadow a re-embed job builds to
+// replace another, and records whether it is being swapped in.
+func (r *Registry) SetShadow(name, of string, swapping bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	col, ok := r.collections[name]
+	if !ok {
+		return fmt.Errorf("collection '%s' not found", name)
+	}
+	col.ShadowOf = of
+	col.Swapping = swapping
+	return r.saveLocked()
+}
+
+// CheckDimension verifies that vectors of size dim fit a collection. A
+// collection registered without a dimension (one that predates schema
+// records and holds no vectors yet) adopts dim.
+func (r *Registry) CheckDimension(name string, dim int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	col, ok := r.collections[name]
+	if !ok {
+		return fmt.Errorf("collection '%s' not found", name)
+	}
+	if col.Dimension == 0 {
+		col.Dimension = dim
+		return r.saveLocked()
+	}
+	if col.Dimension != dim {
+		model := col.EmbeddingModel
+		if model == "" {
+			model = "an unrecorded model"
+		}
+		return fmt.Errorf("%w: collection '%s' holds %d-dimensional vectors from %s, got %d dimensions; re-embed the collection to change embedding models",
+			ErrSchemaMismatch, name, col.Dimension, model, dim)
+	}
+	return nil
+}
+
+// Documents returns copies of the records of a collection's documents.
+func (r *Registry) Documents(collectionName string) []*models.DocumentInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var docs []*models.DocumentInfo
+	for _, doc := range r.documents {
+		if doc.CollectionName == collectionName {
+			info := *doc
+			docs = append(docs, &info)
+		}
+	}
+	sort.Slice(docs, func(i, j int) bool { return docs[i].ID < docs[j].ID })
+	return docs
+}
+
+// Import registers collections and documents found in a store that predates
+// the registry. Entries that are already registered are left alone.
+func (r *Registry) Import(collections []*models.CollectionInfo, documents []*models.DocumentInfo) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	changed := false
+	for _, col := range collections {
+		if _, ok := r.collections[col.Name]; !ok {
+			r.collections[col.Name] = col
+			changed = true
+		}
+	}
+	for _, doc := range documents {
+		key := documentKey(doc.CollectionName, doc.ID)
+		if _, ok := r.documents[key]; !ok {
+			r.documents[key] = doc
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return r.saveLocked()
+}
+
+// PutDocument records a stored document and touches its collection.
+func (r *Registry) PutDocument(doc *models.DocumentInfo) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := documentKey(doc.CollectionName, doc.ID)
+	if existing, ok := r.documents[key]; ok {
+		doc.CreatedAt = existing.CreatedAt
+	}
+	r.documents[key] = doc
+	r.touchLocked(doc.CollectionName, doc.UpdatedAt)
+	return r.saveLocked()
+}
+
+// DeleteDocument forgets a document in every collection holding it and
+// returns those collections.
+func (r *Registry) DeleteDocument(id string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var collections []string
+	now := time.Now().UTC()
+	for key, doc := range r.documents {
+		if doc.ID != id {
+			continue
+		}
+		delete(r.documents, key)
+		r.touchLocked(doc.CollectionName, now)
+		collections = append(collections, doc.CollectionName)
+	}
+	if len(collections) == 0 {
+		return nil, nil
+	}
+	sort.Strings(collections)
+	return collections, r.saveLocked()
+}
+
+// DeleteDocuments forgets every document of a collection.
+func (r *Registry) DeleteDocuments(collectionName string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for key, doc := range r.documents {
+		if doc.CollectionName == collectionName {
+			delete(r.documents, key)
+		}
+	}
+	r.touchLocked(collectionName, time.Now().UTC())
+	return r.saveLocked()
+}
+
+// CheckDeletable refuses to delete a collection that aliases point to, or a
+// re-embed shadow being swapped in, which holds the only complete copy of
+// its collection's chunks.
+func (r *Registry) CheckDeletable(name string) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if col, ok := r.collections[name]; ok && col.Swapping {
+		return fmt.Errorf("%w: collection '%s' holds the only complete copy of '%s'; re-embed '%s' to finish its swap", ErrReembedInProgress, name, col.ShadowOf, col.ShadowOf)
+	}
+
+	if aliases := r.aliasesOfLocked(name); len(aliases) > 0 {
+		return fmt.Errorf("%w: collection '%s' is the target of aliases %v; re-point or delete them first", ErrAliasConflict, name, aliases)
+	}
+	return nil
+}
+
+// DeleteCollection forgets a collection and its documents.
+func (r *Registry) DeleteCollection(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.collections, name)
+	for key, doc := range r.documents {
+		if doc.CollectionName == name {
+			delete(r.documents, key)
+		}
+	}
+	return r.saveLocked()
+}
+
+// ReplaceCollection moves replacement's schema and documents under name,
+// dropping name's previous documents. name keeps its description and
+// creation time; replacement is forgotten.
+func (r *Registry) ReplaceCollection(name, replacement string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	col, ok := r.collections[name]
+	if !ok {
+		return fmt.Errorf("collection '%s' not found", name)
+	}
+	repl, ok := r.collections[replacement]
+	if !ok {
+		return fmt.Errorf("collection '%s' not found", replacement)
+	}
+
+	col.CollectionSchema = repl.CollectionSchema
+	col.UpdatedAt = time.Now().UTC()
+	delete(r.collections, replacement)
+
+	var moved []*models.DocumentInfo
+	for key, doc := range r.documents {
+		switch doc.CollectionName {
+		case name:
+			delete(r.documents, key)
+		case replacement:
+			delete(r.documents, key)
+			moved = append(moved, doc)
+		}
+	}
+	for _, doc := range moved {
+		doc.CollectionName = name
+		r.documents[documentKey(name, doc.ID)] = doc
+	}
+	return r.saveLocked()
+}
+
+// IsAlias reports whether name is an alias.
+func (r *Registry) IsAlias(name string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.aliases[name]
+	return ok
+}
+
+// Resolve returns the collection an alias points to, or name itself when it
+// is not an alias.
+func (r *Registry) Resolve(name string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if collection, ok := r.aliases[name]; ok {
+		return collection
+	}
+	return name
+}
+
+// Aliases returns a copy of every alias and the collection it points to.
+func (r *Registry) Aliases() map[string]string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	aliases := make(map[string]string, len(r.aliases))
+	for alias, collection := range r.aliases {
+		aliases[alias] = collection
+	}
+	return aliases
+}
+
+// UpdateAliases applies actions in order, all or nothing: if any action is
+// invalid no alias changes. Re-pointing an alias with "set" is how a rebuilt
+// collection is swapped in.
+func (r *Registry) UpdateAliases(actions []models.AliasAction) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	aliases := make(map[string]string, len(r.aliases))
+	for alias, collection := range r.aliases {
+		aliases[alias] = collection
+	}
+
+	for i, action := range actions {
+		if action.Alias == "" {
+			return fmt.Errorf("action %d: alias is required", i)
+		}
+		switch action.Op {
+		case models.SetAlias:
+			if _, ok := r.collections[action.Alias]; ok {
+				return fmt.Errorf("%w: action %d: '%s' is a collection", ErrAliasConflict, i, action.Alias)
+			}
+			if _, ok := r.collections[action.Collection]; !ok {
+				return fmt.Errorf("action %d: collection '%s' not found", i, action.Collection)
+			}
+			aliases[action.Alias] = action.Collection
+		case models.DeleteAlias:
+			if _, ok := aliases[action.Alias]; !ok {
+				return fmt.Errorf("action %d: alias '%s' not found", i, action.Alias)
+			}
+			delete(aliases, action.Alias)
+		default:
+			return fmt.Errorf("action %d: invalid op %q (expected %q or %q)", i, action.Op, models.SetAlias, models.DeleteAlias)
+		}
+	}
+
+	r.aliases = aliases
+	return r.saveLocked()
+}
+
+func (r *Registry) aliasesOfLocked(collectionName string) []string {
+	aliases := []string{}
+	for alias, collection := range r.aliases {
+		if collection == collectionName {
+			aliases = append(aliases, alias)
+		}
+	}
+	sort.Strings(aliases)
+	return aliases
+}
+
+// CollectionSummaries lists every registered collection with its document
+// and chunk counts, sorted by name.
+func (r *Registry) CollectionSummaries() []map[string]interface{} {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.collections))
+	for name := range r.collections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	summaries := make([]map[string]interface{}, 0, len(names))
+	for _, name := range names {
+		summaries = append(summaries, r.collectionSummaryLocked(name))
+	}
+	return summaries
+}
+
+// CollectionSummary describes one registered collection.
+func (r *Registry) CollectionSummary(name string) (map[string]interface{}, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if _, ok := r.collections[name]; !ok {
+		return nil, false
+	}
+	return r.collectionSummaryLocked(name), true
+}
+
+func (r *Registry) collectionSummaryLocked(name string) map[string]interface{} {
+	col := r.collections[name]
+	docCount, chunkCount := 0, 0
+	docTypes := map[string]int{}
+	for _, doc := range r.documents {
+		if doc.CollectionName != name {
+			continue
+		}
+		docCount++
+		chunkCount += doc.ChunkCount
+		if doc.DocType != "" {
+			docTypes[doc.DocType]++
+		}
+	}
+	return map[string]interface{}{
+		"name":               col.Name,
+		"description":        col.Description,
+		"embedding_provider": col.EmbeddingProvider,
+		"embedding_model":    col.EmbeddingModel,
+		"dimension":          col.Dimension,
+		"distance":           col.Distance,
+		"aliases":            r.aliasesOfLocked(name),
+		"llm_provider":       col.LLMProvider,
+		"chat_model":         col.ChatModel,
+		"created_at":         col.CreatedAt.Format(time.RFC3339),
+		"updated_at":         col.UpdatedAt.Format(time.RFC3339),
+		"doc_count":          docCount,
+		"chunk_count":        chunkCount,
+		"document_types":     docTypes,
+	}
+}
+
+// DocumentSummaries lists the documents of a collection, oldest first.
+func (r *Registry) DocumentSummaries(collectionName string) []map[string]interface{} {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var docs []*models.DocumentInfo
+	for _, doc := range r.documents {
+		if doc.CollectionName == collectionName {
+			docs = append(docs, doc)
+		}
+	}
+	sort.Slice(docs, func(i, j int) bool {
+		if !docs[i].CreatedAt.Equal(docs[j].CreatedAt) {
+			return docs[i].CreatedAt.Before(docs[j].CreatedAt)
+		}
+		return docs[i].ID < docs[j].ID
+	})
+
+	summaries := make([]map[string]interface{}, len(docs))
+	for i, doc := range docs {
+		summaries[i] = map[string]interface{}{
+			"id":           doc.ID,
+			"source":       doc.Source,
+			"doc_type":     doc.DocType,
+			"content_hash": doc.ContentHash,
+			"chunk_count":  doc.ChunkCount,
+			"metadata":     doc.Metadata,
+			"created_at":   doc.CreatedAt.Format(time.RFC3339),
+			"updated_at":   doc.UpdatedAt.Format(time.RFC3339),
+		}
+	}
+	return summaries
+}
+
+func (r *Registry) touchLocked(collectionName string, at time.Time) {
+	if col, ok := r.collections[collectionName]; ok {
+		col.UpdatedAt = at
+	}
+}
+
+// saveLocked writes the registry atomically: temp file, then rename.
+func (r *Registry) saveLocked() error {
+	file := registryFile{
+		Collections: make([]*models.CollectionInfo, 0, len(r.collections)),
+		Documents:   make([]*models.DocumentInfo, 0, len(r.documents)),
+		Aliases:     r.aliases,
+	}
+	for _, col := range r.collections {
+		file.Collections = append(file.Collections, col)
+	}
+	for _, doc := range r.documents {
+		file.Documents = append(file.Documents, doc)
+	}
+	sort.Slice(file.Collections, func(i, j int) bool { return file.Collections[i].Name < file.Collections[j].Name })
+	sort.Slice(file.Documents, func(i, j int) bool {
+		if file.Documents[i].CollectionName != file.Documents[j].CollectionName {
+			return file.Documents[i].CollectionName < file.Documents[j].CollectionName
+		}
+		return file.Documents[i].ID < file.Documents[j].ID
+	})
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode registry: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(r.path), registryFileName+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to save registry: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to save registry: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to save registry: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), r.path); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to save registry: %w", err)
+	}
+	return nil
+}
+
+// newDocumentInfo builds the registry record of a document being stored.
+func newDocumentInfo(collectionName string, doc *models.Document) *models.DocumentInfo {
+	createdAt := doc.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = time.Now().UTC()
+	}
+	if doc.ContentHash == "" {
+		doc.ContentHash = contentHash(doc.Content)
+	}
+	return &models.DocumentInfo{
+		ID:             doc.ID,
+		CollectionName: collectionName,
+		Source:         doc.Source,
+		DocType:        doc.DocType,
+		ContentHash:    doc.ContentHash,
+		ChunkCount:     len(doc.Chunks),
+		Metadata:       doc.Metadata,
+		CreatedAt:      createdAt,
+		UpdatedAt:      time.Now().UTC(),
+	}
+}
+
+func contentHash(content string) string {
+	if content == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
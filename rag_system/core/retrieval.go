@@ -0,0 +1,126 @@
+package core
+
+import (
+	"fmt"
+	"rag_system/models"
+)
+
+// Retrieval is the candidate list produced by one retrieval pass, before
+// parent inclusion, re-ranking and truncation to TopK.
+type Retrieval struct {
+	Mode   models.RetrievalMode
+	Chunks []*models.EnhancedChunk
+	Scores []float64
+	Ranks  []models.RetrievalRank
+	// Candidates is the number of chunks found before the semantic threshold
+	// was applied, so callers can tell "nothing matched" from "all filtered".
+	Candidates int
+}
+
+// ValidateQueryRequest checks the retrieval options of a query and fills in
+// their defaults.
+func ValidateQueryRequest(req *models.QueryRequest) error {
+	switch req.RetrievalMode {
+	case "":
+		req.RetrievalMode = models.DenseRetrieval
+	case models.DenseRetrieval, models.LexicalRetrieval, models.HybridRetrieval:
+	default:
+		return fmt.Errorf("invalid retrieval_mode %q (expected dense, lexical or hybrid)", req.RetrievalMode)
+	}
+
+	switch req.FusionMethod {
+	case "":
+		req.FusionMethod = models.ReciprocalRankFusion
+	case models.ReciprocalRankFusion, models.WeightedScoreFusion:
+	default:
+		return fmt.Errorf("invalid fusion_method %q (expected rrf or weighted)", req.FusionMethod)
+	}
+
+	if req.DenseWeight < 0 || req.DenseWeight > 1 {
+		return fmt.Errorf("dense_weight must be between 0 and 1")
+	}
+	if req.DenseWeight == 0 {
+		req.DenseWeight = defaultDenseWeight
+	}
+
+	if req.TopK <= 0 {
+		req.TopK = 5
+	}
+
+	_, err := QueryFilter(req)
+	return err
+}
+
+// Retrieve runs the retrieval mode of req against its collection. The dense
+// list is searched with embeddingQuery (which may be an expanded query); the
+// lexical list always uses the original query text so expansion terms do not
+// dilute exact matches. Each list fetches 2*TopK candidates for re-ranking.
+func (r *RAGService) Retrieve(req *models.QueryRequest, embeddingQuery string) (*Retrieval, error) {
+	if err := ValidateQueryRequest(req); err != nil {
+		return nil, err
+	}
+
+	filter, err := QueryFilter(req)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := req.TopK * 2
+	result := &Retrieval{Mode: req.RetrievalMode}
+
+	var dense, lexical rankedList
+	if req.RetrievalMode != models.LexicalRetrieval {
+		sel, err := r.collectionEmbedding(req.CollectionName)
+		if err != nil {
+			return nil, err
+		}
+		queryEmbedding, err := r.embeddingClient.GetEmbeddingWith(embeddingQuery, sel)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate query embedding: %w", err)
+		}
+		dense.chunks, dense.scores, err = r.vectorDB.QuerySimilarChunks(req.CollectionName, queryEmbedding, limit, filter)
+		if err != nil {
+			return nil, fmt.Errorf("failed to search similar chunks: %w", err)
+		}
+	}
+	if req.RetrievalMode != models.DenseRetrieval {
+		lexical.chunks, lexical.scores, err = r.vectorDB.QueryLexical(req.CollectionName, req.Query, limit, filter)
+		if err != nil {
+			return nil, fmt.Errorf("failed to search lexical index: %w", err)
+		}
+	}
+
+	switch req.RetrievalMode {
+	case models.DenseRetrieval:
+		result.Chunks, result.Scores = dense.chunks, dense.scores
+		result.Candidates = len(result.Chunks)
+
+		// Similarity thresholds only make sense for cosine scores
+		if req.SemanticThreshold > 0 {
+			var chunks []*models.EnhancedChunk
+			var scores []float64
+			for i, score := range result.Scores {
+				if score >= req.SemanticThreshold {
+					chunks = append(chunks, result.Chunks[i])
+					scores = append(scores, score)
+				}
+			}
+			result.Chunks, result.Scores = chunks, scores
+		}
+		result.Ranks = singleListRanks(result.Chunks, result.Scores, models.DenseRetrieval)
+	case models.LexicalRetrieval:
+		result.Chunks, result.Scores = lexical.chunks, lexical.scores
+		result.Candidates = len(result.Chunks)
+		result.Ranks = singleListRanks(result.Chunks, result.Scores, models.LexicalRetrieval)
+	case models.HybridRetrieval:
+		result.Chunks, result.Scores, result.Ranks = fuseRankedLists(dense, lexical, req.FusionMethod, req.DenseWeight)
+		if len(result.Chunks) > limit {
+			result.Chunks = result.Chunks[:limit]
+			result.Scores = result.Scores[:limit]
+			result.Ranks = result.Ranks[:limit]
+		}
+		result.Candidates = len(result.Chunks)
+	}
+
+	return result, nil
+}
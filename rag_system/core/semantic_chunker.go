@@ -0,0 +1,131 @@
+package core
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"rag_system/models"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const minSemanticSentences = 3
+
+// sentenceEndPattern matches the end of a sentence with the whitespace after
+// it, or a blank line.
+var sentenceEndPattern = regexp.MustCompile(`[.!?]+["')\]]*\s+|\n\s*\n`)
+
+// splitSentenceSpans splits content into sentences that together cover it,
+// each including the whitespace that follows it.
+func splitSentenceSpans(content string) []textSpan {
+	var spans []textSpan
+	start := 0
+	for _, m := range sentenceEndPattern.FindAllStringIndex(content, -1) {
+		if strings.TrimSpace(content[start:m[1]]) != "" {
+			spans = append(spans, textSpan{start, m[1]})
+			start = m[1]
+		}
+	}
+	if strings.TrimSpace(content[start:]) != "" {
+		spans = append(spans, textSpan{start, len(content)})
+	} else if len(spans) > 0 {
+		spans[len(spans)-1].end = len(content)
+	}
+	return spans
+}
+
+// createSemanticChunks ends chunks where the topic shifts. Every sentence is
+// embedded together with sentence_buffer neighbours on each side, and a
+// boundary is placed between two sentences when their similarity is below
+// the breakpoint_percentile of all neighbour similarities in the document.
+// Chunks are kept within the minimum and maximum chunk size: no topic
+// boundary is placed before a chunk reaches the minimum, and one is forced
+// before it exceeds the maximum.
+// Without an embedder, paragraphs are grouped instead.
+func createSemanticChunks(content string, docID string, config *models.ChunkingConfig, size chunkSizer, embed func([]string) ([][]float32, error), options ChunkerOptions) ([]*models.EnhancedChunk, error) {
+	spans := splitSentenceSpans(content)
+	if embed == nil || len(spans) < minSemanticSentences {
+		return groupParagraphChunks(content, docID, config, size)
+	}
+
+	buffer := options.Int("sentence_buffer")
+	windows := make([]string, len(spans))
+	for i := range spans {
+		from := max(i-buffer, 0)
+		to := min(i+buffer, len(spans)-1)
+		windows[i] = strings.TrimSpace(content[spans[from].start:spans[to].end])
+	}
+	vectors, err := embed(windows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed sentences: %w", err)
+	}
+	if len(vectors) != len(windows) {
+		return nil, fmt.Errorf("got %d sentence embeddings for %d sentences", len(vectors), len(windows))
+	}
+
+	// similarities[i] is between sentence i and sentence i+1
+	similarities := make([]float64, len(spans)-1)
+	for i := range similarities {
+		similarities[i] = cosineSimilarity(vectors[i], vectors[i+1])
+	}
+	percentile := options.Float("breakpoint_percentile")
+	threshold := percentileOf(similarities, percentile)
+	log.Printf("Semantic chunking: %d sentences, breakpoint similarity %.3f (percentile %.0f)", len(spans), threshold, percentile)
+
+	var chunks []*models.EnhancedChunk
+	addChunk := func(start, end int) {
+		chunk := newSpanChunk(content, docID, start, end)
+		if chunk.Text == "" {
+			return
+		}
+		chunk.ChunkType = "semantic"
+		chunk.Section = "content"
+		chunk.ChunkIndex = len(chunks)
+		if config.ExtractKeywords {
+			chunk.Keywords = extractKeywords(chunk.Text)
+		}
+		chunks = append(chunks, chunk)
+	}
+
+	chunkStart := spans[0].start
+	for i := 0; i < len(spans)-1; i++ {
+		current := size.of(content[chunkStart:spans[i].end])
+		next := size.of(content[chunkStart:spans[i+1].end])
+
+		topicShift := similarities[i] < threshold && current >= config.MinChunkSize
+		tooLarge := config.MaxChunkSize > 0 && next > config.MaxChunkSize
+		if topicShift || tooLarge {
+			addChunk(chunkStart, spans[i].end)
+			chunkStart = spans[i].end
+		}
+	}
+
+	// A short tail joins the chunk before it when both fit
+	last := spans[len(spans)-1].end
+	if n := len(chunks); n > 0 && size.of(content[chunkStart:last]) < config.MinChunkSize {
+		previous := chunks[n-1]
+		if config.MaxChunkSize <= 0 || size.of(content[previous.StartPos:last]) <= config.MaxChunkSize {
+			chunks = chunks[:n-1]
+			chunkStart = previous.StartPos
+		}
+	}
+	addChunk(chunkStart, last)
+
+	return chunks, nil
+}
+
+// percentileOf returns the p-th percentile (0-100) of values, interpolating
+// between the nearest ranks.
+func percentileOf(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	rank := p / 100 * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(rank-float64(lower))
+}
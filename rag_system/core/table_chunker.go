@@ -0,0 +1,484 @@
+package core
+
+import (
+	"rag_system/models"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Formats of the tables detectTables finds.
+const (
+	markdownTable  = "markdown"  // | a | b | rows under a |---|---| separator
+	alignedTable   = "aligned"   // Columns aligned with spaces under a ---- ---- rule
+	delimitedTable = "delimited" // CSV-like: lines with the same number of commas, semicolons or tabs
+)
+
+// minDelimitedRows is how many lines, the header included, a run of
+// delimited lines needs to be taken for a table rather than prose.
+const minDelimitedRows = 3
+
+var (
+	markdownSeparatorPattern = regexp.MustCompile(`^\s*\|?\s*:?-{3,}:?\s*(\|\s*:?-{3,}:?\s*)*\|?\s*$`)
+	alignedRulePattern       = regexp.MustCompile(`^\s*[-=]{3,}([ \t+]+[-=]{3,})+\s*$`)
+	alignedColumnPattern     = regexp.MustCompile(`[-=]+`)
+	tableCaptionPattern      = regexp.MustCompile(`(?i)^(?:table|tab\.)\s*[\dIVX]*\s*[:.\-–]\s*\S`)
+	captionHeadingPattern    = regexp.MustCompile(`^#+\s+(.+)$`)
+)
+
+// maxCaptionLength is the longest line taken for a table's caption.
+const maxCaptionLength = 200
+
+// textTable is a table found in a document's content.
+type textTable struct {
+	start, end int        // Span of the header and rows in the content
+	headerEnd  int        // End of the header lines, the markdown separator or aligned rule included
+	rows       []textSpan // Data rows, one per line
+	format     string
+	columns    []string
+	caption    string
+}
+
+// header returns the table's header lines, repeated with every group of rows.
+func (t *textTable) header(content string) string {
+	return strings.TrimSpace(content[t.start:t.headerEnd])
+}
+
+// textLine is a line of content, without its newline.
+type textLine struct {
+	start, end int
+	text       string
+}
+
+func splitTextLines(content string) []textLine {
+	var lines []textLine
+	start := 0
+	for start <= len(content) {
+		end := strings.IndexByte(content[start:], '\n')
+		if end < 0 {
+			end = len(content)
+		} else {
+			end += start
+		}
+		lines = append(lines, textLine{start: start, end: end, text: strings.TrimRight(content[start:end], "\r")})
+		start = end + 1
+	}
+	return lines
+}
+
+// detectTables finds Markdown tables, text tables aligned under a rule of
+// dashes, and runs of CSV-like lines, in the order they appear.
+func detectTables(content string) []*textTable {
+	lines := splitTextLines(content)
+	var tables []*textTable
+
+	for i := 0; i < len(lines); i++ {
+		var table *textTable
+		var next int
+		switch {
+		case i+2 < len(lines) && strings.Contains(lines[i].text, "|") && markdownSeparatorPattern.MatchString(lines[i+1].text) && strings.Contains(lines[i+1].text, "|"):
+			table, next = markdownTableAt(lines, i)
+		case i+2 < len(lines) && strings.TrimSpace(lines[i].text) != "" && alignedRulePattern.MatchString(lines[i+1].text):
+			table, next = alignedTableAt(lines, i)
+		default:
+			table, next = delimitedTableAt(lines, i)
+		}
+		if table == nil {
+			continue
+		}
+		table.caption = tableCaption(lines, i, next)
+		tables = append(tables, table)
+		i = next - 1
+	}
+	return tables
+}
+
+// markdownTableAt reads the Markdown table whose header is lines[i]. It
+// returns the table, or nil when no row follows the separator, and the index
+// of the first line after it.
+func markdownTableAt(lines []textLine, i int) (*textTable, int) {
+	table := &textTable{
+		start:     lines[i].start,
+		headerEnd: lines[i+1].end,
+		format:    markdownTable,
+		columns:   splitMarkdownRow(lines[i].text),
+	}
+	next := i + 2
+	for ; next < len(lines) && strings.Contains(lines[next].text, "|") && strings.TrimSpace(lines[next].text) != ""; next++ {
+		table.rows = append(table.rows, textSpan{lines[next].start, lines[next].end})
+	}
+	if len(table.rows) == 0 {
+		return nil, i + 1
+	}
+	table.end = table.rows[len(table.rows)-1].end
+	return table, next
+}
+
+// splitMarkdownRow returns the cells of a table row; an escaped \| is part
+// of a cell.
+func splitMarkdownRow(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	if strings.HasSuffix(line, "|") && !strings.HasSuffix(line, `\|`) {
+		line = line[:len(line)-1]
+	}
+	var cells []string
+	start := 0
+	for i := 0; i <= len(line); i++ {
+		if i == len(line) || (line[i] == '|' && (i == 0 || line[i-1] != '\\')) {
+			cells = append(cells, strings.TrimSpace(strings.ReplaceAll(line[start:i], `\|`, "|")))
+			start = i + 1
+		}
+	}
+	return cells
+}
+
+// alignedTableAt reads the text table whose header is lines[i], with the
+// rule under it marking the columns. Rows run to a blank line, and a closing
+// rule belongs to the table.
+func alignedTableAt(lines []textLine, i int) (*textTable, int) {
+	table := &textTable{
+		start:     lines[i].start,
+		headerEnd: lines[i+1].end,
+		format:    alignedTable,
+	}
+
+	header, rule := lines[i].text, lines[i+1].text
+	for _, span := range alignedColumnPattern.FindAllStringIndex(rule, -1) {
+		if span[0] >= len(header) {
+			break
+		}
+		table.columns = append(table.columns, strings.TrimSpace(header[span[0]:min(span[1], len(header))]))
+	}
+
+	next := i + 2
+	for ; next < len(lines) && strings.TrimSpace(lines[next].text) != ""; next++ {
+		if alignedRulePattern.MatchString(lines[next].text) {
+			table.end = lines[next].end
+			next++
+			break
+		}
+		table.rows = append(table.rows, textSpan{lines[next].start, lines[next].end})
+	}
+	if len(table.rows) == 0 {
+		return nil, i + 1
+	}
+	table.end = max(table.end, table.rows[len(table.rows)-1].end)
+	return table, next
+}
+
+// delimitedTableAt reads the run of lines starting at lines[i] that have the
+// same number of one delimiter outside quotes: at least one tab, or at least
+// two commas or semicolons, so that prose with a comma or two is left alone.
+func delimitedTableAt(lines []textLine, i int) (*textTable, int) {
+	for _, delimiter := range []byte{'\t', ',', ';'} {
+		count := countDelimiters(lines[i].text, delimiter)
+		if count == 0 || (delimiter != '\t' && count < 2) {
+			continue
+		}
+		next := i + 1
+		for next < len(lines) && countDelimiters(lines[next].text, delimiter) == count {
+			next++
+		}
+		if next-i < minDelimitedRows {
+			continue
+		}
+
+		columns := splitDelimited(lines[i].text, delimiter)
+		if !looksLikeHeader(columns) {
+			continue
+		}
+		table := &textTable{
+			start:     lines[i].start,
+			end:       lines[next-1].end,
+			headerEnd: lines[i].end,
+			format:    delimitedTable,
+			columns:   columns,
+		}
+		for _, line := range lines[i+1 : next] {
+			table.rows = append(table.rows, textSpan{line.start, line.end})
+		}
+		return table, next
+	}
+	return nil, i + 1
+}
+
+// countDelimiters counts delimiter in line outside double quotes.
+func countDelimiters(line string, delimiter byte) int {
+	count := 0
+	quoted := false
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '"':
+			quoted = !quoted
+		case delimiter:
+			if !quoted {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+func splitDelimited(line string, delimiter byte) []string {
+	var cells []string
+	quoted := false
+	start := 0
+	for i := 0; i <= len(line); i++ {
+		if i < len(line) && line[i] == '"' {
+			quoted = !quoted
+		}
+		if i == len(line) || (line[i] == delimiter && !quoted) {
+			cells = append(cells, strings.Trim(strings.TrimSpace(line[start:i]), `"`))
+			start = i + 1
+		}
+	}
+	return cells
+}
+
+// looksLikeHeader reports whether cells can be column names: none empty and
+// none as long as a phrase of prose.
+func looksLikeHeader(cells []string) bool {
+	for _, cell := range cells {
+		if cell == "" || len(cell) > 40 || strings.HasSuffix(cell, ".") {
+			return false
+		}
+	}
+	return true
+}
+
+// tableCaption returns the caption of the table in lines[first:next]: a
+// "Table 1: ..." line, a heading or a line ending in a colon just before
+// it, or a "Table: ..." line just after it, with at most one blank line
+// between.
+func tableCaption(lines []textLine, first, next int) string {
+	nearby := func(from, step int) string {
+		for i, blank := from, 0; i >= 0 && i < len(lines) && blank <= 1; i += step {
+			text := strings.TrimSpace(lines[i].text)
+			if text == "" {
+				blank++
+				continue
+			}
+			return text
+		}
+		return ""
+	}
+
+	if before := nearby(first-1, -1); before != "" && len(before) <= maxCaptionLength {
+		if m := captionHeadingPattern.FindStringSubmatch(before); m != nil {
+			return strings.TrimSpace(m[1])
+		}
+		if tableCaptionPattern.MatchString(before) || strings.HasSuffix(before, ":") {
+			return strings.TrimSuffix(before, ":")
+		}
+	}
+	if after := nearby(next, 1); after != "" && len(after) <= maxCaptionLength && tableCaptionPattern.MatchString(after) {
+		return after
+	}
+	return ""
+}
+
+// createTableChunks splits a table into groups of whole rows. The first
+// group holds the header; the others carry it in their metadata as
+// table_header, and it is put back in front of their text when they are
+// embedded or given to the LLM. Each group, with the header, stays within
+// the maximum chunk size, or the fixed size when there is no maximum.
+func createTableChunks(content string, docID string, table *textTable, index int, config *models.ChunkingConfig, size chunkSizer, section DocumentSection) []*models.EnhancedChunk {
+	limit := config.MaxChunkSize
+	if limit <= 0 {
+		limit = config.FixedSize
+	}
+	header := table.header(content)
+
+	var chunks []*models.EnhancedChunk
+	addChunk := func(first, last int) {
+		start := table.rows[first].start
+		if first == 0 {
+			start = table.start
+		}
+		end := table.rows[last].end
+		if last == len(table.rows)-1 {
+			end = table.end
+		}
+
+		chunk := newSpanChunk(content, docID, start, end)
+		chunk.ChunkType = "table"
+		chunk.Section = section.Title
+		chunk.Subsection = section.Subsection
+		chunk.Metadata = map[string]interface{}{
+			"table_index":     index,
+			"table_format":    table.format,
+			"table_columns":   table.columns,
+			"table_row_start": first + 1,
+			"table_row_end":   last + 1,
+			"table_rows":      len(table.rows),
+		}
+		if first > 0 {
+			chunk.Metadata["table_header"] = header
+		}
+		if table.caption != "" {
+			chunk.Metadata["table_caption"] = table.caption
+		}
+		if config.ExtractKeywords {
+			chunk.Keywords = extractKeywords(tableChunkText(chunk))
+		}
+		chunks = append(chunks, chunk)
+	}
+
+	first := 0
+	for i := range table.rows {
+		if i > first && limit > 0 {
+			groupStart := table.rows[first].start
+			if first == 0 {
+				groupStart = table.start
+			}
+			text := content[groupStart:table.rows[i].end]
+			if first > 0 {
+				text = header + "\n" + text
+			}
+			if size.of(text) > limit {
+				addChunk(first, i-1)
+				first = i
+			}
+		}
+	}
+	addChunk(first, len(table.rows)-1)
+	return chunks
+}
+
+// tableChunkText returns a chunk's text with the header of its table in
+// front when the chunk is a group of rows without it.
+func tableChunkText(chunk *models.EnhancedChunk) string {
+	if header, ok := chunk.Metadata["table_header"].(string); ok && header != "" {
+		return header + "\n" + chunk.Text
+	}
+	return chunk.Text
+}
+
+// spliceTableChunks replaces what a strategy made of the document's tables
+// with chunks of whole rows under their header. Chunks overlapping a table
+// keep their parts outside it; parents keep their span and adopt the table
+// chunks inside it.
+func spliceTableChunks(content string, chunks []*models.EnhancedChunk, tables []*textTable, config *models.ChunkingConfig, size chunkSizer, sections []DocumentSection) []*models.EnhancedChunk {
+	byID := make(map[string]*models.EnhancedChunk, len(chunks))
+	for _, chunk := range chunks {
+		byID[chunk.ID] = chunk
+	}
+
+	var spliced []*models.EnhancedChunk
+	for _, chunk := range chunks {
+		if len(chunk.ChildChunkIDs) > 0 {
+			spliced = append(spliced, chunk)
+			continue
+		}
+		parts := outsideTables(content, chunk, tables, config)
+		spliced = append(spliced, parts...)
+
+		if chunk.ParentChunkID == nil || (len(parts) == 1 && parts[0] == chunk) {
+			continue
+		}
+		if parent, ok := byID[*chunk.ParentChunkID]; ok {
+			var childIDs []string
+			for _, id := range parent.ChildChunkIDs {
+				if id != chunk.ID {
+					childIDs = append(childIDs, id)
+					continue
+				}
+				for _, part := range parts {
+					childIDs = append(childIDs, part.ID)
+				}
+			}
+			parent.ChildChunkIDs = childIDs
+		}
+	}
+
+	for index, table := range tables {
+		section := DocumentSection{Title: "document"}
+		for _, s := range sections {
+			if s.StartPos <= table.start && !insideTable(s.StartPos, tables) {
+				section = s
+			}
+		}
+		for _, tableChunk := range createTableChunks(content, chunks[0].DocumentID, table, index, config, size, section) {
+			for _, chunk := range chunks {
+				if len(chunk.ChildChunkIDs) > 0 && chunk.StartPos <= tableChunk.StartPos && tableChunk.EndPos <= chunk.EndPos {
+					tableChunk.ParentChunkID = &chunk.ID
+					chunk.ChildChunkIDs = append(chunk.ChildChunkIDs, tableChunk.ID)
+					break
+				}
+			}
+			spliced = append(spliced, tableChunk)
+		}
+	}
+
+	sort.SliceStable(spliced, func(i, j int) bool { return spliced[i].StartPos < spliced[j].StartPos })
+	for i, chunk := range spliced {
+		chunk.ChunkIndex = i
+	}
+	return spliced
+}
+
+// insideTable reports whether pos is in a table. Section detection can take
+// a table's header line for a heading, which names no section.
+func insideTable(pos int, tables []*textTable) bool {
+	for _, table := range tables {
+		if table.start <= pos && pos < table.end {
+			return true
+		}
+	}
+	return false
+}
+
+// outsideTables returns the parts of chunk outside every table: the chunk
+// itself when it overlaps none, otherwise copies of it narrowed to each
+// non-blank part, the first keeping its ID.
+func outsideTables(content string, chunk *models.EnhancedChunk, tables []*textTable, config *models.ChunkingConfig) []*models.EnhancedChunk {
+	spans := []textSpan{{chunk.StartPos, chunk.EndPos}}
+	overlaps := false
+	for _, table := range tables {
+		if table.end <= chunk.StartPos || table.start >= chunk.EndPos {
+			continue
+		}
+		overlaps = true
+		var kept []textSpan
+		for _, span := range spans {
+			if span.start < table.start {
+				kept = append(kept, textSpan{span.start, min(span.end, table.start)})
+			}
+			if span.end > table.end {
+				kept = append(kept, textSpan{max(span.start, table.end), span.end})
+			}
+		}
+		spans = kept
+	}
+	if !overlaps {
+		return []*models.EnhancedChunk{chunk}
+	}
+
+	var parts []*models.EnhancedChunk
+	for _, span := range spans {
+		narrowed := newSpanChunk(content, chunk.DocumentID, span.start, span.end)
+		if narrowed.Text == "" {
+			continue
+		}
+		part := *chunk
+		part.Text, part.StartPos, part.EndPos = narrowed.Text, narrowed.StartPos, narrowed.EndPos
+		if len(parts) > 0 {
+			part.ID = uuid.New().String()
+		}
+		if chunk.Metadata != nil {
+			part.Metadata = make(map[string]interface{}, len(chunk.Metadata))
+			for key, value := range chunk.Metadata {
+				part.Metadata[key] = value
+			}
+		}
+		part.Keywords = nil
+		if config.ExtractKeywords {
+			part.Keywords = extractKeywords(part.Text)
+		}
+		parts = append(parts, &part)
+	}
+	return parts
+}
@@ -1,25 +1,39 @@
 package core
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"os"
 	"rag_system/models"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/qdrant/go-client/qdrant"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
-// VectorDB wraps the Qdrant client
+// VectorDB is the Qdrant-backed VectorStore.
 type VectorDB struct {
-	client *qdrant.Client
-	ctx    context.Context
+	client   *qdrant.Client
+	ctx      context.Context
+	registry *Registry
+
+	countsMu sync.Mutex
+	counts   map[string]map[string]uint64 // Exact point counts per collection and filter; see cachedCount
+	writes   uint64                       // Calls to forgetCounts, so counts taken across a write are not cached
 }
 
+var _ VectorStore = (*VectorDB)(nil)
+
 // NewVectorDB creates a new Qdrant-backed VectorDB.
 // Reads QDRANT_HOST and QDRANT_API_KEY from environment variables.
-// The dbPath argument is ignored (kept for signature compatibility).
+// The collection and document registry is kept in the dbPath directory.
 func NewVectorDB(dbPath string) (*VectorDB, error) {
 	host := os.Getenv("QDRANT_HOST")
 	apiKey := os.Getenv("QDRANT_API_KEY")
@@ -50,75 +64,87 @@ func NewVectorDB(dbPath string) (*VectorDB, error) {
 
 	log.Printf("Connected to Qdrant version: %s (host: %s)", info.GetVersion(), host)
 
-	db := &VectorDB{client: client, ctx: ctx}
+	if dbPath == "" {
+		return nil, fmt.Errorf("vector_db_path must be set to hold the collection registry")
+	}
+	registry, err := OpenRegistry(dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	db := &VectorDB{client: client, ctx: ctx, registry: registry, counts: make(map[string]map[string]uint64)}
 
 	// Ensure payload indexes exist on all existing collections
 	if cols, err := client.ListCollections(ctx); err == nil {
 		for _, col := range cols {
 			db.createPayloadIndexes(col)
 			log.Printf("Ensured payload indexes for collection: %s", col)
+			if err := db.importIntoRegistry(col); err != nil {
+				log.Printf("Warning: could not register existing collection %s: %v", col, err)
+			}
 		}
 	}
 
 	return db, nil
 }
 
-// CreateCollection creates a Qdrant collection with default dimension 1024.
-func (db *VectorDB) CreateCollection(name, description string) error {
-	exists, err := db.collectionExists(name)
-	if err != nil {
+// CreateCollection creates a Qdrant collection sized for the schema's
+// dimension. Creating an existing collection is a no-op.
+func (db *VectorDB) CreateCollection(name, description string, schema models.CollectionSchema) error {
+	if err := validateSchema(&schema); err != nil {
 		return err
 	}
-	if exists {
-		return nil
+	if schema.Dimension == 0 {
+		return fmt.Errorf("%w: qdrant collections need a dimension", ErrSchemaMismatch)
+	}
+	if db.registry.IsAlias(name) {
+		return fmt.Errorf("%w: '%s' is an alias", ErrAliasConflict, name)
 	}
 
-	err = db.client.CreateCollection(db.ctx, &qdrant.CreateCollection{
-		CollectionName: name,
-		VectorsConfig: qdrant.NewVectorsConfig(&qdrant.VectorParams{
-			Size:     1024,
-			Distance: qdrant.Distance_Cosine,
-		}),
-	})
-	if err != nil {
-		return fmt.Errorf("failed to create collection: %w", err)
-	}
-
-	// Qdrant has no collection-level metadata, store description as a special meta point
-	zeroVec := make([]float32, 1024)
-	_, err = db.client.Upsert(db.ctx, &qdrant.UpsertPoints{
-		CollectionName: name,
-		Points: []*qdrant.PointStruct{
-			{
-				Id:      qdrant.NewIDNum(0),
-				Vectors: qdrant.NewVectors(zeroVec...),
-				Payload: qdrant.NewValueMap(map[string]interface{}{
-					"_meta":       true,
-					"name":        name,
-					"description": description,
-				}),
-			},
-		},
-	})
+	exists, err := db.collectionExists(name)
 	if err != nil {
-		log.Printf("Warning: could not store collection metadata: %v", err)
+		return err
+	}
+	if !exists {
+		err = db.client.CreateCollection(db.ctx, &qdrant.CreateCollection{
+			CollectionName: name,
+			VectorsConfig: qdrant.NewVectorsConfig(&qdrant.VectorParams{
+				Size:     uint64(schema.Dimension),
+				Distance: qdrant.Distance_Cosine,
+			}),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create collection: %w", err)
+		}
+		db.createPayloadIndexes(name)
 	}
 
-	db.createPayloadIndexes(name)
-	return nil
+	return db.registry.EnsureCollection(name, description, schema)
 }
 
-// AddDocument stores all chunks of a document into the collection with zero vectors.
-// Real vectors are added later via AddEmbeddings.
+// GetCollectionInfo returns a collection's registry record.
+func (db *VectorDB) GetCollectionInfo(name string) (*models.CollectionInfo, error) {
+	info, ok := db.registry.Collection(name)
+	if !ok {
+		return nil, fmt.Errorf("collection '%s' not found", name)
+	}
+	return info, nil
+}
+
+// AddDocument stores all chunks of a document into the collection. Chunks
+// without an embedding get a zero vector until AddEmbeddings fills it in.
 func (db *VectorDB) AddDocument(collectionName string, doc *models.Document) error {
-	exists, err := db.collectionExists(collectionName)
+	dim, err := embeddingDimension(doc.Chunks)
 	if err != nil {
 		return err
 	}
-	if !exists {
-		if err := db.CreateCollection(collectionName, ""); err != nil {
-			return err
-		}
+	if err := db.ensureCollection(collectionName, dim); err != nil {
+		return err
+	}
+	defer db.forgetCounts(collectionName)
+	if dim == 0 {
+		info, _ := db.registry.Collection(collectionName)
+		dim = info.Dimension
 	}
 
 	// Set collection name in chunk metadata so AddEmbeddings stores to correct collection
@@ -132,11 +158,14 @@ func (db *VectorDB) AddDocument(collectionName string, doc *models.Document) err
 	var points []*qdrant.PointStruct
 	for i, chunk := range doc.Chunks {
 		payload := db.chunkToPayload(chunk, doc)
-		zeroVec := make([]float32, 1024)
+		vector := chunk.Embedding
+		if len(vector) == 0 {
+			vector = make([]float32, dim)
+		}
 
 		points = append(points, &qdrant.PointStruct{
 			Id:      qdrant.NewIDUUID(chunk.ID),
-			Vectors: qdrant.NewVectors(zeroVec...),
+			Vectors: qdrant.NewVectors(vector...),
 			Payload: qdrant.NewValueMap(payload),
 		})
 
@@ -152,6 +181,10 @@ func (db *VectorDB) AddDocument(collectionName string, doc *models.Document) err
 		}
 	}
 
+	if err := db.registry.PutDocument(newDocumentInfo(collectionName, doc)); err != nil {
+		return err
+	}
+
 	log.Printf("Stored document %s with %d chunks into collection %s", doc.ID, len(doc.Chunks), collectionName)
 	return nil
 }
@@ -162,13 +195,9 @@ func (db *VectorDB) AddEmbeddings(chunks []*models.EnhancedChunk) error {
 		return nil
 	}
 
-	// Determine embedding dimension from first non-empty chunk
-	var embeddingDim uint64
-	for _, chunk := range chunks {
-		if len(chunk.Embedding) > 0 {
-			embeddingDim = uint64(len(chunk.Embedding))
-			break
-		}
+	embeddingDim, err := embeddingDimension(chunks)
+	if err != nil {
+		return err
 	}
 	if embeddingDim == 0 {
 		return fmt.Errorf("no valid embeddings found in chunks")
@@ -187,10 +216,14 @@ func (db *VectorDB) AddEmbeddings(chunks []*models.EnhancedChunk) error {
 	}
 
 	for collectionName, colChunks := range byCollection {
-		if err := db.ensureCollectionDimension(collectionName, embeddingDim); err != nil {
+		if err := db.ensureCollection(collectionName, embeddingDim); err != nil {
 			return err
 		}
 
+		// Upsert replaces the whole payload, so carry over the document
+		// fields AddDocument stored for these chunks
+		documentFields := db.documentPayloadFields(collectionName, colChunks)
+
 		var points []*qdrant.PointStruct
 		for i, chunk := range colChunks {
 			if len(chunk.Embedding) == 0 {
@@ -199,6 +232,9 @@ func (db *VectorDB) AddEmbeddings(chunks []*models.EnhancedChunk) error {
 
 			payload := db.chunkToPayload(chunk, nil)
 			payload["collection_name"] = collectionName
+			for key, value := range documentFields[chunk.ID] {
+				payload[key] = value
+			}
 
 			points = append(points, &qdrant.PointStruct{
 				Id:      qdrant.NewIDUUID(chunk.ID),
@@ -217,40 +253,64 @@ func (db *VectorDB) AddEmbeddings(chunks []*models.EnhancedChunk) error {
 				points = nil
 			}
 		}
+		db.forgetCounts(collectionName)
 		log.Printf("Upserted %d embeddings into collection %s", len(colChunks), collectionName)
 	}
 
 	return nil
 }
 
+// documentPayloadFields fetches the stored source, doc_type and document
+// metadata of chunks, keyed by chunk ID. Chunks not stored yet are absent.
+func (db *VectorDB) documentPayloadFields(collectionName string, chunks []*models.EnhancedChunk) map[string]map[string]interface{} {
+	fields := map[string]map[string]interface{}{}
+	for start := 0; start < len(chunks); start += 100 {
+		end := min(start+100, len(chunks))
+		ids := make([]*qdrant.PointId, 0, end-start)
+		for _, chunk := range chunks[start:end] {
+			ids = append(ids, qdrant.NewIDUUID(chunk.ID))
+		}
+		points, err := db.client.Get(db.ctx, &qdrant.GetPoints{
+			CollectionName: collectionName,
+			Ids:            ids,
+			WithPayload:    qdrant.NewWithPayloadInclude("chunk_id", "source", "doc_type", "document_metadata"),
+		})
+		if err != nil {
+			log.Printf("Warning: could not read document fields in %s: %v", collectionName, err)
+			return fields
+		}
+		for _, point := range points {
+			payload := point.GetPayload()
+			entry := map[string]interface{}{}
+			for _, key := range []string{"source", "doc_type", "document_metadata"} {
+				if v, ok := payload[key]; ok {
+					entry[key] = payloadInterface(v)
+				}
+			}
+			fields[payloadString(payload, "chunk_id")] = entry
+		}
+	}
+	return fields
+}
+
 // QuerySimilarChunks performs a vector similarity search in Qdrant.
-func (db *VectorDB) QuerySimilarChunks(collectionName string, queryEmbedding []float32, topK int, filters map[string]interface{}) ([]*models.EnhancedChunk, []float64, error) {
-	mustNot := []*qdrant.Condition{
-		qdrant.NewMatch("chunk_type", "meta"),
+func (db *VectorDB) QuerySimilarChunks(collectionName string, queryEmbedding []float32, topK int, filter *models.FilterExpr) ([]*models.EnhancedChunk, []float64, error) {
+	if err := db.registry.CheckDimension(collectionName, len(queryEmbedding)); err != nil {
+		return nil, nil, err
 	}
 
-	var must []*qdrant.Condition
-	for key, value := range filters {
-		switch key {
-		case "chunk_type":
-			must = append(must, qdrant.NewMatch("chunk_type", fmt.Sprintf("%v", value)))
-		case "section":
-			must = append(must, qdrant.NewMatch("section", fmt.Sprintf("%v", value)))
-		case "doc_type":
-			must = append(must, qdrant.NewMatch("doc_type", fmt.Sprintf("%v", value)))
-		}
+	qdrantFilter, err := db.buildFilter(filter)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	limit := uint64(topK)
 	results, err := db.client.Query(db.ctx, &qdrant.QueryPoints{
 		CollectionName: collectionName,
 		Query:          qdrant.NewQuery(queryEmbedding...),
-		Filter: &qdrant.Filter{
-			Must:    must,
-			MustNot: mustNot,
-		},
-		Limit:       &limit,
-		WithPayload: qdrant.NewWithPayload(true),
+		Filter:         qdrantFilter,
+		Limit:          &limit,
+		WithPayload:    qdrant.NewWithPayload(true),
 	})
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to query similar chunks: %w", err)
@@ -267,6 +327,243 @@ func (db *VectorDB) QuerySimilarChunks(collectionName string, queryEmbedding []f
 	return chunks, scores, nil
 }
 
+// lexicalCandidateLimit bounds how many full-text matches are scored with
+// BM25, lexicalScrollBatch how many are fetched per scroll request.
+const (
+	lexicalCandidateLimit = 5000
+	lexicalScrollBatch    = 500
+)
+
+// lexicalCandidatePayload is what candidates are fetched with: enough to
+// score them. The full payload is fetched for the ranked chunks only.
+var lexicalCandidatePayload = qdrant.NewWithPayloadInclude("chunk_id", "text")
+
+// QueryLexical ranks chunks against the query text with BM25. Qdrant's
+// full-text index on "text" selects the chunks containing any query term;
+// they are scored here using collection-wide document frequencies from
+// Count, cached until the collection is next written to. The average chunk
+// length is estimated from the candidates. When more than
+// lexicalCandidateLimit chunks match, the chunks holding every term are
+// scored first and the rest fill the remaining room, so the ranking is
+// approximate; a warning is logged.
+func (db *VectorDB) QueryLexical(collectionName string, query string, topK int, filter *models.FilterExpr) ([]*models.EnhancedChunk, []float64, error) {
+	terms := uniqueStrings(tokenizeForSearch(query))
+	if len(terms) == 0 {
+		return nil, nil, nil
+	}
+
+	base, err := db.buildFilter(filter)
+	if err != nil {
+		return nil, nil, err
+	}
+	var termMatches []*qdrant.Condition
+	for _, term := range terms {
+		termMatches = append(termMatches, qdrant.NewMatchText("text", term))
+	}
+	anyTerm := &qdrant.Filter{Must: base.Must, MustNot: base.MustNot, Should: termMatches}
+	everyTerm := &qdrant.Filter{Must: append(append([]*qdrant.Condition{}, base.Must...), termMatches...), MustNot: base.MustNot}
+
+	matching, err := db.cachedCount(collectionName, anyTerm)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to count lexical matches: %w", err)
+	}
+	if matching == 0 {
+		return nil, nil, nil
+	}
+
+	passes := []*qdrant.Filter{anyTerm}
+	if matching > lexicalCandidateLimit {
+		log.Printf("Warning: lexical search in %s matched %d chunks; scoring %d of them, those holding every query term first", collectionName, matching, lexicalCandidateLimit)
+		if len(terms) > 1 {
+			passes = []*qdrant.Filter{everyTerm, anyTerm}
+		}
+	}
+	var matches []*models.EnhancedChunk
+	seen := make(map[string]bool)
+	for _, pass := range passes {
+		chunks, err := db.scrollChunks(collectionName, pass, lexicalCandidateLimit-len(matches), seen)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to query lexical candidates: %w", err)
+		}
+		matches = append(matches, chunks...)
+	}
+	if len(matches) == 0 {
+		return nil, nil, nil
+	}
+
+	docCount, err := db.cachedCount(collectionName, base)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to count chunks: %w", err)
+	}
+
+	docFreq := make(map[string]int, len(terms))
+	for _, term := range terms {
+		df, err := db.cachedCount(collectionName, &qdrant.Filter{
+			Must:    append(append([]*qdrant.Condition{}, base.Must...), qdrant.NewMatchText("text", term)),
+			MustNot: base.MustNot,
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to count term %q: %w", term, err)
+		}
+		docFreq[term] = int(df)
+	}
+
+	type candidate struct {
+		chunk *models.EnhancedChunk
+		tf    map[string]int
+		len   int
+	}
+	candidates := make([]candidate, 0, len(matches))
+	totalLen := 0
+	for _, chunk := range matches {
+		tokens := tokenizeForSearch(chunk.Text)
+		tf := make(map[string]int)
+		for _, t := range tokens {
+			tf[t]++
+		}
+		candidates = append(candidates, candidate{chunk: chunk, tf: tf, len: len(tokens)})
+		totalLen += len(tokens)
+	}
+	avgDocLen := float64(totalLen) / float64(len(candidates))
+
+	scores := make([]float64, len(candidates))
+	for i, c := range candidates {
+		for _, term := range terms {
+			scores[i] += bm25TermScore(c.tf[term], docFreq[term], int(docCount), float64(c.len), avgDocLen)
+		}
+	}
+
+	order := make([]int, len(candidates))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return scores[order[i]] > scores[order[j]] })
+
+	var ids []*qdrant.PointId
+	var chunkScores []float64
+	for _, i := range order {
+		if scores[i] <= 0 || (topK > 0 && len(ids) == topK) {
+			break
+		}
+		ids = append(ids, qdrant.NewIDUUID(candidates[i].chunk.ID))
+		chunkScores = append(chunkScores, scores[i])
+	}
+	if len(ids) == 0 {
+		return nil, nil, nil
+	}
+
+	points, err := db.client.Get(db.ctx, &qdrant.GetPoints{
+		CollectionName: collectionName,
+		Ids:            ids,
+		WithPayload:    qdrant.NewWithPayload(true),
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch lexical matches: %w", err)
+	}
+	byID := make(map[string]*models.EnhancedChunk, len(points))
+	for _, point := range points {
+		chunk := db.payloadToChunk(point.GetPayload())
+		byID[chunk.ID] = chunk
+	}
+
+	// A chunk deleted since it was scored is left out
+	var chunks []*models.EnhancedChunk
+	var kept []float64
+	for i, id := range ids {
+		if chunk, ok := byID[id.GetUuid()]; ok {
+			chunks = append(chunks, chunk)
+			kept = append(kept, chunkScores[i])
+		}
+	}
+	return chunks, kept, nil
+}
+
+// lexicalCountCacheLimit bounds the counts cached per collection.
+const lexicalCountCacheLimit = 4096
+
+// cachedCount returns the exact number of points of a collection matching
+// filter. Counts are cached until forgetCounts is called for the
+// collection, which every write through this store does; writes by other
+// clients of the Qdrant instance are not seen until then.
+func (db *VectorDB) cachedCount(collectionName string, filter *qdrant.Filter) (uint64, error) {
+	key, err := proto.MarshalOptions{Deterministic: true}.Marshal(filter)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode filter: %w", err)
+	}
+	db.countsMu.Lock()
+	count, ok := db.counts[collectionName][string(key)]
+	writes := db.writes
+	db.countsMu.Unlock()
+	if ok {
+		return count, nil
+	}
+
+	exact := true
+	count, err = db.client.Count(db.ctx, &qdrant.CountPoints{
+		CollectionName: collectionName,
+		Filter:         filter,
+		Exact:          &exact,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	db.countsMu.Lock()
+	defer db.countsMu.Unlock()
+	if db.writes != writes {
+		return count, nil
+	}
+	cached := db.counts[collectionName]
+	if cached == nil || len(cached) >= lexicalCountCacheLimit {
+		cached = make(map[string]uint64)
+		db.counts[collectionName] = cached
+	}
+	cached[string(key)] = count
+	return count, nil
+}
+
+// forgetCounts drops the cached counts of a collection after a write.
+func (db *VectorDB) forgetCounts(collectionName string) {
+	db.countsMu.Lock()
+	defer db.countsMu.Unlock()
+	delete(db.counts, collectionName)
+	db.writes++
+}
+
+// scrollChunks pages through the chunks matching filter, skipping those in
+// seen, until limit chunks are collected, and adds them to seen. The chunks
+// hold only their ID and text.
+func (db *VectorDB) scrollChunks(collectionName string, filter *qdrant.Filter, limit int, seen map[string]bool) ([]*models.EnhancedChunk, error) {
+	var chunks []*models.EnhancedChunk
+	batch := uint32(lexicalScrollBatch)
+	var offset *qdrant.PointId
+	for len(chunks) < limit {
+		points, next, err := db.client.ScrollAndOffset(db.ctx, &qdrant.ScrollPoints{
+			CollectionName: collectionName,
+			Filter:         filter,
+			Offset:         offset,
+			Limit:          &batch,
+			WithPayload:    lexicalCandidatePayload,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, point := range points {
+			chunk := db.payloadToChunk(point.GetPayload())
+			if seen[chunk.ID] || len(chunks) == limit {
+				continue
+			}
+			seen[chunk.ID] = true
+			chunks = append(chunks, chunk)
+		}
+		if next == nil {
+			break
+		}
+		offset = next
+	}
+	return chunks, nil
+}
+
 // GetChunkWithParents retrieves a chunk and walks up its parent hierarchy.
 func (db *VectorDB) GetChunkWithParents(chunkID string) ([]*models.EnhancedChunk, error) {
 	collections, err := db.client.ListCollections(db.ctx)
@@ -353,33 +650,9 @@ func (db *VectorDB) Close() error {
 	return db.client.Close()
 }
 
-// ListCollections returns all Qdrant collections with basic stats.
+// ListCollections returns all collections with their registry records.
 func (db *VectorDB) ListCollections() ([]map[string]interface{}, error) {
-	collections, err := db.client.ListCollections(db.ctx)
-	if err != nil {
-		return nil, fmt.Errorf("failed to list collections: %w", err)
-	}
-
-	var result []map[string]interface{}
-	for _, name := range collections {
-		info, err := db.client.GetCollectionInfo(db.ctx, name)
-		var pointCount uint64
-		if err == nil {
-			pointCount = info.GetPointsCount()
-			if pointCount > 0 {
-				pointCount-- // subtract the meta point
-			}
-		}
-		result = append(result, map[string]interface{}{
-			"name":        name,
-			"description": "",
-			"created_at":  "",
-			"doc_count":   0,
-			"chunk_count": pointCount,
-		})
-	}
-
-	return result, nil
+	return db.registry.CollectionSummaries(), nil
 }
 
 // DeleteCollection deletes a Qdrant collection entirely.
@@ -391,112 +664,246 @@ func (db *VectorDB) DeleteCollection(name string) error {
 	if !exists {
 		return fmt.Errorf("collection '%s' not found", name)
 	}
+	if err := db.registry.CheckDeletable(name); err != nil {
+		return err
+	}
 	if err := db.client.DeleteCollection(db.ctx, name); err != nil {
 		return fmt.Errorf("failed to delete collection: %w", err)
 	}
-	return nil
+	db.forgetCounts(name)
+	return db.registry.DeleteCollection(name)
 }
 
-// ListDocuments returns all unique documents in a collection derived from chunk payloads.
-func (db *VectorDB) ListDocuments(collectionName string) ([]map[string]interface{}, error) {
-	limit := uint32(1000)
-	results, err := db.client.Scroll(db.ctx, &qdrant.ScrollPoints{
-		CollectionName: collectionName,
-		Filter: &qdrant.Filter{
-			MustNot: []*qdrant.Condition{
-				qdrant.NewMatch("chunk_type", "meta"),
-			},
-		},
-		Limit:       &limit,
-		WithPayload: qdrant.NewWithPayload(true),
-	})
+// ReplaceCollection recreates name with replacement's vector size and
+// copies replacement's points, vectors included, into it. Qdrant cannot
+// rename collections, so name is incomplete while points are copied.
+// replacement is marked as swapping before name is dropped and only deleted
+// once every point is copied: when the copy fails it holds the only complete
+// set of chunks, and calling ReplaceCollection again resumes the swap.
+func (db *VectorDB) ReplaceCollection(name, replacement string) error {
+	repl, ok := db.registry.Collection(replacement)
+	if !ok {
+		return fmt.Errorf("collection '%s' not found", replacement)
+	}
+	if !db.registry.HasCollection(name) {
+		return fmt.Errorf("collection '%s' not found", name)
+	}
+	defer db.forgetCounts(name)
+
+	if !repl.Swapping {
+		if err := db.registry.SetShadow(replacement, name, true); err != nil {
+			return err
+		}
+		if err := db.client.DeleteCollection(db.ctx, name); err != nil {
+			return fmt.Errorf("failed to delete collection %s: %w", name, err)
+		}
+	}
+	exists, err := db.collectionExists(name)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list documents: %w", err)
+		return err
+	}
+	if !exists {
+		if err := db.client.CreateCollection(db.ctx, &qdrant.CreateCollection{
+			CollectionName: name,
+			VectorsConfig: qdrant.NewVectorsConfig(&qdrant.VectorParams{
+				Size:     uint64(repl.Dimension),
+				Distance: qdrant.Distance_Cosine,
+			}),
+		}); err != nil {
+			return fmt.Errorf("failed to create collection %s: %w", name, err)
+		}
+		db.createPayloadIndexes(name)
 	}
 
-	docMap := map[string]map[string]interface{}{}
-	for _, point := range results {
-		payload := point.GetPayload()
-		docID := payloadString(payload, "document_id")
-		if docID == "" {
-			continue
+	limit := uint32(migrateBatchSize)
+	var offset *qdrant.PointId
+	copied := 0
+	for {
+		points, next, err := db.client.ScrollAndOffset(db.ctx, &qdrant.ScrollPoints{
+			CollectionName: replacement,
+			Offset:         offset,
+			Limit:          &limit,
+			WithPayload:    qdrant.NewWithPayload(true),
+			WithVectors:    qdrant.NewWithVectors(true),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to scroll collection %s: %w", replacement, err)
 		}
-		if _, exists := docMap[docID]; !exists {
-			docMap[docID] = map[string]interface{}{
-				"id":          docID,
-				"source":      payloadString(payload, "source"),
-				"doc_type":    payloadString(payload, "doc_type"),
-				"created_at":  "",
-				"chunk_count": 0,
+		if len(points) > 0 {
+			upserts := make([]*qdrant.PointStruct, 0, len(points))
+			for _, point := range points {
+				payload := point.GetPayload()
+				payload["collection_name"] = qdrant.NewValueString(name)
+				upserts = append(upserts, &qdrant.PointStruct{
+					Id:      point.GetId(),
+					Vectors: qdrant.NewVectors(pointVector(point.GetVectors())...),
+					Payload: payload,
+				})
+			}
+			wait := true
+			if _, err := db.client.Upsert(db.ctx, &qdrant.UpsertPoints{
+				CollectionName: name,
+				Wait:           &wait,
+				Points:         upserts,
+			}); err != nil {
+				return fmt.Errorf("failed to copy points into %s: %w", name, err)
 			}
+			copied += len(points)
 		}
-		docMap[docID]["chunk_count"] = docMap[docID]["chunk_count"].(int) + 1
+		if next == nil {
+			break
+		}
+		offset = next
+	}
+
+	if err := db.client.DeleteCollection(db.ctx, replacement); err != nil {
+		log.Printf("Warning: could not delete replaced collection %s: %v", replacement, err)
+	}
+	log.Printf("Replaced collection %s with %s (%d points)", name, replacement, copied)
+	return db.registry.ReplaceCollection(name, replacement)
+}
+
+// MarkShadow records that name is the shadow a re-embed job builds to
+// replace collection.
+func (db *VectorDB) MarkShadow(name, collection string) error {
+	return db.registry.SetShadow(name, collection, false)
+}
+
+// SetCollectionLLM records the provider and chat model of a collection.
+func (db *VectorDB) SetCollectionLLM(name string, llm models.LLMSelection) error {
+	return db.registry.SetCollectionLLM(name, llm)
+}
+
+// ResolveCollection returns the collection an alias points to, or name.
+func (db *VectorDB) ResolveCollection(name string) string {
+	return db.registry.Resolve(name)
+}
+
+// ListAliases returns every alias and its collection.
+func (db *VectorDB) ListAliases() map[string]string {
+	return db.registry.Aliases()
+}
+
+// UpdateAliases applies alias actions atomically.
+func (db *VectorDB) UpdateAliases(actions []models.AliasAction) error {
+	return db.registry.UpdateAliases(actions)
+}
+
+// ListDocuments returns the registered documents of a collection.
+func (db *VectorDB) ListDocuments(collectionName string) ([]map[string]interface{}, error) {
+	exists, err := db.collectionExists(collectionName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list documents: %w", err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("failed to list documents: collection '%s' not found", collectionName)
 	}
+	return db.registry.DocumentSummaries(collectionName), nil
+}
 
-	var documents []map[string]interface{}
-	for _, doc := range docMap {
-		documents = append(documents, doc)
+// ExportDocuments scrolls every chunk of a collection and groups them into
+// their documents.
+func (db *VectorDB) ExportDocuments(collectionName string) ([]*models.Document, error) {
+	var chunks []*models.EnhancedChunk
+	limit := uint32(migrateBatchSize)
+	var offset *qdrant.PointId
+	for {
+		points, next, err := db.client.ScrollAndOffset(db.ctx, &qdrant.ScrollPoints{
+			CollectionName: collectionName,
+			Offset:         offset,
+			Limit:          &limit,
+			WithPayload:    qdrant.NewWithPayload(true),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to scroll collection %s: %w", collectionName, err)
+		}
+		for _, point := range points {
+			chunk := db.payloadToChunk(point.GetPayload())
+			if chunk.ID == "" {
+				continue
+			}
+			chunks = append(chunks, chunk)
+		}
+		if next == nil {
+			break
+		}
+		offset = next
 	}
-	return documents, nil
+	return assembleDocuments(db.registry.Documents(collectionName), chunks), nil
 }
 
-// DeleteDocument deletes all chunks belonging to a document ID across all collections.
+// DeleteDocument deletes all chunks belonging to a document ID. Documents
+// missing from the registry are looked for in every collection.
 func (db *VectorDB) DeleteDocument(documentID string) error {
-	collections, err := db.client.ListCollections(db.ctx)
+	collections, err := db.registry.DeleteDocument(documentID)
 	if err != nil {
-		return fmt.Errorf("failed to list collections: %w", err)
+		return err
+	}
+
+	registered := len(collections) > 0
+	if !registered {
+		collections, err = db.client.ListCollections(db.ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list collections: %w", err)
+		}
 	}
 
+	documentFilter := &qdrant.Filter{
+		Must: []*qdrant.Condition{
+			qdrant.NewMatch("document_id", documentID),
+		},
+	}
+	exact := true
 	deleted := false
 	for _, collectionName := range collections {
-		_, err := db.client.Delete(db.ctx, &qdrant.DeletePoints{
+		count, err := db.client.Count(db.ctx, &qdrant.CountPoints{
 			CollectionName: collectionName,
-			Points: qdrant.NewPointsSelectorFilter(&qdrant.Filter{
-				Must: []*qdrant.Condition{
-					qdrant.NewMatch("document_id", documentID),
-				},
-			}),
+			Filter:         documentFilter,
+			Exact:          &exact,
 		})
-		if err == nil {
-			deleted = true
-			log.Printf("Deleted chunks for document '%s' from collection '%s'", documentID, collectionName)
+		if err != nil || count == 0 {
+			continue
 		}
+		_, err = db.client.Delete(db.ctx, &qdrant.DeletePoints{
+			CollectionName: collectionName,
+			Points:         qdrant.NewPointsSelectorFilter(documentFilter),
+		})
+		db.forgetCounts(collectionName)
+		if err != nil {
+			return fmt.Errorf("failed to delete document: %w", err)
+		}
+		deleted = true
+		log.Printf("Deleted chunks for document '%s' from collection '%s'", documentID, collectionName)
 	}
 
-	if !deleted {
+	if !deleted && !registered {
 		return fmt.Errorf("document with ID '%s' not found", documentID)
 	}
 	return nil
 }
 
-// DeleteAllDocumentsInCollection deletes all non-meta points from a collection.
+// DeleteAllDocumentsInCollection deletes every point but keeps the collection.
 func (db *VectorDB) DeleteAllDocumentsInCollection(collectionName string) error {
-	limit := uint32(1)
-	results, err := db.client.Scroll(db.ctx, &qdrant.ScrollPoints{
+	exact := true
+	count, err := db.client.Count(db.ctx, &qdrant.CountPoints{
 		CollectionName: collectionName,
-		Filter: &qdrant.Filter{
-			MustNot: []*qdrant.Condition{
-				qdrant.NewMatch("chunk_type", "meta"),
-			},
-		},
-		Limit:       &limit,
-		WithPayload: qdrant.NewWithPayload(false),
+		Exact:          &exact,
 	})
-	if err != nil || len(results) == 0 {
+	if err != nil || count == 0 {
 		return fmt.Errorf("no documents found in collection '%s'", collectionName)
 	}
 
 	_, err = db.client.Delete(db.ctx, &qdrant.DeletePoints{
 		CollectionName: collectionName,
-		Points: qdrant.NewPointsSelectorFilter(&qdrant.Filter{
-			MustNot: []*qdrant.Condition{
-				qdrant.NewMatch("chunk_type", "meta"),
-			},
-		}),
+		Points:         qdrant.NewPointsSelectorFilter(&qdrant.Filter{}),
 	})
+	db.forgetCounts(collectionName)
 	if err != nil {
 		return fmt.Errorf("failed to delete documents: %w", err)
 	}
+	if err := db.registry.DeleteDocuments(collectionName); err != nil {
+		return err
+	}
 
 	log.Printf("Deleted all documents from collection '%s'", collectionName)
 	return nil
@@ -516,61 +923,122 @@ func (db *VectorDB) GetCollectionStats(collectionName string) (map[string]interf
 	if err != nil {
 		return nil, fmt.Errorf("failed to get collection info: %w", err)
 	}
+	exact := true
+
+	// Chunk types are counted by Qdrant over the keyword index
+	chunkTypes := map[string]int{}
+	facetLimit := uint64(100)
+	hits, err := db.client.Facet(db.ctx, &qdrant.FacetCounts{
+		CollectionName: collectionName,
+		Key:            "chunk_type",
+		Limit:          &facetLimit,
+		Exact:          &exact,
+	})
+	if err != nil {
+		log.Printf("Warning: could not count chunk types in %s: %v", collectionName, err)
+	}
+	for _, hit := range hits {
+		chunkTypes[hit.GetValue().GetStringValue()] = int(hit.GetCount())
+	}
+
+	summary, _ := db.registry.CollectionSummary(collectionName)
+	return map[string]interface{}{
+		"name":               collectionName,
+		"description":        summary["description"],
+		"embedding_provider": summary["embedding_provider"],
+		"embedding_model":    summary["embedding_model"],
+		"created_at":         summary["created_at"],
+		"updated_at":         summary["updated_at"],
+		"document_count":     summary["doc_count"],
+		"chunk_count":        info.GetPointsCount(),
+		"chunk_types":        chunkTypes,
+		"document_types":     summary["document_types"],
+	}, nil
+}
 
-	pointCount := info.GetPointsCount()
-	if pointCount > 0 {
-		pointCount--
+// ── internal helpers ──────────────────────────────────────────────────────────
+
+// importIntoRegistry registers a collection created before the registry
+// existed, with its documents rebuilt from chunk payloads. The description is
+// taken from the legacy zero-vector meta point (ID 0), which is then removed.
+func (db *VectorDB) importIntoRegistry(collectionName string) error {
+	if db.registry.HasCollection(collectionName) {
+		return nil
 	}
 
-	stats := map[string]interface{}{
-		"name":           collectionName,
-		"description":    "",
-		"created_at":     "",
-		"document_count": 0,
-		"chunk_count":    pointCount,
-		"chunk_types":    map[string]int{},
-		"document_types": map[string]int{},
+	now := time.Now().UTC()
+	col := &models.CollectionInfo{Name: collectionName, CreatedAt: now, UpdatedAt: now}
+	col.Distance = models.CosineDistance
+	if info, err := db.client.GetCollectionInfo(db.ctx, collectionName); err == nil {
+		if vp := info.GetConfig().GetParams().GetVectorsConfig().GetParams(); vp != nil {
+			col.Dimension = int(vp.GetSize())
+			if vp.GetDistance() != qdrant.Distance_Cosine {
+				col.Distance = strings.ToLower(vp.GetDistance().String())
+			}
+		}
 	}
 
-	limit := uint32(1000)
-	results, err := db.client.Scroll(db.ctx, &qdrant.ScrollPoints{
+	metaID := qdrant.NewIDNum(0)
+	if points, err := db.client.Get(db.ctx, &qdrant.GetPoints{
 		CollectionName: collectionName,
-		Filter: &qdrant.Filter{
-			MustNot: []*qdrant.Condition{
-				qdrant.NewMatch("chunk_type", "meta"),
-			},
-		},
-		Limit:       &limit,
-		WithPayload: qdrant.NewWithPayload(true),
-	})
-	if err == nil {
-		chunkTypes := map[string]int{}
-		docTypes := map[string]int{}
-		docIDs := map[string]bool{}
+		Ids:            []*qdrant.PointId{metaID},
+		WithPayload:    qdrant.NewWithPayload(true),
+	}); err == nil && len(points) == 1 {
+		col.Description = payloadString(points[0].GetPayload(), "description")
+		if _, err := db.client.Delete(db.ctx, &qdrant.DeletePoints{
+			CollectionName: collectionName,
+			Points:         qdrant.NewPointsSelector(metaID),
+		}); err != nil {
+			log.Printf("Warning: could not remove meta point of collection %s: %v", collectionName, err)
+		}
+	}
 
-		for _, point := range results {
+	docs := map[string]*models.DocumentInfo{}
+	var documents []*models.DocumentInfo
+	limit := uint32(migrateBatchSize)
+	var offset *qdrant.PointId
+	for {
+		points, next, err := db.client.ScrollAndOffset(db.ctx, &qdrant.ScrollPoints{
+			CollectionName: collectionName,
+			Offset:         offset,
+			Limit:          &limit,
+			WithPayload:    qdrant.NewWithPayloadInclude("document_id", "source", "doc_type", "document_metadata"),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to scroll collection %s: %w", collectionName, err)
+		}
+		for _, point := range points {
 			payload := point.GetPayload()
-			if ct := payloadString(payload, "chunk_type"); ct != "" {
-				chunkTypes[ct]++
-			}
-			if dt := payloadString(payload, "doc_type"); dt != "" {
-				docTypes[dt]++
+			docID := payloadString(payload, "document_id")
+			if docID == "" {
+				continue
 			}
-			if did := payloadString(payload, "document_id"); did != "" {
-				docIDs[did] = true
+			doc, ok := docs[docID]
+			if !ok {
+				doc = &models.DocumentInfo{
+					ID:             docID,
+					CollectionName: collectionName,
+					Source:         payloadString(payload, "source"),
+					DocType:        payloadString(payload, "doc_type"),
+					Metadata:       payloadMap(payload, "document_metadata"),
+					CreatedAt:      now,
+					UpdatedAt:      now,
+				}
+				docs[docID] = doc
+				documents = append(documents, doc)
 			}
+			doc.ChunkCount++
 		}
-
-		stats["chunk_types"] = chunkTypes
-		stats["document_types"] = docTypes
-		stats["document_count"] = len(docIDs)
+		if next == nil {
+			break
+		}
+		offset = next
 	}
 
-	return stats, nil
+	log.Printf("Registered existing collection %s with %d documents", collectionName, len(documents))
+	return db.registry.Import([]*models.CollectionInfo{col}, documents)
 }
 
-// ── internal helpers ──────────────────────────────────────────────────────────
-
 func (db *VectorDB) collectionExists(name string) (bool, error) {
 	collections, err := db.client.ListCollections(db.ctx)
 	if err != nil {
@@ -584,72 +1052,36 @@ func (db *VectorDB) collectionExists(name string) (bool, error) {
 	return false, nil
 }
 
-func (db *VectorDB) ensureCollectionDimension(collectionName string, dimension uint64) error {
-	exists, err := db.collectionExists(collectionName)
-	if err != nil {
-		return err
-	}
-
-	if exists {
-		info, err := db.client.GetCollectionInfo(db.ctx, collectionName)
-		if err == nil {
-			if cfg := info.GetConfig(); cfg != nil {
-				if params := cfg.GetParams(); params != nil {
-					if vecs := params.GetVectorsConfig(); vecs != nil {
-						if vp := vecs.GetParams(); vp != nil && vp.Size == dimension {
-							return nil // already correct, nothing to do
-						}
-					}
-				}
-			}
-		}
-		// Dimension mismatch or couldn't verify — recreate
-		log.Printf("Recreating collection %s for dimension %d", collectionName, dimension)
-		if err := db.client.DeleteCollection(db.ctx, collectionName); err != nil {
-			return fmt.Errorf("failed to delete collection for recreation: %w", err)
+// ensureCollection creates a missing collection sized for dim and checks
+// that dim matches an existing collection's recorded dimension. Collections
+// are never recreated here: a mismatch is an ErrSchemaMismatch, and changing
+// embedding models goes through an explicit re-embed.
+func (db *VectorDB) ensureCollection(collectionName string, dim int) error {
+	if !db.registry.HasCollection(collectionName) {
+		if dim == 0 {
+			return fmt.Errorf("collection '%s' not found", collectionName)
 		}
+		return db.CreateCollection(collectionName, "", models.CollectionSchema{Dimension: dim})
 	}
-
-	// Create with correct dimension
-	if err := db.client.CreateCollection(db.ctx, &qdrant.CreateCollection{
-		CollectionName: collectionName,
-		VectorsConfig: qdrant.NewVectorsConfig(&qdrant.VectorParams{
-			Size:     dimension,
-			Distance: qdrant.Distance_Cosine,
-		}),
-	}); err != nil {
-		return fmt.Errorf("failed to create collection %s: %w", collectionName, err)
+	if dim == 0 {
+		return nil
 	}
+	return db.registry.CheckDimension(collectionName, dim)
+}
 
-	// Always insert the meta point after creation so filters work
-	zeroVec := make([]float32, dimension)
-	_, err = db.client.Upsert(db.ctx, &qdrant.UpsertPoints{
-		CollectionName: collectionName,
-		Points: []*qdrant.PointStruct{
-			{
-				Id:      qdrant.NewIDNum(0),
-				Vectors: qdrant.NewVectors(zeroVec...),
-				Payload: qdrant.NewValueMap(map[string]interface{}{
-					"chunk_type": "meta",
-					"name":       collectionName,
-				}),
-			},
-		},
-	})
-	if err != nil {
-		log.Printf("Warning: could not store meta point for collection %s: %v", collectionName, err)
+// pointVector returns the dense vector of a scrolled point.
+func pointVector(vectors *qdrant.VectorsOutput) []float32 {
+	vector := vectors.GetVector()
+	if dense := vector.GetDense(); dense != nil {
+		return dense.GetData()
 	}
-	db.createPayloadIndexes(collectionName)
-	return nil
+	return vector.GetData()
 }
 
-// chunkToPayload converts an EnhancedChunk to a flat Qdrant payload map.
-// ParentChunkID is *string in the model, so we dereference it safely.
+// chunkToPayload converts an EnhancedChunk to a Qdrant payload map. Lists and
+// metadata are stored as native payload values so they can be indexed and
+// filtered. ParentChunkID is *string in the model, so we dereference it safely.
 func (db *VectorDB) chunkToPayload(chunk *models.EnhancedChunk, doc *models.Document) map[string]interface{} {
-	childIDsJSON, _ := json.Marshal(chunk.ChildChunkIDs)
-	keywordsJSON, _ := json.Marshal(chunk.Keywords)
-	metadataJSON, _ := json.Marshal(chunk.Metadata)
-
 	parentID := ""
 	if chunk.ParentChunkID != nil {
 		parentID = *chunk.ParentChunkID
@@ -660,39 +1092,45 @@ func (db *VectorDB) chunkToPayload(chunk *models.EnhancedChunk, doc *models.Docu
 		"document_id":     chunk.DocumentID,
 		"text":            chunk.Text,
 		"parent_chunk_id": parentID,
-		"child_chunk_ids": string(childIDsJSON),
+		"child_chunk_ids": payloadList(chunk.ChildChunkIDs),
 		"section":         chunk.Section,
 		"subsection":      chunk.Subsection,
 		"chunk_type":      chunk.ChunkType,
 		"start_pos":       chunk.StartPos,
 		"end_pos":         chunk.EndPos,
 		"chunk_index":     chunk.ChunkIndex,
-		"keywords":        string(keywordsJSON),
-		"metadata":        string(metadataJSON),
+		"keywords":        payloadList(chunk.Keywords),
+		"metadata":        payloadObject(chunk.Metadata),
 		"confidence":      chunk.Confidence,
 	}
 
 	if doc != nil {
 		payload["source"] = doc.Source
 		payload["doc_type"] = doc.DocType
+		payload["document_metadata"] = payloadObject(doc.Metadata)
 	}
 
 	return payload
 }
 
 // payloadToChunk converts a Qdrant payload back to an EnhancedChunk matching models.go.
+// Payloads written before lists and metadata were stored natively hold them
+// as JSON strings; both forms are read.
 func (db *VectorDB) payloadToChunk(payload map[string]*qdrant.Value) *models.EnhancedChunk {
 	chunk := &models.EnhancedChunk{
-		ID:         payloadString(payload, "chunk_id"),
-		DocumentID: payloadString(payload, "document_id"),
-		Text:       payloadString(payload, "text"),
-		Section:    payloadString(payload, "section"),
-		Subsection: payloadString(payload, "subsection"),
-		ChunkType:  payloadString(payload, "chunk_type"),
-		Confidence: payloadFloat(payload, "confidence"),
-		StartPos:   payloadInt(payload, "start_pos"),
-		EndPos:     payloadInt(payload, "end_pos"),
-		ChunkIndex: payloadInt(payload, "chunk_index"),
+		ID:            payloadString(payload, "chunk_id"),
+		DocumentID:    payloadString(payload, "document_id"),
+		Text:          payloadString(payload, "text"),
+		Section:       payloadString(payload, "section"),
+		Subsection:    payloadString(payload, "subsection"),
+		ChunkType:     payloadString(payload, "chunk_type"),
+		Confidence:    payloadFloat(payload, "confidence"),
+		StartPos:      payloadInt(payload, "start_pos"),
+		EndPos:        payloadInt(payload, "end_pos"),
+		ChunkIndex:    payloadInt(payload, "chunk_index"),
+		ChildChunkIDs: payloadStrings(payload, "child_chunk_ids"),
+		Keywords:      payloadStrings(payload, "keywords"),
+		Metadata:      payloadMap(payload, "metadata"),
 	}
 
 	// ParentChunkID is *string in the model
@@ -700,17 +1138,262 @@ func (db *VectorDB) payloadToChunk(payload map[string]*qdrant.Value) *models.Enh
 		chunk.ParentChunkID = &parentID
 	}
 
-	if v := payloadString(payload, "child_chunk_ids"); v != "" && v != "null" {
-		json.Unmarshal([]byte(v), &chunk.ChildChunkIDs)
+	return chunk
+}
+
+// buildFilter translates a filter expression into a Qdrant filter.
+func (db *VectorDB) buildFilter(filter *models.FilterExpr) (*qdrant.Filter, error) {
+	qdrantFilter := &qdrant.Filter{}
+	if filter != nil {
+		condition, err := qdrantCondition(filter)
+		if err != nil {
+			return nil, err
+		}
+		qdrantFilter.Must = []*qdrant.Condition{condition}
 	}
-	if v := payloadString(payload, "keywords"); v != "" && v != "null" {
-		json.Unmarshal([]byte(v), &chunk.Keywords)
+	return qdrantFilter, nil
+}
+
+// qdrantCondition translates one validated filter node.
+func qdrantCondition(expr *models.FilterExpr) (*qdrant.Condition, error) {
+	switch {
+	case expr.And != nil, expr.Or != nil:
+		children := expr.And
+		if expr.Or != nil {
+			children = expr.Or
+		}
+		conditions := make([]*qdrant.Condition, len(children))
+		for i, child := range children {
+			condition, err := qdrantCondition(child)
+			if err != nil {
+				return nil, err
+			}
+			conditions[i] = condition
+		}
+		if expr.And != nil {
+			return qdrant.NewFilterAsCondition(&qdrant.Filter{Must: conditions}), nil
+		}
+		return qdrant.NewFilterAsCondition(&qdrant.Filter{Should: conditions}), nil
+	case expr.Not != nil:
+		condition, err := qdrantCondition(expr.Not)
+		if err != nil {
+			return nil, err
+		}
+		return qdrant.NewFilterAsCondition(&qdrant.Filter{MustNot: []*qdrant.Condition{condition}}), nil
 	}
-	if v := payloadString(payload, "metadata"); v != "" && v != "null" {
-		json.Unmarshal([]byte(v), &chunk.Metadata)
+
+	kind, err := filterFieldKindOf(expr.Field)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidFilter, err)
+	}
+	field := expr.Field
+	if path, ok := strings.CutPrefix(field, documentMetadataPrefix); ok {
+		field = "document_metadata." + path
+	}
+
+	switch expr.Op {
+	case models.FilterEq:
+		return qdrantMatch(field, expr.Value), nil
+	case models.FilterNe:
+		return qdrant.NewFilterAsCondition(&qdrant.Filter{
+			MustNot: []*qdrant.Condition{qdrantMatch(field, expr.Value)},
+		}), nil
+	case models.FilterIn:
+		values, _ := expr.Value.([]interface{})
+		var keywords []string
+		var ints []int64
+		var conditions []*qdrant.Condition
+		for _, v := range values {
+			if s, ok := v.(string); ok {
+				keywords = append(keywords, s)
+			} else if n, ok := filterNumber(v); ok && n == float64(int64(n)) {
+				ints = append(ints, int64(n))
+			} else {
+				conditions = append(conditions, qdrantMatch(field, v))
+			}
+		}
+		if len(keywords) > 0 {
+			conditions = append(conditions, qdrant.NewMatchKeywords(field, keywords...))
+		}
+		if len(ints) > 0 {
+			conditions = append(conditions, qdrant.NewMatchInts(field, ints...))
+		}
+		return qdrant.NewFilterAsCondition(&qdrant.Filter{Should: conditions}), nil
+	case models.FilterGt, models.FilterGte, models.FilterLt, models.FilterLte:
+		bound, isNumber := filterNumber(expr.Value)
+		if !isNumber {
+			date, _ := filterTime(expr.Value)
+			ts := timestamppb.New(date)
+			r := &qdrant.DatetimeRange{}
+			switch expr.Op {
+			case models.FilterGt:
+				r.Gt = ts
+			case models.FilterGte:
+				r.Gte = ts
+			case models.FilterLt:
+				r.Lt = ts
+			default:
+				r.Lte = ts
+			}
+			return qdrant.NewDatetimeRange(field, r), nil
+		}
+		r := &qdrant.Range{}
+		switch expr.Op {
+		case models.FilterGt:
+			r.Gt = &bound
+		case models.FilterGte:
+			r.Gte = &bound
+		case models.FilterLt:
+			r.Lt = &bound
+		default:
+			r.Lte = &bound
+		}
+		return qdrant.NewRange(field, r), nil
+	case models.FilterExists:
+		// Unset string fields are stored as "", which Qdrant does not treat as empty
+		empty := []*qdrant.Condition{qdrant.NewIsEmpty(field)}
+		if kind == stringField {
+			empty = append(empty, qdrant.NewMatch(field, ""))
+		}
+		if want, ok := expr.Value.(bool); ok && !want {
+			return qdrant.NewFilterAsCondition(&qdrant.Filter{Should: empty}), nil
+		}
+		return qdrant.NewFilterAsCondition(&qdrant.Filter{MustNot: empty}), nil
 	}
+	return nil, fmt.Errorf("%w: unknown op %q", ErrInvalidFilter, expr.Op)
+}
 
-	return chunk
+// qdrantMatch builds an equality condition for a filter value.
+func qdrantMatch(field string, value interface{}) *qdrant.Condition {
+	switch v := value.(type) {
+	case string:
+		return qdrant.NewMatch(field, v)
+	case bool:
+		return qdrant.NewMatchBool(field, v)
+	}
+	n, _ := filterNumber(value)
+	if n == float64(int64(n)) {
+		return qdrant.NewMatchInt(field, int64(n))
+	}
+	return qdrant.NewRange(field, &qdrant.Range{Gte: &n, Lte: &n})
+}
+
+// payloadList converts a string slice into a payload list value.
+func payloadList(items []string) []interface{} {
+	list := make([]interface{}, len(items))
+	for i, item := range items {
+		list[i] = item
+	}
+	return list
+}
+
+// payloadObject converts a metadata map into values NewValueMap accepts:
+// nested maps, []interface{} lists, strings, bools, int64 for whole numbers
+// and float64 otherwise. The JSON round trip also flattens typed slices and
+// structs the processors may have stored.
+func payloadObject(m map[string]interface{}) map[string]interface{} {
+	if len(m) == 0 {
+		return map[string]interface{}{}
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		log.Printf("Warning: could not encode metadata for payload: %v", err)
+		return map[string]interface{}{}
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var decoded map[string]interface{}
+	if err := decoder.Decode(&decoded); err != nil {
+		return map[string]interface{}{}
+	}
+	return payloadNumbers(decoded).(map[string]interface{})
+}
+
+func payloadNumbers(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for key, value := range t {
+			t[key] = payloadNumbers(value)
+		}
+	case []interface{}:
+		for i, value := range t {
+			t[i] = payloadNumbers(value)
+		}
+	case json.Number:
+		if n, err := t.Int64(); err == nil {
+			return n
+		}
+		f, _ := t.Float64()
+		return f
+	}
+	return v
+}
+
+// payloadInterface converts a payload value back into plain Go values.
+func payloadInterface(v *qdrant.Value) interface{} {
+	switch kind := v.GetKind().(type) {
+	case *qdrant.Value_StringValue:
+		return kind.StringValue
+	case *qdrant.Value_IntegerValue:
+		return kind.IntegerValue
+	case *qdrant.Value_DoubleValue:
+		return kind.DoubleValue
+	case *qdrant.Value_BoolValue:
+		return kind.BoolValue
+	case *qdrant.Value_StructValue:
+		m := make(map[string]interface{}, len(kind.StructValue.GetFields()))
+		for key, field := range kind.StructValue.GetFields() {
+			m[key] = payloadInterface(field)
+		}
+		return m
+	case *qdrant.Value_ListValue:
+		list := make([]interface{}, len(kind.ListValue.GetValues()))
+		for i, item := range kind.ListValue.GetValues() {
+			list[i] = payloadInterface(item)
+		}
+		return list
+	}
+	return nil
+}
+
+// payloadStrings reads a list of strings, either native or JSON-encoded.
+func payloadStrings(payload map[string]*qdrant.Value, key string) []string {
+	v, ok := payload[key]
+	if !ok {
+		return nil
+	}
+	if list := v.GetListValue(); list != nil {
+		var items []string
+		for _, item := range list.GetValues() {
+			items = append(items, item.GetStringValue())
+		}
+		return items
+	}
+	var items []string
+	if s := v.GetStringValue(); s != "" && s != "null" {
+		json.Unmarshal([]byte(s), &items)
+	}
+	return items
+}
+
+// payloadMap reads an object, either native or JSON-encoded.
+func payloadMap(payload map[string]*qdrant.Value, key string) map[string]interface{} {
+	v, ok := payload[key]
+	if !ok {
+		return nil
+	}
+	if v.GetStructValue() != nil {
+		m, _ := payloadInterface(v).(map[string]interface{})
+		if len(m) == 0 {
+			return nil
+		}
+		return m
+	}
+	var m map[string]interface{}
+	if s := v.GetStringValue(); s != "" && s != "null" {
+		json.Unmarshal([]byte(s), &m)
+	}
+	return m
 }
 
 func payloadString(payload map[string]*qdrant.Value, key string) string {
@@ -735,7 +1418,7 @@ func payloadInt(payload map[string]*qdrant.Value, key string) int {
 }
 
 func (db *VectorDB) createPayloadIndexes(collectionName string) {
-	fieldIndexes := []string{"chunk_type", "section", "doc_type", "document_id"}
+	fieldIndexes := []string{"chunk_type", "section", "doc_type", "document_id", "keywords"}
 	for _, field := range fieldIndexes {
 		_, err := db.client.CreateFieldIndex(db.ctx, &qdrant.CreateFieldIndexCollection{
 			CollectionName: collectionName,
@@ -746,4 +1429,19 @@ func (db *VectorDB) createPayloadIndexes(collectionName string) {
 			log.Printf("Warning: could not create index for field %s in %s: %v", field, collectionName, err)
 		}
 	}
+
+	// Full-text index for lexical (BM25) retrieval
+	lowercase := true
+	_, err := db.client.CreateFieldIndex(db.ctx, &qdrant.CreateFieldIndexCollection{
+		CollectionName: collectionName,
+		FieldName:      "text",
+		FieldType:      qdrant.FieldType_FieldTypeText.Enum(),
+		FieldIndexParams: qdrant.NewPayloadIndexParamsText(&qdrant.TextIndexParams{
+			Tokenizer: qdrant.TokenizerType_Word,
+			Lowercase: &lowercase,
+		}),
+	})
+	if err != nil {
+		log.Printf("Warning: could not create full-text index for field text in %s: %v", collectionName, err)
+	}
 }
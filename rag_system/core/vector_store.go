@@ -0,0 +1,160 @@
+package core
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"rag_system/hnsw"
+	"rag_system/models"
+	"sort"
+)
+
+// VectorStore is the storage backend used by RAGService and the API handlers.
+// VectorDB (Qdrant) and LocalVectorStore (embedded, on-disk) implement it.
+type VectorStore interface {
+	// Collection management
+	CreateCollection(name, description string, schema models.CollectionSchema) error
+	GetCollectionInfo(name string) (*models.CollectionInfo, error)
+	SetCollectionLLM(name string, llm models.LLMSelection) error
+	ListCollections() ([]map[string]interface{}, error)
+	GetCollectionStats(collectionName string) (map[string]interface{}, error)
+	DeleteCollection(name string) error
+	// MarkShadow records that name is the shadow a re-embed job builds to
+	// replace collection.
+	MarkShadow(name, collection string) error
+	// ReplaceCollection swaps replacement's chunks and schema in under name,
+	// dropping name's previous chunks. replacement no longer exists afterwards.
+	// When it fails after dropping them, replacement is kept and marked as
+	// swapping, and calling it again finishes the swap.
+	ReplaceCollection(name, replacement string) error
+
+	// Document and chunk storage
+	AddDocument(collectionName string, doc *models.Document) error
+	AddEmbeddings(chunks []*models.EnhancedChunk) error
+	ListDocuments(collectionName string) ([]map[string]interface{}, error)
+	DeleteDocument(documentID string) error
+	DeleteAllDocumentsInCollection(collectionName string) error
+	// ExportDocuments returns every document of a collection with its chunks
+	// (without embeddings), for re-embedding.
+	ExportDocuments(collectionName string) ([]*models.Document, error)
+
+	// Aliases. Handlers resolve request collection names before calling the
+	// methods above, which take collection names only.
+	ResolveCollection(name string) string
+	ListAliases() map[string]string
+	UpdateAliases(actions []models.AliasAction) error
+
+	// Retrieval
+	QuerySimilarChunks(collectionName string, queryEmbedding []float32, topK int, filter *models.FilterExpr) ([]*models.EnhancedChunk, []float64, error)
+	QueryLexical(collectionName string, query string, topK int, filter *models.FilterExpr) ([]*models.EnhancedChunk, []float64, error)
+	GetChunkWithParents(chunkID string) ([]*models.EnhancedChunk, error)
+
+	Close() error
+}
+
+// IndexTuner is implemented by stores that maintain their own ANN index and
+// let callers tune it per collection.
+type IndexTuner interface {
+	IndexSettings(collectionName string) (map[string]interface{}, error)
+	SetIndexConfig(collectionName string, cfg hnsw.Config) error
+	BenchmarkIndex(collectionName string, k, queries int, configs []hnsw.Config) ([]hnsw.BenchmarkResult, error)
+}
+
+const (
+	QdrantBackend = "qdrant"
+	LocalBackend  = "local"
+)
+
+// NewVectorStore opens the vector store backend selected by name.
+// "qdrant" connects to the remote Qdrant configured through QDRANT_HOST/QDRANT_API_KEY,
+// "local" opens the embedded store rooted at dbPath. An empty backend picks Qdrant
+// when QDRANT_HOST is set and the embedded store otherwise. index holds the
+// default HNSW parameters of the embedded store.
+func NewVectorStore(backend, dbPath string, index hnsw.Config) (VectorStore, error) {
+	if backend == "" {
+		backend = LocalBackend
+		if os.Getenv("QDRANT_HOST") != "" {
+			backend = QdrantBackend
+		}
+	}
+
+	log.Printf("Using %s vector store backend", backend)
+
+	switch backend {
+	case QdrantBackend:
+		return NewVectorDB(dbPath)
+	case LocalBackend:
+		return NewLocalVectorStore(dbPath, index)
+	default:
+		return nil, fmt.Errorf("unknown vector store backend %q (expected %q or %q)", backend, QdrantBackend, LocalBackend)
+	}
+}
+
+// validateSchema fills in the default distance and rejects schemas neither
+// backend can serve.
+func validateSchema(schema *models.CollectionSchema) error {
+	if schema.Distance == "" {
+		schema.Distance = models.CosineDistance
+	}
+	if schema.Distance != models.CosineDistance {
+		return fmt.Errorf("%w: distance %q is not supported (only %q)", ErrSchemaMismatch, schema.Distance, models.CosineDistance)
+	}
+	if schema.Dimension < 0 {
+		return fmt.Errorf("%w: dimension must be positive", ErrSchemaMismatch)
+	}
+	return nil
+}
+
+// embeddingDimension returns the vector size shared by the chunks that carry
+// an embedding, or 0 when none does.
+func embeddingDimension(chunks []*models.EnhancedChunk) (int, error) {
+	dim := 0
+	for _, chunk := range chunks {
+		if len(chunk.Embedding) == 0 {
+			continue
+		}
+		if dim == 0 {
+			dim = len(chunk.Embedding)
+		} else if len(chunk.Embedding) != dim {
+			return 0, fmt.Errorf("%w: chunks carry embeddings of %d and %d dimensions", ErrSchemaMismatch, dim, len(chunk.Embedding))
+		}
+	}
+	return dim, nil
+}
+
+// assembleDocuments groups exported chunks into their documents, in chunk
+// order, taking document fields from the registry records.
+func assembleDocuments(infos []*models.DocumentInfo, chunks []*models.EnhancedChunk) []*models.Document {
+	docs := map[string]*models.Document{}
+	var order []*models.Document
+	for _, info := range infos {
+		doc := &models.Document{
+			ID:          info.ID,
+			Source:      info.Source,
+			DocType:     info.DocType,
+			Metadata:    info.Metadata,
+			CreatedAt:   info.CreatedAt,
+			ContentHash: info.ContentHash,
+		}
+		docs[info.ID] = doc
+		order = append(order, doc)
+	}
+	for _, chunk := range chunks {
+		doc, ok := docs[chunk.DocumentID]
+		if !ok {
+			doc = &models.Document{ID: chunk.DocumentID}
+			docs[chunk.DocumentID] = doc
+			order = append(order, doc)
+		}
+		doc.Chunks = append(doc.Chunks, chunk)
+	}
+	var result []*models.Document
+	for _, doc := range order {
+		if len(doc.Chunks) == 0 {
+			continue
+		}
+		sort.SliceStable(doc.Chunks, func(i, j int) bool { return doc.Chunks[i].ChunkIndex < doc.Chunks[j].ChunkIndex })
+		result = append(result, doc)
+	}
+	return result
+}
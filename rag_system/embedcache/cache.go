@@ -0,0 +1,461 @@
+// Package embedcache is a persistent, content-addressed cache of embeddings.
+// Vectors are keyed by the model that produced them and the SHA-256 of the
+// normalized text, so re-ingesting a document only pays for chunks whose text
+// changed.
+//
+// Entries live in memory with least-recently-used eviction and are appended
+// to a log file as they are added. The log is replayed on open and compacted
+// once it holds mostly evicted or purged records.
+package embedcache
+
+import (
+	"bufio"
+	"container/list"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Config sets where the cache is kept and how large it may grow.
+type Config struct {
+	Disabled   bool   `json:"disabled"`
+	Path       string `json:"path"`        // Log file; empty means embedding_cache.bin in vector_db_path
+	MaxEntries int    `json:"max_entries"` // 0 means no limit
+	MaxMB      int    `json:"max_mb"`      // Memory held by vectors; 0 means no limit
+}
+
+// DefaultConfig keeps up to 100k vectors in at most 256 MB.
+func DefaultConfig() Config {
+	return Config{
+		MaxEntries: 100000,
+		MaxMB:      256,
+	}
+}
+
+// FileName is the log file name used when Config.Path is empty.
+const FileName = "embedding_cache.bin"
+
+// Stats describes the contents and effectiveness of the cache. Hits,
+// misses and evictions are counted since the cache was opened.
+type Stats struct {
+	Path       string       `json:"path"`
+	Entries    int          `json:"entries"`
+	Bytes      int64        `json:"bytes"`
+	MaxEntries int          `json:"max_entries"`
+	MaxBytes   int64        `json:"max_bytes"`
+	Hits       int64        `json:"hits"`
+	Misses     int64        `json:"misses"`
+	HitRate    float64      `json:"hit_rate"`
+	Evictions  int64        `json:"evictions"`
+	LogRecords int          `json:"log_records"` // Records in the log file, including evicted ones until compaction
+	Models     []ModelStats `json:"models"`
+}
+
+// ModelStats counts the entries of one model.
+type ModelStats struct {
+	Model   string `json:"model"`
+	Entries int    `json:"entries"`
+	Bytes   int64  `json:"bytes"`
+}
+
+type key struct {
+	model string
+	hash  [sha256.Size]byte
+}
+
+type entry struct {
+	key    key
+	vector []float32
+}
+
+// Cache is safe for concurrent use.
+type Cache struct {
+	mu         sync.Mutex
+	path       string
+	maxEntries int
+	maxBytes   int64
+
+	entries map[key]*list.Element
+	lru     *list.List // Front is most recently used
+	bytes   int64
+
+	file       *os.File
+	writer     *bufio.Writer
+	logRecords int // Records in the log, live or not
+
+	hits, misses, evictions int64
+}
+
+const magic = "RAGEMB1\n"
+
+// minCompactRecords keeps small logs from being rewritten over and over.
+const minCompactRecords = 1024
+
+// Open loads the cache from path, creating the file if it does not exist.
+// A record cut short by a crash ends the replay; everything before it is kept.
+func Open(path string, cfg Config) (*Cache, error) {
+	if cfg.MaxEntries < 0 || cfg.MaxMB < 0 {
+		return nil, fmt.Errorf("embedding cache limits must not be negative")
+	}
+	c := &Cache{
+		path:       path,
+		maxEntries: cfg.MaxEntries,
+		maxBytes:   int64(cfg.MaxMB) << 20,
+		entries:    make(map[key]*list.Element),
+		lru:        list.New(),
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create embedding cache directory: %w", err)
+	}
+	valid, err := c.replay()
+	if err != nil {
+		return nil, err
+	}
+	c.evictions = 0 // Records replayed past the limits are not news
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open embedding cache: %w", err)
+	}
+	if valid == 0 {
+		if err := file.Truncate(0); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to reset embedding cache: %w", err)
+		}
+		if _, err := file.WriteString(magic); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to write embedding cache header: %w", err)
+		}
+		valid = int64(len(magic))
+	}
+	// Drop a torn tail so new records follow the last complete one
+	if err := file.Truncate(valid); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to truncate embedding cache: %w", err)
+	}
+	if _, err := file.Seek(valid, io.SeekStart); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to seek embedding cache: %w", err)
+	}
+	c.file = file
+	c.writer = bufio.NewWriter(file)
+
+	if c.needsCompaction() {
+		if err := c.compactLocked(); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// replay loads the records of the log and returns the length of its valid
+// prefix, 0 when the file is missing or not a cache log.
+func (c *Cache) replay() (int64, error) {
+	file, err := os.Open(c.path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to open embedding cache: %w", err)
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+	header := make([]byte, len(magic))
+	if _, err := io.ReadFull(r, header); err != nil || string(header) != magic {
+		return 0, nil
+	}
+
+	valid := int64(len(magic))
+	for {
+		k, vector, n, err := readRecord(r)
+		if err != nil {
+			// io.EOF is a clean end; anything else is a torn record
+			return valid, nil
+		}
+		valid += n
+		c.logRecords++
+		c.setLocked(k, vector)
+	}
+}
+
+// Normalize is the form of a text that is hashed: surrounding whitespace is
+// dropped and inner runs of whitespace collapse to a single space.
+func Normalize(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+func makeKey(model, text string) key {
+	return key{model: model, hash: sha256.Sum256([]byte(Normalize(text)))}
+}
+
+// Get returns a copy of the cached vector of text under model.
+func (c *Cache) Get(model, text string) ([]float32, bool) {
+	k := makeKey(model, text)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[k]
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+	c.hits++
+	c.lru.MoveToFront(el)
+	return append([]float32(nil), el.Value.(*entry).vector...), true
+}
+
+// Put caches the vectors of texts under model and appends them to the log.
+func (c *Cache) Put(model string, texts []string, vectors [][]float32) error {
+	if len(texts) != len(vectors) {
+		return fmt.Errorf("got %d vectors for %d texts", len(vectors), len(texts))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, text := range texts {
+		k := makeKey(model, text)
+		if _, ok := c.entries[k]; ok {
+			continue
+		}
+		vector := append([]float32(nil), vectors[i]...)
+		c.setLocked(k, vector)
+		if err := writeRecord(c.writer, k, vector); err != nil {
+			return fmt.Errorf("failed to append to embedding cache: %w", err)
+		}
+		c.logRecords++
+	}
+	if err := c.writer.Flush(); err != nil {
+		return fmt.Errorf("failed to write embedding cache: %w", err)
+	}
+
+	if c.needsCompaction() {
+		return c.compactLocked()
+	}
+	return nil
+}
+
+// Purge removes the entries of model, or every entry when model is empty,
+// and rewrites the log. It returns how many entries were removed.
+func (c *Cache) Purge(model string) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	removed := 0
+	for k, el := range c.entries {
+		if model == "" || k.model == model {
+			c.removeLocked(el)
+			removed++
+		}
+	}
+	if removed == 0 {
+		return 0, nil
+	}
+	return removed, c.compactLocked()
+}
+
+// Stats reports the size, limits and hit rate of the cache.
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := Stats{
+		Path:       c.path,
+		Entries:    len(c.entries),
+		Bytes:      c.bytes,
+		MaxEntries: c.maxEntries,
+		MaxBytes:   c.maxBytes,
+		Hits:       c.hits,
+		Misses:     c.misses,
+		Evictions:  c.evictions,
+		LogRecords: c.logRecords,
+		Models:     []ModelStats{},
+	}
+	if lookups := c.hits + c.misses; lookups > 0 {
+		stats.HitRate = math.Round(float64(c.hits)/float64(lookups)*1000) / 1000
+	}
+	byModel := map[string]*ModelStats{}
+	for k, el := range c.entries {
+		m, ok := byModel[k.model]
+		if !ok {
+			m = &ModelStats{Model: k.model}
+			byModel[k.model] = m
+		}
+		m.Entries++
+		m.Bytes += entrySize(el.Value.(*entry))
+	}
+	for _, m := range byModel {
+		stats.Models = append(stats.Models, *m)
+	}
+	sort.Slice(stats.Models, func(i, j int) bool { return stats.Models[i].Model < stats.Models[j].Model })
+	return stats
+}
+
+// Close flushes and closes the log.
+func (c *Cache) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.file == nil {
+		return nil
+	}
+	err := c.writer.Flush()
+	if closeErr := c.file.Close(); err == nil {
+		err = closeErr
+	}
+	c.file = nil
+	return err
+}
+
+func entrySize(e *entry) int64 {
+	return int64(len(e.vector)*4 + len(e.key.model) + sha256.Size)
+}
+
+// setLocked inserts or refreshes an entry and evicts the least recently used
+// ones beyond the limits.
+func (c *Cache) setLocked(k key, vector []float32) {
+	if el, ok := c.entries[k]; ok {
+		c.removeLocked(el)
+	}
+	e := &entry{key: k, vector: vector}
+	c.entries[k] = c.lru.PushFront(e)
+	c.bytes += entrySize(e)
+
+	for c.lru.Len() > 1 && c.overLimit() {
+		c.removeLocked(c.lru.Back())
+		c.evictions++
+	}
+}
+
+func (c *Cache) overLimit() bool {
+	return (c.maxEntries > 0 && c.lru.Len() > c.maxEntries) ||
+		(c.maxBytes > 0 && c.bytes > c.maxBytes)
+}
+
+func (c *Cache) removeLocked(el *list.Element) {
+	e := c.lru.Remove(el).(*entry)
+	delete(c.entries, e.key)
+	c.bytes -= entrySize(e)
+}
+
+func (c *Cache) needsCompaction() bool {
+	return c.logRecords >= minCompactRecords && c.logRecords > 2*len(c.entries)
+}
+
+// compactLocked rewrites the log with the live entries, least recently used
+// first so that a replay restores the eviction order.
+func (c *Cache) compactLocked() error {
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), filepath.Base(c.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to compact embedding cache: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	if _, err := w.WriteString(magic); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to compact embedding cache: %w", err)
+	}
+	for el := c.lru.Back(); el != nil; el = el.Prev() {
+		e := el.Value.(*entry)
+		if err := writeRecord(w, e.key, e.vector); err != nil {
+			tmp.Close()
+			return fmt.Errorf("failed to compact embedding cache: %w", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to compact embedding cache: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to compact embedding cache: %w", err)
+	}
+
+	if c.file != nil {
+		c.file.Close()
+	}
+	if err := os.Rename(tmp.Name(), c.path); err != nil {
+		c.file = nil
+		return fmt.Errorf("failed to replace embedding cache: %w", err)
+	}
+	file, err := os.OpenFile(c.path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		c.file = nil
+		return fmt.Errorf("failed to reopen embedding cache: %w", err)
+	}
+	c.file = file
+	c.writer = bufio.NewWriter(file)
+	c.logRecords = len(c.entries)
+	return nil
+}
+
+// A record is the model name length (uint16) and bytes, the text hash, the
+// vector length (uint32) and the vector as little-endian float32s.
+func writeRecord(w io.Writer, k key, vector []float32) error {
+	if len(k.model) > math.MaxUint16 {
+		return fmt.Errorf("model name too long")
+	}
+	buf := make([]byte, 0, 2+len(k.model)+sha256.Size+4+4*len(vector))
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(k.model)))
+	buf = append(buf, k.model...)
+	buf = append(buf, k.hash[:]...)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(vector)))
+	for _, v := range vector {
+		buf = binary.LittleEndian.AppendUint32(buf, math.Float32bits(v))
+	}
+	_, err := w.Write(buf)
+	return err
+}
+
+var errTornRecord = errors.New("torn embedding cache record")
+
+// maxRecordDimension guards against allocating for a corrupt length.
+const maxRecordDimension = 1 << 16
+
+func readRecord(r io.Reader) (key, []float32, int64, error) {
+	var k key
+	var size [4]byte
+	if _, err := io.ReadFull(r, size[:2]); err != nil {
+		if err == io.EOF {
+			return k, nil, 0, io.EOF
+		}
+		return k, nil, 0, errTornRecord
+	}
+	model := make([]byte, binary.LittleEndian.Uint16(size[:2]))
+	if _, err := io.ReadFull(r, model); err != nil {
+		return k, nil, 0, errTornRecord
+	}
+	k.model = string(model)
+	if _, err := io.ReadFull(r, k.hash[:]); err != nil {
+		return k, nil, 0, errTornRecord
+	}
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return k, nil, 0, errTornRecord
+	}
+	dim := binary.LittleEndian.Uint32(size[:])
+	if dim > maxRecordDimension {
+		return k, nil, 0, errTornRecord
+	}
+	raw := make([]byte, 4*dim)
+	if _, err := io.ReadFull(r, raw); err != nil {
+		return k, nil, 0, errTornRecord
+	}
+	vector := make([]float32, dim)
+	for i := range vector {
+		vector[i] = math.Float32frombits(binary.LittleEndian.Uint32(raw[4*i:]))
+	}
+	n := int64(2 + len(model) + sha256.Size + 4 + len(raw))
+	return k, vector, n, nil
+}
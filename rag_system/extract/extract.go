@@ -0,0 +1,125 @@
+// Package extract turns files into text for chunking. A file's format is
+// detected from its content and file name, and the text is extracted by the
+// extractor registered for that MIME type.
+package extract
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Kinds of extraction failures; test with errors.Is.
+var (
+	ErrUnsupportedFormat = errors.New("unsupported file format")
+	ErrNoText            = errors.New("no extractable text")
+	ErrMalformed         = errors.New("malformed file") // Corrupt or truncated content of a known format
+)
+
+// Result is the text of a file with what was learned about it.
+type Result struct {
+	Text     string
+	MIMEType string
+	Metadata map[string]interface{} // Document metadata found in the file, e.g. its title
+}
+
+// PageCount returns the number of pages of a paged document, such as a PDF,
+// whose text separates them with PageBreak; 0 for formats without pages.
+func (r *Result) PageCount() int {
+	pages, _ := r.Metadata["page_count"].(int)
+	return pages
+}
+
+// Extractor returns the text of a file of the format it is registered for.
+type Extractor interface {
+	Extract(data []byte) (*Result, error)
+}
+
+// ExtractorFunc adapts a function to the Extractor interface.
+type ExtractorFunc func(data []byte) (*Result, error)
+
+func (f ExtractorFunc) Extract(data []byte) (*Result, error) {
+	return f(data)
+}
+
+var (
+	mu         sync.RWMutex
+	extractors = map[string]Extractor{}
+	extensions = map[string]string{} // Lowercase extension, dot included, to MIME type
+)
+
+// Register makes e the extractor of mimeType, which files with one of the
+// extensions (".md") are taken to be unless their content says otherwise.
+func Register(mimeType string, exts []string, e Extractor) {
+	mu.Lock()
+	defer mu.Unlock()
+	extractors[mimeType] = e
+	for _, ext := range exts {
+		extensions[strings.ToLower(ext)] = mimeType
+	}
+}
+
+// Formats returns the MIME types that have an extractor, sorted.
+func Formats() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	types := make([]string, 0, len(extractors))
+	for mimeType := range extractors {
+		types = append(types, mimeType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// DetectType returns the MIME type of a file, without parameters. The
+// content is sniffed first; a text or unrecognised content goes by the
+// file name's extension when it is known, since sniffing cannot tell
+// Markdown or CSV from plain text.
+func DetectType(name string, data []byte) string {
+	sniffed := http.DetectContentType(data)
+	if mediaType, _, err := mime.ParseMediaType(sniffed); err == nil {
+		sniffed = mediaType
+	}
+	if sniffed != "application/octet-stream" && !strings.HasPrefix(sniffed, "text/") {
+		return sniffed
+	}
+
+	mu.RLock()
+	byExtension, ok := extensions[strings.ToLower(filepath.Ext(name))]
+	mu.RUnlock()
+	if ok {
+		return byExtension
+	}
+	return sniffed
+}
+
+// Extract detects the format of a file and returns its text. Text formats
+// without an extractor of their own are read as plain text.
+func Extract(name string, data []byte) (*Result, error) {
+	mimeType := DetectType(name, data)
+
+	mu.RLock()
+	e, ok := extractors[mimeType]
+	if !ok && strings.HasPrefix(mimeType, "text/") {
+		e, ok = extractors[PlainText]
+	}
+	mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s (%s)", ErrUnsupportedFormat, mimeType, name)
+	}
+
+	result, err := e.Extract(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	result.MIMEType = mimeType
+	if strings.TrimSpace(result.Text) == "" {
+		return nil, fmt.Errorf("%w: %s", ErrNoText, name)
+	}
+	return result, nil
+}
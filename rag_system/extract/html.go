@@ -0,0 +1,357 @@
+package extract
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// MIME types of HTML.
+const (
+	HTML  = "text/html"
+	XHTML = "application/xhtml+xml"
+)
+
+func init() {
+	e := ExtractorFunc(extractHTML)
+	Register(HTML, []string{".html", ".htm"}, e)
+	Register(XHTML, []string{".xhtml"}, e)
+}
+
+// boilerplate are elements left out of the text: scripts, styles, forms and
+// the navigation around a page's content.
+var boilerplate = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Template: true,
+	atom.Nav: true, atom.Aside: true, atom.Form: true, atom.Button: true,
+	atom.Select: true, atom.Iframe: true, atom.Svg: true, atom.Canvas: true,
+	atom.Object: true, atom.Embed: true,
+}
+
+// boilerplateRoles are ARIA landmark roles of page chrome.
+var boilerplateRoles = map[string]bool{
+	"navigation": true, "banner": true, "contentinfo": true, "search": true, "complementary": true,
+}
+
+// extractHTML returns the content of a page as a Markdown outline: headings
+// as # headings, lists as nested - or 1. items, tables as pipe tables with
+// their caption, and code blocks fenced, so the chunkers find its sections
+// and tables. Boilerplate is dropped, and only <main> is kept when the page
+// has one. The <title>, or else the first <h1>, is the document's title.
+func extractHTML(data []byte) (*Result, error) {
+	doc, err := html.Parse(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to parse HTML: %w", ErrMalformed, err)
+	}
+
+	root := findElement(doc, atom.Main)
+	if root == nil {
+		root = findElement(doc, atom.Body)
+	}
+	if root == nil {
+		root = doc
+	}
+
+	o := &outline{}
+	o.children(root)
+
+	result := &Result{Text: strings.TrimSpace(o.b.String()) + "\n"}
+	title := ""
+	if t := findElement(doc, atom.Title); t != nil {
+		title = inlineText(t)
+	}
+	if title == "" {
+		title = o.firstH1
+	}
+	if title != "" {
+		result.Metadata = map[string]interface{}{"title": title}
+	}
+	return result, nil
+}
+
+// outline writes the Markdown outline of an HTML tree.
+type outline struct {
+	b       strings.Builder
+	space   bool        // Whitespace is pending before the next word
+	lists   []listState // Open lists, innermost last
+	firstH1 string
+}
+
+type listState struct {
+	ordered bool
+	items   int
+}
+
+// ended reports whether the text written so far ends with suffix.
+func (o *outline) ended(suffix string) bool {
+	return strings.HasSuffix(o.b.String(), suffix)
+}
+
+// newline ends the current line.
+func (o *outline) newline() {
+	o.space = false
+	if o.b.Len() > 0 && !o.ended("\n") {
+		o.b.WriteString("\n")
+	}
+}
+
+// paragraph leaves a blank line before what comes next.
+func (o *outline) paragraph() {
+	o.newline()
+	if o.b.Len() > 0 && !o.ended("\n\n") {
+		o.b.WriteString("\n")
+	}
+}
+
+// text writes inline text with its whitespace collapsed. Whitespace at its
+// ends becomes a single space before the next word on the same line.
+func (o *outline) text(s string) {
+	if startsWithSpace(s) {
+		o.space = true
+	}
+	words := strings.Fields(s)
+	if len(words) == 0 {
+		return
+	}
+	if o.space && o.b.Len() > 0 && !o.ended("\n") && !o.ended(" ") {
+		o.b.WriteString(" ")
+	}
+	o.b.WriteString(strings.Join(words, " "))
+	o.space = endsWithSpace(s)
+}
+
+func (o *outline) children(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		o.node(c)
+	}
+}
+
+func (o *outline) node(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		o.text(n.Data)
+		return
+	case html.ElementNode:
+	default:
+		o.children(n)
+		return
+	}
+	if isBoilerplate(n) {
+		return
+	}
+
+	switch n.DataAtom {
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		title := inlineText(n)
+		if title == "" {
+			return
+		}
+		level := int(n.Data[1] - '0')
+		if level == 1 && o.firstH1 == "" {
+			o.firstH1 = title
+		}
+		o.paragraph()
+		o.b.WriteString(strings.Repeat("#", level) + " " + title)
+		o.paragraph()
+
+	case atom.Ul, atom.Ol:
+		if len(o.lists) == 0 {
+			o.paragraph()
+		} else {
+			o.newline()
+		}
+		o.lists = append(o.lists, listState{ordered: n.DataAtom == atom.Ol})
+		o.children(n)
+		o.lists = o.lists[:len(o.lists)-1]
+		if len(o.lists) == 0 {
+			o.paragraph()
+		} else {
+			o.newline()
+		}
+
+	case atom.Li:
+		o.newline()
+		marker := "- "
+		if len(o.lists) > 0 {
+			list := &o.lists[len(o.lists)-1]
+			list.items++
+			if list.ordered {
+				marker = fmt.Sprintf("%d. ", list.items)
+			}
+		}
+		o.b.WriteString(strings.Repeat("  ", max(len(o.lists)-1, 0)) + marker)
+		o.children(n)
+		o.newline()
+
+	case atom.Table:
+		o.table(n)
+
+	case atom.Pre:
+		o.paragraph()
+		o.b.WriteString("```\n" + strings.Trim(textContent(n), "\n") + "\n```")
+		o.paragraph()
+
+	case atom.Br:
+		o.newline()
+
+	case atom.Hr:
+		o.paragraph()
+
+	case atom.Img:
+		if alt := attr(n, "alt"); alt != "" {
+			o.text(" " + alt + " ")
+		}
+
+	case atom.P, atom.Div, atom.Section, atom.Article, atom.Header, atom.Footer,
+		atom.Blockquote, atom.Figure, atom.Figcaption, atom.Dl, atom.Dt, atom.Dd,
+		atom.Address, atom.Details, atom.Summary, atom.Main:
+		if len(o.lists) > 0 {
+			o.newline()
+		} else {
+			o.paragraph()
+		}
+		o.children(n)
+		if len(o.lists) == 0 {
+			o.paragraph()
+		}
+
+	default:
+		o.children(n)
+	}
+}
+
+// table writes a pipe table: the first row is the header, rows are padded
+// to the widest, and the caption goes on a "Table: ..." line above it.
+func (o *outline) table(n *html.Node) {
+	var rows [][]string
+	var caption string
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode {
+				continue
+			}
+			switch c.DataAtom {
+			case atom.Caption:
+				caption = inlineText(c)
+			case atom.Tr:
+				var row []string
+				for cell := c.FirstChild; cell != nil; cell = cell.NextSibling {
+					if cell.DataAtom == atom.Td || cell.DataAtom == atom.Th {
+						row = append(row, strings.ReplaceAll(inlineText(cell), "|", `\|`))
+					}
+				}
+				if len(row) > 0 {
+					rows = append(rows, row)
+				}
+			case atom.Thead, atom.Tbody, atom.Tfoot:
+				walk(c)
+			}
+		}
+	}
+	walk(n)
+	if len(rows) == 0 {
+		return
+	}
+
+	width := 0
+	for _, row := range rows {
+		width = max(width, len(row))
+	}
+	o.paragraph()
+	if caption != "" {
+		o.b.WriteString("Table: " + caption + "\n\n")
+	}
+	writeRow := func(cells []string) {
+		for len(cells) < width {
+			cells = append(cells, "")
+		}
+		o.b.WriteString("| " + strings.Join(cells, " | ") + " |\n")
+	}
+	writeRow(rows[0])
+	separator := make([]string, width)
+	for i := range separator {
+		separator[i] = "---"
+	}
+	writeRow(separator)
+	for _, row := range rows[1:] {
+		writeRow(row)
+	}
+	o.paragraph()
+}
+
+func isBoilerplate(n *html.Node) bool {
+	if boilerplate[n.DataAtom] || boilerplateRoles[attr(n, "role")] || attr(n, "aria-hidden") == "true" {
+		return true
+	}
+	for _, a := range n.Attr {
+		if a.Key == "hidden" {
+			return true
+		}
+	}
+	// A page's own header and footer are chrome; those of an article are not
+	if n.DataAtom == atom.Header || n.DataAtom == atom.Footer {
+		for p := n.Parent; p != nil; p = p.Parent {
+			if p.DataAtom == atom.Article || p.DataAtom == atom.Main || p.DataAtom == atom.Section {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func findElement(n *html.Node, a atom.Atom) *html.Node {
+	if n.Type == html.ElementNode && n.DataAtom == a {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findElement(c, a); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// textContent returns the text of n and its descendants as it is.
+func textContent(n *html.Node) string {
+	var b strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+		}
+		if n.Type == html.ElementNode && isBoilerplate(n) {
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return b.String()
+}
+
+// inlineText returns the text of n on one line.
+func inlineText(n *html.Node) string {
+	return strings.Join(strings.Fields(textContent(n)), " ")
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func startsWithSpace(s string) bool {
+	return s != "" && strings.TrimLeft(s, " \t\r\n\f") != s
+}
+
+func endsWithSpace(s string) bool {
+	return s != "" && strings.TrimRight(s, " \t\r\n\f") != s
+}
@@ -0,0 +1,733 @@
+package extract
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// PDF objects, as read by pdfLexer. Numbers are float64, booleans bool and
+// null nil.
+type (
+	pdfName    string
+	pdfKeyword string // An operator of a content stream, or a keyword such as obj
+	pdfString  []byte
+	pdfArray   []interface{}
+	pdfDict    map[pdfName]interface{}
+	pdfRef     struct{ num, gen int }
+	pdfStream  struct {
+		dict pdfDict
+		data []byte // Still encoded
+	}
+)
+
+var errPDFSyntax = errors.New("malformed PDF")
+
+// maxPDFDepth bounds the nesting of arrays, dictionaries, page trees and
+// form XObjects, so a malicious file cannot exhaust the stack.
+const maxPDFDepth = 64
+
+// pdfLexer reads PDF objects from data.
+type pdfLexer struct {
+	data  []byte
+	pos   int
+	depth int
+	doc   *pdfDoc // Resolves indirect stream lengths; nil in content streams
+}
+
+func isPDFSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f' || c == 0
+}
+
+func isPDFDelimiter(c byte) bool {
+	return bytes.IndexByte([]byte("()<>[]{}/%"), c) >= 0
+}
+
+func (l *pdfLexer) skipSpace() {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		switch {
+		case isPDFSpace(c):
+			l.pos++
+		case c == '%':
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// regular reads a run of characters that are neither space nor delimiter.
+func (l *pdfLexer) regular() []byte {
+	start := l.pos
+	for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelimiter(l.data[l.pos]) {
+		l.pos++
+	}
+	return l.data[start:l.pos]
+}
+
+// object reads the next object. At the end of data it returns io.EOF-like
+// errPDFSyntax; keywords such as obj, R or content stream operators come
+// back as pdfKeyword.
+func (l *pdfLexer) object() (interface{}, error) {
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil, fmt.Errorf("%w: unexpected end of data", errPDFSyntax)
+	}
+	l.depth++
+	defer func() { l.depth-- }()
+	if l.depth > maxPDFDepth {
+		return nil, fmt.Errorf("%w: objects nested too deeply", errPDFSyntax)
+	}
+
+	c := l.data[l.pos]
+	switch {
+	case c == '/':
+		l.pos++
+		return pdfName(decodeNameEscapes(l.regular())), nil
+	case c == '(':
+		return l.literalString(), nil
+	case c == '<' && l.pos+1 < len(l.data) && l.data[l.pos+1] == '<':
+		l.pos += 2
+		return l.dict()
+	case c == '<':
+		return l.hexString(), nil
+	case c == '[':
+		l.pos++
+		return l.array()
+	case c == ']' || c == '>' || c == ')' || c == '{' || c == '}':
+		l.pos++
+		if c == '>' && l.pos < len(l.data) && l.data[l.pos] == '>' {
+			l.pos++
+			return pdfKeyword(">>"), nil
+		}
+		return pdfKeyword(string(c)), nil
+	}
+
+	token := l.regular()
+	if len(token) == 0 {
+		l.pos++ // A stray delimiter
+		return pdfKeyword(string(c)), nil
+	}
+	if n, err := strconv.ParseFloat(string(token), 64); err == nil && (token[0] == '-' || token[0] == '+' || token[0] == '.' || (token[0] >= '0' && token[0] <= '9')) {
+		// Two integers followed by R make a reference
+		if isPDFInteger(token) {
+			save := l.pos
+			if gen, ok := l.integer(); ok {
+				l.skipSpace()
+				if l.pos < len(l.data) && l.data[l.pos] == 'R' && (l.pos+1 == len(l.data) || isPDFSpace(l.data[l.pos+1]) || isPDFDelimiter(l.data[l.pos+1])) {
+					l.pos++
+					return pdfRef{int(n), gen}, nil
+				}
+			}
+			l.pos = save
+		}
+		return n, nil
+	}
+	switch string(token) {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+	return pdfKeyword(token), nil
+}
+
+func isPDFInteger(token []byte) bool {
+	for _, c := range token {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return len(token) > 0
+}
+
+// integer reads an unsigned integer token.
+func (l *pdfLexer) integer() (int, bool) {
+	l.skipSpace()
+	start := l.pos
+	for l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '9' {
+		l.pos++
+	}
+	if start == l.pos || (l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelimiter(l.data[l.pos])) {
+		l.pos = start
+		return 0, false
+	}
+	n, err := strconv.Atoi(string(l.data[start:l.pos]))
+	return n, err == nil
+}
+
+func decodeNameEscapes(name []byte) string {
+	if bytes.IndexByte(name, '#') < 0 {
+		return string(name)
+	}
+	var b []byte
+	for i := 0; i < len(name); i++ {
+		if name[i] == '#' && i+2 < len(name) {
+			if v, err := strconv.ParseUint(string(name[i+1:i+3]), 16, 8); err == nil {
+				b = append(b, byte(v))
+				i += 2
+				continue
+			}
+		}
+		b = append(b, name[i])
+	}
+	return string(b)
+}
+
+func (l *pdfLexer) literalString() pdfString {
+	l.pos++ // (
+	var s []byte
+	nesting := 1
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			nesting++
+		case ')':
+			nesting--
+			if nesting == 0 {
+				return s
+			}
+		case '\\':
+			if l.pos >= len(l.data) {
+				return s
+			}
+			c = l.data[l.pos]
+			l.pos++
+			switch c {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if c >= '0' && c <= '7' {
+					v := int(c - '0')
+					for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+						v = v*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					c = byte(v)
+				}
+			}
+		}
+		s = append(s, c)
+	}
+	return s
+}
+
+func (l *pdfLexer) hexString() pdfString {
+	l.pos++ // <
+	var s []byte
+	var digits []byte
+	for l.pos < len(l.data) && l.data[l.pos] != '>' {
+		if v, ok := hexValue(l.data[l.pos]); ok {
+			digits = append(digits, v)
+		}
+		l.pos++
+	}
+	l.pos++ // >
+	if len(digits)%2 == 1 {
+		digits = append(digits, 0)
+	}
+	for i := 0; i < len(digits); i += 2 {
+		s = append(s, digits[i]<<4|digits[i+1])
+	}
+	return s
+}
+
+func hexValue(c byte) (byte, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0', true
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10, true
+	case c >= 'A' && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
+
+func (l *pdfLexer) array() (pdfArray, error) {
+	var a pdfArray
+	for {
+		obj, err := l.object()
+		if err != nil {
+			return a, err
+		}
+		if obj == pdfKeyword("]") {
+			return a, nil
+		}
+		a = append(a, obj)
+	}
+}
+
+// dict reads a dictionary, and the stream that follows it if any.
+func (l *pdfLexer) dict() (interface{}, error) {
+	d := pdfDict{}
+	for {
+		key, err := l.object()
+		if err != nil {
+			return d, err
+		}
+		if key == pdfKeyword(">>") {
+			break
+		}
+		name, ok := key.(pdfName)
+		if !ok {
+			continue // Tolerate junk between entries
+		}
+		value, err := l.object()
+		if err != nil {
+			return d, err
+		}
+		if value == pdfKeyword(">>") {
+			break
+		}
+		d[name] = value
+	}
+
+	save := l.pos
+	l.skipSpace()
+	if !bytes.HasPrefix(l.data[l.pos:], []byte("stream")) {
+		l.pos = save
+		return d, nil
+	}
+	l.pos += len("stream")
+	if l.pos < len(l.data) && l.data[l.pos] == '\r' {
+		l.pos++
+	}
+	if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+		l.pos++
+	}
+	return &pdfStream{dict: d, data: l.streamData(d)}, nil
+}
+
+// streamData returns the data of a stream starting at the lexer's position,
+// by its /Length when that ends at endstream, otherwise up to endstream.
+func (l *pdfLexer) streamData(d pdfDict) []byte {
+	start := l.pos
+	length := -1
+	if l.doc != nil {
+		if n, ok := l.doc.resolve(d["Length"]).(float64); ok {
+			length = int(n)
+		}
+	} else if n, ok := d["Length"].(float64); ok {
+		length = int(n)
+	}
+	if length >= 0 && start+length <= len(l.data) {
+		end := start + length
+		rest := bytes.TrimLeft(l.data[end:min(end+32, len(l.data))], " \r\n\t\f\x00")
+		if bytes.HasPrefix(rest, []byte("endstream")) {
+			l.pos = end + bytes.Index(l.data[end:], []byte("endstream")) + len("endstream")
+			return l.data[start:end]
+		}
+	}
+	end := bytes.Index(l.data[start:], []byte("endstream"))
+	if end < 0 {
+		l.pos = len(l.data)
+		return l.data[start:]
+	}
+	l.pos = start + end + len("endstream")
+	data := l.data[start : start+end]
+	// The EOL before endstream is not data
+	data = bytes.TrimSuffix(data, []byte("\n"))
+	return bytes.TrimSuffix(data, []byte("\r"))
+}
+
+// pdfDoc is a parsed PDF file whose objects are read as they are needed.
+type pdfDoc struct {
+	data      []byte
+	offsets   map[int]int    // Object number to byte offset
+	inStreams map[int][2]int // Object number to object stream number and index
+	cache     map[int]interface{}
+	loading   map[int]bool // Objects being read, to break reference cycles
+	trailer   pdfDict
+}
+
+var objectHeaderPattern = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+
+// openPDF reads the cross-reference data of a PDF, rebuilding it by
+// scanning for objects when it is missing or damaged.
+func openPDF(data []byte) (*pdfDoc, error) {
+	if !bytes.Contains(data[:min(len(data), 1024)], []byte("%PDF-")) {
+		return nil, fmt.Errorf("%w: no %%PDF header", errPDFSyntax)
+	}
+	d := &pdfDoc{
+		data:      data,
+		offsets:   map[int]int{},
+		inStreams: map[int][2]int{},
+		cache:     map[int]interface{}{},
+		loading:   map[int]bool{},
+	}
+	if err := d.readXref(); err != nil || d.dict(d.dict(d.trailer["Root"])["Pages"]) == nil {
+		d.scanObjects()
+	}
+	if d.dict(d.trailer["Root"]) == nil {
+		return nil, fmt.Errorf("%w: no document catalog", errPDFSyntax)
+	}
+	return d, nil
+}
+
+// readXref follows the chain of cross-reference sections from the last
+// startxref. Newer sections come first, so their entries win.
+func (d *pdfDoc) readXref() error {
+	i := bytes.LastIndex(d.data, []byte("startxref"))
+	if i < 0 {
+		return fmt.Errorf("%w: no startxref", errPDFSyntax)
+	}
+	l := &pdfLexer{data: d.data, pos: i + len("startxref")}
+	offset, ok := l.integer()
+	if !ok {
+		return fmt.Errorf("%w: bad startxref", errPDFSyntax)
+	}
+
+	seen := map[int]bool{}
+	for offset > 0 && offset < len(d.data) && !seen[offset] {
+		seen[offset] = true
+		var section pdfDict
+		var err error
+		if bytes.HasPrefix(bytes.TrimLeft(d.data[offset:], " \r\n\t"), []byte("xref")) {
+			section, err = d.readXrefTable(offset)
+		} else {
+			section, err = d.readXrefStream(offset)
+		}
+		if err != nil {
+			return err
+		}
+		if d.trailer == nil {
+			d.trailer = section
+		}
+		// A hybrid file lists its compressed objects in a stream as well
+		if stm, ok := section["XRefStm"].(float64); ok && !seen[int(stm)] {
+			seen[int(stm)] = true
+			if _, err := d.readXrefStream(int(stm)); err != nil {
+				return err
+			}
+		}
+		prev, _ := section["Prev"].(float64)
+		offset = int(prev)
+	}
+	return nil
+}
+
+func (d *pdfDoc) readXrefTable(offset int) (pdfDict, error) {
+	l := &pdfLexer{data: d.data, pos: offset}
+	l.skipSpace()
+	l.pos += len("xref")
+	for {
+		first, ok := l.integer()
+		if !ok {
+			break
+		}
+		count, ok := l.integer()
+		if !ok {
+			return nil, fmt.Errorf("%w: bad xref subsection", errPDFSyntax)
+		}
+		for n := first; n < first+count; n++ {
+			pos, ok1 := l.integer()
+			_, ok2 := l.integer()
+			l.skipSpace()
+			if !ok1 || !ok2 || l.pos >= len(d.data) {
+				return nil, fmt.Errorf("%w: bad xref entry", errPDFSyntax)
+			}
+			kind := d.data[l.pos]
+			l.pos++
+			if _, known := d.offsets[n]; known || kind != 'n' {
+				continue
+			}
+			if _, known := d.inStreams[n]; !known {
+				d.offsets[n] = pos
+			}
+		}
+	}
+	l.skipSpace()
+	if !bytes.HasPrefix(d.data[l.pos:], []byte("trailer")) {
+		return nil, fmt.Errorf("%w: no trailer", errPDFSyntax)
+	}
+	l.pos += len("trailer")
+	trailer, err := l.object()
+	if err != nil {
+		return nil, err
+	}
+	dict, ok := trailer.(pdfDict)
+	if !ok {
+		return nil, fmt.Errorf("%w: bad trailer", errPDFSyntax)
+	}
+	return dict, nil
+}
+
+func (d *pdfDoc) readXrefStream(offset int) (pdfDict, error) {
+	obj, err := d.objectAt(offset)
+	if err != nil {
+		return nil, err
+	}
+	stream, ok := obj.(*pdfStream)
+	if !ok || stream.dict["Type"] != pdfName("XRef") {
+		return nil, fmt.Errorf("%w: no xref stream at %d", errPDFSyntax, offset)
+	}
+	data, err := d.decodeStream(stream)
+	if err != nil {
+		return nil, err
+	}
+
+	widths, _ := stream.dict["W"].(pdfArray)
+	if len(widths) != 3 {
+		return nil, fmt.Errorf("%w: bad xref stream widths", errPDFSyntax)
+	}
+	var w [3]int
+	for i := range w {
+		n, _ := widths[i].(float64)
+		w[i] = int(n)
+		if w[i] < 0 || w[i] > 8 {
+			return nil, fmt.Errorf("%w: bad xref stream widths", errPDFSyntax)
+		}
+	}
+	index, _ := stream.dict["Index"].(pdfArray)
+	if index == nil {
+		size, _ := stream.dict["Size"].(float64)
+		index = pdfArray{0.0, size}
+	}
+
+	field := func(b []byte, def int) int {
+		if len(b) == 0 {
+			return def
+		}
+		v := 0
+		for _, c := range b {
+			v = v<<8 | int(c)
+		}
+		return v
+	}
+	entry := w[0] + w[1] + w[2]
+	pos := 0
+	for i := 0; i+1 < len(index); i += 2 {
+		first, _ := index[i].(float64)
+		count, _ := index[i+1].(float64)
+		for n := int(first); n < int(first+count) && entry > 0 && pos+entry <= len(data); n++ {
+			row := data[pos : pos+entry]
+			pos += entry
+			kind := field(row[:w[0]], 1)
+			a := field(row[w[0]:w[0]+w[1]], 0)
+			b := field(row[w[0]+w[1]:], 0)
+			if _, known := d.offsets[n]; known {
+				continue
+			}
+			if _, known := d.inStreams[n]; known {
+				continue
+			}
+			switch kind {
+			case 1:
+				d.offsets[n] = a
+			case 2:
+				d.inStreams[n] = [2]int{a, b}
+			}
+		}
+	}
+	return stream.dict, nil
+}
+
+// scanObjects rebuilds the cross-reference data by finding every
+// "n g obj" in the file; later definitions replace earlier ones.
+func (d *pdfDoc) scanObjects() {
+	d.offsets = map[int]int{}
+	d.inStreams = map[int][2]int{}
+	d.cache = map[int]interface{}{}
+	for _, m := range objectHeaderPattern.FindAllSubmatchIndex(d.data, -1) {
+		n, err := strconv.Atoi(string(d.data[m[2]:m[3]]))
+		if err == nil && (m[0] == 0 || isPDFSpace(d.data[m[0]-1]) || isPDFDelimiter(d.data[m[0]-1])) {
+			d.offsets[n] = m[0]
+		}
+	}
+
+	if d.trailer == nil {
+		d.trailer = pdfDict{}
+	}
+	if i := bytes.LastIndex(d.data, []byte("trailer")); i >= 0 {
+		l := &pdfLexer{data: d.data, pos: i + len("trailer")}
+		if t, err := l.object(); err == nil {
+			if dict, ok := t.(pdfDict); ok {
+				for k, v := range dict {
+					d.trailer[k] = v
+				}
+			}
+		}
+	}
+	for n := range d.offsets {
+		obj := d.resolve(pdfRef{n, 0})
+		switch v := obj.(type) {
+		case *pdfStream:
+			switch v.dict["Type"] {
+			case pdfName("ObjStm"):
+				d.indexObjectStream(n, v)
+			case pdfName("XRef"):
+				for _, key := range []pdfName{"Root", "Info", "Encrypt"} {
+					if d.trailer[key] == nil && v.dict[key] != nil {
+						d.trailer[key] = v.dict[key]
+					}
+				}
+			}
+		case pdfDict:
+			if d.trailer["Root"] == nil && v["Type"] == pdfName("Catalog") {
+				d.trailer["Root"] = pdfRef{n, 0}
+			}
+		}
+	}
+	// The catalog may itself be in an object stream
+	if d.trailer["Root"] == nil {
+		for n := range d.inStreams {
+			if dict, ok := d.resolve(pdfRef{n, 0}).(pdfDict); ok && dict["Type"] == pdfName("Catalog") {
+				d.trailer["Root"] = pdfRef{n, 0}
+				break
+			}
+		}
+	}
+}
+
+// indexObjectStream records the objects of an object stream found by
+// scanning.
+func (d *pdfDoc) indexObjectStream(num int, stream *pdfStream) {
+	data, err := d.decodeStream(stream)
+	if err != nil {
+		return
+	}
+	count, _ := stream.dict["N"].(float64)
+	l := &pdfLexer{data: data}
+	for i := 0; i < int(count); i++ {
+		n, ok1 := l.integer()
+		_, ok2 := l.integer()
+		if !ok1 || !ok2 {
+			return
+		}
+		if _, known := d.offsets[n]; !known {
+			d.inStreams[n] = [2]int{num, i}
+		}
+	}
+}
+
+// objectAt parses the "n g obj ... endobj" at offset.
+func (d *pdfDoc) objectAt(offset int) (interface{}, error) {
+	if offset < 0 || offset >= len(d.data) {
+		return nil, fmt.Errorf("%w: object offset %d out of range", errPDFSyntax, offset)
+	}
+	l := &pdfLexer{data: d.data, pos: offset, doc: d}
+	if _, ok := l.integer(); !ok {
+		return nil, fmt.Errorf("%w: no object at %d", errPDFSyntax, offset)
+	}
+	if _, ok := l.integer(); !ok {
+		return nil, fmt.Errorf("%w: no object at %d", errPDFSyntax, offset)
+	}
+	if kw, err := l.object(); err != nil || kw != pdfKeyword("obj") {
+		return nil, fmt.Errorf("%w: no object at %d", errPDFSyntax, offset)
+	}
+	return l.object()
+}
+
+// resolve follows references until it reaches a direct object; a missing
+// or unreadable object is null.
+func (d *pdfDoc) resolve(obj interface{}) interface{} {
+	for i := 0; i < maxPDFDepth; i++ {
+		ref, ok := obj.(pdfRef)
+		if !ok {
+			return obj
+		}
+		obj = d.load(ref.num)
+	}
+	return nil
+}
+
+func (d *pdfDoc) load(num int) interface{} {
+	if obj, ok := d.cache[num]; ok {
+		return obj
+	}
+	if d.loading[num] {
+		return nil
+	}
+	d.loading[num] = true
+	defer delete(d.loading, num)
+
+	var obj interface{}
+	if offset, ok := d.offsets[num]; ok {
+		obj, _ = d.objectAt(offset)
+	} else if loc, ok := d.inStreams[num]; ok {
+		obj = d.loadFromStream(loc[0], loc[1])
+	}
+	d.cache[num] = obj
+	return obj
+}
+
+func (d *pdfDoc) loadFromStream(streamNum, index int) interface{} {
+	stream, ok := d.load(streamNum).(*pdfStream)
+	if !ok {
+		return nil
+	}
+	data, err := d.decodeStream(stream)
+	if err != nil {
+		return nil
+	}
+	first, _ := stream.dict["First"].(float64)
+	count, _ := stream.dict["N"].(float64)
+	if index >= int(count) {
+		return nil
+	}
+	l := &pdfLexer{data: data}
+	offset := -1
+	for i := 0; i <= index; i++ {
+		_, ok1 := l.integer()
+		off, ok2 := l.integer()
+		if !ok1 || !ok2 {
+			return nil
+		}
+		offset = off
+	}
+	pos := int(first) + offset
+	if pos < 0 || pos >= len(data) {
+		return nil
+	}
+	obj, err := (&pdfLexer{data: data, pos: pos, doc: d}).object()
+	if err != nil {
+		return nil
+	}
+	return obj
+}
+
+// dict resolves obj to a dictionary, taking a stream's dictionary.
+func (d *pdfDoc) dict(obj interface{}) pdfDict {
+	switch v := d.resolve(obj).(type) {
+	case pdfDict:
+		return v
+	case *pdfStream:
+		return v.dict
+	}
+	return nil
+}
+
+func (d *pdfDoc) array(obj interface{}) pdfArray {
+	a, _ := d.resolve(obj).(pdfArray)
+	return a
+}
+
+func (d *pdfDoc) number(obj interface{}) (float64, bool) {
+	n, ok := d.resolve(obj).(float64)
+	return n, ok
+}
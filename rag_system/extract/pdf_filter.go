@@ -0,0 +1,312 @@
+package extract
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"fmt"
+	"io"
+)
+
+// maxStreamSize bounds a decoded stream, so a small compressed bomb cannot
+// exhaust memory.
+const maxStreamSize = 256 << 20
+
+// decodeStream returns the data of a stream with its filters undone. Image
+// filters (DCT, JPX, CCITT, JBIG2) are not supported: they carry no text.
+func (d *pdfDoc) decodeStream(s *pdfStream) ([]byte, error) {
+	var filters, params pdfArray
+	switch f := d.resolve(s.dict["Filter"]).(type) {
+	case pdfName:
+		filters = pdfArray{f}
+		params = pdfArray{d.resolve(s.dict["DecodeParms"])}
+	case pdfArray:
+		filters = f
+		params = d.array(s.dict["DecodeParms"])
+	}
+
+	data := s.data
+	for i, f := range filters {
+		var p pdfDict
+		if i < len(params) {
+			p = d.dict(params[i])
+		}
+		var err error
+		switch d.resolve(f) {
+		case pdfName("FlateDecode"), pdfName("Fl"):
+			data, err = inflate(data)
+			if err == nil {
+				data, err = d.unpredict(data, p)
+			}
+		case pdfName("LZWDecode"), pdfName("LZW"):
+			early := 1
+			if n, ok := d.number(p["EarlyChange"]); ok {
+				early = int(n)
+			}
+			data, err = lzwDecode(data, early)
+			if err == nil {
+				data, err = d.unpredict(data, p)
+			}
+		case pdfName("ASCIIHexDecode"), pdfName("AHx"):
+			data = asciiHexDecode(data)
+		case pdfName("ASCII85Decode"), pdfName("A85"):
+			data, err = ascii85Decode(data)
+		case pdfName("RunLengthDecode"), pdfName("RL"):
+			data = runLengthDecode(data)
+		default:
+			return nil, fmt.Errorf("unsupported stream filter %v", f)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// inflate undoes FlateDecode. Streams cut short or with a bad checksum are
+// common, so whatever was decoded before an error is kept.
+func inflate(data []byte) ([]byte, error) {
+	var r io.Reader
+	if zr, err := zlib.NewReader(bytes.NewReader(data)); err == nil {
+		r = zr
+	} else {
+		r = flate.NewReader(bytes.NewReader(data)) // Raw deflate without the zlib header
+	}
+	out, err := io.ReadAll(io.LimitReader(r, maxStreamSize))
+	if err != nil && len(out) == 0 {
+		return nil, fmt.Errorf("failed to inflate stream: %w", err)
+	}
+	return out, nil
+}
+
+// unpredict undoes the PNG and TIFF predictors of /DecodeParms.
+func (d *pdfDoc) unpredict(data []byte, p pdfDict) ([]byte, error) {
+	param := func(key pdfName, def int) int {
+		if n, ok := d.number(p[key]); ok {
+			return int(n)
+		}
+		return def
+	}
+	predictor := param("Predictor", 1)
+	if predictor < 2 {
+		return data, nil
+	}
+	colors, bits, columns := param("Colors", 1), param("BitsPerComponent", 8), param("Columns", 1)
+	bpp := max(colors*bits/8, 1)
+	rowLen := (colors*bits*columns + 7) / 8
+	if rowLen <= 0 {
+		return nil, fmt.Errorf("bad predictor columns %d", columns)
+	}
+
+	if predictor == 2 { // TIFF, for 8-bit components
+		if bits != 8 {
+			return data, nil
+		}
+		out := append([]byte(nil), data...)
+		for row := 0; row+rowLen <= len(out); row += rowLen {
+			for i := bpp; i < rowLen; i++ {
+				out[row+i] += out[row+i-bpp]
+			}
+		}
+		return out, nil
+	}
+
+	var out []byte
+	prev := make([]byte, rowLen)
+	for pos := 0; pos < len(data); pos += rowLen + 1 {
+		end := min(pos+rowLen+1, len(data))
+		row := make([]byte, rowLen)
+		copy(row, data[pos+1:end])
+		kind := data[pos]
+		for i := range row {
+			var left, upLeft byte
+			if i >= bpp {
+				left, upLeft = row[i-bpp], prev[i-bpp]
+			}
+			up := prev[i]
+			switch kind {
+			case 1:
+				row[i] += left
+			case 2:
+				row[i] += up
+			case 3:
+				row[i] += byte((int(left) + int(up)) / 2)
+			case 4:
+				row[i] += paeth(left, up, upLeft)
+			}
+		}
+		out = append(out, row[:end-pos-1]...)
+		prev = row
+	}
+	return out, nil
+}
+
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	switch {
+	case pa <= pb && pa <= pc:
+		return a
+	case pb <= pc:
+		return b
+	}
+	return c
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// lzwDecode undoes LZWDecode. Unlike compress/lzw it supports the code
+// width growing one code early, which is PDF's default.
+func lzwDecode(data []byte, early int) ([]byte, error) {
+	const clear, eod = 256, 257
+	var out []byte
+	var table [][]byte
+	reset := func() {
+		table = table[:0]
+		for i := 0; i < 256; i++ {
+			table = append(table, []byte{byte(i)})
+		}
+		table = append(table, nil, nil)
+	}
+	reset()
+
+	width := 9
+	var bitBuf uint32
+	var bitCount int
+	var prev []byte
+	for pos := 0; ; {
+		for bitCount < width && pos < len(data) {
+			bitBuf = bitBuf<<8 | uint32(data[pos])
+			bitCount += 8
+			pos++
+		}
+		if bitCount < width {
+			break
+		}
+		code := int(bitBuf>>(bitCount-width)) & (1<<width - 1)
+		bitCount -= width
+
+		switch {
+		case code == clear:
+			reset()
+			width, prev = 9, nil
+			continue
+		case code == eod:
+			return out, nil
+		}
+
+		var entry []byte
+		switch {
+		case code < len(table) && table[code] != nil:
+			entry = table[code]
+		case code == len(table) && prev != nil:
+			entry = append(append([]byte(nil), prev...), prev[0])
+		default:
+			return out, fmt.Errorf("bad LZW code %d", code)
+		}
+		out = append(out, entry...)
+		if len(out) > maxStreamSize {
+			return nil, fmt.Errorf("LZW stream is larger than %d bytes", maxStreamSize)
+		}
+		if prev != nil && len(table) < 4096 {
+			table = append(table, append(append([]byte(nil), prev...), entry[0]))
+		}
+		prev = entry
+		if len(table)+early >= 1<<width && width < 12 {
+			width++
+		}
+	}
+	return out, nil
+}
+
+func asciiHexDecode(data []byte) []byte {
+	var out []byte
+	var high byte
+	odd := false
+	for _, c := range data {
+		if c == '>' {
+			break
+		}
+		v, ok := hexValue(c)
+		if !ok {
+			continue
+		}
+		if odd {
+			out = append(out, high<<4|v)
+		} else {
+			high = v
+		}
+		odd = !odd
+	}
+	if odd {
+		out = append(out, high<<4)
+	}
+	return out
+}
+
+// ascii85Decode undoes ASCII85Decode, including the z shorthand for four
+// zero bytes and a short final group.
+func ascii85Decode(data []byte) ([]byte, error) {
+	var out []byte
+	var group [5]byte
+	n := 0
+	flush := func(count int) {
+		var v uint32
+		for i := 0; i < 5; i++ {
+			v = v*85 + uint32(group[i]-'!')
+		}
+		b := []byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}
+		out = append(out, b[:count]...)
+	}
+	data = bytes.TrimPrefix(bytes.TrimSpace(data), []byte("<~"))
+	for _, c := range data {
+		switch {
+		case c == '~':
+			if n > 0 {
+				for i := n; i < 5; i++ {
+					group[i] = 'u'
+				}
+				flush(n - 1)
+			}
+			return out, nil
+		case c == 'z' && n == 0:
+			out = append(out, 0, 0, 0, 0)
+		case c >= '!' && c <= 'u':
+			group[n] = c
+			n++
+			if n == 5 {
+				flush(4)
+				n = 0
+			}
+		case isPDFSpace(c):
+		default:
+			return nil, fmt.Errorf("bad ASCII85 character %q", c)
+		}
+	}
+	return out, nil
+}
+
+func runLengthDecode(data []byte) []byte {
+	var out []byte
+	for i := 0; i < len(data); {
+		n := int(data[i])
+		i++
+		switch {
+		case n == 128:
+			return out
+		case n < 128:
+			end := min(i+n+1, len(data))
+			out = append(out, data[i:end]...)
+			i = end
+		case i < len(data):
+			out = append(out, bytes.Repeat(data[i:i+1], 257-n)...)
+			i++
+		}
+	}
+	return out
+}
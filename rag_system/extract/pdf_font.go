@@ -0,0 +1,513 @@
+package extract
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// pdfFont decodes the strings shown in one font into text and glyph widths.
+type pdfFont struct {
+	toUnicode *cmap     // From /ToUnicode; nil when the font has none
+	encoding  [256]rune // Simple fonts: code to character, 0 when unknown
+	composite bool      // Type0 font with multi-byte codes
+	widths    map[int]float64
+	missing   float64 // Width of codes without one
+	scale     float64 // Glyph space to text space: 1/1000 but for Type3 fonts
+}
+
+// glyph is one character code of a shown string.
+type glyph struct {
+	text   string // Empty when the code maps to no character
+	width  float64
+	space  bool // Single-byte code 32, which word spacing applies to
+	mapped bool
+}
+
+// loadFont reads a font dictionary.
+func (d *pdfDoc) loadFont(obj interface{}) *pdfFont {
+	dict := d.dict(obj)
+	f := &pdfFont{widths: map[int]float64{}, scale: 0.001}
+	if dict == nil {
+		f.encoding = standardEncoding
+		f.missing = 500
+		return f
+	}
+	subtype := d.resolve(dict["Subtype"])
+	base, _ := d.resolve(dict["BaseFont"]).(pdfName)
+
+	if stream, ok := d.resolve(dict["ToUnicode"]).(*pdfStream); ok {
+		if data, err := d.decodeStream(stream); err == nil {
+			f.toUnicode = parseCMap(data)
+		}
+	}
+
+	if subtype == pdfName("Type0") {
+		f.composite = true
+		f.missing = 1000
+		descendants := d.array(dict["DescendantFonts"])
+		if len(descendants) > 0 {
+			cid := d.dict(descendants[0])
+			if dw, ok := d.number(cid["DW"]); ok {
+				f.missing = dw
+			}
+			f.readCIDWidths(d, d.array(cid["W"]))
+		}
+		return f
+	}
+
+	if subtype == pdfName("Type3") {
+		if m := d.array(dict["FontMatrix"]); len(m) > 0 {
+			if a, ok := d.number(m[0]); ok {
+				f.scale = a
+			}
+		}
+	}
+	f.encoding = baseEncoding(string(base))
+	switch enc := d.resolve(dict["Encoding"]).(type) {
+	case pdfName:
+		f.encoding = namedEncoding(enc, f.encoding)
+	case pdfDict:
+		if name, ok := d.resolve(enc["BaseEncoding"]).(pdfName); ok {
+			f.encoding = namedEncoding(name, f.encoding)
+		}
+		code := 0
+		for _, item := range d.array(enc["Differences"]) {
+			switch v := d.resolve(item).(type) {
+			case float64:
+				code = int(v)
+			case pdfName:
+				if code >= 0 && code < 256 {
+					f.encoding[code] = glyphRune(string(v))
+				}
+				code++
+			}
+		}
+	}
+
+	first, _ := d.number(dict["FirstChar"])
+	for i, w := range d.array(dict["Widths"]) {
+		if n, ok := d.number(w); ok {
+			f.widths[int(first)+i] = n
+		}
+	}
+	if desc := d.dict(dict["FontDescriptor"]); desc != nil {
+		f.missing, _ = d.number(desc["MissingWidth"])
+	}
+	if len(f.widths) == 0 {
+		f.widths = standardWidths(string(base))
+	}
+	if f.missing == 0 {
+		f.missing = 500
+	}
+	return f
+}
+
+// readCIDWidths reads the /W array of a CID font: "c [w1 w2 ...]" gives the
+// widths of codes from c, and "first last w" one width for a range.
+func (f *pdfFont) readCIDWidths(d *pdfDoc, w pdfArray) {
+	for i := 0; i+1 < len(w); {
+		first, ok := d.number(w[i])
+		if !ok {
+			return
+		}
+		if list, ok := d.resolve(w[i+1]).(pdfArray); ok {
+			for j, v := range list {
+				if n, ok := d.number(v); ok {
+					f.widths[int(first)+j] = n
+				}
+			}
+			i += 2
+			continue
+		}
+		if i+2 >= len(w) {
+			return
+		}
+		last, _ := d.number(w[i+1])
+		width, _ := d.number(w[i+2])
+		if last-first <= 65535 {
+			for c := int(first); c <= int(last); c++ {
+				f.widths[c] = width
+			}
+		}
+		i += 3
+	}
+}
+
+// decode splits a shown string into glyphs.
+func (f *pdfFont) decode(s []byte) []glyph {
+	var glyphs []glyph
+	for len(s) > 0 {
+		n := 1
+		if f.composite {
+			n = 2
+			if f.toUnicode != nil {
+				n = f.toUnicode.codeLength(s)
+			}
+			n = min(n, len(s))
+		}
+		raw := s[:n]
+		s = s[n:]
+
+		code := 0
+		for _, b := range raw {
+			code = code<<8 | int(b)
+		}
+		g := glyph{space: n == 1 && code == 32}
+		if f.toUnicode != nil {
+			g.text, g.mapped = f.toUnicode.chars[string(raw)]
+		}
+		if !g.mapped && !f.composite {
+			if r := f.encoding[code]; r != 0 {
+				g.text, g.mapped = string(r), true
+			}
+		}
+		w, ok := f.widths[code]
+		if !ok {
+			w = f.missing
+		}
+		g.width = w * f.scale
+		glyphs = append(glyphs, g)
+	}
+	return glyphs
+}
+
+// cmap is a ToUnicode CMap.
+type cmap struct {
+	ranges [][3]int          // Code space ranges: byte length, low and high
+	chars  map[string]string // Code bytes to text
+}
+
+// maxCMapEntries bounds how far bfrange entries are expanded.
+const maxCMapEntries = 1 << 17
+
+func parseCMap(data []byte) *cmap {
+	m := &cmap{chars: map[string]string{}}
+	l := &pdfLexer{data: data}
+	var operands []interface{}
+	for {
+		obj, err := l.object()
+		if err != nil {
+			break
+		}
+		kw, ok := obj.(pdfKeyword)
+		if !ok {
+			operands = append(operands, obj)
+			continue
+		}
+		switch kw {
+		case "endcodespacerange":
+			for i := 0; i+1 < len(operands); i += 2 {
+				lo, ok1 := operands[i].(pdfString)
+				hi, ok2 := operands[i+1].(pdfString)
+				if ok1 && ok2 && len(lo) == len(hi) && len(lo) > 0 {
+					m.ranges = append(m.ranges, [3]int{len(lo), bytesValue(lo), bytesValue(hi)})
+				}
+			}
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				src, ok1 := operands[i].(pdfString)
+				dst, ok2 := operands[i+1].(pdfString)
+				if ok1 && ok2 {
+					m.chars[string(src)] = utf16Text(dst)
+				}
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				lo, ok1 := operands[i].(pdfString)
+				hi, ok2 := operands[i+1].(pdfString)
+				if !ok1 || !ok2 || len(lo) != len(hi) || len(lo) == 0 {
+					continue
+				}
+				m.addRange(lo, bytesValue(hi)-bytesValue(lo), operands[i+2])
+			}
+		}
+		if strings.HasPrefix(string(kw), "end") || strings.HasPrefix(string(kw), "begin") {
+			operands = operands[:0]
+		}
+	}
+	return m
+}
+
+// addRange maps count+1 codes from lo: to consecutive characters from a
+// string, or to the strings of an array.
+func (m *cmap) addRange(lo pdfString, count int, dst interface{}) {
+	if count < 0 || len(m.chars)+count > maxCMapEntries {
+		return
+	}
+	base := bytesValue(lo)
+	for i := 0; i <= count; i++ {
+		src := valueBytes(base+i, len(lo))
+		switch d := dst.(type) {
+		case pdfString:
+			units := utf16Units(d)
+			if len(units) == 0 {
+				continue
+			}
+			units[len(units)-1] += uint16(i)
+			m.chars[src] = string(utf16.Decode(units))
+		case pdfArray:
+			if i < len(d) {
+				if s, ok := d[i].(pdfString); ok {
+					m.chars[src] = utf16Text(s)
+				}
+			}
+		}
+	}
+}
+
+// codeLength returns the byte length of the code at the start of s, from
+// the code space ranges, or 2 when none matches.
+func (m *cmap) codeLength(s []byte) int {
+	for n := 1; n <= 4 && n <= len(s); n++ {
+		v := bytesValue(s[:n])
+		for _, r := range m.ranges {
+			if r[0] == n && v >= r[1] && v <= r[2] {
+				return n
+			}
+		}
+	}
+	return 2
+}
+
+func bytesValue(b []byte) int {
+	v := 0
+	for _, c := range b {
+		v = v<<8 | int(c)
+	}
+	return v
+}
+
+func valueBytes(v, n int) string {
+	b := make([]byte, n)
+	for i := n - 1; i >= 0; i-- {
+		b[i] = byte(v)
+		v >>= 8
+	}
+	return string(b)
+}
+
+func utf16Units(b []byte) []uint16 {
+	units := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		units = append(units, uint16(b[i])<<8|uint16(b[i+1]))
+	}
+	return units
+}
+
+func utf16Text(b []byte) string {
+	if len(b) == 1 {
+		return string(rune(b[0]))
+	}
+	return string(utf16.Decode(utf16Units(b)))
+}
+
+// textString decodes a text string outside a content stream, such as the
+// document title: UTF-16BE with a byte order mark, otherwise PDFDocEncoding,
+// which agrees with Latin-1 for the characters that matter here.
+func textString(s pdfString) string {
+	if len(s) >= 2 && s[0] == 0xFE && s[1] == 0xFF {
+		return string(utf16.Decode(utf16Units(s[2:])))
+	}
+	runes := make([]rune, len(s))
+	for i, c := range s {
+		runes[i] = winAnsiEncoding[c]
+		if runes[i] == 0 {
+			runes[i] = rune(c)
+		}
+	}
+	return string(runes)
+}
+
+// Simple font encodings. Codes below 32 and unassigned codes are 0.
+var (
+	standardEncoding = asciiEncoding(map[byte]rune{
+		'\'': '’', '`': '‘',
+		0xA1: '¡', 0xA2: '¢', 0xA3: '£', 0xA4: '⁄', 0xA5: '¥', 0xA6: 'ƒ', 0xA7: '§',
+		0xA8: '¤', 0xA9: '\'', 0xAA: '“', 0xAB: '«', 0xAC: '‹', 0xAD: '›', 0xAE: 'ﬁ',
+		0xAF: 'ﬂ', 0xB1: '–', 0xB2: '†', 0xB3: '‡', 0xB4: '·', 0xB6: '¶', 0xB7: '•',
+		0xB8: '‚', 0xB9: '„', 0xBA: '”', 0xBB: '»', 0xBC: '…', 0xBD: '‰', 0xBF: '¿',
+		0xC1: '`', 0xC2: '´', 0xC3: 'ˆ', 0xC4: '˜', 0xC5: '¯', 0xC6: '˘', 0xC7: '˙',
+		0xC8: '¨', 0xCA: '˚', 0xCB: '¸', 0xCD: '˝', 0xCE: '˛', 0xCF: 'ˇ', 0xD0: '—',
+		0xE1: 'Æ', 0xE3: 'ª', 0xE8: 'Ł', 0xE9: 'Ø', 0xEA: 'Œ', 0xEB: 'º', 0xF1: 'æ',
+		0xF5: 'ı', 0xF8: 'ł', 0xF9: 'ø', 0xFA: 'œ', 0xFB: 'ß',
+	})
+	winAnsiEncoding = func() [256]rune {
+		e := asciiEncoding(nil)
+		high := []rune("€\x00‚ƒ„…†‡ˆ‰Š‹Œ\x00Ž\x00\x00‘’“”•–—˜™š›œ\x00žŸ")
+		for i, r := range high {
+			e[0x80+i] = r
+		}
+		for c := 0xA0; c < 0x100; c++ {
+			e[c] = rune(c)
+		}
+		return e
+	}()
+	macRomanEncoding = func() [256]rune {
+		e := asciiEncoding(nil)
+		high := []rune("ÄÅÇÉÑÖÜáàâäãåçéèêëíìîïñóòôöõúùûü†°¢£§•¶ß®©™´¨≠ÆØ∞±≤≥¥µ∂∑∏π∫ªºΩæø¿¡¬√ƒ≈∆«»…\u00a0ÀÃÕŒœ–—“”‘’÷◊ÿŸ⁄€‹›ﬁﬂ‡·‚„‰ÂÊÁËÈÍÎÏÌÓÔ\uf8ffÒÚÛÙıˆ˜¯˘˙˚¸˝˛ˇ")
+		for i, r := range high {
+			e[0x80+i] = r
+		}
+		return e
+	}()
+)
+
+func asciiEncoding(high map[byte]rune) [256]rune {
+	var e [256]rune
+	for c := 32; c < 127; c++ {
+		e[c] = rune(c)
+	}
+	for c, r := range high {
+		e[c] = r
+	}
+	return e
+}
+
+func namedEncoding(name pdfName, def [256]rune) [256]rune {
+	switch name {
+	case "WinAnsiEncoding":
+		return winAnsiEncoding
+	case "MacRomanEncoding":
+		return macRomanEncoding
+	case "StandardEncoding":
+		return standardEncoding
+	}
+	return def
+}
+
+// baseEncoding is the built-in encoding of a font without /Encoding. Symbol
+// and dingbat fonts have their own, which is not text.
+func baseEncoding(base string) [256]rune {
+	if strings.Contains(base, "Symbol") || strings.Contains(base, "Dingbats") {
+		return [256]rune{}
+	}
+	return standardEncoding
+}
+
+// glyphNames maps the glyph names of /Differences that are not a single
+// letter or digit name, nor uniXXXX.
+var glyphNames = map[string]rune{
+	"space": ' ', "exclam": '!', "quotedbl": '"', "numbersign": '#', "dollar": '$',
+	"percent": '%', "ampersand": '&', "quotesingle": '\'', "parenleft": '(',
+	"parenright": ')', "asterisk": '*', "plus": '+', "comma": ',', "hyphen": '-',
+	"period": '.', "slash": '/', "zero": '0', "one": '1', "two": '2', "three": '3',
+	"four": '4', "five": '5', "six": '6', "seven": '7', "eight": '8', "nine": '9',
+	"colon": ':', "semicolon": ';', "less": '<', "equal": '=', "greater": '>',
+	"question": '?', "at": '@', "bracketleft": '[', "backslash": '\\',
+	"bracketright": ']', "asciicircum": '^', "underscore": '_', "grave": '`',
+	"braceleft": '{', "bar": '|', "braceright": '}', "asciitilde": '~',
+	"quoteleft": '‘', "quoteright": '’', "quotedblleft": '“', "quotedblright": '”',
+	"quotesinglbase": '‚', "quotedblbase": '„', "guillemotleft": '«',
+	"guillemotright": '»', "guilsinglleft": '‹', "guilsinglright": '›',
+	"endash": '–', "emdash": '—', "bullet": '•', "ellipsis": '…', "dagger": '†',
+	"daggerdbl": '‡', "trademark": '™', "copyright": '©', "registered": '®',
+	"degree": '°', "section": '§', "paragraph": '¶', "periodcentered": '·',
+	"minus": '−', "multiply": '×', "divide": '÷', "plusminus": '±', "Euro": '€',
+	"sterling": '£', "yen": '¥', "cent": '¢', "currency": '¤', "florin": 'ƒ',
+	"exclamdown": '¡', "questiondown": '¿', "nbspace": ' ', "sfthyphen": '­',
+	"dotlessi": 'ı', "germandbls": 'ß', "AE": 'Æ', "ae": 'æ', "OE": 'Œ', "oe": 'œ',
+	"Oslash": 'Ø', "oslash": 'ø', "Lslash": 'Ł', "lslash": 'ł', "fraction": '⁄',
+	"perthousand": '‰', "ordfeminine": 'ª', "ordmasculine": 'º', "mu": 'µ',
+	"onehalf": '½', "onequarter": '¼', "threequarters": '¾', "logicalnot": '¬',
+	"brokenbar": '¦', "dieresis": '¨', "acute": '´', "cedilla": '¸', "macron": '¯',
+	"circumflex": 'ˆ', "tilde": '˜', "arrowright": '→', "arrowleft": '←',
+	"checkmark": '✓', "fi": 'ﬁ', "fl": 'ﬂ', "ff": 'ﬀ', "ffi": 'ﬃ', "ffl": 'ﬄ',
+	"f_i": 'ﬁ', "f_l": 'ﬂ', "f_f": 'ﬀ', "f_f_i": 'ﬃ', "f_f_l": 'ﬄ',
+}
+
+// accented lists the Latin-1 letters with diacritics, named as their base
+// letter followed by the accent.
+var accented = map[string]string{
+	"grave": "ÀàÈèÌìÒòÙù", "acute": "ÁáÉéÍíÓóÚúÝý", "circumflex": "ÂâÊêÎîÔôÛû",
+	"tilde": "ÃãÑñÕõ", "dieresis": "ÄäËëÏïÖöÜüŸÿ", "ring": "Åå", "cedilla": "Çç",
+	"caron": "ŠšŽžČčŘřĚě",
+}
+
+func init() {
+	for accent, letters := range accented {
+		for _, r := range letters {
+			glyphNames[baseLetter(r)+accent] = r
+		}
+	}
+}
+
+// baseLetter returns the unaccented letter of r, one of accented's letters.
+func baseLetter(r rune) string {
+	const from, to = "ÀàÈèÌìÒòÙùÁáÉéÍíÓóÚúÝýÂâÊêÎîÔôÛûÃãÑñÕõÄäËëÏïÖöÜüŸÿÅåÇçŠšŽžČčŘřĚě",
+		"AaEeIiOoUuAaEeIiOoUuYyAaEeIiOoUuAaNnOoAaEeIiOoUuYyAaCcSsZzCcRrEe"
+	fromRunes := []rune(from)
+	for i, f := range fromRunes {
+		if f == r {
+			return to[i : i+1]
+		}
+	}
+	return string(r)
+}
+
+// glyphRune returns the character a glyph name stands for, or 0. Suffixes
+// such as .sc or .alt are dropped, and uniXXXX or uXXXX names give the code
+// point.
+func glyphRune(name string) rune {
+	if i := strings.IndexByte(name, '.'); i > 0 {
+		name = name[:i]
+	}
+	if len(name) == 1 && (name[0] >= 'a' && name[0] <= 'z' || name[0] >= 'A' && name[0] <= 'Z') {
+		return rune(name[0])
+	}
+	if r, ok := glyphNames[name]; ok {
+		return r
+	}
+	hex := ""
+	if h, ok := strings.CutPrefix(name, "uni"); ok && len(h) >= 4 {
+		hex = h[:4] // A uni name may list several code points
+	} else if h, ok := strings.CutPrefix(name, "u"); ok && len(h) >= 4 && len(h) <= 6 {
+		hex = h
+	}
+	if v, err := strconv.ParseUint(hex, 16, 32); err == nil && v > 0 && v <= 0x10FFFF {
+		return rune(v)
+	}
+	return 0
+}
+
+// Widths of the printable ASCII characters in the standard fonts, for fonts
+// that do not list their own.
+var (
+	helveticaWidths = []float64{
+		278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+		1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+		333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+		556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+	}
+	timesWidths = []float64{
+		250, 333, 408, 500, 500, 833, 778, 180, 333, 333, 500, 564, 250, 333, 250, 278,
+		500, 500, 500, 500, 500, 500, 500, 500, 500, 500, 278, 278, 564, 564, 564, 444,
+		921, 722, 667, 667, 722, 611, 556, 722, 722, 333, 389, 722, 611, 889, 722, 722,
+		556, 722, 667, 556, 611, 722, 722, 944, 722, 722, 611, 333, 278, 333, 469, 500,
+		333, 444, 500, 444, 500, 444, 333, 500, 500, 278, 278, 500, 278, 778, 500, 500,
+		500, 500, 333, 389, 278, 500, 500, 722, 500, 500, 444, 480, 200, 480, 541,
+	}
+)
+
+// standardWidths returns the widths of a standard font by its base name:
+// Courier is monospaced, Times and other serif names use Times-Roman, and
+// everything else Helvetica.
+func standardWidths(base string) map[int]float64 {
+	widths := make(map[int]float64, 95)
+	table := helveticaWidths
+	switch {
+	case strings.Contains(base, "Courier") || strings.Contains(base, "Mono"):
+		for c := 32; c < 127; c++ {
+			widths[c] = 600
+		}
+		return widths
+	case strings.Contains(base, "Times") || strings.Contains(base, "Serif") && !strings.Contains(base, "Sans"):
+		table = timesWidths
+	}
+	for i, w := range table {
+		widths[32+i] = w
+	}
+	return widths
+}
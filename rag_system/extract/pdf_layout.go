@@ -0,0 +1,267 @@
+package extract
+
+import (
+	"math"
+	"sort"
+	"strings"
+)
+
+// Layout thresholds, in units of the font size unless noted.
+const (
+	wordGap          = 0.15 // A gap between runs this wide is a space
+	baselineJitter   = 0.5  // Runs whose baselines differ by less share a line
+	paragraphSpacing = 1.35 // Line spacing above this times the usual starts a paragraph
+	minGutter        = 1.0  // Narrowest gap between columns
+	minColumnShare   = 0.25 // Narrowest column, as a share of the text's width
+	minColumnFill    = 0.5  // How much of a column its typical line fills
+	spanningShare    = 0.1  // Share of lines, at least two, that may cross a gutter: titles, footers
+	maxColumnDepth   = 3    // Columns split at most this often, for four columns
+)
+
+// textLine is a line of text on a page.
+type textLine struct {
+	runs   []textRun
+	y      float64
+	size   float64
+	x0, x1 float64
+	block  int // Lines of the same block are read as one flow of text
+}
+
+// layoutPage returns the text of a page in reading order: columns one
+// after the other, lines that span the columns (titles, footers) where they
+// fall between them, and paragraphs separated by a blank line.
+func layoutPage(runs []textRun) string {
+	if len(runs) == 0 {
+		return ""
+	}
+	block := 0
+	lines := orderLines(runs, 0, &block)
+
+	var gaps []float64
+	for i := 1; i < len(lines); i++ {
+		if lines[i].block == lines[i-1].block && lines[i-1].y > lines[i].y {
+			gaps = append(gaps, (lines[i-1].y-lines[i].y)/lines[i].size)
+		}
+	}
+	usual := median(gaps)
+
+	var b strings.Builder
+	for i, line := range lines {
+		text := line.text()
+		if text == "" {
+			continue
+		}
+		if b.Len() > 0 {
+			prev := lines[i-1]
+			gap := (prev.y - line.y) / line.size
+			switch {
+			case prev.block != line.block,
+				gap <= 0,
+				usual > 0 && gap > usual*paragraphSpacing,
+				math.Abs(prev.size-line.size) > 0.15*line.size:
+				b.WriteString("\n\n")
+			default:
+				b.WriteString("\n")
+			}
+		}
+		b.WriteString(text)
+	}
+	if b.Len() == 0 {
+		return ""
+	}
+	return b.String() + "\n"
+}
+
+// orderLines returns the lines of runs in reading order, numbering each
+// flow of text as a block.
+func orderLines(runs []textRun, depth int, block *int) []textLine {
+	lo, hi, ok := findGutter(runs)
+	if !ok || depth >= maxColumnDepth {
+		*block++
+		lines := groupLines(runs)
+		for i := range lines {
+			lines[i].block = *block
+		}
+		return lines
+	}
+
+	var left, right, spanning []textRun
+	for _, run := range runs {
+		switch {
+		case run.x1 <= hi && run.x0 < lo:
+			left = append(left, run)
+		case run.x0 >= lo && run.x1 > hi:
+			right = append(right, run)
+		case run.x1 <= hi:
+			left = append(left, run) // Inside the gutter, by a hair
+		default:
+			spanning = append(spanning, run)
+		}
+	}
+
+	// Spanning lines cut the page into bands, each read column by column
+	var lines []textLine
+	top := math.Inf(1)
+	spanLines := groupLines(spanning)
+	for i := 0; i <= len(spanLines); i++ {
+		bottom := math.Inf(-1)
+		if i < len(spanLines) {
+			bottom = spanLines[i].y
+		}
+		inBand := func(runs []textRun) []textRun {
+			var band []textRun
+			for _, run := range runs {
+				if run.y > bottom && run.y <= top {
+					band = append(band, run)
+				}
+			}
+			return band
+		}
+		for _, column := range [][]textRun{inBand(left), inBand(right)} {
+			if len(column) > 0 {
+				lines = append(lines, orderLines(column, depth+1, block)...)
+			}
+		}
+		if i < len(spanLines) {
+			*block++
+			spanLines[i].block = *block
+			lines = append(lines, spanLines[i])
+			top = bottom
+		}
+	}
+	return lines
+}
+
+// findGutter returns the widest vertical gap between two columns of text,
+// in device space. The columns either side must each be a fair share of the
+// text's width and mostly filled by their lines, so a right-aligned column
+// of dates or a table is not taken for a column of text.
+func findGutter(runs []textRun) (lo, hi float64, ok bool) {
+	minX, maxX := math.Inf(1), math.Inf(-1)
+	var sizes []float64
+	for _, run := range runs {
+		minX, maxX = math.Min(minX, run.x0), math.Max(maxX, run.x1)
+		sizes = append(sizes, run.size)
+	}
+	width := maxX - minX
+	size := median(sizes)
+	if width <= 0 || width > 10000 || size <= 0 {
+		return 0, 0, false
+	}
+
+	// Count the lines covering each point of the width
+	lines := groupLines(runs)
+	coverage := make([]int, int(width)+1)
+	for _, line := range lines {
+		covered := make([]bool, len(coverage))
+		for _, run := range line.runs {
+			for x := int(run.x0 - minX); x < int(math.Ceil(run.x1-minX)) && x < len(covered); x++ {
+				covered[max(x, 0)] = true
+			}
+		}
+		for x, c := range covered {
+			if c {
+				coverage[x]++
+			}
+		}
+	}
+
+	limit := max(2, int(spanningShare*float64(len(lines))))
+	best := 0.0
+	for x := 0; x < len(coverage); {
+		if coverage[x] > limit {
+			x++
+			continue
+		}
+		start := x
+		for x < len(coverage) && coverage[x] <= limit {
+			x++
+		}
+		gapLo, gapHi := minX+float64(start), minX+float64(x)
+		if gapHi-gapLo < minGutter*size || gapHi-gapLo <= best {
+			continue
+		}
+		if !isColumn(lines, minX, gapLo, width) || !isColumn(lines, gapHi, maxX, width) {
+			continue
+		}
+		lo, hi, ok, best = gapLo, gapHi, true, gapHi-gapLo
+	}
+	return lo, hi, ok
+}
+
+// isColumn reports whether the lines between x0 and x1 make a column of
+// text: a fair share of the width, with lines that mostly fill it.
+func isColumn(lines []textLine, x0, x1, width float64) bool {
+	if x1-x0 < minColumnShare*width {
+		return false
+	}
+	var fills []float64
+	for _, line := range lines {
+		filled := 0.0
+		for _, run := range line.runs {
+			filled += math.Max(0, math.Min(run.x1, x1)-math.Max(run.x0, x0))
+		}
+		if filled > 0 {
+			fills = append(fills, filled/(x1-x0))
+		}
+	}
+	return len(fills) >= 3 && median(fills) >= minColumnFill
+}
+
+// groupLines groups runs sharing a baseline into lines, top to bottom.
+func groupLines(runs []textRun) []textLine {
+	sorted := append([]textRun(nil), runs...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].y > sorted[j].y })
+
+	var lines []textLine
+	for _, run := range sorted {
+		if n := len(lines); n > 0 {
+			line := &lines[n-1]
+			if line.y-run.y < baselineJitter*math.Min(line.size, run.size) {
+				line.runs = append(line.runs, run)
+				line.size = math.Max(line.size, run.size)
+				line.x0, line.x1 = math.Min(line.x0, run.x0), math.Max(line.x1, run.x1)
+				continue
+			}
+		}
+		lines = append(lines, textLine{runs: []textRun{run}, y: run.y, size: run.size, x0: run.x0, x1: run.x1})
+	}
+	for i := range lines {
+		runs := lines[i].runs
+		sort.SliceStable(runs, func(a, b int) bool { return runs[a].x0 < runs[b].x0 })
+		if lines[i].size <= 0 {
+			lines[i].size = 1
+		}
+	}
+	return lines
+}
+
+// text joins the runs of a line, with a space where they are apart.
+// A run drawn again over itself, as some PDFs do for bold, is dropped.
+func (l textLine) text() string {
+	var b strings.Builder
+	var prev *textRun
+	for i := range l.runs {
+		run := &l.runs[i]
+		if prev != nil {
+			if run.text == prev.text && math.Abs(run.x0-prev.x0) < wordGap*run.size {
+				continue
+			}
+			if run.x0-prev.x1 > wordGap*run.size {
+				b.WriteByte(' ')
+			}
+		}
+		b.WriteString(run.text)
+		prev = run
+	}
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	return sorted[len(sorted)/2]
+}
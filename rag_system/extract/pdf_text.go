@@ -0,0 +1,408 @@
+package extract
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// PDF is the MIME type of PDF documents.
+const PDF = "application/pdf"
+
+func init() {
+	Register(PDF, []string{".pdf"}, ExtractorFunc(extractPDF))
+}
+
+// PageBreak separates the pages of a paged document's text, so page k
+// starts after the (k-1)th PageBreak.
+const PageBreak = "\f"
+
+// maxUnmappedRatio is the share of shown characters without a Unicode
+// mapping above which a PDF's text layer is taken to be unreadable.
+const maxUnmappedRatio = 0.3
+
+// extractPDF returns the text layer of a PDF, page by page in reading
+// order, with PageBreak between the pages. Two- and three-column layouts
+// are read column by column. A PDF without a text layer, such as a scan,
+// or whose fonts do not map their characters to Unicode, has no
+// extractable text rather than garbage. Encrypted PDFs are not supported.
+func extractPDF(data []byte) (*Result, error) {
+	doc, err := openPDF(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to parse PDF: %w", ErrMalformed, err)
+	}
+	if doc.trailer["Encrypt"] != nil {
+		return nil, fmt.Errorf("%w: the PDF is encrypted", ErrUnsupportedFormat)
+	}
+
+	pages := doc.pages()
+	if len(pages) == 0 {
+		return nil, fmt.Errorf("%w: failed to parse PDF: %w: no pages", ErrMalformed, errPDFSyntax)
+	}
+	r := &pageReader{doc: doc, fonts: map[pdfRef]*pdfFont{}}
+	texts := make([]string, len(pages))
+	for i, page := range pages {
+		r.runs = r.runs[:0]
+		r.page(page)
+		texts[i] = layoutPage(r.runs)
+	}
+
+	switch {
+	case r.shown == 0:
+		return nil, fmt.Errorf("%w: the PDF has no text layer, so its pages are probably scanned images; run OCR on it first", ErrNoText)
+	case float64(r.unmapped) > maxUnmappedRatio*float64(r.shown):
+		return nil, fmt.Errorf("%w: the PDF's fonts map %d of its %d characters to no text", ErrNoText, r.unmapped, r.shown)
+	}
+
+	result := &Result{
+		Text:     strings.Join(texts, PageBreak),
+		Metadata: map[string]interface{}{"page_count": len(pages)},
+	}
+	info := doc.dict(doc.trailer["Info"])
+	for key, field := range map[pdfName]string{"Title": "title", "Author": "author"} {
+		if s, ok := doc.resolve(info[key]).(pdfString); ok {
+			if value := strings.TrimSpace(textString(s)); value != "" {
+				result.Metadata[field] = value
+			}
+		}
+	}
+	return result, nil
+}
+
+// pages returns the page dictionaries in order, with the inheritable
+// attributes of the page tree copied into them.
+func (d *pdfDoc) pages() []pdfDict {
+	root := d.dict(d.trailer["Root"])
+	var pages []pdfDict
+	seen := map[pdfRef]bool{}
+	var walk func(node interface{}, inherited pdfDict, depth int)
+	walk = func(node interface{}, inherited pdfDict, depth int) {
+		if ref, ok := node.(pdfRef); ok {
+			if seen[ref] {
+				return
+			}
+			seen[ref] = true
+		}
+		dict := d.dict(node)
+		if dict == nil || depth > maxPDFDepth {
+			return
+		}
+		attrs := pdfDict{}
+		for key, value := range inherited {
+			attrs[key] = value
+		}
+		for _, key := range []pdfName{"Resources", "MediaBox", "CropBox", "Rotate"} {
+			if value, ok := dict[key]; ok {
+				attrs[key] = value
+			}
+		}
+
+		kids := d.array(dict["Kids"])
+		if dict["Type"] == pdfName("Page") || kids == nil && dict["Contents"] != nil {
+			page := pdfDict{}
+			for key, value := range dict {
+				page[key] = value
+			}
+			for key, value := range attrs {
+				page[key] = value
+			}
+			pages = append(pages, page)
+			return
+		}
+		for _, kid := range kids {
+			walk(kid, attrs, depth+1)
+		}
+	}
+	walk(root["Pages"], nil, 0)
+	return pages
+}
+
+// ligatures spells out ligature characters, so words read by search and
+// embedding models match their typed form.
+var ligatures = strings.NewReplacer("ﬀ", "ff", "ﬁ", "fi", "ﬂ", "fl", "ﬃ", "ffi", "ﬄ", "ffl", "ﬅ", "st", "ﬆ", "st")
+
+// textRun is a string shown on a page, in device space with y up.
+type textRun struct {
+	x0, x1, y float64
+	size      float64 // Font size on the page
+	text      string
+}
+
+// matrix is a PDF transformation matrix [a b c d e f].
+type matrix [6]float64
+
+var identity = matrix{1, 0, 0, 1, 0, 0}
+
+// mul returns m×n, the transformation m followed by n.
+func (m matrix) mul(n matrix) matrix {
+	return matrix{
+		m[0]*n[0] + m[1]*n[2], m[0]*n[1] + m[1]*n[3],
+		m[2]*n[0] + m[3]*n[2], m[2]*n[1] + m[3]*n[3],
+		m[4]*n[0] + m[5]*n[2] + n[4], m[4]*n[1] + m[5]*n[3] + n[5],
+	}
+}
+
+func translate(x, y float64) matrix {
+	return matrix{1, 0, 0, 1, x, y}
+}
+
+// graphicsState is the part of the graphics and text state that places
+// text.
+type graphicsState struct {
+	ctm       matrix
+	font      *pdfFont
+	size      float64
+	charSpace float64
+	wordSpace float64
+	scale     float64 // Horizontal scaling, 1 for 100%
+	leading   float64
+	rise      float64
+}
+
+// pageReader interprets content streams, collecting the text runs of a
+// page.
+type pageReader struct {
+	doc      *pdfDoc
+	fonts    map[pdfRef]*pdfFont
+	runs     []textRun
+	shown    int // Characters shown in all pages so far
+	unmapped int // Of which without a Unicode mapping
+}
+
+// maxFormDepth bounds the nesting of form XObjects.
+const maxFormDepth = 8
+
+func (r *pageReader) page(page pdfDict) {
+	var content [][]byte
+	switch c := r.doc.resolve(page["Contents"]).(type) {
+	case *pdfStream:
+		if data, err := r.doc.decodeStream(c); err == nil {
+			content = append(content, data)
+		}
+	case pdfArray:
+		for _, item := range c {
+			if s, ok := r.doc.resolve(item).(*pdfStream); ok {
+				if data, err := r.doc.decodeStream(s); err == nil {
+					content = append(content, data)
+				}
+			}
+		}
+	}
+	r.content(bytes.Join(content, []byte("\n")), r.doc.dict(page["Resources"]), identity, 0)
+}
+
+// content interprets a content stream with its resources, drawn with ctm.
+func (r *pageReader) content(data []byte, resources pdfDict, ctm matrix, depth int) {
+	gs := graphicsState{ctm: ctm, scale: 1, font: r.doc.loadFont(nil)}
+	var stack []graphicsState
+	tm, tlm := identity, identity
+	nextLine := func() {
+		tlm = translate(0, -gs.leading).mul(tlm)
+		tm = tlm
+	}
+
+	l := &pdfLexer{data: data}
+	var operands []interface{}
+	for {
+		obj, err := l.object()
+		if err != nil {
+			return
+		}
+		op, ok := obj.(pdfKeyword)
+		if !ok {
+			operands = append(operands, obj)
+			continue
+		}
+		num := func(i int) float64 {
+			if i < len(operands) {
+				n, _ := operands[i].(float64)
+				return n
+			}
+			return 0
+		}
+		last := func() interface{} {
+			if len(operands) == 0 {
+				return nil
+			}
+			return operands[len(operands)-1]
+		}
+
+		switch op {
+		case "q":
+			stack = append(stack, gs)
+		case "Q":
+			if n := len(stack); n > 0 {
+				gs, stack = stack[n-1], stack[:n-1]
+			}
+		case "cm":
+			if len(operands) == 6 {
+				gs.ctm = matrix{num(0), num(1), num(2), num(3), num(4), num(5)}.mul(gs.ctm)
+			}
+		case "BT":
+			tm, tlm = identity, identity
+		case "Tf":
+			if len(operands) == 2 {
+				if name, ok := operands[0].(pdfName); ok {
+					gs.font = r.font(resources, name)
+				}
+				gs.size = num(1)
+			}
+		case "Tc":
+			gs.charSpace = num(0)
+		case "Tw":
+			gs.wordSpace = num(0)
+		case "Tz":
+			gs.scale = num(0) / 100
+		case "TL":
+			gs.leading = num(0)
+		case "Ts":
+			gs.rise = num(0)
+		case "Td", "TD":
+			if op == "TD" {
+				gs.leading = -num(1)
+			}
+			tlm = translate(num(0), num(1)).mul(tlm)
+			tm = tlm
+		case "Tm":
+			if len(operands) == 6 {
+				tlm = matrix{num(0), num(1), num(2), num(3), num(4), num(5)}
+				tm = tlm
+			}
+		case "T*":
+			nextLine()
+		case "Tj", "'", "\"":
+			if op != "Tj" {
+				nextLine()
+			}
+			if op == "\"" && len(operands) == 3 {
+				gs.wordSpace, gs.charSpace = num(0), num(1)
+			}
+			if s, ok := last().(pdfString); ok {
+				r.show(&gs, &tm, s)
+			}
+		case "TJ":
+			items, _ := last().(pdfArray)
+			for _, item := range items {
+				switch v := item.(type) {
+				case pdfString:
+					r.show(&gs, &tm, v)
+				case float64:
+					tm = translate(-v/1000*gs.size*gs.scale, 0).mul(tm)
+				}
+			}
+		case "Do":
+			if name, ok := last().(pdfName); ok && depth < maxFormDepth {
+				r.form(resources, name, gs.ctm, depth)
+			}
+		case "BI":
+			skipInlineImage(l)
+		}
+		operands = operands[:0]
+	}
+}
+
+// show adds the run of a string shown at the text matrix, and moves the
+// text matrix past it.
+func (r *pageReader) show(gs *graphicsState, tm *matrix, s pdfString) {
+	start := matrix{gs.size * gs.scale, 0, 0, gs.size, 0, gs.rise}.mul(*tm).mul(gs.ctm)
+	var text strings.Builder
+	for _, g := range gs.font.decode(s) {
+		if !g.mapped {
+			r.unmapped++
+		}
+		r.shown++
+		for _, c := range ligatures.Replace(g.text) {
+			if unicode.IsPrint(c) || c == ' ' {
+				text.WriteRune(c)
+			} else if unicode.IsSpace(c) {
+				text.WriteByte(' ')
+			}
+		}
+		advance := g.width*gs.size + gs.charSpace
+		if g.space {
+			advance += gs.wordSpace
+		}
+		*tm = translate(advance*gs.scale, 0).mul(*tm)
+	}
+	end := matrix{gs.size * gs.scale, 0, 0, gs.size, 0, gs.rise}.mul(*tm).mul(gs.ctm)
+	if text.Len() == 0 {
+		return
+	}
+
+	run := textRun{
+		x0:   start[4],
+		x1:   end[4],
+		y:    start[5],
+		size: math.Hypot(start[2], start[3]),
+		text: text.String(),
+	}
+	if run.x1 < run.x0 {
+		run.x0, run.x1 = run.x1, run.x0
+	}
+	r.runs = append(r.runs, run)
+}
+
+// font returns the font a resource name refers to, loading it once.
+func (r *pageReader) font(resources pdfDict, name pdfName) *pdfFont {
+	obj := r.doc.dict(resources["Font"])[name]
+	ref, isRef := obj.(pdfRef)
+	if isRef {
+		if f, ok := r.fonts[ref]; ok {
+			return f
+		}
+	}
+	f := r.doc.loadFont(obj)
+	if isRef {
+		r.fonts[ref] = f
+	}
+	return f
+}
+
+// form interprets a form XObject. Images and other XObjects are skipped.
+func (r *pageReader) form(resources pdfDict, name pdfName, ctm matrix, depth int) {
+	stream, ok := r.doc.resolve(r.doc.dict(resources["XObject"])[name]).(*pdfStream)
+	if !ok || r.doc.resolve(stream.dict["Subtype"]) != pdfName("Form") {
+		return
+	}
+	data, err := r.doc.decodeStream(stream)
+	if err != nil {
+		return
+	}
+	m := identity
+	if a := r.doc.array(stream.dict["Matrix"]); len(a) == 6 {
+		for i := range m {
+			m[i], _ = r.doc.number(a[i])
+		}
+	}
+	formResources := r.doc.dict(stream.dict["Resources"])
+	if formResources == nil {
+		formResources = resources
+	}
+	r.content(data, formResources, m.mul(ctm), depth+1)
+}
+
+// skipInlineImage moves the lexer past the data of an inline image, which
+// ends at an EI between whitespace.
+func skipInlineImage(l *pdfLexer) {
+	i := bytes.Index(l.data[l.pos:], []byte("ID"))
+	if i < 0 {
+		l.pos = len(l.data)
+		return
+	}
+	pos := l.pos + i + len("ID") + 1
+	for pos < len(l.data) {
+		j := bytes.Index(l.data[pos:], []byte("EI"))
+		if j < 0 {
+			break
+		}
+		end := pos + j
+		if end > 0 && isPDFSpace(l.data[end-1]) && (end+2 == len(l.data) || isPDFSpace(l.data[end+2])) {
+			l.pos = end + 2
+			return
+		}
+		pos = end + 2
+	}
+	l.pos = len(l.data)
+}
@@ -0,0 +1,59 @@
+package extract
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// MIME types of the text formats.
+const (
+	PlainText = "text/plain"
+	Markdown  = "text/markdown"
+	CSV       = "text/csv"
+	JSON      = "application/json"
+)
+
+func init() {
+	text := ExtractorFunc(extractText)
+	Register(PlainText, []string{".txt", ".text", ".log"}, text)
+	Register(Markdown, []string{".md", ".markdown"}, text)
+	Register(CSV, []string{".csv", ".tsv"}, text)
+	Register(JSON, []string{".json"}, text)
+}
+
+// extractText decodes UTF-8, or UTF-16 with a byte order mark, and
+// normalises line endings to "\n". Content with NUL bytes is binary.
+func extractText(data []byte) (*Result, error) {
+	var text string
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}), bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		text = decodeUTF16(data)
+	case bytes.IndexByte(data, 0) >= 0:
+		return nil, fmt.Errorf("%w: content is binary", ErrNoText)
+	default:
+		text = string(bytes.TrimPrefix(data, []byte("\xEF\xBB\xBF")))
+		if !utf8.ValidString(text) {
+			text = strings.ToValidUTF8(text, "�")
+		}
+	}
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	return &Result{Text: text}, nil
+}
+
+// decodeUTF16 decodes data after its byte order mark.
+func decodeUTF16(data []byte) string {
+	bigEndian := data[0] == 0xFE
+	data = data[2:]
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		if bigEndian {
+			units[i] = uint16(data[2*i])<<8 | uint16(data[2*i+1])
+		} else {
+			units[i] = uint16(data[2*i+1])<<8 | uint16(data[2*i])
+		}
+	}
+	return string(utf16.Decode(units))
+}
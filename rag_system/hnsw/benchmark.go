@@ -0,0 +1,165 @@
+package hnsw
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// BenchmarkResult reports the recall and latency of one parameter set
+// against exact (brute-force) search on the same data.
+type BenchmarkResult struct {
+	Config         Config  `json:"config"`
+	K              int     `json:"k"`
+	Vectors        int     `json:"vectors"`
+	Queries        int     `json:"queries"`
+	Recall         float64 `json:"recall"`           // Mean recall@k against exact search
+	BuildSeconds   float64 `json:"build_seconds"`    // Time to insert all vectors
+	AvgLatencyMs   float64 `json:"avg_latency_ms"`   // Mean HNSW query latency
+	P95LatencyMs   float64 `json:"p95_latency_ms"`   // 95th percentile HNSW query latency
+	ExactLatencyMs float64 `json:"exact_latency_ms"` // Mean brute-force query latency
+	SpeedupVsExact float64 `json:"speedup_vs_exact"` // ExactLatencyMs / AvgLatencyMs
+}
+
+// Benchmark builds one index per config over vectors and measures recall@k
+// and latency for the given queries against exact search. Builds are shared
+// between configs that differ only in EfSearch.
+func Benchmark(ids []string, vectors [][]float32, queries [][]float32, k int, configs []Config) ([]BenchmarkResult, error) {
+	if len(ids) != len(vectors) {
+		return nil, fmt.Errorf("got %d ids for %d vectors", len(ids), len(vectors))
+	}
+	if len(vectors) == 0 || len(queries) == 0 {
+		return nil, fmt.Errorf("benchmark needs at least one vector and one query")
+	}
+	if k <= 0 {
+		return nil, fmt.Errorf("k must be positive, got %d", k)
+	}
+	if len(configs) == 0 {
+		configs = []Config{DefaultConfig()}
+	}
+
+	// Ground truth from exact search
+	normalized := make([][]float32, len(vectors))
+	for i, v := range vectors {
+		normalized[i] = normalize(v)
+	}
+	truth := make([]map[string]bool, len(queries))
+	exactStart := time.Now()
+	for qi, q := range queries {
+		truth[qi] = map[string]bool{}
+		for _, r := range exactSearch(ids, normalized, normalize(q), k) {
+			truth[qi][r.ID] = true
+		}
+	}
+	exactLatency := msPerQuery(time.Since(exactStart), len(queries))
+
+	type buildKey struct{ m, efc int }
+	built := map[buildKey]*Index{}
+	buildTimes := map[buildKey]float64{}
+
+	var results []BenchmarkResult
+	for _, cfg := range configs {
+		cfg = cfg.withDefaults()
+		if err := cfg.Validate(); err != nil {
+			return nil, err
+		}
+
+		key := buildKey{cfg.M, cfg.EfConstruction}
+		idx, ok := built[key]
+		if !ok {
+			var err error
+			idx, err = New(cfg)
+			if err != nil {
+				return nil, err
+			}
+			start := time.Now()
+			for i, v := range vectors {
+				if err := idx.Add(ids[i], v); err != nil {
+					return nil, err
+				}
+			}
+			built[key] = idx
+			buildTimes[key] = time.Since(start).Seconds()
+		}
+		idx.SetEfSearch(cfg.EfSearch)
+
+		latencies := make([]time.Duration, len(queries))
+		var recallSum float64
+		for qi, q := range queries {
+			start := time.Now()
+			hits := idx.Search(q, k)
+			latencies[qi] = time.Since(start)
+
+			found := 0
+			for _, h := range hits {
+				if truth[qi][h.ID] {
+					found++
+				}
+			}
+			if len(truth[qi]) > 0 {
+				recallSum += float64(found) / float64(len(truth[qi]))
+			}
+		}
+
+		var total time.Duration
+		for _, l := range latencies {
+			total += l
+		}
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		avg := msPerQuery(total, len(queries))
+
+		result := BenchmarkResult{
+			Config:         cfg,
+			K:              k,
+			Vectors:        len(vectors),
+			Queries:        len(queries),
+			Recall:         recallSum / float64(len(queries)),
+			BuildSeconds:   buildTimes[key],
+			AvgLatencyMs:   avg,
+			P95LatencyMs:   float64(latencies[len(latencies)*95/100].Microseconds()) / 1000,
+			ExactLatencyMs: exactLatency,
+		}
+		if avg > 0 {
+			result.SpeedupVsExact = exactLatency / avg
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// SampleQueries splits vectors into a held-out query set of up to n vectors
+// and the remaining data set, so the benchmark never queries a vector that
+// is also in the index.
+func SampleQueries(ids []string, vectors [][]float32, n int, seed int64) (dataIDs []string, data [][]float32, queries [][]float32) {
+	order := rand.New(rand.NewSource(seed)).Perm(len(vectors))
+	if n > len(vectors)/2 {
+		n = len(vectors) / 2
+	}
+	for i, j := range order {
+		if i < n {
+			queries = append(queries, vectors[j])
+			continue
+		}
+		dataIDs = append(dataIDs, ids[j])
+		data = append(data, vectors[j])
+	}
+	return dataIDs, data, queries
+}
+
+func exactSearch(ids []string, normalized [][]float32, q []float32, k int) []Result {
+	results := make([]Result, len(ids))
+	for i, v := range normalized {
+		results[i] = Result{ID: ids[i], Score: 1 - float64(distance(q, v))}
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+	if len(results) > k {
+		results = results[:k]
+	}
+	return results
+}
+
+func msPerQuery(total time.Duration, queries int) float64 {
+	return float64(total.Microseconds()) / 1000 / float64(queries)
+}
@@ -0,0 +1,536 @@
+// Package hnsw implements a Hierarchical Navigable Small World graph for
+// approximate nearest-neighbour search over cosine similarity.
+//
+// The index supports incremental inserts, upserts and deletes. Deleted nodes
+// are tombstoned so the graph stays navigable, and the graph is compacted
+// automatically once tombstones make up a large share of it.
+package hnsw
+
+import (
+	"container/heap"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+)
+
+// Config holds the tunable HNSW parameters.
+type Config struct {
+	M              int `json:"m"`               // Max neighbours per node on upper layers (2*M on layer 0)
+	EfConstruction int `json:"ef_construction"` // Candidate list size while inserting
+	EfSearch       int `json:"ef_search"`       // Candidate list size while searching
+}
+
+// DefaultConfig returns parameters that give high recall on typical embedding sizes.
+func DefaultConfig() Config {
+	return Config{
+		M:              16,
+		EfConstruction: 200,
+		EfSearch:       64,
+	}
+}
+
+// Validate reports whether the parameters are usable.
+func (c Config) Validate() error {
+	if c.M < 2 {
+		return fmt.Errorf("m must be at least 2, got %d", c.M)
+	}
+	if c.EfConstruction < c.M {
+		return fmt.Errorf("ef_construction (%d) must be at least m (%d)", c.EfConstruction, c.M)
+	}
+	if c.EfSearch < 1 {
+		return fmt.Errorf("ef_search must be at least 1, got %d", c.EfSearch)
+	}
+	return nil
+}
+
+// withDefaults fills zero fields from DefaultConfig.
+func (c Config) withDefaults() Config {
+	def := DefaultConfig()
+	if c.M == 0 {
+		c.M = def.M
+	}
+	if c.EfConstruction == 0 {
+		c.EfConstruction = def.EfConstruction
+	}
+	if c.EfSearch == 0 {
+		c.EfSearch = def.EfSearch
+	}
+	return c
+}
+
+// Result is a single search hit.
+type Result struct {
+	ID    string
+	Score float64 // Cosine similarity
+}
+
+// compactRatio is the share of tombstoned nodes that triggers a rebuild.
+const compactRatio = 0.3
+
+type node struct {
+	id      string
+	vec     []float32 // Unit-normalised
+	level   int
+	friends [][]uint32 // friends[layer] = neighbour node indexes
+	deleted bool
+}
+
+// Index is an HNSW graph. It is safe for concurrent use.
+type Index struct {
+	mu        sync.RWMutex
+	cfg       Config
+	dim       int
+	nodes     []*node
+	ids       map[string]uint32
+	entry     int
+	maxLevel  int
+	deleted   int
+	levelMult float64
+	rng       *rand.Rand
+}
+
+// New creates an empty index. Zero fields in cfg take their default value.
+func New(cfg Config) (*Index, error) {
+	cfg = cfg.withDefaults()
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &Index{
+		cfg:       cfg,
+		ids:       make(map[string]uint32),
+		entry:     -1,
+		levelMult: 1 / math.Log(float64(cfg.M)),
+		rng:       rand.New(rand.NewSource(42)),
+	}, nil
+}
+
+// Config returns the parameters the index was built with.
+func (idx *Index) Config() Config {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return idx.cfg
+}
+
+// SetEfSearch changes the search-time candidate list size without a rebuild.
+func (idx *Index) SetEfSearch(ef int) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if ef > 0 {
+		idx.cfg.EfSearch = ef
+	}
+}
+
+// Len returns the number of live (non-deleted) vectors.
+func (idx *Index) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return len(idx.ids)
+}
+
+// Dimension returns the vector size, or 0 while the index is empty.
+func (idx *Index) Dimension() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return idx.dim
+}
+
+// Contains reports whether id is a live vector in the index.
+func (idx *Index) Contains(id string) bool {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	_, ok := idx.ids[id]
+	return ok
+}
+
+// IDs returns the IDs of all live vectors.
+func (idx *Index) IDs() []string {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	ids := make([]string, 0, len(idx.ids))
+	for id := range idx.ids {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// Add inserts a vector, replacing any existing vector with the same ID.
+func (idx *Index) Add(id string, vec []float32) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if len(vec) == 0 {
+		return fmt.Errorf("vector for %s is empty", id)
+	}
+	if idx.dim == 0 {
+		idx.dim = len(vec)
+	} else if len(vec) != idx.dim {
+		return fmt.Errorf("vector for %s has dimension %d, index expects %d", id, len(vec), idx.dim)
+	}
+
+	if existing, ok := idx.ids[id]; ok {
+		idx.tombstone(existing)
+	}
+
+	idx.insert(id, normalize(vec))
+	idx.maybeCompact()
+	return nil
+}
+
+// Delete removes a vector. Deleting an unknown ID is a no-op.
+func (idx *Index) Delete(id string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if existing, ok := idx.ids[id]; ok {
+		idx.tombstone(existing)
+		idx.maybeCompact()
+	}
+}
+
+// Search returns the k nearest live vectors to query, best first.
+func (idx *Index) Search(query []float32, k int) []Result {
+	return idx.SearchFiltered(query, k, nil)
+}
+
+// SearchFiltered is Search restricted to IDs accepted by accept. A nil accept
+// admits every ID. Very selective filters can return fewer than k results;
+// callers should fall back to exact search in that case.
+func (idx *Index) SearchFiltered(query []float32, k int, accept func(id string) bool) []Result {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	if idx.entry < 0 || k <= 0 || len(query) != idx.dim {
+		return nil
+	}
+
+	q := normalize(query)
+	ep := uint32(idx.entry)
+	for layer := idx.maxLevel; layer > 0; layer-- {
+		ep = idx.greedyClosest(q, ep, layer)
+	}
+
+	ef := idx.cfg.EfSearch
+	if ef < k {
+		ef = k
+	}
+	candidates := idx.searchLayer(q, []uint32{ep}, ef, 0)
+
+	results := make([]Result, 0, k)
+	for _, c := range candidates {
+		n := idx.nodes[c.node]
+		if n.deleted || (accept != nil && !accept(n.id)) {
+			continue
+		}
+		results = append(results, Result{ID: n.id, Score: 1 - float64(c.dist)})
+		if len(results) == k {
+			break
+		}
+	}
+	return results
+}
+
+// ── graph construction ───────────────────────────────────────────────────────
+
+func (idx *Index) insert(id string, vec []float32) {
+	level := int(math.Floor(-math.Log(1-idx.rng.Float64()) * idx.levelMult))
+	n := &node{id: id, vec: vec, level: level, friends: make([][]uint32, level+1)}
+	nodeIdx := uint32(len(idx.nodes))
+	idx.nodes = append(idx.nodes, n)
+	idx.ids[id] = nodeIdx
+
+	if idx.entry < 0 {
+		idx.entry = int(nodeIdx)
+		idx.maxLevel = level
+		return
+	}
+
+	ep := uint32(idx.entry)
+	for layer := idx.maxLevel; layer > level; layer-- {
+		ep = idx.greedyClosest(vec, ep, layer)
+	}
+
+	eps := []uint32{ep}
+	for layer := min(level, idx.maxLevel); layer >= 0; layer-- {
+		candidates := idx.searchLayer(vec, eps, idx.cfg.EfConstruction, layer)
+		neighbours := idx.selectNeighbours(candidates, idx.cfg.M)
+		n.friends[layer] = neighbours
+
+		for _, nb := range neighbours {
+			idx.link(nb, nodeIdx, layer)
+		}
+
+		eps = eps[:0]
+		for _, c := range candidates {
+			eps = append(eps, c.node)
+		}
+	}
+
+	if level > idx.maxLevel {
+		idx.maxLevel = level
+		idx.entry = int(nodeIdx)
+	}
+}
+
+// link adds target to the neighbour list of from, pruning it back to the
+// layer's capacity with the selection heuristic when it overflows.
+func (idx *Index) link(from, target uint32, layer int) {
+	n := idx.nodes[from]
+	n.friends[layer] = append(n.friends[layer], target)
+
+	maxConn := idx.cfg.M
+	if layer == 0 {
+		maxConn = 2 * idx.cfg.M
+	}
+	if len(n.friends[layer]) <= maxConn {
+		return
+	}
+
+	candidates := make([]candidate, 0, len(n.friends[layer]))
+	for _, f := range n.friends[layer] {
+		candidates = append(candidates, candidate{node: f, dist: distance(n.vec, idx.nodes[f].vec)})
+	}
+	sortCandidates(candidates)
+	n.friends[layer] = idx.selectNeighbours(candidates, maxConn)
+}
+
+// selectNeighbours implements the HNSW neighbour selection heuristic: keep a
+// candidate only if it is closer to the base node than to every neighbour
+// already kept, then top up with the nearest discarded candidates.
+// candidates must be sorted by ascending distance.
+func (idx *Index) selectNeighbours(candidates []candidate, m int) []uint32 {
+	if len(candidates) <= m {
+		out := make([]uint32, len(candidates))
+		for i, c := range candidates {
+			out[i] = c.node
+		}
+		return out
+	}
+
+	selected := make([]uint32, 0, m)
+	var discarded []uint32
+	for _, c := range candidates {
+		if len(selected) == m {
+			break
+		}
+		good := true
+		for _, s := range selected {
+			if distance(idx.nodes[c.node].vec, idx.nodes[s].vec) < c.dist {
+				good = false
+				break
+			}
+		}
+		if good {
+			selected = append(selected, c.node)
+		} else {
+			discarded = append(discarded, c.node)
+		}
+	}
+	for _, d := range discarded {
+		if len(selected) == m {
+			break
+		}
+		selected = append(selected, d)
+	}
+	return selected
+}
+
+// greedyClosest walks a layer towards the node closest to q.
+func (idx *Index) greedyClosest(q []float32, ep uint32, layer int) uint32 {
+	best := ep
+	bestDist := distance(q, idx.nodes[ep].vec)
+	for changed := true; changed; {
+		changed = false
+		for _, f := range idx.nodes[best].friendsAt(layer) {
+			if d := distance(q, idx.nodes[f].vec); d < bestDist {
+				best, bestDist = f, d
+				changed = true
+			}
+		}
+	}
+	return best
+}
+
+// searchLayer runs a best-first beam search of width ef on one layer and
+// returns the candidates found sorted by ascending distance.
+func (idx *Index) searchLayer(q []float32, eps []uint32, ef int, layer int) []candidate {
+	visited := acquireVisited(len(idx.nodes))
+	defer visitedPool.Put(visited)
+	toVisit := &minHeap{}
+	found := &maxHeap{}
+
+	for _, ep := range eps {
+		if !visited.visit(ep) {
+			continue
+		}
+		c := candidate{node: ep, dist: distance(q, idx.nodes[ep].vec)}
+		heap.Push(toVisit, c)
+		heap.Push(found, c)
+	}
+	for found.Len() > ef {
+		heap.Pop(found)
+	}
+
+	for toVisit.Len() > 0 {
+		current := heap.Pop(toVisit).(candidate)
+		if found.Len() >= ef && current.dist > (*found)[0].dist {
+			break
+		}
+		for _, f := range idx.nodes[current.node].friendsAt(layer) {
+			if !visited.visit(f) {
+				continue
+			}
+			d := distance(q, idx.nodes[f].vec)
+			if found.Len() < ef || d < (*found)[0].dist {
+				c := candidate{node: f, dist: d}
+				heap.Push(toVisit, c)
+				heap.Push(found, c)
+				if found.Len() > ef {
+					heap.Pop(found)
+				}
+			}
+		}
+	}
+
+	out := make([]candidate, found.Len())
+	for i := len(out) - 1; i >= 0; i-- {
+		out[i] = heap.Pop(found).(candidate)
+	}
+	return out
+}
+
+// ── deletes ──────────────────────────────────────────────────────────────────
+
+func (idx *Index) tombstone(nodeIdx uint32) {
+	n := idx.nodes[nodeIdx]
+	if n.deleted {
+		return
+	}
+	n.deleted = true
+	delete(idx.ids, n.id)
+	idx.deleted++
+}
+
+// maybeCompact rebuilds the graph from live nodes once tombstones dominate it.
+func (idx *Index) maybeCompact() {
+	if idx.deleted == 0 || float64(idx.deleted) < compactRatio*float64(len(idx.nodes)) {
+		return
+	}
+
+	old := idx.nodes
+	idx.nodes = nil
+	idx.ids = make(map[string]uint32, len(old)-idx.deleted)
+	idx.entry = -1
+	idx.maxLevel = 0
+	idx.deleted = 0
+	for _, n := range old {
+		if !n.deleted {
+			idx.insert(n.id, n.vec)
+		}
+	}
+	if len(idx.nodes) == 0 {
+		idx.dim = 0
+	}
+}
+
+// ── helpers ──────────────────────────────────────────────────────────────────
+
+func (n *node) friendsAt(layer int) []uint32 {
+	if layer < len(n.friends) {
+		return n.friends[layer]
+	}
+	return nil
+}
+
+func normalize(vec []float32) []float32 {
+	var norm float64
+	for _, v := range vec {
+		norm += float64(v) * float64(v)
+	}
+	out := make([]float32, len(vec))
+	if norm == 0 {
+		return out
+	}
+	inv := 1 / math.Sqrt(norm)
+	for i, v := range vec {
+		out[i] = float32(float64(v) * inv)
+	}
+	return out
+}
+
+// distance is the cosine distance between two unit vectors.
+func distance(a, b []float32) float32 {
+	var dot float32
+	for i := range a {
+		dot += a[i] * b[i]
+	}
+	return 1 - dot
+}
+
+// visitedSet marks nodes seen during one layer search. Sets are pooled and
+// cleared in O(1) by bumping an epoch instead of zeroing the marks.
+type visitedSet struct {
+	marks []uint32
+	epoch uint32
+}
+
+var visitedPool = sync.Pool{New: func() any { return &visitedSet{} }}
+
+func acquireVisited(n int) *visitedSet {
+	v := visitedPool.Get().(*visitedSet)
+	if len(v.marks) < n {
+		v.marks = make([]uint32, n+n/2)
+		v.epoch = 0
+	}
+	v.epoch++
+	if v.epoch == 0 {
+		clear(v.marks)
+		v.epoch = 1
+	}
+	return v
+}
+
+// visit marks node as seen and reports whether it was unseen before.
+func (v *visitedSet) visit(node uint32) bool {
+	if v.marks[node] == v.epoch {
+		return false
+	}
+	v.marks[node] = v.epoch
+	return true
+}
+
+type candidate struct {
+	node uint32
+	dist float32
+}
+
+func sortCandidates(c []candidate) {
+	sort.Slice(c, func(i, j int) bool { return c[i].dist < c[j].dist })
+}
+
+type minHeap []candidate
+
+func (h minHeap) Len() int           { return len(h) }
+func (h minHeap) Less(i, j int) bool { return h[i].dist < h[j].dist }
+func (h minHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *minHeap) Push(x any)        { *h = append(*h, x.(candidate)) }
+func (h *minHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+type maxHeap []candidate
+
+func (h maxHeap) Len() int           { return len(h) }
+func (h maxHeap) Less(i, j int) bool { return h[i].dist > h[j].dist }
+func (h maxHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *maxHeap) Push(x any)        { *h = append(*h, x.(candidate)) }
+func (h *maxHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
@@ -0,0 +1,198 @@
+package hnsw
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+)
+
+// snapshot is the serialised form of an Index. Tombstoned nodes are dropped
+// on save, so node indexes are remapped to the live nodes only.
+type snapshot struct {
+	Config   Config
+	Dim      int
+	Entry    int
+	MaxLevel int
+	IDs      []string
+	Levels   []int
+	Vectors  [][]float32
+	Friends  [][][]uint32
+}
+
+// Save writes the index to w.
+func (idx *Index) Save(w io.Writer) error {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	remap := make(map[uint32]uint32, len(idx.ids))
+	for i, n := range idx.nodes {
+		if !n.deleted {
+			remap[uint32(i)] = uint32(len(remap))
+		}
+	}
+
+	snap := snapshot{
+		Config:   idx.cfg,
+		Dim:      idx.dim,
+		Entry:    -1,
+		MaxLevel: idx.maxLevel,
+	}
+	for i, n := range idx.nodes {
+		if n.deleted {
+			continue
+		}
+		friends := make([][]uint32, len(n.friends))
+		for layer, list := range n.friends {
+			for _, f := range list {
+				if to, ok := remap[f]; ok {
+					friends[layer] = append(friends[layer], to)
+				}
+			}
+		}
+		snap.IDs = append(snap.IDs, n.id)
+		snap.Levels = append(snap.Levels, n.level)
+		snap.Vectors = append(snap.Vectors, n.vec)
+		snap.Friends = append(snap.Friends, friends)
+		if i == idx.entry {
+			snap.Entry = int(remap[uint32(i)])
+		}
+	}
+
+	// A tombstoned entry point cannot be saved; promote the highest live node.
+	if snap.Entry < 0 && len(snap.IDs) > 0 {
+		snap.MaxLevel = -1
+		for i, level := range snap.Levels {
+			if level > snap.MaxLevel {
+				snap.Entry, snap.MaxLevel = i, level
+			}
+		}
+	}
+
+	if err := gob.NewEncoder(w).Encode(&snap); err != nil {
+		return fmt.Errorf("failed to encode hnsw index: %w", err)
+	}
+	return nil
+}
+
+// Load reads an index previously written by Save. A snapshot whose graph
+// refers to missing nodes or layers is refused rather than loaded.
+func Load(r io.Reader) (*Index, error) {
+	var snap snapshot
+	if err := gob.NewDecoder(r).Decode(&snap); err != nil {
+		return nil, fmt.Errorf("failed to decode hnsw index: %w", err)
+	}
+
+	cfg := snap.Config.withDefaults()
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid hnsw index parameters: %w", err)
+	}
+	if len(snap.Levels) != len(snap.IDs) || len(snap.Vectors) != len(snap.IDs) || len(snap.Friends) != len(snap.IDs) {
+		return nil, fmt.Errorf("corrupt hnsw index: inconsistent node arrays")
+	}
+	if err := snap.validate(); err != nil {
+		return nil, fmt.Errorf("corrupt hnsw index: %w", err)
+	}
+
+	idx := &Index{
+		cfg:       cfg,
+		dim:       snap.Dim,
+		ids:       make(map[string]uint32, len(snap.IDs)),
+		entry:     snap.Entry,
+		maxLevel:  snap.MaxLevel,
+		levelMult: 1 / math.Log(float64(cfg.M)),
+		rng:       rand.New(rand.NewSource(int64(len(snap.IDs)) + 42)),
+		nodes:     make([]*node, len(snap.IDs)),
+	}
+	for i, id := range snap.IDs {
+		friends := snap.Friends[i]
+		if len(friends) < snap.Levels[i]+1 {
+			friends = append(friends, make([][]uint32, snap.Levels[i]+1-len(friends))...)
+		}
+		idx.nodes[i] = &node{id: id, vec: snap.Vectors[i], level: snap.Levels[i], friends: friends}
+		idx.ids[id] = uint32(i)
+	}
+	if len(idx.nodes) == 0 {
+		idx.entry = -1
+		idx.maxLevel = 0
+	}
+	return idx, nil
+}
+
+// validate checks that the graph of a decoded snapshot can be searched: an
+// out-of-range neighbour or level would otherwise panic at search time.
+func (snap *snapshot) validate() error {
+	n := len(snap.IDs)
+	if n == 0 {
+		return nil
+	}
+	if snap.Entry < 0 || snap.Entry >= n {
+		return fmt.Errorf("entry point %d out of %d nodes", snap.Entry, n)
+	}
+	if snap.Levels[snap.Entry] != snap.MaxLevel {
+		return fmt.Errorf("entry point at level %d, index at level %d", snap.Levels[snap.Entry], snap.MaxLevel)
+	}
+	seen := make(map[string]bool, n)
+	for i, id := range snap.IDs {
+		if seen[id] {
+			return fmt.Errorf("duplicate node %q", id)
+		}
+		seen[id] = true
+		level := snap.Levels[i]
+		if level < 0 || level > snap.MaxLevel {
+			return fmt.Errorf("node %q at level %d, index at level %d", id, level, snap.MaxLevel)
+		}
+		if len(snap.Vectors[i]) != snap.Dim {
+			return fmt.Errorf("node %q has dimension %d, index has %d", id, len(snap.Vectors[i]), snap.Dim)
+		}
+		if len(snap.Friends[i]) > level+1 {
+			return fmt.Errorf("node %q at level %d has neighbours on %d layers", id, level, len(snap.Friends[i]))
+		}
+		for layer, friends := range snap.Friends[i] {
+			for _, f := range friends {
+				if int(f) >= n {
+					return fmt.Errorf("node %q has neighbour %d out of %d nodes", id, f, n)
+				}
+				if snap.Levels[f] < layer {
+					return fmt.Errorf("node %q has neighbour %q on layer %d above its level %d", id, snap.IDs[f], layer, snap.Levels[f])
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// SaveFile writes the index to path atomically.
+func (idx *Index) SaveFile(path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to save hnsw index: %w", err)
+	}
+	if err := idx.Save(tmp); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to save hnsw index: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to save hnsw index: %w", err)
+	}
+	return nil
+}
+
+// LoadFile reads an index from path.
+func LoadFile(path string) (*Index, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Load(f)
+}
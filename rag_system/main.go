@@ -2,6 +2,7 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
@@ -18,6 +19,7 @@ func main() {
 	configPath := flag.String("config", "config.json", "Path to configuration file")
 	showHelp := flag.Bool("help", false, "Show help information")
 	showVersion := flag.Bool("version", false, "Show version information")
+	migratePayloads := flag.Bool("migrate-payloads", false, "Rewrite JSON-string payloads of existing collections as typed values, then exit")
 
 	// Custom usage function
 	flag.Usage = func() {
@@ -29,6 +31,7 @@ func main() {
 		log.Printf("  %s                           # Use default config.json\n", os.Args[0])
 		log.Printf("  %s -config=prod.json         # Use custom config file\n", os.Args[0])
 		log.Printf("  %s -help                     # Show this help\n", os.Args[0])
+		log.Printf("  %s -migrate-payloads         # Upgrade stored payloads and exit\n", os.Args[0])
 	}
 
 	flag.Parse()
@@ -51,8 +54,15 @@ func main() {
 	log.Printf("Server will run on port %s", config.AppConfig.ServerPort)
 	log.Printf("Vector DB path: %s", config.AppConfig.VectorDBPath)
 
+	if *migratePayloads {
+		if err := runPayloadMigration(); err != nil {
+			log.Fatalf("Payload migration failed: %v", err)
+		}
+		os.Exit(0)
+	}
+
 	// Initialize services
-	err := api.InitializeServices(config.AppConfig.VectorDBPath)
+	err := api.InitializeServices(config.AppConfig)
 	if err != nil {
 		log.Fatalf("Failed to initialize services: %v", err)
 	}
@@ -80,9 +90,22 @@ func main() {
 	log.Println("  GET    /api/v1/collections             - List all collections")
 	log.Println("  GET    /api/v1/collections/:name       - Get collection statistics")
 	log.Println("  DELETE /api/v1/collections/:name       - Delete collection")
+	log.Println("  PUT    /api/v1/collections/:name/llm   - Set the collection's LLM provider and chat model")
+	log.Println("  POST   /api/v1/collections/:name/reembed - Start re-embedding with a new model (requires ?confirm=true)")
+	log.Println("  GET    /api/v1/collections/:name/reembed - Re-embed job progress")
+	log.Println("  GET    /api/v1/aliases                 - List collection aliases")
+	log.Println("  POST   /api/v1/aliases                 - Apply alias actions atomically")
+	log.Println("  PUT    /api/v1/aliases/:alias          - Point an alias at a collection")
+	log.Println("  DELETE /api/v1/aliases/:alias          - Delete an alias")
+	log.Println("  GET    /api/v1/collections/:name/index - Get ANN index settings (local store)")
+	log.Println("  PUT    /api/v1/collections/:name/index - Tune ANN index parameters (local store)")
+	log.Println("  POST   /api/v1/collections/:name/index/benchmark - Recall vs latency benchmark (local store)")
+	log.Println("  GET    /api/v1/embedding-cache         - Embedding cache size and hit rate")
+	log.Println("  DELETE /api/v1/embedding-cache         - Purge the embedding cache (?model=<provider>/<model> for one model)")
 	log.Println("")
 	log.Println("📄 Document Management:")
 	log.Println("  POST   /api/v1/documents               - Add document")
+	log.Println("  POST   /api/v1/documents/upload        - Upload files (multipart; text, Markdown, CSV, JSON, HTML, PDF)")
 	log.Println("  GET    /api/v1/collections/:name/documents - List documents in collection")
 	log.Println("  DELETE /api/v1/documents/:id           - Delete specific document")
 	log.Println("  DELETE /api/v1/collections/:name/documents - Delete all documents (requires ?confirm=true)")
@@ -90,7 +113,12 @@ func main() {
 	log.Println("🔍 Query & Analysis:")
 	log.Println("  POST   /api/v1/query                   - Query documents")
 	log.Println("  POST   /api/v1/analyze                 - Analyze document with metadata")
+	log.Println("  GET    /api/v1/chunking-strategies     - List chunking strategies and their options")
 	log.Println("  POST   /api/v1/compare-chunking        - Compare chunking strategies")
+	log.Println("  GET    /api/v1/doc-type-profiles       - List chunking profiles by doc type")
+	log.Println("  GET    /api/v1/doc-type-profiles/:doc_type - Get a doc type's chunking profile")
+	log.Println("  PUT    /api/v1/doc-type-profiles/:doc_type - Set a doc type's headings, strategy and sizes")
+	log.Println("  DELETE /api/v1/doc-type-profiles/:doc_type - Delete a profile set through the API")
 	log.Println()
 	log.Println("Enhanced features available:")
 	log.Println("  ✓ Intelligent structural chunking with automatic section detection")
@@ -105,3 +133,33 @@ func main() {
 		log.Fatalf("Failed to start server: %v", err)
 	}
 }
+
+// runPayloadMigration upgrades the payload format of the configured vector
+// store in place. The store is closed before returning, also on failure,
+// so that what was migrated is kept.
+func runPayloadMigration() (err error) {
+	store, err := core.NewVectorStore(config.AppConfig.VectorStore, config.AppConfig.VectorDBPath, config.AppConfig.HNSW)
+	if err != nil {
+		return fmt.Errorf("failed to open vector store: %w", err)
+	}
+	defer func() {
+		if closeErr := store.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("failed to close vector store: %w", closeErr)
+		}
+	}()
+
+	migrator, ok := store.(core.PayloadMigrator)
+	if !ok {
+		log.Println("This vector store has no payloads to migrate")
+		return nil
+	}
+	result, err := migrator.MigratePayloads()
+	if err != nil {
+		return fmt.Errorf("stopped after %d points: %w", result.Migrated, err)
+	}
+	log.Printf("Payload migration complete: %d points rewritten", result.Migrated)
+	if result.Failed > 0 {
+		log.Printf("Warning: %d points were skipped because their legacy fields are not valid JSON; they keep their strings until repaired and migrated again", result.Failed)
+	}
+	return nil
+}
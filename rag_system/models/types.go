@@ -82,6 +82,108 @@ type Document struct {
 	Metadata  map[string]interface{} `json:"metadata,omitempty"` // Document-level metadata
 	DocType   string                 `json:"doc_type,omitempty"` // e.g., "resume", "bible", "article"
 	CreatedAt time.Time              `json:"created_at"`
+
+	// ContentHash is the hex SHA-256 of Content. It is carried separately so
+	// documents rebuilt from stored chunks, which have no Content, keep it.
+	ContentHash string `json:"content_hash,omitempty"`
+}
+
+// CollectionSchema describes the vectors a collection holds. It is fixed when
+// the collection is created; writes and queries that do not match it are
+// rejected rather than silently recreating the collection.
+type CollectionSchema struct {
+	EmbeddingSelection        // Provider and model the collection's vectors were produced with
+	Dimension          int    `json:"dimension,omitempty"` // Vector size
+	Distance           string `json:"distance,omitempty"`  // Similarity metric, "cosine"
+}
+
+// EmbeddingSelection picks the provider and model that embed text. An empty
+// provider means the deployment's embedding_provider, an empty model that
+// provider's embedding model.
+type EmbeddingSelection struct {
+	EmbeddingProvider string `json:"embedding_provider,omitempty"`
+	EmbeddingModel    string `json:"embedding_model,omitempty"`
+}
+
+// CosineDistance is the similarity metric of every collection.
+const CosineDistance = "cosine"
+
+// LLMSelection picks the provider and chat model that answer queries. Empty
+// fields of a request fall back to the collection's selection, then to the
+// deployment's llm_provider and that provider's chat model.
+type LLMSelection struct {
+	LLMProvider string `json:"llm_provider,omitempty"`
+	ChatModel   string `json:"chat_model,omitempty"`
+}
+
+// CollectionInfo is the registry record of a collection.
+type CollectionInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	CollectionSchema
+	LLMSelection
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`          // Last document added or removed
+	ShadowOf  string    `json:"shadow_of,omitempty"` // Collection a re-embed job builds this one to replace
+	Swapping  bool      `json:"swapping,omitempty"`  // Being copied into ShadowOf, which is incomplete until it is
+}
+
+// ReembedStatus is the state of a re-embedding job.
+type ReembedStatus string
+
+const (
+	ReembedRunning   ReembedStatus = "running"
+	ReembedCompleted ReembedStatus = "completed"
+	ReembedFailed    ReembedStatus = "failed"
+)
+
+// ReembedJob reports the progress of re-embedding a collection into a new
+// embedding model through a shadow collection.
+type ReembedJob struct {
+	ID                 string        `json:"id"`
+	CollectionName     string        `json:"collection_name"`
+	ShadowCollection   string        `json:"shadow_collection"`
+	PreviousProvider   string        `json:"previous_provider"`
+	PreviousModel      string        `json:"previous_model"`
+	EmbeddingProvider  string        `json:"embedding_provider"`
+	EmbeddingModel     string        `json:"embedding_model"`
+	Status             ReembedStatus `json:"status"`
+	TotalDocuments     int           `json:"total_documents"`
+	CompletedDocuments int           `json:"completed_documents"`
+	TotalChunks        int           `json:"total_chunks"`
+	EmbeddedChunks     int           `json:"embedded_chunks"`
+	Error              string        `json:"error,omitempty"`
+	StartedAt          time.Time     `json:"started_at"`
+	FinishedAt         *time.Time    `json:"finished_at,omitempty"`
+}
+
+// AliasOp is the kind of an AliasAction.
+type AliasOp string
+
+const (
+	SetAlias    AliasOp = "set"
+	DeleteAlias AliasOp = "delete"
+)
+
+// AliasAction is one step of an atomic alias update. "set" points Alias at
+// Collection, creating or re-pointing it; "delete" removes Alias.
+type AliasAction struct {
+	Op         AliasOp `json:"op" binding:"required"`
+	Alias      string  `json:"alias" binding:"required"`
+	Collection string  `json:"collection,omitempty"`
+}
+
+// DocumentInfo is the registry record of a stored document.
+type DocumentInfo struct {
+	ID             string                 `json:"id"`
+	CollectionName string                 `json:"collection_name"`
+	Source         string                 `json:"source,omitempty"`
+	DocType        string                 `json:"doc_type,omitempty"`
+	ContentHash    string                 `json:"content_hash,omitempty"` // Hex SHA-256 of the document content
+	ChunkCount     int                    `json:"chunk_count"`
+	Metadata       map[string]interface{} `json:"metadata,omitempty"`
+	CreatedAt      time.Time              `json:"created_at"`
+	UpdatedAt      time.Time              `json:"updated_at"`
 }
 
 // EnhancedChunk represents a piece of a document with rich metadata and relationships.
@@ -101,8 +203,8 @@ type EnhancedChunk struct {
 	ChunkType  string `json:"chunk_type"`           // e.g., "sentence", "paragraph", "section", "parent"
 
 	// Position and context
-	StartPos   int `json:"start_pos"`   // Character position in original document
-	EndPos     int `json:"end_pos"`     // End character position
+	StartPos   int `json:"start_pos"`   // Byte offset of Text in the document's content
+	EndPos     int `json:"end_pos"`     // Byte offset just past Text
 	ChunkIndex int `json:"chunk_index"` // Sequential index in document
 
 	// Semantic metadata
@@ -127,11 +229,13 @@ const (
 	StructuralStrategy     ChunkingStrategy = "structural"
 	SentenceWindowStrategy ChunkingStrategy = "sentence_window"
 	ParentDocumentStrategy ChunkingStrategy = "parent_document"
+	CodeStrategy           ChunkingStrategy = "code"
 )
 
 // ChunkingConfig contains parameters for different chunking strategies.
 type ChunkingConfig struct {
 	Strategy           ChunkingStrategy `json:"strategy"`
+	SizeUnit           SizeUnit         `json:"size_unit,omitempty"`            // Unit of the sizes below (default chars)
 	FixedSize          int              `json:"fixed_size,omitempty"`           // For fixed size chunking
 	Overlap            int              `json:"overlap,omitempty"`              // Overlap between chunks
 	SentenceWindowSize int              `json:"sentence_window_size,omitempty"` // For sentence window strategy
@@ -139,16 +243,46 @@ type ChunkingConfig struct {
 	MaxChunkSize       int              `json:"max_chunk_size,omitempty"`       // Maximum chunk size
 	PreserveParagraphs bool             `json:"preserve_paragraphs,omitempty"`  // Try to keep paragraphs intact
 	ExtractKeywords    bool             `json:"extract_keywords,omitempty"`     // Extract keywords from chunks
+
+	// Options of the strategy, as listed by GET /chunking-strategies, e.g.
+	// {"breakpoint_percentile": 10} for semantic
+	Options map[string]interface{} `json:"options,omitempty"`
 }
 
+// DocTypeProfile tunes chunking for documents of one doc_type: how their
+// headings look, how deep their sections nest, and the strategy and sizes
+// they are chunked with unless a request sets its own.
+type DocTypeProfile struct {
+	DocType  string          `json:"doc_type"`
+	Headings []HeadingRule   `json:"headings,omitempty"` // Replace the built-in heading patterns when set
+	Chunking *ChunkingConfig `json:"chunking,omitempty"` // Preferred strategy, sizes and options
+	Source   string          `json:"source,omitempty"`   // "config" or "api"
+}
+
+// HeadingRule recognises the heading lines of one section level.
+type HeadingRule struct {
+	Pattern string `json:"pattern"`         // Regular expression matched against each trimmed line; the first group, or else the match, is the title
+	Level   int    `json:"level,omitempty"` // 1 (default) starts a section, deeper levels nest subsections in it
+}
+
+// SizeUnit is the unit chunk sizes and overlaps are given in.
+type SizeUnit string
+
+const (
+	CharUnits  SizeUnit = "chars"  // Bytes of text
+	TokenUnits SizeUnit = "tokens" // Tokens of the configured tokenizer
+)
+
 // AddDocumentRequest is the structure for requests to add a new document.
 type AddDocumentRequest struct {
-	CollectionName string          `json:"collection_name" binding:"required"`
-	FilePath       string          `json:"file_path,omitempty"`       // For server-side file access
-	Content        string          `json:"content,omitempty"`         // For direct content submission
-	Source         string          `json:"source,omitempty"`          // e.g. filename if content is direct
-	DocType        string          `json:"doc_type,omitempty"`        // Document type for strategy selection
-	ChunkingConfig *ChunkingConfig `json:"chunking_config,omitempty"` // Custom chunking configuration
+	CollectionName string                 `json:"collection_name" binding:"required"`
+	FilePath       string                 `json:"file_path,omitempty"`       // For server-side file access
+	Content        string                 `json:"content,omitempty"`         // For direct content submission
+	Source         string                 `json:"source,omitempty"`          // e.g. filename if content is direct
+	DocType        string                 `json:"doc_type,omitempty"`        // Document type for strategy selection
+	ChunkingConfig *ChunkingConfig        `json:"chunking_config,omitempty"` // Custom chunking configuration
+	Metadata       map[string]interface{} `json:"metadata,omitempty"`        // Custom document metadata
+	PageCount      int                    `json:"-"`                         // Pages of the paged file (PDF) Content was extracted from
 }
 
 // QueryRequest is the structure for requests to query the RAG system.
@@ -157,10 +291,74 @@ type QueryRequest struct {
 	Query             string                 `json:"query" binding:"required"`
 	TopK              int                    `json:"top_k,omitempty"`
 	RerankerEnabled   bool                   `json:"reranker_enabled,omitempty"`   // Enable re-ranking
-	MetadataFilters   map[string]interface{} `json:"metadata_filters,omitempty"`   // Filter by metadata
+	MetadataFilters   map[string]interface{} `json:"metadata_filters,omitempty"`   // Equality filters, ANDed with Filter
+	Filter            *FilterExpr            `json:"filter,omitempty"`             // Boolean filter expression
 	IncludeParents    bool                   `json:"include_parents,omitempty"`    // Include parent chunks in results
 	QueryExpansion    bool                   `json:"query_expansion,omitempty"`    // Expand query with synonyms/related terms
-	SemanticThreshold float64                `json:"semantic_threshold,omitempty"` // Minimum similarity threshold
+	SemanticThreshold float64                `json:"semantic_threshold,omitempty"` // Minimum similarity threshold (dense mode only)
+	RetrievalMode     RetrievalMode          `json:"retrieval_mode,omitempty"`     // dense (default), lexical or hybrid
+	FusionMethod      FusionMethod           `json:"fusion_method,omitempty"`      // rrf (default) or weighted, for hybrid mode
+	DenseWeight       float64                `json:"dense_weight,omitempty"`       // Weight of dense scores in weighted fusion (default 0.5)
+	MaxContextTokens  int                    `json:"max_context_tokens,omitempty"` // Token budget of the context given to the LLM (default max_context_tokens)
+	LLMSelection                             // Provider and chat model overriding the collection's
+}
+
+// FilterExpr is a node of a metadata filter expression. A node is either a
+// boolean combination (exactly one of And, Or, Not) or a comparison of Field
+// against Value with Op.
+//
+// Field names a chunk attribute (chunk_type, section, subsection, doc_type,
+// source, document_id, chunk_index, start_pos, end_pos, confidence, keywords,
+// parent_chunk_id), a path into the chunk's metadata ("metadata.author.name")
+// or a path into the document's metadata ("document.chunking_strategy").
+// Dates are compared as RFC 3339 strings ("2024-01-31" is accepted too).
+type FilterExpr struct {
+	And []*FilterExpr `json:"and,omitempty"`
+	Or  []*FilterExpr `json:"or,omitempty"`
+	Not *FilterExpr   `json:"not,omitempty"`
+
+	Field string      `json:"field,omitempty"`
+	Op    FilterOp    `json:"op,omitempty"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+type FilterOp string
+
+const (
+	FilterEq     FilterOp = "eq"     // Equal; on list fields, any element equal
+	FilterNe     FilterOp = "ne"     // Not equal
+	FilterIn     FilterOp = "in"     // Equal to one of a list of values
+	FilterGt     FilterOp = "gt"     // Greater than (numbers and dates)
+	FilterGte    FilterOp = "gte"    // Greater than or equal
+	FilterLt     FilterOp = "lt"     // Less than
+	FilterLte    FilterOp = "lte"    // Less than or equal
+	FilterExists FilterOp = "exists" // Field present and non-empty; value false inverts
+)
+
+type RetrievalMode string
+
+const (
+	DenseRetrieval   RetrievalMode = "dense"
+	LexicalRetrieval RetrievalMode = "lexical"
+	HybridRetrieval  RetrievalMode = "hybrid"
+)
+
+type FusionMethod string
+
+const (
+	ReciprocalRankFusion FusionMethod = "rrf"
+	WeightedScoreFusion  FusionMethod = "weighted"
+)
+
+// RetrievalRank explains where a returned chunk ranked in each retrieval list.
+// Ranks are 1-based; 0 means the chunk was not in that list.
+type RetrievalRank struct {
+	ChunkID      string  `json:"chunk_id"`
+	DenseRank    int     `json:"dense_rank,omitempty"`
+	LexicalRank  int     `json:"lexical_rank,omitempty"`
+	DenseScore   float64 `json:"dense_score,omitempty"`
+	LexicalScore float64 `json:"lexical_score,omitempty"`
+	FusedScore   float64 `json:"fused_score"`
 }
 
 // QueryResponse is the structure for the RAG system's answer.
@@ -172,6 +370,10 @@ type QueryResponse struct {
 	RerankedScores   []float64        `json:"reranked_scores,omitempty"`   // Re-ranking scores
 	ProcessingTime   float64          `json:"processing_time,omitempty"`   // Query processing time
 	MetadataUsed     bool             `json:"metadata_used,omitempty"`     // Whether metadata filtering was applied
+	RetrievalMode    RetrievalMode    `json:"retrieval_mode,omitempty"`    // Retrieval mode used
+	RetrievalRanks   []RetrievalRank  `json:"retrieval_ranks,omitempty"`   // Per-list ranks for each returned chunk
+	ContextTokens    int              `json:"context_tokens,omitempty"`    // Tokens of context given to the LLM
+	LLMSelection                      // Provider and chat model that generated the answer
 }
 
 // EmbeddingRequest represents OpenAI embedding request
@@ -0,0 +1,140 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"rag_system/models"
+	"strings"
+)
+
+// ChatProvider generates chat completions.
+type ChatProvider interface {
+	ChatCompletion(messages []models.ChatCompletionMessage, model string) (string, error)
+}
+
+// NewChat returns the chat client of a provider.
+func NewChat(name string, cfg Config) (ChatProvider, error) {
+	if err := cfg.validate(name); err != nil {
+		return nil, err
+	}
+	if !cfg.Type.ServesChat() {
+		return nil, fmt.Errorf("provider %q: type %q does not serve chat", name, cfg.Type)
+	}
+	call := newCaller(name)
+	switch cfg.Type {
+	case Ollama:
+		return &ollamaChat{cfg: cfg, call: call}, nil
+	case Anthropic:
+		return &anthropicChat{cfg: cfg, call: call}, nil
+	default:
+		return &openAIChat{cfg: cfg, call: call}, nil
+	}
+}
+
+// openAIChat calls POST {base_url}/chat/completions.
+type openAIChat struct {
+	cfg  Config
+	call *caller
+}
+
+func (p *openAIChat) ChatCompletion(messages []models.ChatCompletionMessage, model string) (string, error) {
+	headers := map[string]string{}
+	if key := p.cfg.APIKey(); key != "" {
+		headers["Authorization"] = "Bearer " + key
+	}
+
+	var resp models.ChatCompletionResponse
+	req := models.ChatCompletionRequest{Model: model, Messages: messages}
+	if err := p.call.postJSON(context.Background(), endpoint(p.cfg.BaseURL, "/chat/completions"), headers, req, &resp); err != nil {
+		return "", err
+	}
+	if len(resp.Choices) == 0 {
+		return "", fmt.Errorf("no response choices returned")
+	}
+	return resp.Choices[0].Message.Content, nil
+}
+
+// ollamaChat calls Ollama's native POST {base_url}/api/chat.
+type ollamaChat struct {
+	cfg  Config
+	call *caller
+}
+
+type ollamaChatRequest struct {
+	Model    string                         `json:"model"`
+	Messages []models.ChatCompletionMessage `json:"messages"`
+	Stream   bool                           `json:"stream"`
+}
+
+type ollamaChatResponse struct {
+	Message models.ChatCompletionMessage `json:"message"`
+}
+
+func (p *ollamaChat) ChatCompletion(messages []models.ChatCompletionMessage, model string) (string, error) {
+	var resp ollamaChatResponse
+	req := ollamaChatRequest{Model: model, Messages: messages}
+	if err := p.call.postJSON(context.Background(), endpoint(p.cfg.BaseURL, "/api/chat"), nil, req, &resp); err != nil {
+		return "", err
+	}
+	return resp.Message.Content, nil
+}
+
+// anthropicChat calls the Messages API, POST {base_url}/messages.
+type anthropicChat struct {
+	cfg  Config
+	call *caller
+}
+
+const (
+	anthropicVersion   = "2023-06-01"
+	anthropicMaxTokens = 4096
+)
+
+type anthropicRequest struct {
+	Model     string                         `json:"model"`
+	System    string                         `json:"system,omitempty"`
+	Messages  []models.ChatCompletionMessage `json:"messages"`
+	MaxTokens int                            `json:"max_tokens"`
+}
+
+type anthropicResponse struct {
+	Content []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"content"`
+}
+
+func (p *anthropicChat) ChatCompletion(messages []models.ChatCompletionMessage, model string) (string, error) {
+	// The Messages API takes system prompts separately from the conversation
+	req := anthropicRequest{Model: model, MaxTokens: anthropicMaxTokens}
+	var system []string
+	for _, message := range messages {
+		if message.Role == "system" {
+			system = append(system, message.Content)
+			continue
+		}
+		req.Messages = append(req.Messages, message)
+	}
+	req.System = strings.Join(system, "\n\n")
+
+	headers := map[string]string{
+		"x-api-key":         p.cfg.APIKey(),
+		"anthropic-version": anthropicVersion,
+	}
+
+	var resp anthropicResponse
+	if err := p.call.postJSON(context.Background(), endpoint(p.cfg.BaseURL, "/messages"), headers, req, &resp); err != nil {
+		return "", err
+	}
+
+	var text strings.Builder
+	for _, block := range resp.Content {
+		if block.Type == "text" {
+			text.WriteString(block.Text)
+		}
+	}
+	if text.Len() == 0 {
+		return "", fmt.Errorf("no text content returned")
+	}
+	return text.String(), nil
+}
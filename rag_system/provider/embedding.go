@@ -0,0 +1,197 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"rag_system/models"
+	"rag_system/tokenizer"
+	"strings"
+	"unicode"
+)
+
+// EmbeddingProvider turns texts into vectors, one per text and in order.
+// Implementations are safe for concurrent use.
+type EmbeddingProvider interface {
+	Embed(ctx context.Context, texts []string, model string) ([][]float32, error)
+}
+
+// NewEmbedding returns the embedding client of a provider, held to the
+// provider's requests and tokens per minute, with tokens counted by tok.
+func NewEmbedding(name string, cfg Config, tok tokenizer.Tokenizer) (EmbeddingProvider, error) {
+	if err := cfg.validate(name); err != nil {
+		return nil, err
+	}
+	if !cfg.Type.ServesEmbeddings() {
+		return nil, fmt.Errorf("provider %q: type %q does not serve embeddings", name, cfg.Type)
+	}
+
+	var embedder EmbeddingProvider
+	switch cfg.Type {
+	case Ollama:
+		embedder = &ollamaEmbedding{cfg: cfg, call: newCaller(name)}
+	case Local:
+		dimensions := cfg.Dimensions
+		if dimensions == 0 {
+			dimensions = DefaultLocalDimensions
+		}
+		embedder = &localEmbedding{dimensions: dimensions}
+	default:
+		embedder = &openAIEmbedding{cfg: cfg, call: newCaller(name)}
+	}
+
+	if limiter := NewLimiter(cfg.RequestsPerMinute, cfg.TokensPerMinute); limiter != nil {
+		embedder = &limitedEmbedding{next: embedder, limiter: limiter, tokenizer: tok}
+	}
+	return embedder, nil
+}
+
+// limitedEmbedding waits for the rate limiter before every request.
+type limitedEmbedding struct {
+	next      EmbeddingProvider
+	limiter   *Limiter
+	tokenizer tokenizer.Tokenizer
+}
+
+func (p *limitedEmbedding) Embed(ctx context.Context, texts []string, model string) ([][]float32, error) {
+	if err := p.limiter.Wait(ctx, tokenizer.CountAll(p.tokenizer, texts)); err != nil {
+		return nil, err
+	}
+	return p.next.Embed(ctx, texts, model)
+}
+
+// openAIEmbedding calls POST {base_url}/embeddings.
+type openAIEmbedding struct {
+	cfg  Config
+	call *caller
+}
+
+func (p *openAIEmbedding) Embed(ctx context.Context, texts []string, model string) ([][]float32, error) {
+	headers := map[string]string{}
+	if key := p.cfg.APIKey(); key != "" {
+		headers["Authorization"] = "Bearer " + key
+	}
+
+	var resp models.EmbeddingAPIResponse
+	req := models.EmbeddingRequest{Input: texts, Model: model}
+	if err := p.call.postJSON(ctx, endpoint(p.cfg.BaseURL, "/embeddings"), headers, req, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Data) != len(texts) {
+		return nil, fmt.Errorf("mismatch in number of embeddings returned (%d) vs texts sent (%d)", len(resp.Data), len(texts))
+	}
+
+	// Results carry the index of their input and need not arrive in order
+	embeddings := make([][]float32, len(texts))
+	for _, data := range resp.Data {
+		if data.Index < 0 || data.Index >= len(embeddings) {
+			return nil, fmt.Errorf("embedding data index out of bounds: %d", data.Index)
+		}
+		embeddings[data.Index] = data.Embedding
+	}
+	return embeddings, nil
+}
+
+// ollamaEmbedding calls Ollama's native POST {base_url}/api/embed.
+type ollamaEmbedding struct {
+	cfg  Config
+	call *caller
+}
+
+type ollamaEmbedRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type ollamaEmbedResponse struct {
+	Embeddings [][]float32 `json:"embeddings"`
+}
+
+func (p *ollamaEmbedding) Embed(ctx context.Context, texts []string, model string) ([][]float32, error) {
+	var resp ollamaEmbedResponse
+	req := ollamaEmbedRequest{Model: model, Input: texts}
+	if err := p.call.postJSON(ctx, endpoint(p.cfg.BaseURL, "/api/embed"), nil, req, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Embeddings) != len(texts) {
+		return nil, fmt.Errorf("mismatch in number of embeddings returned (%d) vs texts sent (%d)", len(resp.Embeddings), len(texts))
+	}
+	return resp.Embeddings, nil
+}
+
+// LocalEmbeddingModel is the only model of the local embedder.
+const LocalEmbeddingModel = "feature-hash-v1"
+
+// DefaultLocalDimensions is the vector size of the local embedder when the
+// provider does not set dimensions.
+const DefaultLocalDimensions = 384
+
+// localEmbedding is an offline embedder for development and air-gapped
+// deployments. It hashes words, word pairs and character trigrams into a
+// fixed number of signed buckets, so texts sharing vocabulary and spelling
+// end up close under cosine similarity. It captures no meaning beyond that,
+// but the same text always yields the same vector.
+type localEmbedding struct {
+	dimensions int
+}
+
+const (
+	localWordWeight    = 1.0
+	localBigramWeight  = 0.5
+	localTrigramWeight = 0.25
+)
+
+func (p *localEmbedding) Embed(ctx context.Context, texts []string, model string) ([][]float32, error) {
+	if model != LocalEmbeddingModel {
+		return nil, fmt.Errorf("local embedder has no model %q (available: %q)", model, LocalEmbeddingModel)
+	}
+	embeddings := make([][]float32, len(texts))
+	for i, text := range texts {
+		embeddings[i] = p.embed(text)
+	}
+	return embeddings, nil
+}
+
+func (p *localEmbedding) embed(text string) []float32 {
+	vector := make([]float64, p.dimensions)
+	add := func(feature string, weight float64) {
+		h := fnv.New64a()
+		h.Write([]byte(feature))
+		sum := h.Sum64()
+		// The top bit picks the sign so colliding features tend to cancel
+		// out rather than pile up
+		if sum>>63 == 1 {
+			weight = -weight
+		}
+		vector[sum%uint64(p.dimensions)] += weight
+	}
+
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	for i, word := range words {
+		add("w:"+word, localWordWeight)
+		if i > 0 {
+			add("b:"+words[i-1]+" "+word, localBigramWeight)
+		}
+		runes := []rune("^" + word + "$")
+		for j := 0; j+3 <= len(runes); j++ {
+			add("t:"+string(runes[j:j+3]), localTrigramWeight)
+		}
+	}
+
+	var norm float64
+	for _, v := range vector {
+		norm += v * v
+	}
+	norm = math.Sqrt(norm)
+
+	embedding := make([]float32, p.dimensions)
+	for i, v := range vector {
+		if norm > 0 {
+			embedding[i] = float32(v / norm)
+		}
+	}
+	return embedding
+}
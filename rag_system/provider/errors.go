@@ -0,0 +1,121 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Kinds of provider failures. Errors returned by provider clients wrap one of
+// them when the failure could be classified; test with errors.Is.
+var (
+	ErrRateLimited = errors.New("provider rate limit exceeded")
+	ErrOversized   = errors.New("input too large for model")
+	ErrAuth        = errors.New("provider rejected credentials")
+	ErrServer      = errors.New("provider server error")
+	ErrUnavailable = errors.New("provider unavailable") // Circuit breaker open
+)
+
+// Error is a failed call to a provider.
+type Error struct {
+	Kind       error         // One of the Err* kinds, or nil for other client errors
+	URL        string        // Endpoint called
+	StatusCode int           // HTTP status, 0 when the server could not be reached
+	RetryAfter time.Duration // Delay the server asked for, 0 if none
+	Message    string        // Response body or transport error
+}
+
+func (e *Error) Error() string {
+	if e.StatusCode == 0 {
+		return fmt.Sprintf("failed to call %s: %s", e.URL, e.Message)
+	}
+	msg := fmt.Sprintf("request to %s failed with status %d %s", e.URL, e.StatusCode, http.StatusText(e.StatusCode))
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() error {
+	return e.Kind
+}
+
+// Retryable reports whether the same request may succeed later.
+func (e *Error) Retryable() bool {
+	return e.Kind == ErrRateLimited || e.Kind == ErrServer
+}
+
+// RetryAfter returns the delay a rate-limited or unavailable provider asked
+// for, if err carries one.
+func RetryAfter(err error) (time.Duration, bool) {
+	var perr *Error
+	if errors.As(err, &perr) && perr.RetryAfter > 0 {
+		return perr.RetryAfter, true
+	}
+	var open *openCircuitError
+	if errors.As(err, &open) {
+		return open.retryIn, true
+	}
+	return 0, false
+}
+
+// oversizedIndicators are how OpenAI-compatible servers and Ollama word a
+// 400 for inputs beyond the model's context.
+var oversizedIndicators = []string{
+	"too large",
+	"input is too large",
+	"context length exceeded",
+	"maximum context length",
+	"token limit",
+	"input size",
+	"too many tokens",
+}
+
+// classify builds the error of a non-200 response.
+func classify(url string, resp *http.Response, body []byte) *Error {
+	e := &Error{
+		URL:        url,
+		StatusCode: resp.StatusCode,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		Message:    strings.TrimSpace(string(body)),
+	}
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		e.Kind = ErrRateLimited
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		e.Kind = ErrAuth
+	case resp.StatusCode == http.StatusRequestEntityTooLarge:
+		e.Kind = ErrOversized
+	case resp.StatusCode >= 500:
+		e.Kind = ErrServer
+	case resp.StatusCode >= 400:
+		lower := strings.ToLower(e.Message)
+		for _, indicator := range oversizedIndicators {
+			if strings.Contains(lower, indicator) {
+				e.Kind = ErrOversized
+				break
+			}
+		}
+	}
+	return e
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an HTTP
+// date.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if wait := time.Until(at); wait > 0 {
+			return wait
+		}
+	}
+	return 0
+}
@@ -0,0 +1,159 @@
+// Package provider holds the clients of the model servers the RAG system
+// talks to. A provider is a named endpoint of one of the supported API
+// flavours: any OpenAI-compatible server (OpenAI, llama.cpp, vLLM, ...),
+// Ollama's native API, Anthropic's Messages API, or the built-in offline
+// embedder.
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Type is the API flavour a provider speaks.
+type Type string
+
+const (
+	OpenAI    Type = "openai" // Any OpenAI-compatible /v1 API
+	Ollama    Type = "ollama"
+	Anthropic Type = "anthropic" // Chat only
+	Local     Type = "local"     // In-process hashing embedder, embeddings only
+)
+
+// ServesChat reports whether providers of this type generate chat completions.
+func (t Type) ServesChat() bool {
+	return t != Local
+}
+
+// ServesEmbeddings reports whether providers of this type embed text.
+func (t Type) ServesEmbeddings() bool {
+	return t != Anthropic
+}
+
+// Config describes one provider endpoint.
+type Config struct {
+	Type           Type   `json:"type"`
+	BaseURL        string `json:"base_url"`         // e.g. http://localhost:8091/v1 for an OpenAI-compatible server
+	APIKeyEnv      string `json:"api_key_env"`      // Environment variable holding the API key, if any
+	ChatModel      string `json:"chat_model"`       // Chat model used when none is requested
+	EmbeddingModel string `json:"embedding_model"`  // Embedding model used when none is requested
+	Dimensions     int    `json:"dimensions"`       // Vector size of the local embedder
+	MaxInputTokens int    `json:"max_input_tokens"` // Tokens of one text the embedding model reads; 0 picks the type's default
+
+	// Embedding throughput. Requests and tokens per minute are budgets the
+	// embedding client stays within, 0 meaning unlimited.
+	Concurrency       int `json:"concurrency"` // Embedding batches in flight at once
+	RequestsPerMinute int `json:"requests_per_minute"`
+	TokensPerMinute   int `json:"tokens_per_minute"`
+}
+
+// DefaultConcurrency is the number of embedding batches in flight when a
+// provider does not set concurrency.
+const DefaultConcurrency = 4
+
+// Workers returns the configured concurrency, or DefaultConcurrency.
+func (c Config) Workers() int {
+	if c.Concurrency > 0 {
+		return c.Concurrency
+	}
+	return DefaultConcurrency
+}
+
+// Default embedding input limits, in tokens: OpenAI's embedding models
+// read 8191, and Ollama's default context is 2048 tokens, past which it
+// truncates input without reporting it.
+const (
+	DefaultOpenAIInputTokens = 8191
+	DefaultOllamaInputTokens = 2048
+)
+
+// InputTokenLimit returns the configured max_input_tokens, or the default
+// of the provider's type; 0 means no limit.
+func (c Config) InputTokenLimit() int {
+	if c.MaxInputTokens > 0 {
+		return c.MaxInputTokens
+	}
+	switch c.Type {
+	case OpenAI:
+		return DefaultOpenAIInputTokens
+	case Ollama:
+		return DefaultOllamaInputTokens
+	}
+	return 0
+}
+
+// APIKey returns the key from the configured environment variable.
+func (c Config) APIKey() string {
+	if c.APIKeyEnv == "" {
+		return ""
+	}
+	return os.Getenv(c.APIKeyEnv)
+}
+
+func (c Config) validate(name string) error {
+	switch c.Type {
+	case OpenAI, Ollama, Anthropic, Local:
+	default:
+		return fmt.Errorf("provider %q: unknown type %q (expected %q, %q, %q or %q)", name, c.Type, OpenAI, Ollama, Anthropic, Local)
+	}
+	if c.Concurrency < 0 || c.RequestsPerMinute < 0 || c.TokensPerMinute < 0 || c.MaxInputTokens < 0 {
+		return fmt.Errorf("provider %q: concurrency, rate limits and max_input_tokens must not be negative", name)
+	}
+	if c.Type == Local {
+		if c.Dimensions < 0 {
+			return fmt.Errorf("provider %q: dimensions must not be negative", name)
+		}
+		return nil
+	}
+	if c.BaseURL == "" {
+		return fmt.Errorf("provider %q: base_url is required", name)
+	}
+	return nil
+}
+
+var httpClient = &http.Client{Timeout: 180 * time.Second}
+
+// postJSON sends body as JSON to url and decodes a 200 response into out.
+// The request is abandoned when ctx is done. Failed calls return an *Error;
+// an unreachable server counts as a server error.
+func postJSON(ctx context.Context, url string, headers map[string]string, body, out interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return &Error{Kind: ErrServer, URL: url, Message: err.Error()}
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return classify(url, resp, respBody)
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("failed to decode response from %s: %w", url, err)
+	}
+	return nil
+}
+
+func endpoint(baseURL, path string) string {
+	return strings.TrimRight(baseURL, "/") + path
+}
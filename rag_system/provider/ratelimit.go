@@ -0,0 +1,94 @@
+package provider
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Limiter spaces out requests to stay within a requests-per-minute and a
+// tokens-per-minute budget. A nil Limiter allows everything.
+type Limiter struct {
+	requests *tokenBucket
+	tokens   *tokenBucket
+}
+
+// NewLimiter returns a limiter for the given budgets, 0 meaning unlimited,
+// or nil when neither is set.
+func NewLimiter(requestsPerMinute, tokensPerMinute int) *Limiter {
+	if requestsPerMinute <= 0 && tokensPerMinute <= 0 {
+		return nil
+	}
+	return &Limiter{
+		requests: newTokenBucket(requestsPerMinute),
+		tokens:   newTokenBucket(tokensPerMinute),
+	}
+}
+
+// Wait blocks until one request of the given tokens fits the budgets, or ctx
+// is done.
+func (l *Limiter) Wait(ctx context.Context, tokens int) error {
+	if l == nil {
+		return nil
+	}
+	if err := l.requests.take(ctx, 1); err != nil {
+		return err
+	}
+	return l.tokens.take(ctx, float64(tokens))
+}
+
+// tokenBucket holds up to a minute's budget and refills continuously. A nil
+// bucket is unlimited.
+type tokenBucket struct {
+	mu       sync.Mutex
+	capacity float64
+	tokens   float64
+	perSec   float64
+	last     time.Time
+}
+
+func newTokenBucket(perMinute int) *tokenBucket {
+	if perMinute <= 0 {
+		return nil
+	}
+	return &tokenBucket{
+		capacity: float64(perMinute),
+		tokens:   float64(perMinute),
+		perSec:   float64(perMinute) / 60,
+		last:     time.Now(),
+	}
+}
+
+func (b *tokenBucket) take(ctx context.Context, n float64) error {
+	if b == nil {
+		return nil
+	}
+	// A single request larger than the whole budget waits for a full bucket
+	if n > b.capacity {
+		n = b.capacity
+	}
+	for {
+		b.mu.Lock()
+		now := time.Now()
+		b.tokens += now.Sub(b.last).Seconds() * b.perSec
+		if b.tokens > b.capacity {
+			b.tokens = b.capacity
+		}
+		b.last = now
+		if b.tokens >= n {
+			b.tokens -= n
+			b.mu.Unlock()
+			return nil
+		}
+		wait := time.Duration((n - b.tokens) / b.perSec * float64(time.Second))
+		b.mu.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
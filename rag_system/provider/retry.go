@@ -0,0 +1,174 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	maxRetries    = 4 // Retries after the first attempt
+	baseBackoff   = 500 * time.Millisecond
+	maxBackoff    = 30 * time.Second
+	maxRetryAfter = 2 * time.Minute // Longer Retry-After delays fail the call instead
+
+	breakerThreshold = 5 // Consecutive server failures that open the circuit
+	breakerCooldown  = 30 * time.Second
+)
+
+// caller sends the requests of one provider. Rate limits and server errors
+// are retried with exponential backoff, and the provider's circuit breaker
+// fails calls fast while the provider is down.
+type caller struct {
+	name    string
+	breaker *breaker
+}
+
+func newCaller(name string) *caller {
+	return &caller{name: name, breaker: breakerFor(name)}
+}
+
+func (c *caller) postJSON(ctx context.Context, url string, headers map[string]string, body, out interface{}) error {
+	for attempt := 0; ; attempt++ {
+		if err := c.breaker.allow(); err != nil {
+			return err
+		}
+		err := postJSON(ctx, url, headers, body, out)
+		if ctx.Err() != nil {
+			c.breaker.release()
+			return ctx.Err()
+		}
+		c.breaker.record(err)
+		if err == nil {
+			return nil
+		}
+
+		var perr *Error
+		if !errors.As(err, &perr) || !perr.Retryable() || attempt == maxRetries {
+			return err
+		}
+		if perr.RetryAfter > maxRetryAfter {
+			return fmt.Errorf("%w (not retrying, server asked to wait %v)", err, perr.RetryAfter.Round(time.Second))
+		}
+
+		wait := backoff(attempt, perr.RetryAfter)
+		log.Printf("Provider %s: %v; retrying in %v (retry %d of %d)", c.name, perr.Kind, wait.Round(time.Millisecond), attempt+1, maxRetries)
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff doubles the delay with every attempt, randomizing the upper half
+// so that concurrent callers do not retry in lockstep. A Retry-After from the
+// server is the minimum.
+func backoff(attempt int, retryAfter time.Duration) time.Duration {
+	d := baseBackoff << attempt
+	if d > maxBackoff || d <= 0 {
+		d = maxBackoff
+	}
+	wait := d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+	if retryAfter > 0 {
+		// Spread callers told to come back at the same moment
+		wait = retryAfter + time.Duration(rand.Int63n(int64(retryAfter/10)+1))
+	}
+	return wait
+}
+
+// breaker counts consecutive server failures of a provider. After
+// breakerThreshold of them it opens and rejects calls for breakerCooldown,
+// then lets a single trial call through: success closes it, failure opens it
+// again. Rate limits and client errors show the provider is up and reset the
+// count.
+type breaker struct {
+	mu        sync.Mutex
+	name      string
+	failures  int
+	openUntil time.Time
+	probing   bool // A trial call is in flight
+}
+
+// breakers are shared by the chat and embedding clients of a provider name.
+var (
+	breakersMu sync.Mutex
+	breakers   = map[string]*breaker{}
+)
+
+func breakerFor(name string) *breaker {
+	breakersMu.Lock()
+	defer breakersMu.Unlock()
+
+	b, ok := breakers[name]
+	if !ok {
+		b = &breaker{name: name}
+		breakers[name] = b
+	}
+	return b
+}
+
+type openCircuitError struct {
+	name     string
+	failures int
+	retryIn  time.Duration
+}
+
+func (e *openCircuitError) Error() string {
+	return fmt.Sprintf("provider %q is unavailable after %d consecutive failures; next attempt in %v", e.name, e.failures, e.retryIn.Round(time.Second))
+}
+
+func (e *openCircuitError) Unwrap() error {
+	return ErrUnavailable
+}
+
+func (b *breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < breakerThreshold {
+		return nil
+	}
+	now := time.Now()
+	if now.Before(b.openUntil) || b.probing {
+		retryIn := b.openUntil.Sub(now)
+		if retryIn < 0 {
+			retryIn = 0
+		}
+		return &openCircuitError{name: b.name, failures: b.failures, retryIn: retryIn}
+	}
+	b.probing = true
+	return nil
+}
+
+func (b *breaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if !errors.Is(err, ErrServer) {
+		if b.failures >= breakerThreshold {
+			log.Printf("Provider %s is reachable again, closing circuit", b.name)
+		}
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= breakerThreshold {
+		b.openUntil = time.Now().Add(breakerCooldown)
+		log.Printf("Provider %s failed %d times in a row, failing calls fast for %v", b.name, b.failures, breakerCooldown)
+	}
+}
+
+// release ends a trial call that was abandoned by its caller.
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
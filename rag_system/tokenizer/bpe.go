@@ -0,0 +1,265 @@
+package tokenizer
+
+import (
+	"bufio"
+	"bytes"
+	"container/heap"
+	"encoding/base64"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+)
+
+// BPE is a byte-level byte-pair encoding: text is split into pieces by the
+// encoding's pre-tokenizer, and each piece's bytes are merged pairwise,
+// lowest rank first, for as long as the merged bytes are in the vocabulary.
+type BPE struct {
+	name     string
+	split    func(text string, piece func(start, end int))
+	ranks    map[string]int
+	decoder  [][]byte
+	maxRank  int
+	maxPiece int // Longest vocabulary entry in bytes
+}
+
+// splitters are the pre-tokenizers of the supported encodings.
+var splitters = map[string]func(string, func(int, int)){
+	"cl100k_base": splitCl100k,
+	"o200k_base":  splitO200k,
+}
+
+// LoadBPE reads a vocabulary in the tiktoken format, one base64 token and
+// its rank per line, for the named encoding.
+func LoadBPE(encoding, path string) (*BPE, error) {
+	split, ok := splitters[encoding]
+	if !ok {
+		return nil, fmt.Errorf("unknown encoding %q (supported: cl100k_base, o200k_base)", encoding)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s vocabulary: %w", encoding, err)
+	}
+	defer file.Close()
+
+	b := &BPE{name: encoding, split: split, ranks: make(map[string]int)}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		fields := bytes.Fields(scanner.Bytes())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected a token and a rank", path, line)
+		}
+		token, err := base64.StdEncoding.DecodeString(string(fields[0]))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid token: %w", path, line, err)
+		}
+		rank, err := strconv.Atoi(string(fields[1]))
+		if err != nil || rank < 0 {
+			return nil, fmt.Errorf("%s:%d: invalid rank %q", path, line, fields[1])
+		}
+		b.ranks[string(token)] = rank
+		if rank > b.maxRank {
+			b.maxRank = rank
+		}
+		if len(token) > b.maxPiece {
+			b.maxPiece = len(token)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s vocabulary: %w", encoding, err)
+	}
+
+	// Any text can be encoded only if every byte is a token
+	for i := 0; i < 256; i++ {
+		if _, ok := b.ranks[string([]byte{byte(i)})]; !ok {
+			return nil, fmt.Errorf("%s vocabulary in %s has no token for byte 0x%02x", encoding, path, i)
+		}
+	}
+
+	b.decoder = make([][]byte, b.maxRank+1)
+	for token, rank := range b.ranks {
+		b.decoder[rank] = []byte(token)
+	}
+	return b, nil
+}
+
+func (b *BPE) Name() string {
+	return b.name
+}
+
+func (b *BPE) Count(text string) int {
+	count := 0
+	b.encode(text, func(int, int) { count++ })
+	return count
+}
+
+func (b *BPE) Offsets(text string) []int {
+	var offsets []int
+	b.encode(text, func(_, end int) { offsets = append(offsets, end) })
+	return offsets
+}
+
+// Encode returns the token ids of text.
+func (b *BPE) Encode(text string) []int {
+	var ids []int
+	b.encode(text, func(id, _ int) { ids = append(ids, id) })
+	return ids
+}
+
+// Decode returns the text of token ids. Ids outside the vocabulary are
+// skipped.
+func (b *BPE) Decode(ids []int) string {
+	var buf bytes.Buffer
+	for _, id := range ids {
+		if id >= 0 && id < len(b.decoder) {
+			buf.Write(b.decoder[id])
+		}
+	}
+	return buf.String()
+}
+
+// encode calls token with the id and end offset of every token of text, in
+// order.
+func (b *BPE) encode(text string, token func(id, end int)) {
+	var bounds []int
+	b.split(text, func(start, end int) {
+		piece := text[start:end]
+		if id, ok := b.ranks[piece]; ok {
+			token(id, end)
+			return
+		}
+		bounds = b.merge(piece, bounds[:0])
+		for i := 1; i < len(bounds); i++ {
+			token(b.ranks[piece[bounds[i-1]:bounds[i]]], start+bounds[i])
+		}
+	})
+}
+
+// mergeHeapMin is the piece length from which merge keeps its candidate
+// pairs in a heap; rescanning every pair is faster for shorter pieces.
+const mergeHeapMin = 64
+
+// merge returns the token boundaries of piece, starting at 0 and ending at
+// len(piece). Starting from single bytes, it repeatedly joins the adjacent
+// pair whose bytes have the lowest rank, the leftmost of equal ranks.
+func (b *BPE) merge(piece string, bounds []int) []int {
+	if len(piece) >= mergeHeapMin {
+		return b.mergeLong(piece, bounds)
+	}
+	return b.mergeShort(piece, bounds)
+}
+
+// mergeShort is merge rescanning every pair after each join.
+func (b *BPE) mergeShort(piece string, bounds []int) []int {
+	for i := 0; i <= len(piece); i++ {
+		bounds = append(bounds, i)
+	}
+	for len(bounds) > 2 {
+		best, bestRank := -1, math.MaxInt
+		for i := 0; i+2 < len(bounds); i++ {
+			if rank := b.pairRank(piece, bounds[i], bounds[i+2]); rank >= 0 && rank < bestRank {
+				best, bestRank = i, rank
+			}
+		}
+		if best < 0 {
+			break
+		}
+		bounds = append(bounds[:best+1], bounds[best+2:]...)
+	}
+	return bounds
+}
+
+// pairRank returns the rank of piece[start:end], or -1 if it is not a token.
+func (b *BPE) pairRank(piece string, start, end int) int {
+	if end-start > b.maxPiece {
+		return -1
+	}
+	if rank, ok := b.ranks[piece[start:end]]; ok {
+		return rank
+	}
+	return -1
+}
+
+// mergeLong is merge for long pieces, which would take quadratic time
+// rescanning every pair after each join. Tokens are kept as a linked list
+// of their start offsets and the pairs in a heap ordered by rank and
+// offset; a pair whose tokens were joined since it was pushed no longer has
+// the rank recorded for its left token and is skipped.
+func (b *BPE) mergeLong(piece string, bounds []int) []int {
+	n := len(piece)
+	next := make([]int, n+1) // Start of the token after the one at each offset
+	prev := make([]int, n+1)
+	rank := make([]int, n+1) // Rank of the token at each offset joined with the next, or -1
+	for i := 0; i <= n; i++ {
+		next[i], prev[i], rank[i] = min(i+1, n), i-1, -1
+	}
+	pairAt := func(i int) int {
+		if next[i] >= n {
+			return -1
+		}
+		return b.pairRank(piece, i, next[next[i]])
+	}
+
+	pairs := &pairHeap{}
+	for i := 0; i < n; i++ {
+		if rank[i] = pairAt(i); rank[i] >= 0 {
+			pairs.items = append(pairs.items, pair{rank: rank[i], start: i})
+		}
+	}
+	heap.Init(pairs)
+	for pairs.Len() > 0 {
+		p := heap.Pop(pairs).(pair)
+		i := p.start
+		if rank[i] != p.rank {
+			continue
+		}
+		joined := next[i]
+		next[i], rank[joined] = next[joined], -1
+		prev[next[joined]] = i
+		if rank[i] = pairAt(i); rank[i] >= 0 {
+			heap.Push(pairs, pair{rank: rank[i], start: i})
+		}
+		if left := prev[i]; left >= 0 {
+			if rank[left] = pairAt(left); rank[left] >= 0 {
+				heap.Push(pairs, pair{rank: rank[left], start: left})
+			}
+		}
+	}
+
+	for i := 0; i < n; i = next[i] {
+		bounds = append(bounds, i)
+	}
+	return append(bounds, n)
+}
+
+// pair is a candidate join of the token starting at start with the next.
+type pair struct {
+	rank, start int
+}
+
+type pairHeap struct {
+	items []pair
+}
+
+func (h *pairHeap) Len() int { return len(h.items) }
+
+func (h *pairHeap) Less(i, j int) bool {
+	if h.items[i].rank != h.items[j].rank {
+		return h.items[i].rank < h.items[j].rank
+	}
+	return h.items[i].start < h.items[j].start
+}
+
+func (h *pairHeap) Swap(i, j int) { h.items[i], h.items[j] = h.items[j], h.items[i] }
+
+func (h *pairHeap) Push(x any) { h.items = append(h.items, x.(pair)) }
+
+func (h *pairHeap) Pop() any {
+	last := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	return last
+}
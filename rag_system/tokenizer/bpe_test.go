@@ -0,0 +1,133 @@
+package tokenizer
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// fixtureTokens are the multi-byte tokens of the test vocabulary, ranked
+// from 256 in order; each byte is its own token ranked by its value.
+var fixtureTokens = []string{
+	"we", "lo", "er", " d", " do", " don", "'l", "'ll", "'t",
+	"12", "123", "45", "20", "202", "  ", "\r\n", "ne", "li", "line",
+	"Camel", "Case",
+}
+
+func loadFixture(t *testing.T, encoding string) *BPE {
+	t.Helper()
+	var vocab strings.Builder
+	for i := 0; i < 256; i++ {
+		fmt.Fprintf(&vocab, "%s %d\n", base64.StdEncoding.EncodeToString([]byte{byte(i)}), i)
+	}
+	for i, token := range fixtureTokens {
+		fmt.Fprintf(&vocab, "%s %d\n", base64.StdEncoding.EncodeToString([]byte(token)), 256+i)
+	}
+	path := filepath.Join(t.TempDir(), encoding+".tiktoken")
+	if err := os.WriteFile(path, []byte(vocab.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	b, err := LoadBPE(encoding, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// The expected tokens are what tiktoken yields with the fixture vocabulary:
+// text is split by the encoding's pattern, a piece that is a token is kept
+// whole, and the others are merged lowest rank first.
+func TestBPEEncode(t *testing.T) {
+	tests := []struct {
+		name     string
+		encoding string
+		text     string
+		want     []string
+	}{
+		{
+			name:     "contractions",
+			encoding: "cl100k_base",
+			text:     "I'll don't HE'S",
+			want:     []string{"I", "'ll", " don", "'t", " ", "H", "E", "'", "S"},
+		},
+		{
+			name:     "digit runs",
+			encoding: "cl100k_base",
+			text:     "1234567 2024",
+			want:     []string{"123", "45", "6", "7", " ", "202", "4"},
+		},
+		{
+			name:     "whitespace before non-space",
+			encoding: "cl100k_base",
+			text:     "a   b  !   ",
+			want:     []string{"a", "  ", " ", "b", " ", " ", "!", "  ", " "},
+		},
+		{
+			name:     "CRLF",
+			encoding: "cl100k_base",
+			text:     "line\r\nnext  \r\n  x!\r\n",
+			want:     []string{"line", "\r\n", "ne", "x", "t", "  ", "\r\n", " ", " ", "x", "!", "\r\n"},
+		},
+		{
+			name:     "merge order",
+			encoding: "cl100k_base",
+			text:     "lower",
+			want:     []string{"lo", "we", "r"},
+		},
+		{
+			name:     "long piece",
+			encoding: "cl100k_base",
+			text:     strings.Repeat("lower", 40),
+			want:     slices.Repeat([]string{"lo", "we", "r"}, 40),
+		},
+		{
+			name:     "CamelCase",
+			encoding: "o200k_base",
+			text:     "CamelCaseHTTPServer don't I'M",
+			want:     []string{"Camel", "Case", "H", "T", "T", "P", "S", "er", "v", "er", " don", "'t", " ", "I", "'", "M"},
+		},
+	}
+
+	encodings := map[string]*BPE{
+		"cl100k_base": loadFixture(t, "cl100k_base"),
+		"o200k_base":  loadFixture(t, "o200k_base"),
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := encodings[tt.encoding]
+			var want []int
+			for _, token := range tt.want {
+				id, ok := b.ranks[token]
+				if !ok {
+					t.Fatalf("%q is not in the fixture vocabulary", token)
+				}
+				want = append(want, id)
+			}
+
+			if got := b.Encode(tt.text); !slices.Equal(got, want) {
+				t.Errorf("Encode(%q) = %v, want %v", tt.text, got, want)
+			}
+			if got := b.Count(tt.text); got != len(want) {
+				t.Errorf("Count(%q) = %d, want %d", tt.text, got, len(want))
+			}
+			if got := b.Decode(want); got != tt.text {
+				t.Errorf("Decode(%v) = %q, want %q", want, got, tt.text)
+			}
+		})
+	}
+}
+
+// mergeLong must join pairs in the same order as mergeShort.
+func TestMergeLong(t *testing.T) {
+	b := loadFixture(t, "cl100k_base")
+	for _, piece := range []string{"lower", "HTTPServer", " don't", "   \r\n", strings.Repeat("wer", 30) + "lo"} {
+		short := b.mergeShort(piece, nil)
+		if got := b.mergeLong(piece, nil); !slices.Equal(got, short) {
+			t.Errorf("mergeLong(%q) = %v, want %v", piece, got, short)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package tokenizer
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// The pre-tokenizers below are hand-written equivalents of the regular
+// expressions tiktoken splits text with before merging, which use lookahead
+// that Go's regexp does not support. Each calls piece with the byte range of
+// every piece in order; alternatives are tried in the order of the pattern.
+
+// splitCl100k follows the cl100k_base pattern:
+//
+//	(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}|
+//	 ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+(?!\S)|\s+
+func splitCl100k(text string, piece func(start, end int)) {
+	for i := 0; i < len(text); {
+		end := contraction(text, i)
+		if end < 0 {
+			end = prefixed(text, i, func(s int) int { return run(text, s, unicode.IsLetter) })
+		}
+		if end < 0 {
+			end = numbers(text, i)
+		}
+		if end < 0 {
+			end = punctuation(text, i, isNewline)
+		}
+		if end < 0 {
+			end = whitespace(text, i)
+		}
+		if end < 0 {
+			_, size := utf8.DecodeRuneInString(text[i:])
+			end = i + size
+		}
+		piece(i, end)
+		i = end
+	}
+}
+
+// splitO200k follows the o200k_base pattern, which keeps contractions with
+// their word and splits words at case changes:
+//
+//	[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]*[\p{Ll}\p{Lm}\p{Lo}\p{M}]+(?i:'s|'t|'re|'ve|'m|'ll|'d)?|
+//	[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]+[\p{Ll}\p{Lm}\p{Lo}\p{M}]*(?i:'s|'t|'re|'ve|'m|'ll|'d)?|
+//	\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n/]*|\s*[\r\n]+|\s+(?!\S)|\s+
+func splitO200k(text string, piece func(start, end int)) {
+	withContraction := func(end int) int {
+		if end >= 0 {
+			if c := contraction(text, end); c >= 0 {
+				return c
+			}
+		}
+		return end
+	}
+	for i := 0; i < len(text); {
+		end := withContraction(prefixed(text, i, func(s int) int { return lowerWord(text, s) }))
+		if end < 0 {
+			end = withContraction(prefixed(text, i, func(s int) int { return upperWord(text, s) }))
+		}
+		if end < 0 {
+			end = numbers(text, i)
+		}
+		if end < 0 {
+			end = punctuation(text, i, func(r rune) bool { return isNewline(r) || r == '/' })
+		}
+		if end < 0 {
+			end = whitespace(text, i)
+		}
+		if end < 0 {
+			_, size := utf8.DecodeRuneInString(text[i:])
+			end = i + size
+		}
+		piece(i, end)
+		i = end
+	}
+}
+
+// contraction matches (?i:'s|'t|'re|'ve|'m|'ll|'d) at i, returning its end
+// or -1.
+func contraction(text string, i int) int {
+	if i >= len(text) || text[i] != '\'' {
+		return -1
+	}
+	lower := func(j int) byte {
+		if j < len(text) && 'A' <= text[j] && text[j] <= 'Z' {
+			return text[j] + 'a' - 'A'
+		}
+		if j < len(text) {
+			return text[j]
+		}
+		return 0
+	}
+	switch lower(i + 1) {
+	case 's', 't', 'm', 'd':
+		return i + 2
+	}
+	switch string([]byte{lower(i + 1), lower(i + 2)}) {
+	case "re", "ve", "ll":
+		return i + 3
+	}
+	return -1
+}
+
+// prefixed matches [^\r\n\p{L}\p{N}]? followed by what word matches. word
+// returns the end of its match starting at s, or -1.
+func prefixed(text string, i int, word func(s int) int) int {
+	r, size := utf8.DecodeRuneInString(text[i:])
+	if !isNewline(r) && !unicode.IsLetter(r) && !unicode.IsNumber(r) {
+		if end := word(i + size); end >= 0 {
+			return end
+		}
+	}
+	return word(i)
+}
+
+// run matches one or more characters of class at s.
+func run(text string, s int, class func(rune) bool) int {
+	end := s
+	for end < len(text) {
+		r, size := utf8.DecodeRuneInString(text[end:])
+		if !class(r) {
+			break
+		}
+		end += size
+	}
+	if end == s {
+		return -1
+	}
+	return end
+}
+
+func isUpperClass(r rune) bool {
+	return unicode.In(r, unicode.Lu, unicode.Lt, unicode.Lm, unicode.Lo, unicode.M)
+}
+
+func isLowerClass(r rune) bool {
+	return unicode.In(r, unicode.Ll, unicode.Lm, unicode.Lo, unicode.M)
+}
+
+// lowerWord matches [upper]*[lower]+, giving back upper characters until a
+// lower one can follow.
+func lowerWord(text string, s int) int {
+	var starts []int // Start of each upper character
+	u := s
+	for u < len(text) {
+		r, size := utf8.DecodeRuneInString(text[u:])
+		if !isUpperClass(r) {
+			break
+		}
+		starts = append(starts, u)
+		u += size
+	}
+	if end := run(text, u, isLowerClass); end >= 0 {
+		return end
+	}
+	for k := len(starts) - 1; k >= 0; k-- {
+		if end := run(text, starts[k], isLowerClass); end >= 0 {
+			return end
+		}
+	}
+	return -1
+}
+
+// upperWord matches [upper]+[lower]*.
+func upperWord(text string, s int) int {
+	end := run(text, s, isUpperClass)
+	if end < 0 {
+		return -1
+	}
+	if lower := run(text, end, isLowerClass); lower >= 0 {
+		return lower
+	}
+	return end
+}
+
+// numbers matches \p{N}{1,3}.
+func numbers(text string, i int) int {
+	end := i
+	for n := 0; n < 3 && end < len(text); n++ {
+		r, size := utf8.DecodeRuneInString(text[end:])
+		if !unicode.IsNumber(r) {
+			break
+		}
+		end += size
+	}
+	if end == i {
+		return -1
+	}
+	return end
+}
+
+func isPunctuation(r rune) bool {
+	return !unicode.IsSpace(r) && !unicode.IsLetter(r) && !unicode.IsNumber(r)
+}
+
+// punctuation matches ` ?[^\s\p{L}\p{N}]+` followed by any characters of
+// trailing.
+func punctuation(text string, i int, trailing func(rune) bool) int {
+	s := i
+	if text[s] == ' ' {
+		s++
+	}
+	end := run(text, s, isPunctuation)
+	if end < 0 {
+		return -1
+	}
+	if t := run(text, end, trailing); t >= 0 {
+		return t
+	}
+	return end
+}
+
+func isNewline(r rune) bool {
+	return r == '\r' || r == '\n'
+}
+
+// whitespace matches \s*[\r\n]+|\s+(?!\S)|\s+.
+func whitespace(text string, i int) int {
+	var starts []int // Start of each whitespace character
+	end := i
+	for end < len(text) {
+		r, size := utf8.DecodeRuneInString(text[end:])
+		if !unicode.IsSpace(r) {
+			break
+		}
+		starts = append(starts, end)
+		end += size
+	}
+	if len(starts) == 0 {
+		return -1
+	}
+
+	// \s*[\r\n]+ ends after the last newline of the run
+	for k := len(starts) - 1; k >= 0; k-- {
+		if isNewline(rune(text[starts[k]])) {
+			return starts[k] + 1
+		}
+	}
+	// \s+(?!\S) leaves the last space to the word that follows
+	if end == len(text) || len(starts) == 1 {
+		return end
+	}
+	return starts[len(starts)-1]
+}
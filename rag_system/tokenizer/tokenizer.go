@@ -0,0 +1,117 @@
+// Package tokenizer counts text in model tokens. It reads byte-pair encoding
+// vocabularies in the tiktoken file format (cl100k_base, o200k_base) from
+// local files, so no network access is needed, and falls back to an estimate
+// of four bytes per token when none is configured.
+package tokenizer
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// Tokenizer splits text into tokens. Implementations are safe for concurrent
+// use.
+type Tokenizer interface {
+	// Name identifies the vocabulary, e.g. "cl100k_base".
+	Name() string
+	// Count returns the number of tokens in text.
+	Count(text string) int
+	// Offsets returns the byte offset in text at which each token ends. A
+	// token may end inside a multi-byte character.
+	Offsets(text string) []int
+}
+
+// Config picks the vocabulary tokens are counted with.
+type Config struct {
+	Encoding string `json:"encoding"` // "cl100k_base", "o200k_base", or empty to estimate
+	Path     string `json:"path"`     // Vocabulary file; empty means <encoding>.tiktoken in the working directory
+}
+
+// New returns the tokenizer of cfg: the estimate when no encoding is set,
+// otherwise the encoding's vocabulary loaded from cfg.Path.
+func New(cfg Config) (Tokenizer, error) {
+	if cfg.Encoding == "" {
+		return Estimate{}, nil
+	}
+	path := cfg.Path
+	if path == "" {
+		path = cfg.Encoding + ".tiktoken"
+	}
+	return LoadBPE(cfg.Encoding, path)
+}
+
+// CountAll returns the tokens of all texts together.
+func CountAll(tok Tokenizer, texts []string) int {
+	total := 0
+	for _, text := range texts {
+		total += tok.Count(text)
+	}
+	return total
+}
+
+// Prefix returns the length in bytes of the longest prefix of text that
+// holds at most n tokens and does not end inside a character.
+func Prefix(tok Tokenizer, text string, n int) int {
+	if n <= 0 {
+		return 0
+	}
+	offsets := tok.Offsets(text)
+	if n >= len(offsets) {
+		return len(text)
+	}
+	return runeStart(text, offsets[n-1])
+}
+
+// Suffix returns the length in bytes of the longest suffix of text that
+// holds at most n tokens and does not start inside a character.
+func Suffix(tok Tokenizer, text string, n int) int {
+	if n <= 0 {
+		return 0
+	}
+	offsets := tok.Offsets(text)
+	if n >= len(offsets) {
+		return len(text)
+	}
+	start := offsets[len(offsets)-n-1]
+	for start < len(text) && !utf8.RuneStart(text[start]) {
+		start++
+	}
+	return len(text) - start
+}
+
+// runeStart moves offset back to the start of the character it falls in.
+func runeStart(text string, offset int) int {
+	for offset > 0 && offset < len(text) && !utf8.RuneStart(text[offset]) {
+		offset--
+	}
+	return offset
+}
+
+// EstimateBytesPerToken is the ratio the estimate assumes; it is close for
+// English prose and generous for code and other languages.
+const EstimateBytesPerToken = 4
+
+// Estimate approximates tokens as EstimateBytesPerToken bytes each. It is
+// used when no vocabulary is configured.
+type Estimate struct{}
+
+func (Estimate) Name() string {
+	return fmt.Sprintf("estimate (%d bytes per token)", EstimateBytesPerToken)
+}
+
+func (Estimate) Count(text string) int {
+	return (len(text) + EstimateBytesPerToken - 1) / EstimateBytesPerToken
+}
+
+func (e Estimate) Offsets(text string) []int {
+	offsets := make([]int, 0, e.Count(text))
+	for end := EstimateBytesPerToken; ; end += EstimateBytesPerToken {
+		if end >= len(text) {
+			if len(text) > 0 {
+				offsets = append(offsets, len(text))
+			}
+			return offsets
+		}
+		offsets = append(offsets, end)
+	}
+}